@@ -0,0 +1,308 @@
+// Command mockidp is a minimal OpenID Connect identity provider for trying single sign-on
+// locally. It supports discovery, the authorization code flow with PKCE and a JWKS endpoint,
+// and lets you pick the identity to sign in as. Do not use it in production.
+//
+//	go run ./cmd/mockidp -addr :9000
+//
+// Then start the app with OIDC_ISSUER_URL=http://localhost:9000, OIDC_CLIENT_ID=weather-app
+// and OIDC_CLIENT_SECRET=mock-secret.
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	keyID         = "mock-key-1"
+	codeLifetime  = time.Minute
+	tokenLifetime = 5 * time.Minute
+)
+
+// authorization is an issued authorization code waiting to be redeemed
+type authorization struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	claims        map[string]interface{}
+	expiresAt     time.Time
+}
+
+// mockIdP holds the signing key and the outstanding authorization codes
+type mockIdP struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+var authorizeTemplate = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Mock identity provider</title></head>
+<body style="font-family: sans-serif; max-width: 420px; margin: 40px auto;">
+  <h2>Mock identity provider</h2>
+  <p>Choose who to sign in as.</p>
+  <form method="post" action="/authorize">
+    {{ range $name, $value := .Params }}<input type="hidden" name="{{ $name }}" value="{{ $value }}">
+    {{ end }}
+    <p><label>Subject<br><input name="sub" value="mock-user-1" required></label></p>
+    <p><label>Email<br><input name="email" value="alice@example.com"></label></p>
+    <p><label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label></p>
+    <p><label>Name<br><input name="name" value="Alice Example"></label></p>
+    <p><label>Preferred username<br><input name="preferred_username" value="alice"></label></p>
+    <p><button type="submit" name="decision" value="allow">Sign in</button>
+       <button type="submit" name="decision" value="deny">Deny</button></p>
+  </form>
+</body>
+</html>`))
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL, must match OIDC_ISSUER_URL")
+	clientID := flag.String("client-id", "weather-app", "accepted client ID")
+	clientSecret := flag.String("client-secret", "mock-secret", "accepted client secret")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("Error generating signing key: %v", err)
+	}
+
+	idp := &mockIdP{
+		issuer:       strings.TrimSuffix(*issuer, "/"),
+		clientID:     *clientID,
+		clientSecret: *clientSecret,
+		key:          key,
+		codes:        make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/jwks", idp.jwks)
+
+	log.Printf("Mock identity provider %s listening on %s", idp.issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+// discovery serves the provider metadata
+func (p *mockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+// authorize shows the identity picker and redirects back with a code
+func (p *mockIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := map[string]string{}
+	for _, name := range []string{"client_id", "redirect_uri", "state", "nonce", "code_challenge", "code_challenge_method", "response_type", "scope"} {
+		params[name] = r.Form.Get(name)
+	}
+	if params["client_id"] != p.clientID || params["redirect_uri"] == "" {
+		http.Error(w, "unknown client or missing redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if params["response_type"] != "code" || params["code_challenge_method"] != "S256" || params["code_challenge"] == "" {
+		http.Error(w, "only the code flow with S256 PKCE is supported", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		authorizeTemplate.Execute(w, map[string]interface{}{"Params": params})
+		return
+	}
+
+	redirect, err := url.Parse(params["redirect_uri"])
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := redirect.Query()
+	query.Set("state", params["state"])
+
+	if r.Form.Get("decision") != "allow" {
+		query.Set("error", "access_denied")
+	} else {
+		code := randomString()
+		p.mu.Lock()
+		p.codes[code] = authorization{
+			clientID:      params["client_id"],
+			redirectURI:   params["redirect_uri"],
+			codeChallenge: params["code_challenge"],
+			nonce:         params["nonce"],
+			claims: map[string]interface{}{
+				"sub":                r.Form.Get("sub"),
+				"email":              r.Form.Get("email"),
+				"email_verified":     r.Form.Get("email_verified") == "true",
+				"name":               r.Form.Get("name"),
+				"preferred_username": r.Form.Get("preferred_username"),
+				"auth_time":          time.Now().Unix(),
+			},
+			expiresAt: time.Now().Add(codeLifetime),
+		}
+		p.mu.Unlock()
+		query.Set("code", code)
+	}
+
+	redirect.RawQuery = query.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token redeems an authorization code for a signed ID token
+func (p *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.clientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.clientSecret)) != 1 {
+		tokenError(w, "invalid_client", "bad client credentials")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	// Codes can only be redeemed once
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	auth, found := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	switch {
+	case !found || time.Now().After(auth.expiresAt) || auth.clientID != clientID:
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	case auth.redirectURI != r.PostForm.Get("redirect_uri"):
+		tokenError(w, "invalid_grant", "redirect_uri mismatch")
+		return
+	case pkceChallenge(r.PostForm.Get("code_verifier")) != auth.codeChallenge:
+		tokenError(w, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	now := time.Now()
+	claims := auth.claims
+	claims["iss"] = p.issuer
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(tokenLifetime).Unix()
+	claims["nonce"] = auth.nonce
+
+	idToken, err := p.sign(claims)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenLifetime.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+// jwks serves the public signing key
+func (p *mockIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// sign creates an RS256 JWT
+func (p *mockIdP) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// pkceChallenge returns the S256 challenge for a verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// randomString creates a random URL-safe value for codes and access tokens
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// tokenError writes an OAuth error response
+func tokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code, "error_description": description})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
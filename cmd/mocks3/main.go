@@ -0,0 +1,452 @@
+// Command mocks3 is a minimal in-memory S3 stand-in for trying the S3 blob store locally
+// without MinIO. It serves path-style PutObject, GetObject, DeleteObject and CreateBucket,
+// and checks Signature Version 4 on every request, both signed headers and presigned URLs.
+// Do not use it in production.
+//
+//	go run ./cmd/mocks3 -addr :9100
+//
+// Then start the app with BLOB_STORE=s3, S3_ENDPOINT=http://localhost:9100,
+// S3_BUCKET=weather-uploads, S3_ACCESS_KEY=mock-access, S3_SECRET_KEY=mock-secret and
+// S3_PATH_STYLE=true.
+//
+// With -selfcheck it instead starts the stand-in in-process, runs the app's S3 blob store
+// against it (put, open, presigned download, delete and rejected signatures) and exits
+// non-zero on the first failure:
+//
+//	go run ./cmd/mocks3 -selfcheck
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"weather-app/services"
+)
+
+const (
+	amzDateFormat   = "20060102T150405Z"
+	maxClockSkew    = 15 * time.Minute
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	maxObjectBytes  = 32 * 1024 * 1024
+)
+
+// object is a stored blob
+type object struct {
+	data        []byte
+	contentType string
+}
+
+// mockS3 keeps buckets in memory and accepts one set of credentials
+type mockS3 struct {
+	accessKey string
+	secretKey string
+	region    string
+
+	mu      sync.Mutex
+	buckets map[string]map[string]object
+}
+
+func main() {
+	addr := flag.String("addr", ":9100", "listen address")
+	accessKey := flag.String("access-key", "mock-access", "accepted access key")
+	secretKey := flag.String("secret-key", "mock-secret", "accepted secret key")
+	region := flag.String("region", "us-east-1", "region requests must be signed for")
+	bucket := flag.String("bucket", "weather-uploads", "bucket created at startup")
+	selfCheck := flag.Bool("selfcheck", false, "run the app's S3 blob store against an in-process stand-in and exit")
+	flag.Parse()
+
+	if *selfCheck {
+		if err := runSelfCheck(*accessKey, *secretKey, *region, *bucket); err != nil {
+			log.Printf("Self check failed: %v", err)
+			os.Exit(1)
+		}
+		log.Printf("Self check passed")
+		return
+	}
+
+	s3 := newMockS3(*accessKey, *secretKey, *region)
+	s3.createBucket(*bucket)
+
+	log.Printf("Mock S3 listening on %s with bucket %s", *addr, *bucket)
+	log.Fatal(http.ListenAndServe(*addr, s3))
+}
+
+// newMockS3 creates a stand-in without buckets
+func newMockS3(accessKey, secretKey, region string) *mockS3 {
+	return &mockS3{
+		accessKey: accessKey,
+		secretKey: secretKey,
+		region:    region,
+		buckets:   make(map[string]map[string]object),
+	}
+}
+
+// createBucket adds an empty bucket if it doesn't exist yet
+func (s *mockS3) createBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.buckets[name]; !exists {
+		s.buckets[name] = make(map[string]object)
+	}
+}
+
+// ServeHTTP authenticates a path-style request and runs the bucket or object operation
+func (s *mockS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxObjectBytes+1))
+	if err != nil || len(body) > maxObjectBytes {
+		s3Error(w, http.StatusBadRequest, "EntityTooLarge", "object is too large or unreadable")
+		return
+	}
+
+	if code, message := s.authenticate(r, body); code != "" {
+		s3Error(w, http.StatusForbidden, code, message)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		s3Error(w, http.StatusBadRequest, "InvalidRequest", "only path-style bucket addressing is supported")
+		return
+	}
+
+	if key == "" {
+		if r.Method != http.MethodPut {
+			s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "only CreateBucket is supported on buckets")
+			return
+		}
+		s.createBucket(bucket)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects, exists := s.buckets[bucket]
+	if !exists {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket", "the bucket does not exist")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		objects[key] = object{data: body, contentType: r.Header.Get("Content-Type")}
+		w.Header().Set("ETag", `"`+sha256Hex(body)[:32]+`"`)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		obj, found := objects[key]
+		if !found {
+			s3Error(w, http.StatusNotFound, "NoSuchKey", "the key does not exist")
+			return
+		}
+		if obj.contentType != "" {
+			w.Header().Set("Content-Type", obj.contentType)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "unsupported method")
+	}
+}
+
+// authenticate checks a request's Signature Version 4 signature, either in the Authorization
+// header or in a presigned URL. It returns an S3 error code and message when it fails.
+func (s *mockS3) authenticate(r *http.Request, body []byte) (string, string) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "" {
+		return s.authenticatePresigned(r, query)
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return "AccessDenied", "missing Signature Version 4 authorization"
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		fields[name] = value
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != unsignedPayload && payloadHash != sha256Hex(body) {
+		return "XAmzContentSHA256Mismatch", "the payload does not match x-amz-content-sha256"
+	}
+
+	return s.verify(r, fields["Credential"], r.Header.Get("X-Amz-Date"), fields["SignedHeaders"],
+		fields["Signature"], canonicalQuery(r.URL.Query(), ""), payloadHash, 0)
+}
+
+// authenticatePresigned checks a presigned URL, including its expiry
+func (s *mockS3) authenticatePresigned(r *http.Request, query map[string][]string) (string, string) {
+	get := func(name string) string {
+		if values := query[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	if get("X-Amz-Algorithm") != "AWS4-HMAC-SHA256" {
+		return "AuthorizationQueryParametersError", "unsupported algorithm"
+	}
+	expires, err := strconv.Atoi(get("X-Amz-Expires"))
+	if err != nil || expires <= 0 || expires > int((7*24*time.Hour).Seconds()) {
+		return "AuthorizationQueryParametersError", "X-Amz-Expires must be between 1 second and 7 days"
+	}
+
+	return s.verify(r, get("X-Amz-Credential"), get("X-Amz-Date"), get("X-Amz-SignedHeaders"),
+		get("X-Amz-Signature"), canonicalQuery(query, "X-Amz-Signature"), unsignedPayload,
+		time.Duration(expires)*time.Second)
+}
+
+// verify recomputes the signature of a request. A non-zero validity marks a presigned URL,
+// which may be used until validity after its date; signed requests must be recent.
+func (s *mockS3) verify(r *http.Request, credential, amzDate, signedHeaders, signature, query, payloadHash string, validity time.Duration) (string, string) {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[3] != "s3" || parts[4] != "aws4_request" {
+		return "AuthorizationHeaderMalformed", "malformed credential"
+	}
+	if parts[0] != s.accessKey {
+		return "InvalidAccessKeyId", "unknown access key"
+	}
+	if parts[2] != s.region {
+		return "AuthorizationHeaderMalformed", "credential is for region " + parts[2] + ", expected " + s.region
+	}
+
+	signedAt, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil || signedAt.Format("20060102") != parts[1] {
+		return "AccessDenied", "missing or inconsistent request date"
+	}
+	now := time.Now()
+	if validity > 0 {
+		if now.After(signedAt.Add(validity)) || signedAt.After(now.Add(maxClockSkew)) {
+			return "AccessDenied", "request has expired"
+		}
+	} else if now.Sub(signedAt) > maxClockSkew || signedAt.Sub(now) > maxClockSkew {
+		return "RequestTimeTooSkewed", "request date is too far from the server time"
+	}
+
+	names := strings.Split(signedHeaders, ";")
+	if !sort.StringsAreSorted(names) || !contains(names, "host") {
+		return "AuthorizationHeaderMalformed", "signed headers must be sorted and include host"
+	}
+	var headers strings.Builder
+	for _, name := range names {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		query,
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join(parts[1:], "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), parts[1])
+	key = hmacSHA256(key, parts[2])
+	key = hmacSHA256(key, parts[3])
+	key = hmacSHA256(key, parts[4])
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return "SignatureDoesNotMatch", "the request signature does not match"
+	}
+	return "", ""
+}
+
+// canonicalQuery sorts and encodes query parameters, leaving out skip
+func canonicalQuery(query map[string][]string, skip string) string {
+	var pairs []string
+	for name, values := range query {
+		if name == skip {
+			continue
+		}
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes every byte except unreserved characters, and slashes unless
+// encodeSlash is set, as Signature Version 4 requires
+func uriEncode(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// runSelfCheck exercises the app's S3 blob store against an in-process stand-in
+func runSelfCheck(accessKey, secretKey, region, bucket string) error {
+	s3 := newMockS3(accessKey, secretKey, region)
+	s3.createBucket(bucket)
+	server := httptest.NewServer(s3)
+	defer server.Close()
+
+	config := services.S3Config{
+		Endpoint:  server.URL,
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		PathStyle: true,
+	}
+	store, err := services.NewS3BlobStore(config)
+	if err != nil {
+		return err
+	}
+
+	// Characters outside the unreserved set check that both sides encode paths alike
+	key := "chat_images/self check+(1)=ü.png"
+	data := []byte("\x89PNG mock image data")
+
+	if err := store.Put(key, data, "image/png"); err != nil {
+		return fmt.Errorf("put: %w", err)
+	}
+	log.Printf("Put %s", key)
+
+	blob, contentType, err := store.Open(key)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	got, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	if !bytes.Equal(got, data) || contentType != "image/png" {
+		return fmt.Errorf("open returned %q as %s, want the stored data as image/png", got, contentType)
+	}
+	log.Printf("Opened %s", key)
+
+	presigned, err := store.DirectURL(key, time.Hour)
+	if err != nil {
+		return fmt.Errorf("presign: %w", err)
+	}
+	if got, err := download(presigned); err != nil || !bytes.Equal(got, data) {
+		return fmt.Errorf("presigned download of %s: %q, %v", presigned, got, err)
+	}
+	if _, err := download(strings.Replace(presigned, "X-Amz-Signature=", "X-Amz-Signature=0", 1)); err == nil {
+		return errors.New("a tampered presigned URL was accepted")
+	}
+	if _, err := download(strings.Replace(presigned, "X-Amz-Expires=3600", "X-Amz-Expires=7200", 1)); err == nil {
+		return errors.New("a presigned URL with a changed expiry was accepted")
+	}
+	log.Printf("Downloaded %s with a presigned URL and rejected tampered ones", key)
+
+	config.SecretKey = "wrong-" + secretKey
+	wrongStore, err := services.NewS3BlobStore(config)
+	if err != nil {
+		return err
+	}
+	if err := wrongStore.Put(key, []byte("overwritten"), "image/png"); err == nil {
+		return errors.New("a put signed with the wrong secret key was accepted")
+	}
+	log.Printf("Rejected a put signed with the wrong secret key")
+
+	if err := store.Delete(key); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	if _, _, err := store.Open(key); !errors.Is(err, services.ErrBlobNotFound) {
+		return fmt.Errorf("open after delete returned %v, want ErrBlobNotFound", err)
+	}
+	if err := store.Delete(key); err != nil {
+		return fmt.Errorf("deleting a missing blob: %w", err)
+	}
+	log.Printf("Deleted %s", key)
+
+	return nil
+}
+
+// download fetches a URL without credentials and fails on any status but 200
+func download(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+// s3Error writes an S3-style XML error response
+func s3Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+}
+
+// contains reports whether values includes value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sha256Hex returns the hex-encoded SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"weather-app/middleware"
+	"weather-app/models"
+	"weather-app/services"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// AccountHandler handles personal data exports and account deletion
+type AccountHandler struct {
+	userStore models.UserStore
+	accounts  *services.AccountService
+}
+
+// NewAccountHandler creates a new instance of AccountHandler
+func NewAccountHandler(userStore models.UserStore, accounts *services.AccountService) *AccountHandler {
+	return &AccountHandler{
+		userStore: userStore,
+		accounts:  accounts,
+	}
+}
+
+// RegisterRoutes registers account data routes
+func (h *AccountHandler) RegisterRoutes(router *gin.Engine) {
+	accountGroup := router.Group("/api/account")
+	accountGroup.Use(middleware.AuthRequired())
+	{
+		accountGroup.GET("/export", h.exportData)
+		accountGroup.GET("/deletion", h.getDeletion)
+		accountGroup.POST("/deletion", h.scheduleDeletion)
+		accountGroup.DELETE("/deletion", h.cancelDeletion)
+	}
+}
+
+// Users without a password, such as those created by single sign-on, confirm a deletion by
+// signing in with their provider again shortly before
+const (
+	reauthenticatedAtKey   = "reauthenticated_at"
+	reauthenticationWindow = 5 * time.Minute
+)
+
+// scheduleDeletionRequest confirms an account deletion with the user's password. The password
+// may be left out right after reauthenticating with single sign-on.
+type scheduleDeletionRequest struct {
+	Password string `json:"password"`
+}
+
+// exportData handles GET requests for a ZIP archive of the user's personal data
+func (h *AccountHandler) exportData(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	user, err := h.userStore.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data: " + err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("go-weather-%s-%s.zip", user.Username, time.Now().Format("2006-01-02"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-store")
+
+	// The archive is streamed; errors can only be reported until the first byte is written
+	if err := h.accounts.WriteExport(user, c.Writer); err != nil {
+		if c.Writer.Written() {
+			log.Printf("Error streaming data export of user %d: %v", userID, err)
+			return
+		}
+		c.Header("Content-Type", "")
+		c.Header("Content-Disposition", "")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export data: " + err.Error()})
+		return
+	}
+
+	log.Printf("User %d exported their data", userID)
+}
+
+// getDeletion handles GET requests for when the user's account will be deleted
+func (h *AccountHandler) getDeletion(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	scheduledAt, err := h.accounts.DeletionScheduledAt(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check account deletion: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scheduled_at":      scheduledAt,
+		"grace_period_days": int(services.AccountDeletionGracePeriod.Hours() / 24),
+		"reauthenticated":   recentlyReauthenticated(sessions.Default(c)),
+	})
+}
+
+// recentlyReauthenticated reports whether the user confirmed their identity with single
+// sign-on within reauthenticationWindow
+func recentlyReauthenticated(session sessions.Session) bool {
+	at, ok := session.Get(reauthenticatedAtKey).(int64)
+	return ok && time.Since(time.Unix(at, 0)) <= reauthenticationWindow
+}
+
+// scheduleDeletion handles POST requests to delete the user's account after the grace period
+func (h *AccountHandler) scheduleDeletion(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	var req scheduleDeletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Please enter your password to confirm"})
+		return
+	}
+
+	session := sessions.Default(c)
+	if req.Password == "" {
+		if !recentlyReauthenticated(session) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please enter your password or confirm with single sign-on"})
+			return
+		}
+	} else {
+		user, err := h.userStore.GetUserByID(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account: " + err.Error()})
+			return
+		}
+		if !user.ValidatePassword(req.Password) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password is incorrect"})
+			return
+		}
+	}
+
+	// A confirmation is good for one deletion
+	session.Delete(reauthenticatedAtKey)
+	if err := session.Save(); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+
+	scheduledAt, err := h.accounts.ScheduleDeletion(userID)
+	if errors.Is(err, services.ErrDeletionAlreadyScheduled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled_at": scheduledAt})
+}
+
+// cancelDeletion handles DELETE requests to keep an account scheduled for deletion
+func (h *AccountHandler) cancelDeletion(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	err := h.accounts.CancelDeletion(userID)
+	if errors.Is(err, services.ErrDeletionNotScheduled) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel account deletion: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -3,21 +3,24 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"weather-app/models"
+	"weather-app/services"
 )
 
 // ActivityHandler handles requests for activity-related features
 type ActivityHandler struct {
-	apiKey string
+	activities *services.ActivityService
 }
 
 // NewActivityHandler creates a new instance of ActivityHandler
-func NewActivityHandler(apiKey string) *ActivityHandler {
+func NewActivityHandler(activities *services.ActivityService) *ActivityHandler {
 	return &ActivityHandler{
-		apiKey: apiKey,
+		activities: activities,
 	}
 }
 
@@ -43,84 +46,117 @@ func (h *ActivityHandler) GetActivitiesPageHandler(c *gin.Context) {
 	})
 }
 
-// GetActivitiesHandler handles API requests for activity recommendations
+// GetActivitiesHandler handles API requests for activity recommendations. Activities are
+// rated on the conditions in the query, best first.
 func (h *ActivityHandler) GetActivitiesHandler(c *gin.Context) {
-	// Get weather parameters from query
 	city := c.Query("city")
-	tempStr := c.DefaultQuery("temp", "20")
 	condition := c.DefaultQuery("condition", "clear")
-	humidity := c.DefaultQuery("humidity", "50")
-	windSpeed := c.DefaultQuery("wind", "5")
+
+	temp, err := strconv.ParseFloat(c.DefaultQuery("temp", "20"), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid temp parameter"})
+		return
+	}
+	windSpeed, err := strconv.ParseFloat(c.DefaultQuery("wind", "5"), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wind parameter"})
+		return
+	}
+	uvi, err := strconv.ParseFloat(c.DefaultQuery("uvi", "0"), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid uvi parameter"})
+		return
+	}
+	aqi, err := strconv.Atoi(c.DefaultQuery("aqi", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid aqi parameter"})
+		return
+	}
+	daylight := c.DefaultQuery("daylight", "true") != "false"
 
 	log.Printf("Activity recommendation request for city: %s, condition: %s", city, condition)
 
-	// Generate activity recommendations based on weather conditions
-	// In a real implementation, you would have more sophisticated logic
-	activities := generateActivityRecommendations(condition, tempStr, humidity, windSpeed)
+	hour := services.EstimateConditionHour(temp, windSpeed, condition, daylight, aqi)
+	hour.UVI = uvi
 
 	c.JSON(http.StatusOK, gin.H{
 		"city":       city,
-		"activities": activities,
+		"activities": generateActivityRecommendations(hour),
 		"success":    true,
 	})
 }
 
-// generateActivityRecommendations returns activities appropriate for the given weather
-func generateActivityRecommendations(condition, tempStr, humidity, windSpeed string) []map[string]interface{} {
-	condition = strings.ToLower(condition)
-
-	// Default activities for various weather conditions
-	outdoorActivities := []map[string]interface{}{
-		{
-			"name":        "Walking",
-			"description": "Perfect conditions for a walk in the park",
-			"suitability": "Excellent",
-			"icon":        "fas fa-walking",
-		},
-		{
-			"name":        "Cycling",
-			"description": "Good weather for cycling",
-			"suitability": "Good",
-			"icon":        "fas fa-bicycle",
-		},
-		{
-			"name":        "Picnic",
-			"description": "Consider a picnic in this weather",
-			"suitability": "Good",
-			"icon":        "fas fa-utensils",
-		},
+// generateActivityRecommendations rates the built-in activities for one hour of weather,
+// best first
+func generateActivityRecommendations(hour services.ForecastHour) []map[string]interface{} {
+	activities := make([]map[string]interface{}, 0, len(services.DefaultActivityProfiles))
+	for _, profile := range services.DefaultActivityProfiles {
+		score := services.ScoreHour(profile.Conditions, hour)
+
+		description := "Ideal conditions"
+		if len(score.Limits) > 0 {
+			reasons := make([]string, len(score.Limits))
+			for i, limit := range score.Limits {
+				reasons[i] = limit.Explanation
+			}
+			description = "Limited by " + strings.Join(reasons, "; ")
+		}
+
+		activities = append(activities, map[string]interface{}{
+			"key":         profile.Key,
+			"name":        profile.Name,
+			"description": description,
+			"suitability": score.Rating,
+			"score":       score.Score,
+			"limits":      score.Limits,
+			"icon":        profile.Icon,
+		})
 	}
 
-	indoorActivities := []map[string]interface{}{
-		{
-			"name":        "Visit Museum",
-			"description": "A great day to enjoy indoor cultural activities",
-			"suitability": "Excellent",
-			"icon":        "fas fa-landmark",
-		},
-		{
-			"name":        "Shopping",
-			"description": "Good time for shopping",
-			"suitability": "Good",
-			"icon":        "fas fa-shopping-bag",
-		},
-		{
-			"name":        "Watch a Movie",
-			"description": "Enjoy a movie at home or theater",
-			"suitability": "Excellent",
-			"icon":        "fas fa-film",
-		},
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activities[i]["score"].(int) > activities[j]["score"].(int)
+	})
+
+	return activities
+}
+
+// GetActivityWindowsHandler handles API requests for the best upcoming times for each activity
+// at a city or at lat and lon
+func (h *ActivityHandler) GetActivityWindowsHandler(c *gin.Context) {
+	var lat, lon float64
+	city := c.Query("city")
+	if city != "" {
+		weatherData, err := services.GetCurrentWeather(city)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "City not found: " + city})
+			return
+		}
+		lat, lon, city = weatherData.Coord.Lat, weatherData.Coord.Lon, weatherData.Name
+	} else {
+		var latErr, lonErr error
+		lat, latErr = strconv.ParseFloat(c.Query("lat"), 64)
+		lon, lonErr = strconv.ParseFloat(c.Query("lon"), 64)
+		if latErr != nil || lonErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "City or lat and lon are required"})
+			return
+		}
+		if !services.ValidCoordinates(lat, lon) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Coordinates are out of range"})
+			return
+		}
 	}
 
-	// Return appropriate activities based on weather condition
-	if strings.Contains(condition, "rain") ||
-		strings.Contains(condition, "snow") ||
-		strings.Contains(condition, "storm") ||
-		strings.Contains(condition, "thunder") {
-		return indoorActivities
+	windows, err := h.activities.GetActivityWindows(lat, lon)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load activity windows: " + err.Error()})
+		return
 	}
 
-	return outdoorActivities
+	c.JSON(http.StatusOK, gin.H{
+		"city":            city,
+		"timezone_offset": windows.TimezoneOffset,
+		"activities":      windows.Activities,
+	})
 }
 
 // RegisterActivityRoutes registers activity-related routes
@@ -128,4 +164,5 @@ func (h *ActivityHandler) RegisterActivityRoutes(router *gin.Engine) {
 	router.GET("/activities", h.GetActivitiesPageHandler)
 	router.GET("/weather-impact", h.GetActivitiesPageHandler)
 	router.GET("/api/activities", h.GetActivitiesHandler)
+	router.GET("/api/activities/windows", h.GetActivityWindowsHandler)
 }
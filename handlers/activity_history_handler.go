@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"weather-app/middleware"
+	"weather-app/models"
+	"weather-app/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ActivityHistoryHandler serves a user's activity timeline and insights built from it
+type ActivityHistoryHandler struct {
+	activities *services.ActivityService
+}
+
+// NewActivityHistoryHandler creates a new instance of ActivityHistoryHandler
+func NewActivityHistoryHandler(activities *services.ActivityService) *ActivityHistoryHandler {
+	return &ActivityHistoryHandler{
+		activities: activities,
+	}
+}
+
+// RegisterRoutes registers activity history routes
+func (h *ActivityHistoryHandler) RegisterRoutes(router *gin.Engine) {
+	historyGroup := router.Group("/api/activity")
+	{
+		historyGroup.GET("/timeline", middleware.AuthRequired(models.ScopeReadWeather), h.getTimeline)
+		historyGroup.GET("/insights", middleware.AuthRequired(models.ScopeReadWeather), h.getInsights)
+		// Only the dashboard records views, so read-only API tokens can't write to the history
+		historyGroup.POST("/views", middleware.AuthRequired(), h.recordView)
+	}
+}
+
+// recordViewRequest is a city the dashboard loaded in the browser
+type recordViewRequest struct {
+	City      string  `json:"city" binding:"required"`
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+}
+
+// getTimeline handles GET requests for the user's activities, newest first. Pass the last
+// ID of a page as before to get the next one.
+func (h *ActivityHistoryHandler) getTimeline(c *gin.Context) {
+	filter := models.ActivityFilter{Type: c.Query("type")}
+	switch filter.Type {
+	case "", models.ActivityTypeWeatherSearch, models.ActivityTypeComparison, models.ActivityTypeHistorical:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown activity type"})
+		return
+	}
+
+	var err error
+	if before := c.Query("before"); before != "" {
+		if filter.BeforeID, err = strconv.Atoi(before); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before parameter"})
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+			return
+		}
+	}
+
+	activities, err := h.activities.Timeline(middleware.CurrentUserID(c), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load activity: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"activities": activities})
+}
+
+// getInsights handles GET requests for the user's most viewed and recently viewed cities
+func (h *ActivityHistoryHandler) getInsights(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(services.ActivityInsightsDefaultDays)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days parameter"})
+		return
+	}
+
+	insights, err := h.activities.Insights(middleware.CurrentUserID(c), days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load activity insights: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, insights)
+}
+
+// recordView handles POST requests from the dashboard, which fetches weather in the browser,
+// to add a searched city to the user's history
+func (h *ActivityHistoryHandler) recordView(c *gin.Context) {
+	var req recordViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	err := h.activities.RecordActivity(models.Activity{
+		UserID:    middleware.CurrentUserID(c),
+		Type:      models.ActivityTypeWeatherSearch,
+		City:      req.City,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record activity: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true})
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"weather-app/middleware"
+	"weather-app/models"
+	"weather-app/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// outboxListLimit is how many outbox entries the admin console shows
+const outboxListLimit = 100
+
+// AdminHandler serves the admin console. Moderators can moderate chat rooms; admins can
+// also manage users and check on email, background jobs and upstream APIs.
+type AdminHandler struct {
+	userStore models.UserStore
+	admin     *services.AdminService
+	chat      *services.ChatService
+	outbox    *services.NotificationOutbox
+	jobs      *services.JobMonitor
+	apiUsage  *services.APIUsageTracker
+}
+
+// NewAdminHandler creates a new instance of AdminHandler
+func NewAdminHandler(userStore models.UserStore, admin *services.AdminService, chat *services.ChatService, outbox *services.NotificationOutbox, jobs *services.JobMonitor, apiUsage *services.APIUsageTracker) *AdminHandler {
+	return &AdminHandler{
+		userStore: userStore,
+		admin:     admin,
+		chat:      chat,
+		outbox:    outbox,
+		jobs:      jobs,
+		apiUsage:  apiUsage,
+	}
+}
+
+// RegisterRoutes registers the admin console page and API
+func (h *AdminHandler) RegisterRoutes(router *gin.Engine) {
+	router.GET("/admin", middleware.AuthRequired(), middleware.RequireRole(h.userStore, models.RoleModerator), h.getAdminPage)
+
+	moderatorGroup := router.Group("/api/admin")
+	moderatorGroup.Use(middleware.AuthRequired(), middleware.RequireRole(h.userStore, models.RoleModerator))
+	{
+		moderatorGroup.GET("/chat/rooms", h.listChatRooms)
+		moderatorGroup.GET("/chat/messages", h.listRoomMessages)
+		moderatorGroup.DELETE("/chat/messages/:id", h.removeMessage)
+	}
+
+	adminGroup := router.Group("/api/admin")
+	adminGroup.Use(middleware.AuthRequired(), middleware.RequireRole(h.userStore, models.RoleAdmin))
+	{
+		adminGroup.GET("/users", h.listUsers)
+		adminGroup.PUT("/users/:id/role", h.setRole)
+		adminGroup.POST("/users/:id/disable", h.disableUser)
+		adminGroup.POST("/users/:id/enable", h.enableUser)
+		adminGroup.GET("/outbox", h.listOutbox)
+		adminGroup.GET("/jobs", h.listJobs)
+		adminGroup.GET("/api-usage", h.getAPIUsage)
+	}
+}
+
+// setRoleRequest is the body of a role change
+type setRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// getAdminPage renders the admin console
+func (h *AdminHandler) getAdminPage(c *gin.Context) {
+	c.HTML(http.StatusOK, "admin.html", gin.H{
+		"title":     "Admin - Weather App",
+		"csrfToken": middleware.CSRFToken(c),
+		"isAdmin":   c.GetString(middleware.UserRoleKey) == models.RoleAdmin,
+	})
+}
+
+// listUsers handles GET requests to search users
+func (h *AdminHandler) listUsers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+
+	users, total, err := h.admin.ListUsers(c.Query("q"), page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users, "total": total, "page_size": services.AdminUsersPageSize})
+}
+
+// setRole handles PUT requests to change a user's role
+func (h *AdminHandler) setRole(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req setRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	err = h.admin.SetRole(middleware.CurrentUserID(c), userID, req.Role)
+	if !h.writeUserError(c, err, "Failed to change role: ") {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+// disableUser handles POST requests to disable an account
+func (h *AdminHandler) disableUser(c *gin.Context) {
+	h.setDisabled(c, true)
+}
+
+// enableUser handles POST requests to re-enable an account
+func (h *AdminHandler) enableUser(c *gin.Context) {
+	h.setDisabled(c, false)
+}
+
+// setDisabled disables or re-enables the account in the URL
+func (h *AdminHandler) setDisabled(c *gin.Context, disabled bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	err = h.admin.SetDisabled(middleware.CurrentUserID(c), userID, disabled)
+	if !h.writeUserError(c, err, "Failed to update account: ") {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+// writeUserError writes the response for a failed user change and reports whether it did
+func (h *AdminHandler) writeUserError(c *gin.Context, err error, prefix string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrCannotModifySelf):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": prefix + err.Error()})
+	}
+	return true
+}
+
+// listChatRooms handles GET requests for chat rooms ordered by recent activity
+func (h *AdminHandler) listChatRooms(c *gin.Context) {
+	rooms, err := h.admin.ListChatRooms()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list chat rooms: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rooms": rooms})
+}
+
+// listRoomMessages handles GET requests for a chat room's recent messages
+func (h *AdminHandler) listRoomMessages(c *gin.Context) {
+	placeID := c.Query("place_id")
+	if placeID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "place_id is required"})
+		return
+	}
+
+	messages, err := h.admin.RoomMessages(placeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list messages: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
+// removeMessage handles DELETE requests to remove any user's chat message
+func (h *AdminHandler) removeMessage(c *gin.Context) {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	msg, err := h.chat.ModerateMessage(messageID)
+	switch {
+	case errors.Is(err, services.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrMessageDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove message: " + err.Error()})
+		return
+	}
+
+	log.Printf("Moderator %d removed chat message %d", middleware.CurrentUserID(c), messageID)
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+// listOutbox handles GET requests for recently sent and failed emails
+func (h *AdminHandler) listOutbox(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != models.OutboxStatusSent && status != models.OutboxStatusFailed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be sent or failed"})
+		return
+	}
+
+	entries, err := h.outbox.List(status, outboxListLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list outbox: " + err.Error()})
+		return
+	}
+	counts, err := h.outbox.Counts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count outbox: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "last_24h": counts})
+}
+
+// listJobs handles GET requests for the status of background jobs
+func (h *AdminHandler) listJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"jobs": h.jobs.Statuses()})
+}
+
+// getAPIUsage handles GET requests for outgoing API traffic since the server started
+func (h *AdminHandler) getAPIUsage(c *gin.Context) {
+	usage, since := h.apiUsage.Usage()
+	c.JSON(http.StatusOK, gin.H{"usage": usage, "since": since})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"weather-app/middleware"
+	"weather-app/models"
+	"weather-app/services"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// APITokenHandler lets users create and revoke personal access tokens
+type APITokenHandler struct {
+	tokens *services.APITokenService
+}
+
+// NewAPITokenHandler creates a new instance of APITokenHandler
+func NewAPITokenHandler(tokens *services.APITokenService) *APITokenHandler {
+	return &APITokenHandler{
+		tokens: tokens,
+	}
+}
+
+// RegisterRoutes registers API token routes. Tokens can only be managed from a browser
+// session, so a leaked token cannot mint new ones.
+func (h *APITokenHandler) RegisterRoutes(router *gin.Engine) {
+	tokenGroup := router.Group("/api/tokens")
+	tokenGroup.Use(middleware.AuthRequired())
+	{
+		tokenGroup.GET("", h.listTokens)
+		tokenGroup.POST("", h.createToken)
+		tokenGroup.DELETE("/:id", h.revokeToken)
+	}
+}
+
+// createTokenRequest is the body of a create token request
+type createTokenRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"required"`
+}
+
+// listTokens handles GET requests for the user's tokens and the scopes they can have
+func (h *APITokenHandler) listTokens(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	tokens, err := h.tokens.ListTokens(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API tokens: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens, "scopes": models.APITokenScopes})
+}
+
+// createToken handles POST requests for a new token, which is returned only this once
+func (h *APITokenHandler) createToken(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	var req createTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	token, err := h.tokens.CreateToken(userID, req.Name, req.Scopes, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	switch {
+	case errors.Is(err, services.ErrInvalidTokenName),
+		errors.Is(err, services.ErrInvalidTokenScopes),
+		errors.Is(err, services.ErrInvalidTokenExpiry):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrTooManyAPITokens):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API token: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": token})
+}
+
+// revokeToken handles DELETE requests for one of the user's tokens
+func (h *APITokenHandler) revokeToken(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	tokenID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	err = h.tokens.RevokeToken(userID, tokenID)
+	if errors.Is(err, services.ErrAPITokenNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API token: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -1,31 +1,51 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"weather-app/middleware"
 	"weather-app/models"
+	"weather-app/services"
 )
 
 // AuthHandler handles authentication related routes
 type AuthHandler struct {
-	userStore models.UserStore
+	userStore         models.UserStore
+	emailVerification *services.EmailVerificationService
+	loginSecurity     *services.LoginSecurityService
+	twoFactor         *services.TwoFactorService
+	uploads           *services.UploadService
 }
 
+// Second sign-in step
+const (
+	twoFactorStartedKey    = "two_factor_started_at"
+	twoFactorLoginDeadline = 5 * time.Minute
+)
+
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(userStore models.UserStore) *AuthHandler {
+func NewAuthHandler(userStore models.UserStore, emailVerification *services.EmailVerificationService, loginSecurity *services.LoginSecurityService, twoFactor *services.TwoFactorService, uploads *services.UploadService) *AuthHandler {
 	return &AuthHandler{
-		userStore: userStore,
+		userStore:         userStore,
+		emailVerification: emailVerification,
+		loginSecurity:     loginSecurity,
+		twoFactor:         twoFactor,
+		uploads:           uploads,
 	}
 }
 
 // GetSignup displays signup form
 func (h *AuthHandler) GetSignup(c *gin.Context) {
 	c.HTML(http.StatusOK, "signup.html", gin.H{
-		"title": "Sign Up - Weather App",
+		"title":     "Sign Up - Weather App",
+		"csrfToken": middleware.CSRFToken(c),
 	})
 }
 
@@ -44,8 +64,9 @@ func (h *AuthHandler) PostSignup(c *gin.Context) {
 	// Validate input
 	if username == "" || email == "" || password == "" {
 		c.HTML(http.StatusBadRequest, "signup.html", gin.H{
-			"title": "Sign Up - Weather App",
-			"error": "All fields are required",
+			"title":     "Sign Up - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     "All fields are required",
 		})
 		return
 	}
@@ -53,8 +74,9 @@ func (h *AuthHandler) PostSignup(c *gin.Context) {
 	// Check if terms are accepted
 	if acceptTerms != "on" {
 		c.HTML(http.StatusBadRequest, "signup.html", gin.H{
-			"title": "Sign Up - Weather App",
-			"error": "You must accept the Terms & Conditions",
+			"title":     "Sign Up - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     "You must accept the Terms & Conditions",
 		})
 		return
 	}
@@ -75,14 +97,20 @@ func (h *AuthHandler) PostSignup(c *gin.Context) {
 	if err != nil {
 		log.Printf("Error creating user: %v", err)
 		c.HTML(http.StatusBadRequest, "signup.html", gin.H{
-			"title": "Sign Up - Weather App",
-			"error": err.Error(),
+			"title":     "Sign Up - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     err.Error(),
 		})
 		return
 	}
 
 	log.Printf("User created successfully: ID=%d, username=%s", user.ID, user.Username)
 
+	// Ask the user to confirm their email address before we send anything else to it
+	if err := h.emailVerification.SendVerification(user.ID); err != nil {
+		log.Printf("Error sending verification email: %v", err)
+	}
+
 	// Log the user in
 	session := sessions.Default(c)
 	session.Set("user_id", user.ID)
@@ -90,8 +118,9 @@ func (h *AuthHandler) PostSignup(c *gin.Context) {
 	if err != nil {
 		log.Printf("Error saving session: %v", err)
 		c.HTML(http.StatusInternalServerError, "signup.html", gin.H{
-			"title": "Sign Up - Weather App",
-			"error": "Failed to create session. Please try logging in.",
+			"title":     "Sign Up - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     "Failed to create session. Please try logging in.",
 		})
 		return
 	}
@@ -102,9 +131,14 @@ func (h *AuthHandler) PostSignup(c *gin.Context) {
 
 // GetLogin displays login form
 func (h *AuthHandler) GetLogin(c *gin.Context) {
-	c.HTML(http.StatusOK, "login.html", gin.H{
-		"title": "Login - Weather App",
-	})
+	data := gin.H{
+		"title":     "Login - Weather App",
+		"csrfToken": middleware.CSRFToken(c),
+	}
+	if c.Query("reset") == "success" {
+		data["success"] = "Your password has been reset. Please log in with your new password."
+	}
+	c.HTML(http.StatusOK, "login.html", data)
 }
 
 // PostLogin processes login form
@@ -113,49 +147,112 @@ func (h *AuthHandler) PostLogin(c *gin.Context) {
 	username := c.PostForm("username")
 	password := c.PostForm("password")
 
-	log.Printf("Login attempt: username=%s", username)
-
 	// Validate input
 	if username == "" || password == "" {
 		c.HTML(http.StatusBadRequest, "login.html", gin.H{
-			"title": "Login - Weather App",
-			"error": "Username and password are required",
+			"title":     "Login - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     "Username and password are required",
 		})
 		return
 	}
 
-	// Get user by username
+	// Get user by username; unknown usernames are still throttled by IP address
+	userID := 0
 	user, err := h.userStore.GetUserByUsername(username)
-	if err != nil {
-		log.Printf("Login error: User not found: %v", err)
-		c.HTML(http.StatusUnauthorized, "login.html", gin.H{
-			"title": "Login - Weather App",
-			"error": "Invalid username or password",
+	if err == nil {
+		userID = user.ID
+	}
+
+	ipAddress := c.RemoteIP()
+	userAgent := c.Request.UserAgent()
+
+	// Slow down repeated failures before checking the password
+	wait, err := h.loginSecurity.CheckAllowed(userID, ipAddress)
+	if errors.Is(err, services.ErrAccountLocked) {
+		c.HTML(http.StatusTooManyRequests, "login.html", gin.H{
+			"title":     "Login - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     fmt.Sprintf("This account is temporarily locked after too many failed sign-in attempts. Try again in %s or reset your password.", formatWait(wait)),
 		})
 		return
 	}
+	if errors.Is(err, services.ErrLoginThrottled) {
+		c.HTML(http.StatusTooManyRequests, "login.html", gin.H{
+			"title":     "Login - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     fmt.Sprintf("Too many failed sign-in attempts. Please wait %s and try again.", formatWait(wait)),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking sign-in throttling: %v", err)
+	}
 
 	// Validate password
-	if !user.ValidatePassword(password) {
-		log.Printf("Login error: Invalid password for user %s", username)
+	if user == nil || !user.ValidatePassword(password) {
+		log.Printf("Login failed from %s", ipAddress)
+		if err := h.loginSecurity.RecordFailure(userID, ipAddress, userAgent); err != nil {
+			log.Printf("Error recording failed sign-in: %v", err)
+		}
 		c.HTML(http.StatusUnauthorized, "login.html", gin.H{
-			"title": "Login - Weather App",
-			"error": "Invalid username or password",
+			"title":     "Login - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     "Invalid username or password",
 		})
 		return
 	}
 
-	log.Printf("Login successful: username=%s, ID=%d", username, user.ID)
+	// Disabled accounts are told so only after the password is known to be right
+	if user.Disabled {
+		log.Printf("Login refused for disabled user %d", user.ID)
+		c.HTML(http.StatusForbidden, "login.html", gin.H{
+			"title":     "Login - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     services.ErrAccountDisabled.Error(),
+		})
+		return
+	}
 
-	// Set session
 	session := sessions.Default(c)
+
+	// Accounts with two-factor authentication need a code before they are signed in. The
+	// sign-in is only recorded as successful after that, so failed codes keep counting.
+	twoFactorEnabled, err := h.twoFactor.IsEnabled(user.ID)
+	if err != nil {
+		log.Printf("Error checking two-factor authentication: %v", err)
+		c.HTML(http.StatusInternalServerError, "login.html", gin.H{
+			"title":     "Login - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     "Failed to sign in. Please try again.",
+		})
+		return
+	}
+	if twoFactorEnabled {
+		session.Delete("user_id")
+		session.Set(middleware.TwoFactorPendingKey, user.ID)
+		session.Set(twoFactorStartedKey, time.Now().Unix())
+		if err := session.Save(); err != nil {
+			log.Printf("Error saving session: %v", err)
+		}
+		c.Redirect(http.StatusSeeOther, "/login/2fa")
+		return
+	}
+
+	log.Printf("Login successful: ID=%d", user.ID)
+	if err := h.loginSecurity.RecordSuccess(user.ID, ipAddress, userAgent); err != nil {
+		log.Printf("Error recording sign-in: %v", err)
+	}
+
+	// Set session
 	session.Set("user_id", user.ID)
 	err = session.Save()
 	if err != nil {
 		log.Printf("Error saving session: %v", err)
 		c.HTML(http.StatusInternalServerError, "login.html", gin.H{
-			"title": "Login - Weather App",
-			"error": "Failed to create session. Please try again.",
+			"title":     "Login - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     "Failed to create session. Please try again.",
 		})
 		return
 	}
@@ -164,6 +261,124 @@ func (h *AuthHandler) PostLogin(c *gin.Context) {
 	c.Redirect(http.StatusFound, "/")
 }
 
+// GetLoginTwoFactor displays the second sign-in step
+func (h *AuthHandler) GetLoginTwoFactor(c *gin.Context) {
+	if _, ok := pendingTwoFactorUser(sessions.Default(c)); !ok {
+		c.Redirect(http.StatusFound, "/login")
+		return
+	}
+
+	c.HTML(http.StatusOK, "login_2fa.html", gin.H{
+		"title":     "Two-Factor Authentication - Weather App",
+		"csrfToken": middleware.CSRFToken(c),
+	})
+}
+
+// PostLoginTwoFactor checks the authentication or recovery code and completes the sign-in
+func (h *AuthHandler) PostLoginTwoFactor(c *gin.Context) {
+	session := sessions.Default(c)
+	userID, ok := pendingTwoFactorUser(session)
+	if !ok {
+		session.Delete(middleware.TwoFactorPendingKey)
+		session.Delete(twoFactorStartedKey)
+		session.Save()
+		c.Redirect(http.StatusSeeOther, "/login")
+		return
+	}
+
+	ipAddress := c.RemoteIP()
+	userAgent := c.Request.UserAgent()
+
+	wait, err := h.loginSecurity.CheckAllowed(userID, ipAddress)
+	if errors.Is(err, services.ErrAccountLocked) || errors.Is(err, services.ErrLoginThrottled) {
+		c.HTML(http.StatusTooManyRequests, "login_2fa.html", gin.H{
+			"title":     "Two-Factor Authentication - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     fmt.Sprintf("Too many failed attempts. Please wait %s and try again.", formatWait(wait)),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking sign-in throttling: %v", err)
+	}
+
+	err = h.twoFactor.Verify(userID, c.PostForm("code"))
+	if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+		if err := h.loginSecurity.RecordFailure(userID, ipAddress, userAgent); err != nil {
+			log.Printf("Error recording failed sign-in: %v", err)
+		}
+		c.HTML(http.StatusUnauthorized, "login_2fa.html", gin.H{
+			"title":     "Two-Factor Authentication - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     "Invalid authentication code",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying two-factor code: %v", err)
+		c.HTML(http.StatusInternalServerError, "login_2fa.html", gin.H{
+			"title":     "Two-Factor Authentication - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     "Failed to verify the code. Please try again.",
+		})
+		return
+	}
+
+	log.Printf("Login successful: ID=%d", userID)
+	if err := h.loginSecurity.RecordSuccess(userID, ipAddress, userAgent); err != nil {
+		log.Printf("Error recording sign-in: %v", err)
+	}
+
+	session.Delete(middleware.TwoFactorPendingKey)
+	session.Delete(twoFactorStartedKey)
+	session.Set("user_id", userID)
+	if err := session.Save(); err != nil {
+		log.Printf("Error saving session: %v", err)
+		c.HTML(http.StatusInternalServerError, "login_2fa.html", gin.H{
+			"title":     "Two-Factor Authentication - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     "Failed to create session. Please try again.",
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/")
+}
+
+// pendingTwoFactorUser returns the user waiting for the second sign-in step, if the
+// password step was passed less than twoFactorLoginDeadline ago
+func pendingTwoFactorUser(session sessions.Session) (int, bool) {
+	userID, ok := session.Get(middleware.TwoFactorPendingKey).(int)
+	if !ok {
+		return 0, false
+	}
+	startedAt, _ := session.Get(twoFactorStartedKey).(int64)
+	if time.Since(time.Unix(startedAt, 0)) > twoFactorLoginDeadline {
+		return 0, false
+	}
+	return userID, true
+}
+
+// formatWait describes a wait time in whole seconds or minutes
+func formatWait(wait time.Duration) string {
+	if wait < time.Minute {
+		seconds := int(wait.Round(time.Second).Seconds())
+		if seconds < 1 {
+			seconds = 1
+		}
+		if seconds == 1 {
+			return "1 second"
+		}
+		return fmt.Sprintf("%d seconds", seconds)
+	}
+
+	minutes := int((wait + time.Minute - 1) / time.Minute)
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
 // Logout logs out a user
 func (h *AuthHandler) Logout(c *gin.Context) {
 	session := sessions.Default(c)
@@ -171,7 +386,9 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 	if userID != nil {
 		log.Printf("Logout: user_id=%v", userID)
 	}
+	// A negative MaxAge deletes the server-side session and expires the cookie
 	session.Clear()
+	session.Options(sessions.Options{Path: "/", MaxAge: -1})
 	session.Save()
 	c.Redirect(http.StatusFound, "/")
 }
@@ -196,10 +413,11 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 
 	// Render profile page
 	c.HTML(http.StatusOK, "profile.html", gin.H{
-		"title":   "Your Profile - Weather App",
-		"user":    user,
-		"success": success,
-		"error":   errorMsg,
+		"title":     "Your Profile - Weather App",
+		"csrfToken": middleware.CSRFToken(c),
+		"user":      user,
+		"success":   success,
+		"error":     errorMsg,
 	})
 }
 
@@ -228,31 +446,12 @@ func (h *AuthHandler) PostProfile(c *gin.Context) {
 	log.Printf("Profile photo from form: '%s'", profilePhoto)
 
 	// Update user fields
+	emailChanged := email != user.Email
 	user.Email = email
 	user.HomeCity = homeCity
 	user.NotificationsEnabled = notificationsEnabled
 	user.AlertThreshold = alertThreshold
 
-	// Update profile photo if provided
-	if profilePhoto != "" {
-		// Validate profile photo
-		validPhotos := map[string]bool{
-			"photo1.jpg":  true,
-			"photo2.jpg":  true,
-			"photo3.jpg":  true,
-			"photo4.jpg":  true,
-			"photo5.jpg":  true,
-			"default.jpg": true,
-		}
-
-		if validPhotos[profilePhoto] {
-			log.Printf("Setting profile photo to: %s", profilePhoto)
-			user.ProfilePhoto = profilePhoto
-		} else {
-			log.Printf("Invalid profile photo selection: %s", profilePhoto)
-		}
-	}
-
 	// If alert threshold is not set, default to "severe"
 	if user.AlertThreshold == "" {
 		user.AlertThreshold = "severe"
@@ -265,13 +464,17 @@ func (h *AuthHandler) PostProfile(c *gin.Context) {
 		currentPassword := c.PostForm("current_password")
 		if !user.ValidatePassword(currentPassword) {
 			c.HTML(http.StatusBadRequest, "profile.html", gin.H{
-				"title": "Your Profile - Weather App",
-				"user":  user,
-				"error": "Current password is incorrect",
+				"title":     "Your Profile - Weather App",
+				"csrfToken": middleware.CSRFToken(c),
+				"user":      user,
+				"error":     "Current password is incorrect",
 			})
 			return
 		}
 		user.Password = newPassword
+	} else {
+		// Keep the stored hash; UpdateUserProfile hashes any non-empty password
+		user.Password = ""
 	}
 
 	// Update timestamp
@@ -282,15 +485,33 @@ func (h *AuthHandler) PostProfile(c *gin.Context) {
 	if err != nil {
 		log.Printf("Error updating user profile: %v", err)
 		c.HTML(http.StatusInternalServerError, "profile.html", gin.H{
-			"title": "Your Profile - Weather App",
-			"user":  user,
-			"error": "Failed to update profile: " + err.Error(),
+			"title":     "Your Profile - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"user":      user,
+			"error":     "Failed to update profile: " + err.Error(),
 		})
 		return
 	}
 
+	// Update profile photo if provided
+	if profilePhoto != "" {
+		if err := h.uploads.SetProfilePhoto(user.ID, profilePhoto); err != nil {
+			log.Printf("Error setting profile photo %s: %v", profilePhoto, err)
+		} else {
+			log.Printf("Setting profile photo to: %s", profilePhoto)
+		}
+	}
+
 	log.Printf("Profile successfully updated for user ID: %d", user.ID)
-	log.Printf("Profile photo set to: %s", user.ProfilePhoto)
+
+	// A new email address has to be verified before notifications are sent to it
+	if emailChanged {
+		if err := h.emailVerification.SendVerification(user.ID); err != nil {
+			log.Printf("Error sending verification email: %v", err)
+		}
+		c.Redirect(http.StatusSeeOther, "/profile?success="+url.QueryEscape("Profile updated. We've sent a verification link to "+user.Email+"."))
+		return
+	}
 
 	// Redirect back to profile with success message
 	c.Redirect(http.StatusSeeOther, "/profile?success=true")
@@ -1,24 +1,34 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"weather-app/middleware"
 	"weather-app/models"
 	"weather-app/services"
 
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
 // ChatHandler handles all chat-related HTTP requests
 type ChatHandler struct {
-	chatService *services.ChatService
+	chatService    *services.ChatService
+	chatBot        *services.ChatBot
+	mentionService *services.MentionService
+	uploadService  *services.UploadService
 }
 
-// NewChatHandler creates a new instance of ChatHandler
-func NewChatHandler(chatService *services.ChatService) *ChatHandler {
+// NewChatHandler creates a new instance of ChatHandler.
+// chatBot may be nil, in which case slash commands are posted as plain messages.
+func NewChatHandler(chatService *services.ChatService, chatBot *services.ChatBot, mentionService *services.MentionService, uploadService *services.UploadService) *ChatHandler {
 	return &ChatHandler{
-		chatService: chatService,
+		chatService:    chatService,
+		chatBot:        chatBot,
+		mentionService: mentionService,
+		uploadService:  uploadService,
 	}
 }
 
@@ -26,11 +36,20 @@ func NewChatHandler(chatService *services.ChatService) *ChatHandler {
 func (h *ChatHandler) RegisterRoutes(router *gin.Engine) {
 	// API routes with authentication middleware
 	chatGroup := router.Group("/api/chat")
-	chatGroup.Use(middleware.AuthRequired())
+	chatGroup.Use(middleware.AuthRequired(models.ScopeChat))
 	{
 		chatGroup.GET("/room", h.getChatRoom)
 		chatGroup.POST("/message", h.postMessage)
+		chatGroup.PUT("/message/:id", h.editMessage)
+		chatGroup.DELETE("/message/:id", h.deleteMessage)
+		chatGroup.GET("/message/:id/history", h.getMessageHistory)
+		chatGroup.POST("/message/:id/reactions", h.addReaction)
+		chatGroup.DELETE("/message/:id/reactions", h.removeReaction)
 		chatGroup.POST("/activity", h.updateActivity)
+		chatGroup.POST("/typing", h.updateTyping)
+		chatGroup.GET("/mentions", h.getMentions)
+		chatGroup.GET("/mentions/unread", h.getUnreadMentionCount)
+		chatGroup.POST("/mentions/read", h.markMentionsRead)
 		chatGroup.GET("/popular", h.getPopularChatRooms) // New endpoint for popular chat rooms
 	}
 
@@ -45,19 +64,25 @@ func (h *ChatHandler) RegisterRoutes(router *gin.Engine) {
 
 // getChatRoom handles GET requests to retrieve a chat room
 func (h *ChatHandler) getChatRoom(c *gin.Context) {
+	placeID := c.Query("place_id")
 	cityName := c.Query("city")
-	if cityName == "" {
+	if placeID == "" && cityName == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "City name is required"})
 		return
 	}
 
+	place, err := h.resolvePlace(placeID, cityName)
+	if err != nil {
+		c.JSON(chatErrorStatus(err), gin.H{"error": "Failed to find chat room: " + err.Error()})
+		return
+	}
+
 	// Get the chat room
-	room := h.chatService.GetOrCreateChatRoom(cityName)
+	room := h.chatService.GetOrCreateChatRoom(place)
 
 	// Update user activity in this room
-	session := sessions.Default(c)
-	userID := session.Get("user_id").(int)
-	h.chatService.UpdateUserActivity(userID, cityName)
+	userID := middleware.CurrentUserID(c)
+	h.chatService.UpdateUserActivity(userID, place)
 
 	// Return the chat room
 	c.JSON(http.StatusOK, room)
@@ -67,7 +92,8 @@ func (h *ChatHandler) getChatRoom(c *gin.Context) {
 func (h *ChatHandler) postMessage(c *gin.Context) {
 	// Parse request body
 	var req struct {
-		CityName string `json:"city_name" binding:"required"`
+		PlaceID  string `json:"place_id"`
+		CityName string `json:"city_name"`
 		Message  string `json:"message" binding:"required"`
 		ImageURL string `json:"image_url"`
 	}
@@ -77,9 +103,14 @@ func (h *ChatHandler) postMessage(c *gin.Context) {
 		return
 	}
 
-	// Get user info from session
-	session := sessions.Default(c)
-	userID := session.Get("user_id").(int)
+	place, err := h.resolvePlace(req.PlaceID, req.CityName)
+	if err != nil {
+		c.JSON(chatErrorStatus(err), gin.H{"error": "Failed to find chat room: " + err.Error()})
+		return
+	}
+
+	// Get user info from the session or API token
+	userID := middleware.CurrentUserID(c)
 
 	// Get user from store
 	userStore := c.MustGet("user_store").(models.UserStore)
@@ -89,20 +120,27 @@ func (h *ChatHandler) postMessage(c *gin.Context) {
 		return
 	}
 
-	// Get avatar URL
-	avatarURL := "/static/profile_photos/default.jpg"
-	if user.ProfilePhoto != "" {
-		avatarURL = "/static/profile_photos/" + user.ProfilePhoto
+	// Images must be the poster's own uploads, which are kept from now on
+	if req.ImageURL != "" {
+		if err := h.uploadService.UseChatImage(userID, req.ImageURL); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, services.ErrImageNotUploaded) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": "Failed to attach image: " + err.Error()})
+			return
+		}
 	}
 
 	// Create message
 	msg := models.ChatMessage{
 		UserID:    userID,
 		Username:  user.Username,
-		CityName:  req.CityName,
+		CityName:  place.Name,
+		PlaceID:   place.ID,
 		Message:   req.Message,
 		ImageURL:  req.ImageURL,
-		AvatarURL: avatarURL,
+		AvatarURL: user.AvatarURL(),
 	}
 
 	// Add message to chat room
@@ -112,18 +150,171 @@ func (h *ChatHandler) postMessage(c *gin.Context) {
 		return
 	}
 
-	// Update user activity
-	h.chatService.UpdateUserActivity(userID, req.CityName)
+	// Store @mentions and notify the mentioned users
+	if _, err := h.mentionService.RecordMentions(newMsg); err != nil {
+		log.Printf("Error recording mentions for message %d: %v", newMsg.ID, err)
+	}
+
+	// Let the weather bot answer slash commands
+	if h.chatBot != nil && services.IsCommand(req.Message) {
+		if _, err := h.chatBot.HandleCommand(place, req.Message); err != nil {
+			log.Printf("Error answering chat command %q in %s: %v", req.Message, place.ID, err)
+		}
+	}
+
+	// Posting counts as activity and ends the typing indicator
+	h.chatService.SetTyping(userID, place, false)
 
 	// Return the new message
 	c.JSON(http.StatusOK, newMsg)
 }
 
+// editMessage handles PUT requests to change the text of the user's own message
+func (h *ChatHandler) editMessage(c *gin.Context) {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req struct {
+		Message string `json:"message" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	text := strings.TrimSpace(req.Message)
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message cannot be empty"})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+
+	msg, err := h.chatService.EditMessage(messageID, userID, text)
+	if err != nil {
+		c.JSON(chatErrorStatus(err), gin.H{"error": "Failed to edit message: " + err.Error()})
+		return
+	}
+
+	// Notify users newly mentioned by the edit; users already mentioned keep their one
+	// mention, since chat_mentions allows a single row per message and user
+	if _, err := h.mentionService.RecordMentions(msg); err != nil {
+		log.Printf("Error recording mentions for edited message %d: %v", msg.ID, err)
+	}
+
+	c.JSON(http.StatusOK, msg)
+}
+
+// deleteMessage handles DELETE requests to soft-delete the user's own message
+func (h *ChatHandler) deleteMessage(c *gin.Context) {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+
+	msg, err := h.chatService.DeleteMessage(messageID, userID)
+	if err != nil {
+		c.JSON(chatErrorStatus(err), gin.H{"error": "Failed to delete message: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, msg)
+}
+
+// getMessageHistory handles GET requests for the edit history of a message
+func (h *ChatHandler) getMessageHistory(c *gin.Context) {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	edits, err := h.chatService.GetMessageHistory(messageID)
+	if err != nil {
+		c.JSON(chatErrorStatus(err), gin.H{"error": "Failed to get message history: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"edits": edits})
+}
+
+// addReaction handles POST requests to react to a message with an emoji
+func (h *ChatHandler) addReaction(c *gin.Context) {
+	h.changeReaction(c, h.chatService.AddReaction)
+}
+
+// removeReaction handles DELETE requests to take back an emoji reaction
+func (h *ChatHandler) removeReaction(c *gin.Context) {
+	h.changeReaction(c, h.chatService.RemoveReaction)
+}
+
+// changeReaction parses a reaction request and applies it with the given service call
+func (h *ChatHandler) changeReaction(c *gin.Context, apply func(messageID, userID int, emoji string) (models.ChatMessage, error)) {
+	messageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req struct {
+		Emoji string `json:"emoji" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+
+	msg, err := apply(messageID, userID, req.Emoji)
+	if err != nil {
+		c.JSON(chatErrorStatus(err), gin.H{"error": "Failed to update reaction: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, msg)
+}
+
+// chatErrorStatus maps chat service errors to HTTP status codes
+func chatErrorStatus(err error) int {
+	switch err {
+	case services.ErrMessageNotFound:
+		return http.StatusNotFound
+	case services.ErrNotMessageAuthor:
+		return http.StatusForbidden
+	case services.ErrEditWindowExpired, services.ErrMessageDeleted:
+		return http.StatusConflict
+	case services.ErrInvalidReaction:
+		return http.StatusBadRequest
+	case services.ErrPlaceNotFound:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// resolvePlace finds the canonical place of a room by place ID, falling back to a city name or alias
+func (h *ChatHandler) resolvePlace(placeID, cityName string) (models.ChatPlace, error) {
+	if placeID != "" {
+		return h.chatService.GetPlace(placeID)
+	}
+	return h.chatService.ResolvePlace(cityName)
+}
+
 // updateActivity handles POST requests to update user activity in a chat room
 func (h *ChatHandler) updateActivity(c *gin.Context) {
 	// Parse request body
 	var req struct {
-		CityName string `json:"city_name" binding:"required"`
+		PlaceID  string `json:"place_id"`
+		CityName string `json:"city_name"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -131,12 +322,17 @@ func (h *ChatHandler) updateActivity(c *gin.Context) {
 		return
 	}
 
-	// Get user ID from session
-	session := sessions.Default(c)
-	userID := session.Get("user_id").(int)
+	place, err := h.resolvePlace(req.PlaceID, req.CityName)
+	if err != nil {
+		c.JSON(chatErrorStatus(err), gin.H{"error": "Failed to find chat room: " + err.Error()})
+		return
+	}
+
+	// Get user ID from the session or API token
+	userID := middleware.CurrentUserID(c)
 
 	// Update user activity
-	if err := h.chatService.UpdateUserActivity(userID, req.CityName); err != nil {
+	if err := h.chatService.UpdateUserActivity(userID, place); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update activity: " + err.Error()})
 		return
 	}
@@ -145,14 +341,99 @@ func (h *ChatHandler) updateActivity(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// updateTyping handles POST requests to start or stop the user's typing indicator
+func (h *ChatHandler) updateTyping(c *gin.Context) {
+	var req struct {
+		PlaceID string `json:"place_id" binding:"required"`
+		Typing  bool   `json:"typing"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	place, err := h.chatService.GetPlace(req.PlaceID)
+	if err != nil {
+		c.JSON(chatErrorStatus(err), gin.H{"error": "Failed to find chat room: " + err.Error()})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+
+	if err := h.chatService.SetTyping(userID, place, req.Typing); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update typing status: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// getMentions handles GET requests for the messages that mentioned the current user
+func (h *ChatHandler) getMentions(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+
+	// Only unread mentions unless ?all=true
+	unreadOnly := c.Query("all") != "true"
+
+	mentions, err := h.mentionService.ListMentions(userID, unreadOnly, 50)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get mentions: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mentions": mentions})
+}
+
+// getUnreadMentionCount handles GET requests for the number of unread mentions
+func (h *ChatHandler) getUnreadMentionCount(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+
+	count, err := h.mentionService.GetUnreadCount(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get unread mentions: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+// markMentionsRead handles POST requests to mark mentions as read, in one room or everywhere
+func (h *ChatHandler) markMentionsRead(c *gin.Context) {
+	var req struct {
+		PlaceID string `json:"place_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+
+	var err error
+	if req.PlaceID != "" {
+		err = h.mentionService.MarkRoomRead(userID, req.PlaceID)
+	} else {
+		err = h.mentionService.MarkAllRead(userID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark mentions as read: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
 // getPopularChatRooms handles GET requests to retrieve popular chat rooms
 func (h *ChatHandler) getPopularChatRooms(c *gin.Context) {
 	// Get popular chat rooms (rooms with most messages or active users)
 	rows, err := h.chatService.GetDB().Query(
-		`SELECT city_name, COUNT(*) as message_count 
-		FROM chat_messages 
-		WHERE created_at > NOW() - INTERVAL 24 HOUR 
-		GROUP BY city_name 
+		`SELECT m.place_id, p.name, COUNT(*) as message_count 
+		FROM chat_messages m 
+		JOIN chat_places p ON p.place_id = m.place_id 
+		WHERE m.created_at > NOW() - INTERVAL 24 HOUR 
+		GROUP BY m.place_id, p.name 
 		ORDER BY message_count DESC 
 		LIMIT 5`,
 	)
@@ -164,6 +445,7 @@ func (h *ChatHandler) getPopularChatRooms(c *gin.Context) {
 	defer rows.Close()
 
 	type PopularCity struct {
+		PlaceID      string `json:"place_id"`
 		Name         string `json:"name"`
 		MessageCount int    `json:"message_count"`
 		ActiveUsers  int    `json:"active_users"`
@@ -172,15 +454,15 @@ func (h *ChatHandler) getPopularChatRooms(c *gin.Context) {
 	var cities []PopularCity
 	for rows.Next() {
 		var city PopularCity
-		if err := rows.Scan(&city.Name, &city.MessageCount); err != nil {
+		if err := rows.Scan(&city.PlaceID, &city.Name, &city.MessageCount); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process popular chat rooms: " + err.Error()})
 			return
 		}
 
 		// Get active users count
 		h.chatService.GetDB().QueryRow(
-			"SELECT COUNT(*) FROM chat_active_users WHERE city_name = ? AND last_active > NOW() - INTERVAL 10 MINUTE",
-			city.Name,
+			"SELECT COUNT(*) FROM chat_active_users WHERE place_id = ? AND last_active > NOW() - INTERVAL 10 MINUTE",
+			city.PlaceID,
 		).Scan(&city.ActiveUsers)
 
 		cities = append(cities, city)
@@ -192,15 +474,23 @@ func (h *ChatHandler) getPopularChatRooms(c *gin.Context) {
 
 // handleChatPage serves the chat page for a specific city
 func (h *ChatHandler) handleChatPage(c *gin.Context) {
+	placeID := c.Query("place")
 	cityName := c.Query("city")
-	if cityName == "" {
+	if placeID == "" && cityName == "" {
+		c.Redirect(http.StatusSeeOther, "/chats")
+		return
+	}
+
+	// Only places that resolve to a real city have a room
+	place, err := h.resolvePlace(placeID, cityName)
+	if err != nil {
+		log.Printf("Error resolving chat room %q: %v", placeID+cityName, err)
 		c.Redirect(http.StatusSeeOther, "/chats")
 		return
 	}
 
-	// Get user ID and username from session
-	session := sessions.Default(c)
-	userID := session.Get("user_id").(int)
+	// Get user ID and username from the session
+	userID := middleware.CurrentUserID(c)
 
 	// Get user from store
 	userStore := c.MustGet("user_store").(models.UserStore)
@@ -212,9 +502,10 @@ func (h *ChatHandler) handleChatPage(c *gin.Context) {
 
 	// Render template
 	c.HTML(http.StatusOK, "chat.html", gin.H{
-		"title":    "Weather Chat - " + cityName,
+		"title":    "Weather Chat - " + place.Name,
 		"User":     user,
-		"CityName": cityName,
+		"CityName": place.Name,
+		"PlaceID":  place.ID,
 		"UserID":   userID,
 		"Username": user.Username,
 	})
@@ -223,8 +514,7 @@ func (h *ChatHandler) handleChatPage(c *gin.Context) {
 // handleChatsListPage serves the chats list page
 func (h *ChatHandler) handleChatsListPage(c *gin.Context) {
 	// Get user's saved cities from database
-	session := sessions.Default(c)
-	userID := session.Get("user_id").(int)
+	userID := middleware.CurrentUserID(c)
 
 	// Get user from store
 	userStore := c.MustGet("user_store").(models.UserStore)
@@ -252,15 +542,17 @@ func (h *ChatHandler) handleChatsListPage(c *gin.Context) {
 
 	// Get popular chat rooms (rooms with most messages or active users)
 	rows, err = h.chatService.GetDB().Query(
-		`SELECT city_name, COUNT(*) as message_count 
-		FROM chat_messages 
-		WHERE created_at > NOW() - INTERVAL 24 HOUR 
-		GROUP BY city_name 
+		`SELECT m.place_id, p.name, COUNT(*) as message_count 
+		FROM chat_messages m 
+		JOIN chat_places p ON p.place_id = m.place_id 
+		WHERE m.created_at > NOW() - INTERVAL 24 HOUR 
+		GROUP BY m.place_id, p.name 
 		ORDER BY message_count DESC 
 		LIMIT 5`,
 	)
 
 	type PopularCity struct {
+		PlaceID      string
 		Name         string
 		MessageCount int
 		ActiveUsers  int
@@ -271,12 +563,12 @@ func (h *ChatHandler) handleChatsListPage(c *gin.Context) {
 		defer rows.Close()
 		for rows.Next() {
 			var city PopularCity
-			rows.Scan(&city.Name, &city.MessageCount)
+			rows.Scan(&city.PlaceID, &city.Name, &city.MessageCount)
 
 			// Get active users count
 			h.chatService.GetDB().QueryRow(
-				"SELECT COUNT(*) FROM chat_active_users WHERE city_name = ? AND last_active > NOW() - INTERVAL 10 MINUTE",
-				city.Name,
+				"SELECT COUNT(*) FROM chat_active_users WHERE place_id = ? AND last_active > NOW() - INTERVAL 10 MINUTE",
+				city.PlaceID,
 			).Scan(&city.ActiveUsers)
 
 			popularCities = append(popularCities, city)
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"weather-app/middleware"
+	"weather-app/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CustomActivityHandler handles users' own activities and their good weather windows
+type CustomActivityHandler struct {
+	activities *services.CustomActivityService
+}
+
+// NewCustomActivityHandler creates a new instance of CustomActivityHandler
+func NewCustomActivityHandler(activities *services.CustomActivityService) *CustomActivityHandler {
+	return &CustomActivityHandler{
+		activities: activities,
+	}
+}
+
+// RegisterRoutes registers custom activity routes
+func (h *CustomActivityHandler) RegisterRoutes(router *gin.Engine) {
+	activityGroup := router.Group("/api/custom-activities")
+	activityGroup.Use(middleware.AuthRequired())
+	{
+		activityGroup.GET("", h.listActivities)
+		activityGroup.POST("", h.createActivity)
+		activityGroup.PUT("/:id", h.updateActivity)
+		activityGroup.DELETE("/:id", h.deleteActivity)
+		activityGroup.GET("/:id/windows", h.getWindows)
+		activityGroup.POST("/:id/windows/:windowId/plan", h.planWindow)
+		activityGroup.DELETE("/:id/windows/:windowId/plan", h.unplanWindow)
+	}
+}
+
+// customActivityRequest is a custom activity as the user enters it; the city is looked up
+// to get its coordinates
+type customActivityRequest struct {
+	Name                 string                      `json:"name" binding:"required"`
+	Conditions           services.ActivityConditions `json:"conditions"`
+	PreferredDays        []int                       `json:"preferred_days"`
+	StartHour            int                         `json:"start_hour"`
+	EndHour              int                         `json:"end_hour"`
+	City                 string                      `json:"city" binding:"required"`
+	MinHours             int                         `json:"min_hours" binding:"required"`
+	NotificationsEnabled bool                        `json:"notifications_enabled"`
+}
+
+// listActivities handles GET requests for the user's custom activities
+func (h *CustomActivityHandler) listActivities(c *gin.Context) {
+	activities, err := h.activities.ListActivities(middleware.CurrentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load activities: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"activities": activities})
+}
+
+// createActivity handles POST requests to add a custom activity
+func (h *CustomActivityHandler) createActivity(c *gin.Context) {
+	activity, ok := h.bindActivity(c)
+	if !ok {
+		return
+	}
+
+	activity, err := h.activities.CreateActivity(activity)
+	if err != nil {
+		respondCustomActivityError(c, "Failed to save activity", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, activity)
+}
+
+// updateActivity handles PUT requests to change a custom activity
+func (h *CustomActivityHandler) updateActivity(c *gin.Context) {
+	activityID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity ID"})
+		return
+	}
+
+	activity, ok := h.bindActivity(c)
+	if !ok {
+		return
+	}
+	activity.ID = activityID
+
+	activity, err = h.activities.UpdateActivity(activity)
+	if err != nil {
+		respondCustomActivityError(c, "Failed to save activity", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, activity)
+}
+
+// deleteActivity handles DELETE requests to remove a custom activity
+func (h *CustomActivityHandler) deleteActivity(c *gin.Context) {
+	activityID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity ID"})
+		return
+	}
+
+	if err := h.activities.DeleteActivity(middleware.CurrentUserID(c), activityID); err != nil {
+		respondCustomActivityError(c, "Failed to delete activity", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// getWindows handles GET requests for an activity's qualifying windows in the coming week
+func (h *CustomActivityHandler) getWindows(c *gin.Context) {
+	activityID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity ID"})
+		return
+	}
+
+	windows, timezoneOffset, err := h.activities.RefreshWindows(middleware.CurrentUserID(c), activityID)
+	if err != nil {
+		respondCustomActivityError(c, "Failed to load windows", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"windows":         windows,
+		"timezone_offset": timezoneOffset,
+	})
+}
+
+// planWindow handles POST requests to mark a window as planned
+func (h *CustomActivityHandler) planWindow(c *gin.Context) {
+	h.setWindowPlanned(c, true)
+}
+
+// unplanWindow handles DELETE requests to unmark a planned window
+func (h *CustomActivityHandler) unplanWindow(c *gin.Context) {
+	h.setWindowPlanned(c, false)
+}
+
+// setWindowPlanned marks or unmarks the window in the request path
+func (h *CustomActivityHandler) setWindowPlanned(c *gin.Context, planned bool) {
+	activityID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid activity ID"})
+		return
+	}
+	windowID, err := strconv.Atoi(c.Param("windowId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window ID"})
+		return
+	}
+
+	if err := h.activities.SetWindowPlanned(middleware.CurrentUserID(c), activityID, windowID, planned); err != nil {
+		respondCustomActivityError(c, "Failed to update window", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "planned": planned})
+}
+
+// bindActivity reads a custom activity from the request body and looks up its city
+func (h *CustomActivityHandler) bindActivity(c *gin.Context) (services.CustomActivity, bool) {
+	var req customActivityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return services.CustomActivity{}, false
+	}
+
+	weatherData, err := services.GetCurrentWeather(req.City)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "City not found: " + req.City})
+		return services.CustomActivity{}, false
+	}
+
+	return services.CustomActivity{
+		UserID:               middleware.CurrentUserID(c),
+		Name:                 req.Name,
+		Conditions:           req.Conditions,
+		PreferredDays:        req.PreferredDays,
+		StartHour:            req.StartHour,
+		EndHour:              req.EndHour,
+		City:                 weatherData.Name,
+		Latitude:             weatherData.Coord.Lat,
+		Longitude:            weatherData.Coord.Lon,
+		MinHours:             req.MinHours,
+		NotificationsEnabled: req.NotificationsEnabled,
+	}, true
+}
+
+// respondCustomActivityError maps custom activity errors to HTTP statuses
+func respondCustomActivityError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInvalidCustomActivity):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrCustomActivityNotFound), errors.Is(err, services.ErrActivityWindowNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrTooManyCustomActivities):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": message + ": " + err.Error()})
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"weather-app/middleware"
+	"weather-app/models"
+	"weather-app/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DirectMessageHandler handles private conversations between users
+type DirectMessageHandler struct {
+	dmService     *services.DirectMessageService
+	uploadService *services.UploadService
+}
+
+// NewDirectMessageHandler creates a new instance of DirectMessageHandler
+func NewDirectMessageHandler(dmService *services.DirectMessageService, uploadService *services.UploadService) *DirectMessageHandler {
+	return &DirectMessageHandler{
+		dmService:     dmService,
+		uploadService: uploadService,
+	}
+}
+
+// RegisterRoutes registers all direct message routes
+func (h *DirectMessageHandler) RegisterRoutes(router *gin.Engine) {
+	// API routes with authentication middleware
+	dmGroup := router.Group("/api/dm")
+	dmGroup.Use(middleware.AuthRequired(models.ScopeChat))
+	{
+		dmGroup.GET("/conversations", h.getConversations)
+		dmGroup.POST("/conversations", h.startConversation)
+		dmGroup.GET("/conversations/:id/messages", h.getMessages)
+		dmGroup.POST("/conversations/:id/messages", h.postMessage)
+		dmGroup.POST("/conversations/:id/read", h.markRead)
+		dmGroup.GET("/unread", h.getUnreadCount)
+		dmGroup.GET("/blocks", h.getBlockedUsers)
+		dmGroup.POST("/blocks", h.blockUser)
+		dmGroup.DELETE("/blocks/:userID", h.unblockUser)
+	}
+
+	// Page routes with authentication middleware
+	pageGroup := router.Group("")
+	pageGroup.Use(middleware.AuthRequired())
+	{
+		pageGroup.GET("/messages", h.handleMessagesPage)
+	}
+}
+
+// getConversations handles GET requests for the user's conversation list
+func (h *DirectMessageHandler) getConversations(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+
+	conversations, err := h.dmService.ListConversations(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get conversations: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"conversations": conversations})
+}
+
+// startConversation handles POST requests to open a conversation with another user
+func (h *DirectMessageHandler) startConversation(c *gin.Context) {
+	var req struct {
+		UserID   int    `json:"user_id"`
+		Username string `json:"username"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+
+	// Resolve the other participant by ID or username
+	userStore := c.MustGet("user_store").(models.UserStore)
+	var other *models.User
+	var err error
+	switch {
+	case req.UserID != 0:
+		other, err = userStore.GetUserByID(req.UserID)
+	case strings.TrimSpace(req.Username) != "":
+		other, err = userStore.GetUserByUsername(strings.TrimSpace(req.Username))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id or username is required"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	conv, err := h.dmService.GetOrCreateConversation(userID, other.ID)
+	if err != nil {
+		c.JSON(dmErrorStatus(err), gin.H{"error": "Failed to start conversation: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, conv)
+}
+
+// getMessages handles GET requests for the messages of a conversation
+func (h *DirectMessageHandler) getMessages(c *gin.Context) {
+	conversationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+
+	messages, err := h.dmService.GetMessages(conversationID, userID, 100)
+	if err != nil {
+		c.JSON(dmErrorStatus(err), gin.H{"error": "Failed to get messages: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
+// postMessage handles POST requests to send a message in a conversation
+func (h *DirectMessageHandler) postMessage(c *gin.Context) {
+	conversationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return
+	}
+
+	var req struct {
+		Message  string `json:"message"`
+		ImageURL string `json:"image_url"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	text := strings.TrimSpace(req.Message)
+	if text == "" && req.ImageURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message cannot be empty"})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+
+	// Images must be the sender's own uploads, which are kept from now on
+	if req.ImageURL != "" {
+		if err := h.uploadService.UseChatImage(userID, req.ImageURL); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, services.ErrImageNotUploaded) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": "Failed to attach image: " + err.Error()})
+			return
+		}
+	}
+
+	msg, err := h.dmService.SendMessage(conversationID, userID, text, req.ImageURL)
+	if err != nil {
+		c.JSON(dmErrorStatus(err), gin.H{"error": "Failed to send message: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, msg)
+}
+
+// markRead handles POST requests to mark a conversation as read
+func (h *DirectMessageHandler) markRead(c *gin.Context) {
+	conversationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+
+	if err := h.dmService.MarkRead(conversationID, userID); err != nil {
+		c.JSON(dmErrorStatus(err), gin.H{"error": "Failed to mark conversation as read: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// getUnreadCount handles GET requests for the total number of unread direct messages
+func (h *DirectMessageHandler) getUnreadCount(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+
+	count, err := h.dmService.GetUnreadCount(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get unread count: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+// getBlockedUsers handles GET requests for the users the current user has blocked
+func (h *DirectMessageHandler) getBlockedUsers(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+
+	blocked, err := h.dmService.ListBlockedUsers(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get blocked users: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"blocked": blocked})
+}
+
+// blockUser handles POST requests to block another user
+func (h *DirectMessageHandler) blockUser(c *gin.Context) {
+	var req struct {
+		UserID int `json:"user_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+
+	userStore := c.MustGet("user_store").(models.UserStore)
+	if _, err := userStore.GetUserByID(req.UserID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := h.dmService.BlockUser(userID, req.UserID); err != nil {
+		c.JSON(dmErrorStatus(err), gin.H{"error": "Failed to block user: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "User blocked"})
+}
+
+// unblockUser handles DELETE requests to remove a block
+func (h *DirectMessageHandler) unblockUser(c *gin.Context) {
+	blockedID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+
+	if err := h.dmService.UnblockUser(userID, blockedID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock user: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "User unblocked"})
+}
+
+// handleMessagesPage serves the direct messages page
+func (h *DirectMessageHandler) handleMessagesPage(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+
+	userStore := c.MustGet("user_store").(models.UserStore)
+	user, err := userStore.GetUserByID(userID)
+	if err != nil {
+		c.Redirect(http.StatusSeeOther, "/logout")
+		return
+	}
+
+	// Optionally open a conversation straight away
+	conversationID, _ := strconv.Atoi(c.Query("conversation"))
+
+	c.HTML(http.StatusOK, "messages.html", gin.H{
+		"title":          "Direct Messages",
+		"User":           user,
+		"UserID":         userID,
+		"ConversationID": conversationID,
+	})
+}
+
+// dmErrorStatus maps direct message service errors to HTTP status codes
+func dmErrorStatus(err error) int {
+	switch err {
+	case services.ErrConversationNotFound:
+		return http.StatusNotFound
+	case services.ErrCannotMessageSelf:
+		return http.StatusBadRequest
+	case services.ErrUserBlocked:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
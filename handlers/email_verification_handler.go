@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"weather-app/middleware"
+	"weather-app/services"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// EmailVerificationHandler handles verification links and resend requests
+type EmailVerificationHandler struct {
+	verificationService *services.EmailVerificationService
+}
+
+// NewEmailVerificationHandler creates a new instance of EmailVerificationHandler
+func NewEmailVerificationHandler(verificationService *services.EmailVerificationService) *EmailVerificationHandler {
+	return &EmailVerificationHandler{
+		verificationService: verificationService,
+	}
+}
+
+// RegisterRoutes registers email verification routes
+func (h *EmailVerificationHandler) RegisterRoutes(router *gin.Engine) {
+	router.GET("/verify-email", h.verifyEmail)
+
+	verificationGroup := router.Group("/api/email-verification")
+	verificationGroup.Use(middleware.AuthRequired())
+	{
+		verificationGroup.POST("/resend", h.resendVerification)
+	}
+}
+
+// verifyEmail handles the link from the verification email
+func (h *EmailVerificationHandler) verifyEmail(c *gin.Context) {
+	_, err := h.verificationService.Verify(c.Query("token"))
+	if errors.Is(err, services.ErrInvalidVerificationToken) {
+		c.HTML(http.StatusBadRequest, "verify_email.html", gin.H{
+			"title": "Verify Email - Weather App",
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying email: %v", err)
+		c.HTML(http.StatusInternalServerError, "verify_email.html", gin.H{
+			"title": "Verify Email - Weather App",
+			"error": "Failed to verify your email address. Please try again.",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "verify_email.html", gin.H{
+		"title":   "Verify Email - Weather App",
+		"success": "Your email address has been verified. You'll now receive the notifications you've turned on.",
+	})
+}
+
+// resendVerification handles POST requests to send a new verification link
+func (h *EmailVerificationHandler) resendVerification(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	err := h.verificationService.SendVerification(userID)
+	switch {
+	case errors.Is(err, services.ErrEmailAlreadyVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrVerificationRateLimited):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"weather-app/middleware"
+	"weather-app/models"
+	"weather-app/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GroundReportHandler handles crowd-sourced weather reports
+type GroundReportHandler struct {
+	reportService *services.GroundReportService
+}
+
+// NewGroundReportHandler creates a new instance of GroundReportHandler
+func NewGroundReportHandler(reportService *services.GroundReportService) *GroundReportHandler {
+	return &GroundReportHandler{
+		reportService: reportService,
+	}
+}
+
+// RegisterRoutes registers ground report routes
+func (h *GroundReportHandler) RegisterRoutes(router *gin.Engine) {
+	// Reading reports is public, like the other weather APIs
+	router.GET("/api/reports/nearby", h.getNearbyReports)
+
+	reportsGroup := router.Group("/api/reports")
+	reportsGroup.Use(middleware.AuthRequired())
+	{
+		reportsGroup.POST("", h.createReport)
+	}
+}
+
+// createReport handles POST requests to submit a ground report
+func (h *GroundReportHandler) createReport(c *gin.Context) {
+	var req struct {
+		Condition string   `json:"condition" binding:"required"`
+		Intensity int      `json:"intensity" binding:"required"`
+		Note      string   `json:"note"`
+		PhotoURL  string   `json:"photo_url"`
+		Latitude  *float64 `json:"latitude" binding:"required"`
+		Longitude *float64 `json:"longitude" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	userID := middleware.CurrentUserID(c)
+
+	report, err := h.reportService.CreateReport(models.GroundReport{
+		UserID:    userID,
+		Condition: req.Condition,
+		Intensity: req.Intensity,
+		Note:      req.Note,
+		PhotoURL:  req.PhotoURL,
+		Latitude:  *req.Latitude,
+		Longitude: *req.Longitude,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrInvalidReport):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrReportRateLimited):
+			status = http.StatusTooManyRequests
+		}
+		c.JSON(status, gin.H{"error": "Failed to save report: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// getNearbyReports handles GET requests for reports aggregated around a location
+func (h *GroundReportHandler) getNearbyReports(c *gin.Context) {
+	lat, err := strconv.ParseFloat(c.Query("lat"), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid latitude value"})
+		return
+	}
+
+	lon, err := strconv.ParseFloat(c.Query("lon"), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid longitude value"})
+		return
+	}
+
+	// Default to a 25 km radius over the last 3 hours
+	radiusKm, err := strconv.ParseFloat(c.DefaultQuery("radius_km", "25"), 64)
+	if err != nil || !services.ValidReportRadius(radiusKm) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "radius_km must be between 0 and 200"})
+		return
+	}
+
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "3"))
+	if err != nil || hours < 1 || hours > 48 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hours must be between 1 and 48"})
+		return
+	}
+	window := time.Duration(hours) * time.Hour
+
+	areas, err := h.reportService.AggregateReports(lat, lon, radiusKm, window)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidReport) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": "Failed to get reports: " + err.Error()})
+		return
+	}
+
+	total := 0
+	for _, area := range areas {
+		total += area.Count
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"areas":         areas,
+		"total_reports": total,
+		"radius_km":     radiusKm,
+		"hours":         hours,
+	})
+}
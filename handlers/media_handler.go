@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"weather-app/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SignedMediaURLExpiry is how long redirect URLs handed out for media stay valid
+const SignedMediaURLExpiry = time.Hour
+
+// MediaHandler serves uploaded files from the blob store under /media
+type MediaHandler struct {
+	store services.BlobStore
+	proxy bool
+}
+
+// NewMediaHandler creates a new media handler. When proxy is false, clients are redirected
+// to the store's public or signed URL where it has one; otherwise files are streamed by the app.
+func NewMediaHandler(store services.BlobStore, proxy bool) *MediaHandler {
+	return &MediaHandler{
+		store: store,
+		proxy: proxy,
+	}
+}
+
+// RegisterRoutes registers media routes
+func (h *MediaHandler) RegisterRoutes(router *gin.Engine) {
+	router.GET("/media/*key", h.serveMedia)
+	router.HEAD("/media/*key", h.serveMedia)
+}
+
+// serveMedia redirects to or streams a stored file
+func (h *MediaHandler) serveMedia(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	if !h.proxy {
+		url, err := h.store.DirectURL(key, SignedMediaURLExpiry)
+		if errors.Is(err, services.ErrInvalidBlobKey) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Error creating media URL for %s: %v", key, err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		if url != "" {
+			// Signed URLs expire, so the redirect must not outlive them
+			c.Header("Cache-Control", "private, max-age=300")
+			c.Redirect(http.StatusFound, url)
+			return
+		}
+	}
+
+	body, contentType, err := h.store.Open(key)
+	if errors.Is(err, services.ErrBlobNotFound) || errors.Is(err, services.ErrInvalidBlobKey) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening media %s: %v", key, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	// Keys are random and never rewritten, so files can be cached for good
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	if c.Request.Method != http.MethodHead {
+		io.Copy(c.Writer, body)
+	}
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"weather-app/middleware"
+	"weather-app/services"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// Session keys that carry an OpenID Connect sign-in across the redirect to the provider
+const (
+	oidcStateKey      = "oidc_state"
+	oidcNonceKey      = "oidc_nonce"
+	oidcVerifierKey   = "oidc_verifier"
+	oidcLinkUserKey   = "oidc_link_user_id"
+	oidcReauthKey     = "oidc_reauthenticate"
+	oidcStartedKey    = "oidc_started_at"
+	oidcFlowDeadline  = 10 * time.Minute
+	oidcCallbackRoute = "/auth/oidc/callback"
+)
+
+// OIDCHandler handles single sign-on with an OpenID Connect identity provider
+type OIDCHandler struct {
+	provider      *services.OIDCProvider
+	sso           *services.SSOService
+	loginSecurity *services.LoginSecurityService
+	twoFactor     *services.TwoFactorService
+}
+
+// NewOIDCHandler creates a new instance of OIDCHandler
+func NewOIDCHandler(provider *services.OIDCProvider, sso *services.SSOService, loginSecurity *services.LoginSecurityService, twoFactor *services.TwoFactorService) *OIDCHandler {
+	return &OIDCHandler{
+		provider:      provider,
+		sso:           sso,
+		loginSecurity: loginSecurity,
+		twoFactor:     twoFactor,
+	}
+}
+
+// RegisterRoutes registers single sign-on routes
+func (h *OIDCHandler) RegisterRoutes(router *gin.Engine) {
+	router.GET("/auth/oidc/login", middleware.RedirectIfLoggedIn(), h.startLogin)
+	router.POST("/auth/oidc/link", middleware.AuthRequired(), h.startLink)
+	router.POST("/auth/oidc/reauthenticate", middleware.AuthRequired(), h.startReauthentication)
+	router.GET(oidcCallbackRoute, h.callback)
+
+	identityGroup := router.Group("/api/sso/identities")
+	identityGroup.Use(middleware.AuthRequired())
+	{
+		identityGroup.GET("", h.listIdentities)
+		identityGroup.DELETE("/:id", h.unlinkIdentity)
+	}
+}
+
+// startLogin handles GET requests that send the visitor to the identity provider to sign in
+func (h *OIDCHandler) startLogin(c *gin.Context) {
+	h.redirectToProvider(c, 0, false)
+}
+
+// startLink handles POST requests from the profile page to link the provider account
+func (h *OIDCHandler) startLink(c *gin.Context) {
+	h.redirectToProvider(c, sessions.Default(c).Get("user_id").(int), false)
+}
+
+// startReauthentication handles POST requests from the profile page to confirm the user's
+// identity with the provider, for users who have no password to confirm a deletion with
+func (h *OIDCHandler) startReauthentication(c *gin.Context) {
+	h.redirectToProvider(c, sessions.Default(c).Get("user_id").(int), true)
+}
+
+// redirectToProvider remembers the state, nonce and PKCE verifier in the session and
+// redirects to the provider. linkUserID is 0 for sign-ins; with reauthenticate the flow
+// confirms that user's identity instead of linking it.
+func (h *OIDCHandler) redirectToProvider(c *gin.Context, linkUserID int, reauthenticate bool) {
+	state := services.NewOIDCNonce()
+	nonce := services.NewOIDCNonce()
+	verifier := services.NewPKCEVerifier()
+
+	authURL, err := h.provider.AuthCodeURL(state, nonce, verifier, reauthenticate)
+	if err != nil {
+		log.Printf("Error starting SSO sign-in: %v", err)
+		h.fail(c, linkUserID, "Single sign-on is not available right now. Please try again later.")
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set(oidcStateKey, state)
+	session.Set(oidcNonceKey, nonce)
+	session.Set(oidcVerifierKey, verifier)
+	session.Set(oidcLinkUserKey, linkUserID)
+	session.Set(oidcReauthKey, reauthenticate)
+	session.Set(oidcStartedKey, time.Now().Unix())
+	if err := session.Save(); err != nil {
+		log.Printf("Error saving session: %v", err)
+		h.fail(c, linkUserID, "Failed to start single sign-on. Please try again.")
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// callback handles the provider's redirect back with an authorization code
+func (h *OIDCHandler) callback(c *gin.Context) {
+	session := sessions.Default(c)
+	state, _ := session.Get(oidcStateKey).(string)
+	nonce, _ := session.Get(oidcNonceKey).(string)
+	verifier, _ := session.Get(oidcVerifierKey).(string)
+	linkUserID, _ := session.Get(oidcLinkUserKey).(int)
+	reauthenticate, _ := session.Get(oidcReauthKey).(bool)
+	startedAt, _ := session.Get(oidcStartedKey).(int64)
+
+	// The flow can only be completed once
+	session.Delete(oidcStateKey)
+	session.Delete(oidcNonceKey)
+	session.Delete(oidcVerifierKey)
+	session.Delete(oidcLinkUserKey)
+	session.Delete(oidcReauthKey)
+	session.Delete(oidcStartedKey)
+	session.Save()
+
+	if state == "" || c.Query("state") != state || time.Since(time.Unix(startedAt, 0)) > oidcFlowDeadline {
+		h.fail(c, linkUserID, "Your single sign-on request expired. Please try again.")
+		return
+	}
+	if providerErr := c.Query("error"); providerErr != "" {
+		log.Printf("SSO provider returned error: %s", providerErr)
+		h.fail(c, linkUserID, "Sign-in was cancelled or denied by "+h.provider.Name()+".")
+		return
+	}
+
+	claims, err := h.provider.Exchange(c.Query("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("Error completing SSO sign-in: %v", err)
+		h.fail(c, linkUserID, "Could not verify your sign-in with "+h.provider.Name()+". Please try again.")
+		return
+	}
+
+	if linkUserID != 0 && reauthenticate {
+		h.completeReauthentication(c, linkUserID, claims)
+		return
+	}
+	if linkUserID != 0 {
+		h.completeLink(c, linkUserID, claims)
+		return
+	}
+	h.completeLogin(c, claims)
+}
+
+// completeLink links the verified identity to the user who started the flow
+func (h *OIDCHandler) completeLink(c *gin.Context, linkUserID int, claims *services.OIDCClaims) {
+	// The user must still be signed in as the account that asked for the link
+	if userID, ok := sessions.Default(c).Get("user_id").(int); !ok || userID != linkUserID {
+		c.Redirect(http.StatusFound, "/login")
+		return
+	}
+
+	err := h.sso.Link(linkUserID, claims)
+	if errors.Is(err, services.ErrSSOIdentityInUse) || errors.Is(err, services.ErrSSOAlreadyLinked) {
+		h.fail(c, linkUserID, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error linking SSO identity: %v", err)
+		h.fail(c, linkUserID, "Failed to link your "+h.provider.Name()+" account.")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/profile?success="+url.QueryEscape("Your "+h.provider.Name()+" account is now linked."))
+}
+
+// completeReauthentication records that the signed-in user just proved their identity with
+// the provider, which lets them confirm an account deletion without a password
+func (h *OIDCHandler) completeReauthentication(c *gin.Context, userID int, claims *services.OIDCClaims) {
+	session := sessions.Default(c)
+	if current, ok := session.Get("user_id").(int); !ok || current != userID {
+		c.Redirect(http.StatusFound, "/login")
+		return
+	}
+
+	linked, err := h.sso.IsLinked(userID, claims)
+	if err != nil {
+		log.Printf("Error checking SSO identity: %v", err)
+		h.fail(c, userID, "Failed to confirm your identity. Please try again.")
+		return
+	}
+	if !linked {
+		h.fail(c, userID, "Please sign in with the "+h.provider.Name()+" account linked to this profile.")
+		return
+	}
+
+	// Providers that report when the user authenticated must have just asked them
+	if !claims.AuthTime.IsZero() && time.Since(claims.AuthTime) > reauthenticationWindow {
+		h.fail(c, userID, h.provider.Name()+" didn't ask you to sign in again. Please try again.")
+		return
+	}
+
+	session.Set(reauthenticatedAtKey, time.Now().Unix())
+	if err := session.Save(); err != nil {
+		log.Printf("Error saving session: %v", err)
+		h.fail(c, userID, "Failed to confirm your identity. Please try again.")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/profile?success="+url.QueryEscape("Identity confirmed. You can now delete your account without a password."))
+}
+
+// completeLogin signs in the account for the verified identity, asking for a two-factor
+// code first when the account has it turned on
+func (h *OIDCHandler) completeLogin(c *gin.Context, claims *services.OIDCClaims) {
+	userID, err := h.sso.SignIn(claims)
+	if errors.Is(err, services.ErrSSOEmailNotVerified) || errors.Is(err, services.ErrSSOAccountNotLinked) ||
+		errors.Is(err, services.ErrAccountDisabled) {
+		h.fail(c, 0, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error signing in with SSO: %v", err)
+		h.fail(c, 0, "Failed to sign in. Please try again.")
+		return
+	}
+
+	session := sessions.Default(c)
+
+	twoFactorEnabled, err := h.twoFactor.IsEnabled(userID)
+	if err != nil {
+		log.Printf("Error checking two-factor authentication: %v", err)
+		h.fail(c, 0, "Failed to sign in. Please try again.")
+		return
+	}
+	if twoFactorEnabled {
+		session.Delete("user_id")
+		session.Set(middleware.TwoFactorPendingKey, userID)
+		session.Set(twoFactorStartedKey, time.Now().Unix())
+		if err := session.Save(); err != nil {
+			log.Printf("Error saving session: %v", err)
+		}
+		c.Redirect(http.StatusSeeOther, "/login/2fa")
+		return
+	}
+
+	log.Printf("SSO login successful: ID=%d", userID)
+	if err := h.loginSecurity.RecordSuccess(userID, c.RemoteIP(), c.Request.UserAgent()); err != nil {
+		log.Printf("Error recording sign-in: %v", err)
+	}
+
+	session.Set("user_id", userID)
+	if err := session.Save(); err != nil {
+		log.Printf("Error saving session: %v", err)
+		h.fail(c, 0, "Failed to create session. Please try again.")
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/")
+}
+
+// fail shows an error on the login page, or on the profile page when linking
+func (h *OIDCHandler) fail(c *gin.Context, linkUserID int, message string) {
+	if linkUserID != 0 {
+		c.Redirect(http.StatusSeeOther, "/profile?error="+url.QueryEscape(message))
+		return
+	}
+	c.HTML(http.StatusUnauthorized, "login.html", gin.H{
+		"title":     "Login - Weather App",
+		"csrfToken": middleware.CSRFToken(c),
+		"error":     message,
+	})
+}
+
+// listIdentities handles GET requests for the user's linked identities
+func (h *OIDCHandler) listIdentities(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	identities, err := h.sso.ListIdentities(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list linked accounts: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"identities": identities,
+		"provider":   gin.H{"name": h.provider.Name(), "issuer": h.provider.Issuer()},
+	})
+}
+
+// unlinkIdentity handles DELETE requests for one of the user's linked identities
+func (h *OIDCHandler) unlinkIdentity(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	identityID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identity ID"})
+		return
+	}
+
+	err = h.sso.Unlink(userID, identityID)
+	if errors.Is(err, services.ErrSSOIdentityNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink account: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
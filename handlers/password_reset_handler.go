@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"weather-app/middleware"
+	"weather-app/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// forgotPasswordMessage is shown after every reset request so it does not reveal whether an account exists
+const forgotPasswordMessage = "If an account exists for that email address, we've sent a link to reset your password."
+
+// PasswordResetHandler handles the forgot password and reset password pages
+type PasswordResetHandler struct {
+	resetService *services.PasswordResetService
+}
+
+// NewPasswordResetHandler creates a new instance of PasswordResetHandler
+func NewPasswordResetHandler(resetService *services.PasswordResetService) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		resetService: resetService,
+	}
+}
+
+// RegisterRoutes registers password reset routes
+func (h *PasswordResetHandler) RegisterRoutes(router *gin.Engine) {
+	router.GET("/forgot-password", h.getForgotPassword)
+	router.POST("/forgot-password", h.postForgotPassword)
+	router.GET("/reset-password", h.getResetPassword)
+	router.POST("/reset-password", h.postResetPassword)
+}
+
+// getForgotPassword displays the form to request a reset link
+func (h *PasswordResetHandler) getForgotPassword(c *gin.Context) {
+	c.HTML(http.StatusOK, "forgot_password.html", gin.H{
+		"title":     "Forgot Password - Weather App",
+		"csrfToken": middleware.CSRFToken(c),
+	})
+}
+
+// postForgotPassword sends a reset link and always shows the same confirmation
+func (h *PasswordResetHandler) postForgotPassword(c *gin.Context) {
+	email := strings.TrimSpace(c.PostForm("email"))
+	if email == "" {
+		c.HTML(http.StatusBadRequest, "forgot_password.html", gin.H{
+			"title":     "Forgot Password - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     "Please enter your email address",
+		})
+		return
+	}
+
+	if err := h.resetService.RequestReset(email); err != nil {
+		log.Printf("Error requesting password reset: %v", err)
+	}
+
+	c.HTML(http.StatusOK, "forgot_password.html", gin.H{
+		"title":     "Forgot Password - Weather App",
+		"csrfToken": middleware.CSRFToken(c),
+		"success":   forgotPasswordMessage,
+	})
+}
+
+// getResetPassword displays the form to choose a new password
+func (h *PasswordResetHandler) getResetPassword(c *gin.Context) {
+	token := c.Query("token")
+	if !h.resetService.ValidToken(token) {
+		c.HTML(http.StatusBadRequest, "reset_password.html", gin.H{
+			"title":     "Reset Password - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     services.ErrInvalidResetToken.Error(),
+			"expired":   true,
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "reset_password.html", gin.H{
+		"title":     "Reset Password - Weather App",
+		"csrfToken": middleware.CSRFToken(c),
+		"token":     token,
+	})
+}
+
+// postResetPassword sets the new password and sends the user to the login page
+func (h *PasswordResetHandler) postResetPassword(c *gin.Context) {
+	token := c.PostForm("token")
+	password := c.PostForm("password")
+
+	if password != c.PostForm("confirm_password") {
+		c.HTML(http.StatusBadRequest, "reset_password.html", gin.H{
+			"title":     "Reset Password - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"token":     token,
+			"error":     "Passwords do not match",
+		})
+		return
+	}
+
+	err := h.resetService.ResetPassword(token, password)
+	switch {
+	case errors.Is(err, services.ErrWeakPassword):
+		c.HTML(http.StatusBadRequest, "reset_password.html", gin.H{
+			"title":     "Reset Password - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"token":     token,
+			"error":     err.Error(),
+		})
+		return
+	case errors.Is(err, services.ErrInvalidResetToken):
+		c.HTML(http.StatusBadRequest, "reset_password.html", gin.H{
+			"title":     "Reset Password - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"error":     err.Error(),
+			"expired":   true,
+		})
+		return
+	case err != nil:
+		log.Printf("Error resetting password: %v", err)
+		c.HTML(http.StatusInternalServerError, "reset_password.html", gin.H{
+			"title":     "Reset Password - Weather App",
+			"csrfToken": middleware.CSRFToken(c),
+			"token":     token,
+			"error":     "Failed to reset password. Please try again.",
+		})
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/login?reset=success")
+}
@@ -4,8 +4,8 @@ import (
 	"database/sql" // Add this import
 	"net/http"
 	"weather-app/middleware"
+	"weather-app/models"
 
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
@@ -25,19 +25,18 @@ func NewSavedCitiesHandler(db *sql.DB) *SavedCitiesHandler {
 func (h *SavedCitiesHandler) RegisterRoutes(router *gin.Engine) {
 	// API routes with authentication middleware
 	citiesGroup := router.Group("/api/cities")
-	citiesGroup.Use(middleware.AuthRequired())
+	citiesGroup.Use(middleware.AuthRequired(models.ScopeReadWeather, models.ScopeWriteCities))
 	{
-		citiesGroup.GET("/saved", h.getSavedCities)
-		citiesGroup.POST("/save", h.saveCity)
-		citiesGroup.DELETE("/remove", h.removeCity)
+		citiesGroup.GET("/saved", middleware.RequireScope(models.ScopeReadWeather), h.getSavedCities)
+		citiesGroup.POST("/save", middleware.RequireScope(models.ScopeWriteCities), h.saveCity)
+		citiesGroup.DELETE("/remove", middleware.RequireScope(models.ScopeWriteCities), h.removeCity)
 	}
 }
 
 // getSavedCities handles GET requests to retrieve a user's saved cities
 func (h *SavedCitiesHandler) getSavedCities(c *gin.Context) {
-	// Get user ID from session
-	session := sessions.Default(c)
-	userID := session.Get("user_id").(int)
+	// Get user ID from the session or API token
+	userID := middleware.CurrentUserID(c)
 
 	// Query database for saved cities
 	rows, err := h.db.Query(
@@ -77,9 +76,8 @@ func (h *SavedCitiesHandler) saveCity(c *gin.Context) {
 		return
 	}
 
-	// Get user ID from session
-	session := sessions.Default(c)
-	userID := session.Get("user_id").(int)
+	// Get user ID from the session or API token
+	userID := middleware.CurrentUserID(c)
 
 	// Insert into database, ignoring if already exists
 	_, err := h.db.Exec(
@@ -108,9 +106,8 @@ func (h *SavedCitiesHandler) removeCity(c *gin.Context) {
 		return
 	}
 
-	// Get user ID from session
-	session := sessions.Default(c)
-	userID := session.Get("user_id").(int)
+	// Get user ID from the session or API token
+	userID := middleware.CurrentUserID(c)
 
 	// Delete from database
 	_, err := h.db.Exec(
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"weather-app/middleware"
+	"weather-app/services"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// securityEventsLimit is how many events the profile security log shows
+const securityEventsLimit = 50
+
+// SecurityHandler serves the user's sign-in history
+type SecurityHandler struct {
+	loginSecurity *services.LoginSecurityService
+}
+
+// NewSecurityHandler creates a new instance of SecurityHandler
+func NewSecurityHandler(loginSecurity *services.LoginSecurityService) *SecurityHandler {
+	return &SecurityHandler{
+		loginSecurity: loginSecurity,
+	}
+}
+
+// RegisterRoutes registers security log routes
+func (h *SecurityHandler) RegisterRoutes(router *gin.Engine) {
+	securityGroup := router.Group("/api/security")
+	securityGroup.Use(middleware.AuthRequired())
+	{
+		securityGroup.GET("/events", h.listEvents)
+	}
+}
+
+// listEvents handles GET requests for the user's recent sign-in events
+func (h *SecurityHandler) listEvents(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	events, err := h.loginSecurity.ListEvents(userID, securityEventsLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list security events: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
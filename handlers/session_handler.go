@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"weather-app/middleware"
+	"weather-app/services"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// SessionHandler lets users see and revoke the devices they are signed in on
+type SessionHandler struct {
+	sessionStore *services.SessionStore
+}
+
+// NewSessionHandler creates a new instance of SessionHandler
+func NewSessionHandler(sessionStore *services.SessionStore) *SessionHandler {
+	return &SessionHandler{
+		sessionStore: sessionStore,
+	}
+}
+
+// RegisterRoutes registers session management routes
+func (h *SessionHandler) RegisterRoutes(router *gin.Engine) {
+	sessionsGroup := router.Group("/api/sessions")
+	sessionsGroup.Use(middleware.AuthRequired())
+	{
+		sessionsGroup.GET("", h.listSessions)
+		sessionsGroup.DELETE("/:id", h.revokeSession)
+		sessionsGroup.POST("/revoke-others", h.revokeOtherSessions)
+	}
+}
+
+// listSessions handles GET requests for the user's active sessions
+func (h *SessionHandler) listSessions(c *gin.Context) {
+	session := sessions.Default(c)
+	userID := session.Get("user_id").(int)
+
+	list, err := h.sessionStore.ListSessions(userID, session.ID())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": list})
+}
+
+// revokeSession handles DELETE requests to sign out one session
+func (h *SessionHandler) revokeSession(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	err := h.sessionStore.RevokeSession(userID, c.Param("id"))
+	if errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// revokeOtherSessions handles POST requests to sign out every other device
+func (h *SessionHandler) revokeOtherSessions(c *gin.Context) {
+	session := sessions.Default(c)
+	userID := session.Get("user_id").(int)
+
+	revoked, err := h.sessionStore.RevokeOtherSessions(userID, session.ID())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "revoked": revoked})
+}
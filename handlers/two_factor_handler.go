@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"weather-app/middleware"
+	"weather-app/services"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorHandler lets users turn TOTP two-factor authentication on and off
+type TwoFactorHandler struct {
+	twoFactor     *services.TwoFactorService
+	loginSecurity *services.LoginSecurityService
+}
+
+// NewTwoFactorHandler creates a new instance of TwoFactorHandler
+func NewTwoFactorHandler(twoFactor *services.TwoFactorService, loginSecurity *services.LoginSecurityService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactor:     twoFactor,
+		loginSecurity: loginSecurity,
+	}
+}
+
+// RegisterRoutes registers two-factor authentication routes
+func (h *TwoFactorHandler) RegisterRoutes(router *gin.Engine) {
+	twoFactorGroup := router.Group("/api/2fa")
+	twoFactorGroup.Use(middleware.AuthRequired())
+	{
+		twoFactorGroup.GET("/status", h.getStatus)
+		twoFactorGroup.POST("/setup", h.startSetup)
+		twoFactorGroup.POST("/enable", h.enable)
+		twoFactorGroup.POST("/disable", h.disable)
+	}
+}
+
+// twoFactorCodeRequest is the body of enable and disable requests
+type twoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// getStatus handles GET requests for the user's two-factor status
+func (h *TwoFactorHandler) getStatus(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	status, err := h.twoFactor.Status(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get two-factor status: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// startSetup handles POST requests to create a new secret for the authenticator app
+func (h *TwoFactorHandler) startSetup(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	secret, uri, err := h.twoFactor.StartEnrollment(userID)
+	if errors.Is(err, services.ErrTwoFactorEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor setup: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "provisioning_uri": uri})
+}
+
+// enable handles POST requests confirming the first code, and returns the recovery codes
+func (h *TwoFactorHandler) enable(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	codes, err := h.twoFactor.ConfirmEnrollment(userID, req.Code)
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrTwoFactorNotEnrolling), errors.Is(err, services.ErrTwoFactorEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "recovery_codes": codes})
+}
+
+// disable handles POST requests to turn two-factor authentication off with a valid code.
+// Wrong codes count as failed sign-ins so the code cannot be guessed from a stolen session.
+func (h *TwoFactorHandler) disable(c *gin.Context) {
+	userID := sessions.Default(c).Get("user_id").(int)
+
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	wait, err := h.loginSecurity.CheckAllowed(userID, c.RemoteIP())
+	if errors.Is(err, services.ErrAccountLocked) || errors.Is(err, services.ErrLoginThrottled) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("Too many failed attempts. Please wait %s and try again.", formatWait(wait))})
+		return
+	}
+
+	err = h.twoFactor.Disable(userID, req.Code)
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		h.loginSecurity.RecordFailure(userID, c.RemoteIP(), c.Request.UserAgent())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrTwoFactorNotEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
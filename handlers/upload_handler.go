@@ -1,123 +1,202 @@
 package handlers
 
 import (
-	"crypto/rand"
-	"encoding/hex"
-	"io"
+	"errors"
+	"image"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
+	"strconv"
 	"weather-app/middleware"
+	"weather-app/models"
+	"weather-app/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 // UploadHandler handles file uploads
 type UploadHandler struct {
-	uploadDir string
+	uploadService *services.UploadService
 }
 
 // NewUploadHandler creates a new upload handler
-func NewUploadHandler(uploadDir string) *UploadHandler {
-	// Create upload directory if it doesn't exist
-	os.MkdirAll(filepath.Join(uploadDir, "chat_images"), 0755)
-
+func NewUploadHandler(uploadService *services.UploadService) *UploadHandler {
 	return &UploadHandler{
-		uploadDir: uploadDir,
+		uploadService: uploadService,
 	}
 }
 
 // RegisterRoutes registers upload-related routes
 func (h *UploadHandler) RegisterRoutes(router *gin.Engine) {
 	uploadGroup := router.Group("/api/upload")
-	uploadGroup.Use(middleware.AuthRequired())
+	uploadGroup.Use(middleware.AuthRequired(models.ScopeChat))
 	{
 		uploadGroup.POST("/image", h.handleImageUpload)
+		uploadGroup.GET("/usage", h.getUsage)
+	}
+
+	// Profile photos can only be changed from the browser
+	profilePhotoGroup := router.Group("/api/upload/profile-photo")
+	profilePhotoGroup.Use(middleware.AuthRequired())
+	{
+		profilePhotoGroup.POST("", h.handleProfilePhotoUpload)
+		profilePhotoGroup.DELETE("", h.removeProfilePhoto)
 	}
 }
 
-// handleImageUpload processes image uploads
+// handleImageUpload decodes an uploaded image, re-encodes it without metadata and
+// stores the original, medium and thumbnail variants
 func (h *UploadHandler) handleImageUpload(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+
+	// Reject oversized bodies before parsing the form
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MaxImageUploadBytes+1024*1024)
+
 	// Get the file from the request
-	file, header, err := c.Request.FormFile("image")
+	file, _, err := c.Request.FormFile("image")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file: " + err.Error()})
 		return
 	}
 	defer file.Close()
 
-	// Check if the file is an image
-	if !isImageFile(header.Filename) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only image files are allowed"})
+	// Decode and re-encode the image; the file name and reported size are not trusted
+	processed, err := services.ProcessImage(file)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrNotAnImage):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrImageTooLarge), errors.Is(err, services.ErrImageDimensions):
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": "Failed to process image: " + err.Error()})
 		return
 	}
 
-	// Check file size (limit to 5MB)
-	if header.Size > 5*1024*1024 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File size should be less than 5MB"})
+	// Store the variants for chat use, enforcing quotas; profile photos have their own endpoint
+	upload, err := h.uploadService.SaveImage(userID, c.PostForm("purpose"), processed)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrUploadPurpose):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrDailyUploadQuota):
+			status = http.StatusTooManyRequests
+		case errors.Is(err, services.ErrUploadQuota):
+			status = http.StatusInsufficientStorage
+		}
+		c.JSON(status, gin.H{"error": "Failed to save file: " + err.Error()})
 		return
 	}
 
-	// Generate a unique filename
-	filename := generateUniqueFilename(header.Filename)
+	// Return the file URLs
+	c.JSON(http.StatusOK, gin.H{
+		"id":     upload.ID,
+		"url":    upload.URL,
+		"urls":   upload.URLs,
+		"width":  upload.Width,
+		"height": upload.Height,
+	})
+}
 
-	// Get upload purpose (chat, profile, etc.)
-	purpose := c.PostForm("purpose")
-	if purpose == "" {
-		purpose = "misc"
+// handleProfilePhotoUpload crops an uploaded photo to the square given by crop_x, crop_y and
+// crop_size, stores it in the user's folder and makes it their profile photo
+func (h *UploadHandler) handleProfilePhotoUpload(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MaxImageUploadBytes+1024*1024)
+
+	file, _, err := c.Request.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file: " + err.Error()})
+		return
 	}
+	defer file.Close()
 
-	// Determine the directory based on purpose
-	var uploadPath string
-	switch purpose {
-	case "chat":
-		uploadPath = filepath.Join(h.uploadDir, "chat_images", filename)
-	case "profile":
-		uploadPath = filepath.Join(h.uploadDir, "profile_photos", filename)
-	default:
-		uploadPath = filepath.Join(h.uploadDir, "misc", filename)
+	// Without a crop the largest centred square is used
+	var crop image.Rectangle
+	if c.PostForm("crop_size") != "" {
+		x, errX := strconv.Atoi(c.PostForm("crop_x"))
+		y, errY := strconv.Atoi(c.PostForm("crop_y"))
+		size, errSize := strconv.Atoi(c.PostForm("crop_size"))
+		if errX != nil || errY != nil || errSize != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid crop area"})
+			return
+		}
+		crop = image.Rect(x, y, x+size, y+size)
 	}
 
-	// Create a new file
-	dst, err := os.Create(uploadPath)
+	processed, err := services.ProcessProfilePhoto(file, crop)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create file: " + err.Error()})
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrNotAnImage), errors.Is(err, services.ErrInvalidCrop):
+			status = http.StatusBadRequest
+		case errors.Is(err, services.ErrImageTooLarge), errors.Is(err, services.ErrImageDimensions):
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": "Failed to process image: " + err.Error()})
 		return
 	}
-	defer dst.Close()
 
-	// Copy the file
-	if _, err := io.Copy(dst, file); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file: " + err.Error()})
+	upload, err := h.uploadService.SaveProfilePhoto(userID, processed)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrDailyUploadQuota):
+			status = http.StatusTooManyRequests
+		case errors.Is(err, services.ErrUploadQuota):
+			status = http.StatusInsufficientStorage
+		}
+		c.JSON(status, gin.H{"error": "Failed to save file: " + err.Error()})
 		return
 	}
 
-	// Determine the URL path
-	var urlPath string
-	switch purpose {
-	case "chat":
-		urlPath = "/static/chat_images/" + filename
-	case "profile":
-		urlPath = "/static/profile_photos/" + filename
-	default:
-		urlPath = "/static/misc/" + filename
+	if err := h.uploadService.SetProfilePhoto(userID, upload.URL); err != nil {
+		h.uploadService.DeleteUpload(userID, upload.URL)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile photo: " + err.Error()})
+		return
 	}
 
-	// Return the file URL
-	c.JSON(http.StatusOK, gin.H{"url": urlPath})
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"profile_photo": upload.URL,
+		"urls":          upload.URLs,
+	})
 }
 
-// isImageFile checks if a filename has an image extension
-func isImageFile(filename string) bool {
-	ext := strings.ToLower(filepath.Ext(filename))
-	return ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".gif"
+// removeProfilePhoto deletes the user's uploaded profile photo and switches back to the default avatar
+func (h *UploadHandler) removeProfilePhoto(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+
+	userStore := c.MustGet("user_store").(models.UserStore)
+	user, err := userStore.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user data"})
+		return
+	}
+
+	if !models.IsCustomProfilePhoto(userID, user.ProfilePhoto) {
+		c.JSON(http.StatusOK, gin.H{"success": true, "profile_photo": user.ProfilePhoto})
+		return
+	}
+
+	if err := h.uploadService.SetProfilePhoto(userID, "default.jpg"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile photo: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "profile_photo": "default.jpg"})
 }
 
-// generateUniqueFilename creates a unique filename
-func generateUniqueFilename(originalFilename string) string {
-	ext := filepath.Ext(originalFilename)
-	randomBytes := make([]byte, 16)
-	rand.Read(randomBytes)
-	return hex.EncodeToString(randomBytes) + ext
+// getUsage handles GET requests for the current user's upload quota usage
+func (h *UploadHandler) getUsage(c *gin.Context) {
+	userID := middleware.CurrentUserID(c)
+
+	usage, err := h.uploadService.GetUsage(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get upload usage: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
 }
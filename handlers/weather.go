@@ -632,6 +632,17 @@ func (h *WeatherHandler) GetWeather(c *gin.Context) {
 		User:          user,
 	}
 
+	if user != nil {
+		h.recordActivity(models.Activity{
+			UserID:    user.ID,
+			Type:      models.ActivityTypeWeatherSearch,
+			City:      currentWeather.Name,
+			Latitude:  currentWeather.Coord.Lat,
+			Longitude: currentWeather.Coord.Lon,
+			Details:   city,
+		})
+	}
+
 	// Render the weather template with the response data
 	c.HTML(http.StatusOK, "weather.html", response)
 }
@@ -740,6 +751,22 @@ func (h *WeatherHandler) GetCompare(c *gin.Context) {
 	// Wait for all requests to complete
 	wg.Wait()
 
+	// Record a view of every compared city
+	if user != nil {
+		names := make([]string, len(response.Cities))
+		for i, city := range response.Cities {
+			names[i] = city.Name
+		}
+		for _, name := range names {
+			h.recordActivity(models.Activity{
+				UserID:  user.ID,
+				Type:    models.ActivityTypeComparison,
+				City:    name,
+				Details: strings.Join(names, ", "),
+			})
+		}
+	}
+
 	// Check if we have any cities in the response
 	if len(response.Cities) == 0 && len(response.Errors) > 0 {
 		// All cities failed, show a general error
@@ -1036,35 +1063,38 @@ func (h *WeatherHandler) GetHistoricalComparison(c *gin.Context) {
 			return
 		}
 
-		// Record this activity
-		activity := models.Activity{
-			UserID:    user.ID,
-			Type:      "HISTORICAL_COMPARISON",
-			Latitude:  lat,
-			Longitude: lon,
-			Timestamp: time.Now(),
-		}
-
-		if err := h.activityService.RecordActivity(activity); err != nil {
-			h.logger.Printf("Failed to record historical comparison activity: %v", err)
-		}
+		h.recordHistoricalComparison(c, user.ID, lat, lon)
 
 		c.JSON(http.StatusOK, fallbackData)
 		return
 	}
 
-	// Record this activity
-	activity := models.Activity{
-		UserID:    user.ID,
-		Type:      "HISTORICAL_COMPARISON",
+	h.recordHistoricalComparison(c, user.ID, lat, lon)
+
+	c.JSON(http.StatusOK, historicalData)
+}
+
+// recordHistoricalComparison records a historical comparison, using the location name the
+// page sends along with the coordinates
+func (h *WeatherHandler) recordHistoricalComparison(c *gin.Context, userID int, lat, lon float64) {
+	city := c.Query("city")
+	if city == "Unknown Location" {
+		city = ""
+	}
+
+	h.recordActivity(models.Activity{
+		UserID:    userID,
+		Type:      models.ActivityTypeHistorical,
+		City:      city,
 		Latitude:  lat,
 		Longitude: lon,
-		Timestamp: time.Now(),
-	}
+	})
+}
 
+// recordActivity adds an activity to the user's history; failures are only logged
+func (h *WeatherHandler) recordActivity(activity models.Activity) {
+	activity.Timestamp = time.Now()
 	if err := h.activityService.RecordActivity(activity); err != nil {
-		h.logger.Printf("Failed to record historical comparison activity: %v", err)
+		h.logger.Printf("Failed to record %s activity: %v", activity.Type, err)
 	}
-
-	c.JSON(http.StatusOK, historicalData)
 }
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"crypto/rand"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -10,7 +13,6 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -19,7 +21,6 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/joho/godotenv"
@@ -35,6 +36,13 @@ const apiKey = "0c2e2084bdd01a671b1b450215191f89" // Your Premium OpenWeather AP
 
 var notificationService *services.NotificationService
 
+// notificationOutbox records every email the notification service sends
+var notificationOutbox *services.NotificationOutbox
+
+// ssoProviderName is the name of the configured OpenID Connect provider, empty when single
+// sign-on is off
+var ssoProviderName string
+
 // WeatherData struct holds the structure of the current weather response
 type WeatherData struct {
 	Name string `json:"name"`
@@ -923,6 +931,29 @@ func getAirQualityData(lat, lon float64) (*AirQualityData, error) {
 	return &aqData, nil
 }
 
+// getAirQualityForecast fetches the hourly air quality forecast for the next four days
+func getAirQualityForecast(lat, lon float64) (*AirQualityData, error) {
+	aqUrl := fmt.Sprintf("https://api.openweathermap.org/data/2.5/air_pollution/forecast?lat=%f&lon=%f&appid=%s", lat, lon, apiKey)
+
+	resp, err := http.Get(aqUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to fetch air quality forecast: %s", resp.Status)
+	}
+
+	var aqData AirQualityData
+	err = json.NewDecoder(resp.Body).Decode(&aqData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aqData, nil
+}
+
 // getLocationNameFromCoordinates performs reverse geocoding to get location name
 func getLocationNameFromCoordinates(lat, lon float64) (string, error) {
 	// OpenWeatherMap Geocoding API - reverse geocoding
@@ -2179,7 +2210,9 @@ func initializeNotificationService() {
 		SenderEmail:  senderEmail,
 		SenderName:   "Go Weather Premium",
 		SMTPPassword: smtpPassword,
+		AppBaseURL:   getEnv("APP_BASE_URL", "http://localhost:8080"),
 	})
+	notificationService.Outbox = notificationOutbox
 
 	log.Printf("Notification service initialized with host=%s and port=%s", smtpHost, smtpPort)
 }
@@ -3286,6 +3319,10 @@ func setupTemplateHelpers(router *gin.Engine) {
 			}
 			return s[i:j]
 		},
+		// Name for the single sign-on buttons; empty hides them
+		"ssoProviderName": func() string {
+			return ssoProviderName
+		},
 	})
 }
 
@@ -3577,8 +3614,345 @@ func sendDailyReportForUser(user *models.User, notificationService *services.Not
 	}
 }
 
+// chatPlaceResolver resolves chat room names through the OpenWeather geocoding API
+type chatPlaceResolver struct{}
+
+// ResolvePlace returns the best geocoding match for a city name, or services.ErrPlaceNotFound
+func (chatPlaceResolver) ResolvePlace(query string) (*models.ChatPlace, error) {
+	geocodeURL := fmt.Sprintf("https://api.openweathermap.org/geo/1.0/direct?q=%s&limit=1&appid=%s",
+		url.QueryEscape(query), apiKey)
+
+	resp, err := http.Get(geocodeURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geocoding API returned status: %d", resp.StatusCode)
+	}
+
+	var locations []struct {
+		Name    string  `json:"name"`
+		State   string  `json:"state"`
+		Country string  `json:"country"`
+		Lat     float64 `json:"lat"`
+		Lon     float64 `json:"lon"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&locations); err != nil {
+		return nil, err
+	}
+
+	if len(locations) == 0 {
+		return nil, services.ErrPlaceNotFound
+	}
+
+	return &models.ChatPlace{
+		Name:      locations[0].Name,
+		State:     locations[0].State,
+		Country:   locations[0].Country,
+		Latitude:  locations[0].Lat,
+		Longitude: locations[0].Lon,
+	}, nil
+}
+
+// newSessionStore creates the session store with the secret and cookie flags from the environment
+func newSessionStore(db *sql.DB) *services.SessionStore {
+	secret := []byte(os.Getenv("SESSION_SECRET"))
+	if len(secret) == 0 {
+		log.Printf("SESSION_SECRET is not set, using a random key; everyone will be signed out on restart")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+
+	maxAgeDays, err := strconv.Atoi(getEnv("SESSION_MAX_AGE_DAYS", "7"))
+	if err != nil || maxAgeDays <= 0 {
+		maxAgeDays = 7
+	}
+
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(getEnv("SESSION_COOKIE_SAMESITE", "lax")) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	store := services.NewSessionStore(db, secret)
+	store.Options(sessions.Options{
+		Path:     "/",
+		Domain:   os.Getenv("SESSION_COOKIE_DOMAIN"),
+		MaxAge:   86400 * maxAgeDays,
+		HttpOnly: true,
+		Secure:   getEnv("SESSION_COOKIE_SECURE", "false") == "true", // Set to true when served over HTTPS
+		SameSite: sameSite,
+	})
+	return store
+}
+
+// newCORS allows cross-origin requests from CORS_ALLOWED_ORIGINS, a comma-separated list
+// that defaults to APP_BASE_URL
+func newCORS() gin.HandlerFunc {
+	var origins []string
+	for _, origin := range strings.Split(getEnv("CORS_ALLOWED_ORIGINS", getEnv("APP_BASE_URL", "http://localhost:8080")), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+
+	config := cors.Config{
+		AllowOrigins: origins,
+		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS"},
+		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization", middleware.CSRFHeaderName},
+		MaxAge:       12 * time.Hour,
+	}
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid CORS_ALLOWED_ORIGINS: %v", err)
+	}
+
+	log.Printf("CORS allowed origins: %s", strings.Join(origins, ", "))
+	return cors.New(config)
+}
+
+// newBlobStore creates the upload storage backend selected by BLOB_STORE (local or s3)
+func newBlobStore() (services.BlobStore, error) {
+	switch getEnv("BLOB_STORE", "local") {
+	case "local":
+		return services.NewLocalBlobStore(getEnv("BLOB_LOCAL_DIR", "./uploads"), os.Getenv("BLOB_PUBLIC_BASE_URL"))
+	case "s3":
+		return services.NewS3BlobStore(services.S3Config{
+			Endpoint:      os.Getenv("S3_ENDPOINT"),
+			Region:        getEnv("S3_REGION", "us-east-1"),
+			Bucket:        os.Getenv("S3_BUCKET"),
+			AccessKey:     os.Getenv("S3_ACCESS_KEY"),
+			SecretKey:     os.Getenv("S3_SECRET_KEY"),
+			PathStyle:     getEnv("S3_PATH_STYLE", "false") == "true",
+			PublicBaseURL: os.Getenv("BLOB_PUBLIC_BASE_URL"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q, expected local or s3", os.Getenv("BLOB_STORE"))
+	}
+}
+
+// newPollenProvider creates the pollen data source selected by POLLEN_PROVIDER (http, stub or
+// none). Without a provider, pollen counts are estimated from seasonal averages.
+func newPollenProvider() (services.PollenProvider, error) {
+	switch getEnv("POLLEN_PROVIDER", "http") {
+	case "http":
+		return services.NewHTTPPollenProvider(getEnv("POLLEN_API_URL", "https://air-quality-api.open-meteo.com")), nil
+	case "stub":
+		return services.NewStubPollenProvider(), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown POLLEN_PROVIDER %q, expected http, stub or none", os.Getenv("POLLEN_PROVIDER"))
+	}
+}
+
+// chatMentionNotifier emails chat mentions through the shared notification service
+type chatMentionNotifier struct{}
+
+// SendChatMention sends the mention email once the notification service is configured
+func (chatMentionNotifier) SendChatMention(to, author, city, message, link string) error {
+	if notificationService == nil {
+		return fmt.Errorf("notification service is not configured")
+	}
+	return notificationService.SendChatMention(to, author, city, message, link)
+}
+
+// passwordResetNotifier emails password reset links through the shared notification service
+type passwordResetNotifier struct{}
+
+// SendPasswordReset sends the reset email once the notification service is configured
+func (passwordResetNotifier) SendPasswordReset(to, username, link string) error {
+	if notificationService == nil {
+		return fmt.Errorf("notification service is not configured")
+	}
+	return notificationService.SendPasswordReset(to, username, link)
+}
+
+// emailVerificationNotifier emails verification links through the shared notification service
+type emailVerificationNotifier struct{}
+
+// SendEmailVerification sends the verification email once the notification service is configured
+func (emailVerificationNotifier) SendEmailVerification(to, username, link string) error {
+	if notificationService == nil {
+		return fmt.Errorf("notification service is not configured")
+	}
+	return notificationService.SendEmailVerification(to, username, link)
+}
+
+// accountLockNotifier emails account lockout notices through the shared notification service
+type accountLockNotifier struct{}
+
+// SendAccountLocked sends the lockout email once the notification service is configured
+func (accountLockNotifier) SendAccountLocked(to, username, ipAddress string, duration time.Duration) error {
+	if notificationService == nil {
+		return fmt.Errorf("notification service is not configured")
+	}
+	return notificationService.SendAccountLocked(to, username, ipAddress, duration)
+}
+
+// accountDeletionNotifier emails account deletion notices through the shared notification service
+type accountDeletionNotifier struct{}
+
+// SendAccountDeletionScheduled sends the deletion email once the notification service is configured
+func (accountDeletionNotifier) SendAccountDeletionScheduled(to, username string, deleteAt time.Time) error {
+	if notificationService == nil {
+		return fmt.Errorf("notification service is not configured")
+	}
+	return notificationService.SendAccountDeletionScheduled(to, username, deleteAt)
+}
+
+// customActivityNotifier emails custom activity windows through the shared notification service
+type customActivityNotifier struct{}
+
+// SendActivityWindowsFound sends the new windows email once the notification service is configured
+func (customActivityNotifier) SendActivityWindowsFound(to, username, activity, city string, windows []services.SuitabilityWindow, timezoneOffset int) error {
+	if notificationService == nil {
+		return fmt.Errorf("notification service is not configured")
+	}
+	return notificationService.SendActivityWindowsFound(to, username, activity, city, windows, timezoneOffset)
+}
+
+// SendActivityWindowLost sends the lost window email once the notification service is configured
+func (customActivityNotifier) SendActivityWindowLost(to, username, activity, city string, window services.ActivityWindow, timezoneOffset int) error {
+	if notificationService == nil {
+		return fmt.Errorf("notification service is not configured")
+	}
+	return notificationService.SendActivityWindowLost(to, username, activity, city, window, timezoneOffset)
+}
+
+// activityForecastSource feeds activity suitability scoring from the OneCall hourly forecast
+// and the air quality forecast
+type activityForecastSource struct{}
+
+// HourlyForecast fetches the next 48 hours of weather at a location and the daily forecast
+// for the week
+func (activityForecastSource) HourlyForecast(lat, lon float64) (*services.HourlyForecast, error) {
+	oneCallData, err := getOneCallData(lat, lon)
+	if err != nil {
+		return nil, err
+	}
+
+	// Air quality is optional; hours without it are scored on the weather alone
+	aqiByTime := make(map[int64]int)
+	if aqData, err := getAirQualityForecast(lat, lon); err != nil {
+		log.Printf("Air quality forecast unavailable for (%.2f, %.2f): %v", lat, lon, err)
+	} else {
+		for _, entry := range aqData.List {
+			aqiByTime[entry.Dt] = entry.Main.Aqi
+		}
+	}
+
+	forecast := &services.HourlyForecast{TimezoneOffset: oneCallData.TimezoneOffset}
+	for _, hourly := range oneCallData.Hourly {
+		hour := services.ForecastHour{
+			Time:       time.Unix(hourly.Dt, 0),
+			Temp:       hourly.Temp,
+			WindSpeed:  hourly.WindSpeed,
+			PrecipProb: hourly.Pop * 100,
+			UVI:        hourly.Uvi,
+			AQI:        aqiByTime[hourly.Dt],
+			Clouds:     float64(hourly.Clouds),
+		}
+		for _, daily := range oneCallData.Daily {
+			if hourly.Dt >= daily.Sunrise && hourly.Dt < daily.Sunset {
+				hour.Daylight = true
+				break
+			}
+		}
+		forecast.Hours = append(forecast.Hours, hour)
+	}
+
+	for _, daily := range oneCallData.Daily {
+		forecast.Days = append(forecast.Days, services.DailyForecast{
+			Date:       time.Unix(daily.Dt, 0),
+			Sunrise:    time.Unix(daily.Sunrise, 0),
+			Sunset:     time.Unix(daily.Sunset, 0),
+			TempMorn:   daily.Temp.Morn,
+			TempDay:    daily.Temp.Day,
+			TempEve:    daily.Temp.Eve,
+			TempNight:  daily.Temp.Night,
+			WindSpeed:  daily.WindSpeed,
+			PrecipProb: daily.Pop * 100,
+			UVI:        daily.Uvi,
+			Clouds:     float64(daily.Clouds),
+		})
+	}
+
+	return forecast, nil
+}
+
+// chatBotWeatherSource feeds the chat bot from the same fetch functions as the weather pages
+type chatBotWeatherSource struct{}
+
+// WeatherReport fetches current conditions, the OneCall forecast and air quality for a city
+func (chatBotWeatherSource) WeatherReport(city string) (*services.BotWeatherReport, error) {
+	weatherData, err := getCurrentWeather(city)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &services.BotWeatherReport{
+		City:           weatherData.Name,
+		TimezoneOffset: weatherData.Timezone,
+		Temp:           weatherData.Main.Temp,
+		FeelsLike:      weatherData.Main.FeelsLike,
+		Humidity:       weatherData.Main.Humidity,
+		WindSpeed:      weatherData.Wind.Speed,
+		Sunrise:        time.Unix(weatherData.Sys.Sunrise, 0),
+		Sunset:         time.Unix(weatherData.Sys.Sunset, 0),
+		AQICategory:    getAQICategory(0),
+	}
+	if len(weatherData.Weather) > 0 {
+		report.Description = weatherData.Weather[0].Description
+		report.Icon = weatherData.Weather[0].Icon
+	}
+
+	// Forecast and alerts come from the OneCall API
+	oneCallData, err := getOneCallData(weatherData.Coord.Lat, weatherData.Coord.Lon)
+	if err != nil {
+		log.Printf("Chat bot: OneCall data unavailable for %s: %v", city, err)
+	} else {
+		for _, daily := range oneCallData.Daily {
+			forecast := services.BotDailyForecast{
+				Date:       time.Unix(daily.Dt, 0),
+				MinTemp:    daily.Temp.Min,
+				MaxTemp:    daily.Temp.Max,
+				PrecipProb: daily.Pop * 100,
+			}
+			if len(daily.Weather) > 0 {
+				forecast.Description = daily.Weather[0].Description
+			}
+			report.Daily = append(report.Daily, forecast)
+		}
+
+		for _, alert := range oneCallData.Alerts {
+			botAlert := services.BotWeatherAlert{
+				Event:       alert.Event,
+				Sender:      alert.SenderName,
+				Start:       time.Unix(alert.Start, 0),
+				Description: alert.Description,
+			}
+			if alert.End > 0 {
+				botAlert.End = time.Unix(alert.End, 0)
+			}
+			report.Alerts = append(report.Alerts, botAlert)
+		}
+	}
+
+	aqData, err := getAirQualityData(weatherData.Coord.Lat, weatherData.Coord.Lon)
+	if err == nil && len(aqData.List) > 0 {
+		report.AQI = aqData.List[0].Main.Aqi
+		report.AQICategory = getAQICategory(report.AQI)
+	}
+
+	return report, nil
+}
+
 // weatherImpactAPIHandler is specifically for the Weather Impact feature
-func weatherImpactAPIHandler(c *gin.Context) {
+func weatherImpactAPIHandler(c *gin.Context, activityService *services.ActivityService) {
 	city := c.DefaultQuery("city", "")
 	if city == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "City name is required"})
@@ -3620,6 +3994,11 @@ func weatherImpactAPIHandler(c *gin.Context) {
 		},
 	}
 
+	// Pollen counts say whether they are estimates so the page can label them
+	if pollen, err := activityService.GetPollenData(weatherData.Coord.Lat, weatherData.Coord.Lon); err == nil {
+		response["pollen"] = pollen
+	}
+
 	c.JSON(http.StatusOK, response)
 }
 
@@ -3628,6 +4007,14 @@ func main() {
 	// Set API key for services package
 	services.SetAPIKey(apiKey)
 
+	// Count outgoing API requests for the admin console; clients without their own
+	// transport use http.DefaultTransport
+	apiUsage := services.NewAPIUsageTracker(http.DefaultTransport)
+	http.DefaultTransport = apiUsage
+
+	// Background jobs report their runs to the admin console
+	jobMonitor := services.NewJobMonitor()
+
 	// Create router with default middleware
 	router := gin.Default()
 
@@ -3640,24 +4027,17 @@ func main() {
 	// Register travel weather routes with the standard HTTP mux
 	handlers.RegisterTravelWeatherRoutes(mux)
 
-	// Set up the session store with a secure secret
-	store := cookie.NewStore([]byte("your-unique-secret-key-change-this"))
-	store.Options(sessions.Options{
-		Path:     "/",
-		MaxAge:   86400 * 7, // 7 days
-		HttpOnly: true,
-		Secure:   false, // Set to true if using HTTPS
-	})
-	router.Use(sessions.Sessions("weather_session", store))
-
 	// Set the router to use HTML templates
 	router.LoadHTMLGlob("templates/*.html")
 
 	// Serve static files
 	router.Static("/static", "./static")
 
-	// Enable CORS
-	router.Use(cors.Default())
+	// Only allow cross-origin requests from configured origins
+	router.Use(newCORS())
+
+	// Require a CSRF token on every state-changing request
+	router.Use(middleware.CSRFProtection(getEnv("SESSION_COOKIE_SECURE", "false") == "true"))
 
 	// Get database connection details from environment variables or use defaults
 	dbHost := getEnv("DB_HOST", "localhost")
@@ -3682,7 +4062,11 @@ func main() {
 
 	// Initialize services for historical comparison
 	var weatherService = services.NewWeatherService(apiKey)
-	var activityService = services.NewActivityService(apiKey) // Using your existing constructor
+	pollenProvider, err := newPollenProvider()
+	if err != nil {
+		log.Fatalf("Failed to configure pollen data: %v", err)
+	}
+	var activityService = services.NewActivityService(apiKey, models.NewMySQLActivityStore(userStore.GetDB()), pollenProvider, activityForecastSource{})
 
 	// Initialize travel weather service
 	_ = services.NewTravelWeatherService(weatherService)
@@ -3690,6 +4074,21 @@ func main() {
 	// Create weather handler with services
 	weatherHandler := handlers.NewWeatherHandler(userStore, weatherService, activityService)
 
+	// Keep sessions server-side so they can be listed and revoked
+	sessionStore := newSessionStore(userStore.GetDB())
+	router.Use(sessions.Sessions("weather_session", sessionStore))
+
+	// Start a goroutine to delete expired sessions
+	go func() {
+		for {
+			jobMonitor.Wait("session_cleanup", time.Hour)
+			jobMonitor.Run("session_cleanup", func() error {
+				_, err := sessionStore.DeleteExpired()
+				return err
+			})
+		}
+	}()
+
 	// Add user store to the context
 	router.Use(func(c *gin.Context) {
 		c.Set("user_store", userStore)
@@ -3709,11 +4108,68 @@ func main() {
 		c.Next()
 	})
 	dbConn := userStore.GetDB()
+
+	notificationOutbox = services.NewNotificationOutbox(dbConn)
+
+	// Start a goroutine to delete old outbox entries
+	go func() {
+		for {
+			jobMonitor.Wait("outbox_cleanup", 24*time.Hour)
+			jobMonitor.Run("outbox_cleanup", func() error {
+				_, err := notificationOutbox.DeleteOld()
+				return err
+			})
+		}
+	}()
+
+	// Accept personal access tokens as well as sessions; a token's user replaces the session user
+	apiTokenService := services.NewAPITokenService(dbConn)
+	router.Use(middleware.BearerAuth(apiTokenService))
+
+	// Start a goroutine to delete expired API tokens
+	go func() {
+		for {
+			jobMonitor.Wait("api_token_cleanup", 24*time.Hour)
+			jobMonitor.Run("api_token_cleanup", func() error {
+				_, err := apiTokenService.DeleteExpired()
+				return err
+			})
+		}
+	}()
+
+	sessionHandler := handlers.NewSessionHandler(sessionStore)
+	sessionHandler.RegisterRoutes(router)
+
+	apiTokenHandler := handlers.NewAPITokenHandler(apiTokenService)
+	apiTokenHandler.RegisterRoutes(router)
+
 	savedCitiesHandler := handlers.NewSavedCitiesHandler(dbConn)
 	savedCitiesHandler.RegisterRoutes(router)
+
+	// Initialize blob storage for uploads, served under /media
+	blobStore, err := newBlobStore()
+	if err != nil {
+		log.Fatalf("Error setting up upload storage: %v", err)
+	}
+
+	// One-off copy of images uploaded to ./static/chat_images before blob storage existed
+	if getEnv("MIGRATE_UPLOADS", "false") == "true" {
+		migrated, err := services.MigrateLegacyUploads(blobStore, dbConn, "./static")
+		if err != nil {
+			log.Printf("Error migrating uploads: %v", err)
+		}
+		log.Printf("Moved %d uploaded images into blob storage", migrated)
+	}
+
+	// Uploads are tracked for quotas, garbage collection and profile photos
+	uploadService := services.NewUploadService(dbConn, blobStore)
+
 	// Create auth handlers
-	authHandler := handlers.NewAuthHandler(userStore)
-	activityHandler := handlers.NewActivityHandler(apiKey)
+	emailVerificationService := services.NewEmailVerificationService(dbConn, emailVerificationNotifier{})
+	loginSecurityService := services.NewLoginSecurityService(dbConn, accountLockNotifier{})
+	twoFactorService := services.NewTwoFactorService(dbConn)
+	authHandler := handlers.NewAuthHandler(userStore, emailVerificationService, loginSecurityService, twoFactorService, uploadService)
+	activityHandler := handlers.NewActivityHandler(activityService)
 
 	// Public routes
 	router.GET("/", homeHandler)
@@ -3724,6 +4180,54 @@ func main() {
 	// Add this missing route
 	router.GET("/login", middleware.RedirectIfLoggedIn(), authHandler.GetLogin)
 
+	// Forgot password and reset links
+	passwordResetService := services.NewPasswordResetService(dbConn, passwordResetNotifier{}, sessionStore)
+	passwordResetHandler := handlers.NewPasswordResetHandler(passwordResetService)
+	passwordResetHandler.RegisterRoutes(router)
+
+	// Email verification links and resends
+	emailVerificationHandler := handlers.NewEmailVerificationHandler(emailVerificationService)
+	emailVerificationHandler.RegisterRoutes(router)
+
+	// Sign-in history on the profile page
+	securityHandler := handlers.NewSecurityHandler(loginSecurityService)
+	securityHandler.RegisterRoutes(router)
+
+	// Two-factor authentication setup on the profile page
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService, loginSecurityService)
+	twoFactorHandler.RegisterRoutes(router)
+
+	// Single sign-on with an OpenID Connect provider, when one is configured
+	if issuerURL := getEnv("OIDC_ISSUER_URL", ""); issuerURL != "" {
+		oidcProvider, err := services.NewOIDCProvider(services.OIDCConfig{
+			IssuerURL:    issuerURL,
+			ClientID:     getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  getEnv("OIDC_REDIRECT_URL", getEnv("APP_BASE_URL", "http://localhost:8080")+"/auth/oidc/callback"),
+			ProviderName: getEnv("OIDC_PROVIDER_NAME", ""),
+		})
+		if err != nil {
+			log.Fatalf("Invalid OIDC configuration: %v", err)
+		}
+		ssoProviderName = oidcProvider.Name()
+
+		ssoService := services.NewSSOService(dbConn, userStore)
+		oidcHandler := handlers.NewOIDCHandler(oidcProvider, ssoService, loginSecurityService, twoFactorService)
+		oidcHandler.RegisterRoutes(router)
+		log.Printf("Single sign-on enabled with %s", ssoProviderName)
+	}
+
+	// Start a goroutine to delete old security events
+	go func() {
+		for {
+			jobMonitor.Wait("security_event_cleanup", 24*time.Hour)
+			jobMonitor.Run("security_event_cleanup", func() error {
+				_, err := loginSecurityService.DeleteOldEvents()
+				return err
+			})
+		}
+	}()
+
 	// Add these routes in your main.go near the other API routes section
 	router.GET("/api/nearby-locations", func(c *gin.Context) {
 		// Get latitude and longitude from query parameters
@@ -3901,6 +4405,8 @@ func main() {
 	})
 
 	router.POST("/login", authHandler.PostLogin)
+	router.GET("/login/2fa", middleware.RedirectIfLoggedIn(), authHandler.GetLoginTwoFactor)
+	router.POST("/login/2fa", authHandler.PostLoginTwoFactor)
 	router.GET("/signup", middleware.RedirectIfLoggedIn(), authHandler.GetSignup)
 	// In main.go
 	router.GET("/activities", activityHandler.GetActivitiesPageHandler)
@@ -3998,12 +4504,15 @@ func main() {
 	router.GET("/weather", weatherHandler.GetWeather)
 
 	// API routes (no auth required)
-	router.GET("/api/weather/impact", weatherImpactAPIHandler)
+	router.GET("/api/weather/impact", func(c *gin.Context) {
+		weatherImpactAPIHandler(c, activityService)
+	})
 
 	router.GET("/api/weather", weatherAPIHandler)
 	router.GET("/api/compare", compareAPIHandler)
 	router.GET("/api/historical-comparison", historicalComparisonAPIHandler)
 	router.GET("/api/activities", activityHandler.GetActivitiesHandler)
+	router.GET("/api/activities/windows", activityHandler.GetActivityWindowsHandler)
 	router.GET("/api/weather/historical-comparison", func(c *gin.Context) {
 		weatherHandler.GetHistoricalComparison(c)
 	})
@@ -4031,36 +4540,12 @@ func main() {
 				return
 			}
 
-			// Get user details
-			userStore := c.MustGet("user_store").(models.UserStore)
-			user, err := userStore.GetUserByID(userID.(int))
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user data"})
-				return
-			}
-
-			// Get the profile photo from form
-			profilePhoto := c.PostForm("profile_photo")
-
-			// Validate profile photo
-			validPhotos := map[string]bool{
-				"photo1.jpg":  true,
-				"photo2.jpg":  true,
-				"photo3.jpg":  true,
-				"photo4.jpg":  true,
-				"photo5.jpg":  true,
-				"default.jpg": true,
-			}
-
-			if !validPhotos[profilePhoto] {
+			// Built-in avatars or the user's own uploads; a replaced upload is deleted
+			err := uploadService.SetProfilePhoto(userID.(int), c.PostForm("profile_photo"))
+			if errors.Is(err, services.ErrProfilePhoto) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile photo selection"})
 				return
 			}
-
-			user.ProfilePhoto = profilePhoto
-			user.UpdatedAt = time.Now()
-
-			err = userStore.UpdateUser(user)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile photo"})
 				return
@@ -4074,32 +4559,141 @@ func main() {
 	// ============= CHAT FEATURE INTEGRATION START =============
 
 	dbConn = userStore.GetDB()
-	chatService := services.NewChatService(dbConn)
+	chatService := services.NewChatService(dbConn, chatPlaceResolver{})
+
+	// One-off merge of rooms created from free-text city names into canonical places
+	if getEnv("MIGRATE_CHAT_ROOMS", "false") == "true" {
+		merged, unresolved, err := chatService.MigrateChatRooms()
+		if err != nil {
+			log.Printf("Error migrating chat rooms: %v", err)
+		}
+		log.Printf("Merged %d chat rooms into canonical places", merged)
+		if len(unresolved) > 0 {
+			log.Printf("Chat rooms that could not be resolved and were left as they are: %v", unresolved)
+		}
+	}
 
-	// Initialize upload handler for chat images
-	uploadDir := "./static"
-	uploadHandler := handlers.NewUploadHandler(uploadDir)
+	mediaHandler := handlers.NewMediaHandler(blobStore, getEnv("BLOB_URL_MODE", "redirect") == "proxy")
+	mediaHandler.RegisterRoutes(router)
+
+	// Initialize upload handler for chat images and profile photos
+	uploadHandler := handlers.NewUploadHandler(uploadService)
 	uploadHandler.RegisterRoutes(router)
 
+	// Start a goroutine to delete chat images that were never posted
+	go func() {
+		for {
+			jobMonitor.Wait("upload_gc", services.UploadGCInterval)
+			jobMonitor.Run("upload_gc", func() error {
+				deleted, err := uploadService.CollectOrphans()
+				if deleted > 0 {
+					log.Printf("Deleted %d orphaned uploads", deleted)
+				}
+				return err
+			})
+		}
+	}()
+
+	// Initialize activity history handler for the timeline and recently viewed cities
+	activityHistoryHandler := handlers.NewActivityHistoryHandler(activityService)
+	activityHistoryHandler.RegisterRoutes(router)
+
+	// Start a goroutine to delete activity history past its retention
+	go func() {
+		for {
+			jobMonitor.Wait("activity_cleanup", 24*time.Hour)
+			jobMonitor.Run("activity_cleanup", func() error {
+				_, err := activityService.DeleteOldActivities()
+				return err
+			})
+		}
+	}()
+
+	// Initialize custom activity handler for user-defined activities and their weather windows
+	customActivityService := services.NewCustomActivityService(dbConn, activityForecastSource{}, customActivityNotifier{})
+	customActivityHandler := handlers.NewCustomActivityHandler(customActivityService)
+	customActivityHandler.RegisterRoutes(router)
+
+	// Start a goroutine to watch the forecast for custom activity windows
+	go func() {
+		for {
+			jobMonitor.Wait("custom_activity_windows", services.CustomActivityInterval)
+			jobMonitor.Run("custom_activity_windows", customActivityService.CheckAllActivities)
+		}
+	}()
+
+	// Initialize account handler for data exports and account deletion
+	accountService := services.NewAccountService(dbConn, blobStore, accountDeletionNotifier{})
+	accountHandler := handlers.NewAccountHandler(userStore, accountService)
+	accountHandler.RegisterRoutes(router)
+
+	// Start a goroutine to delete accounts whose grace period is over
+	go func() {
+		for {
+			jobMonitor.Wait("account_deletion", services.AccountDeletionInterval)
+			jobMonitor.Run("account_deletion", func() error {
+				deleted, err := accountService.DeleteScheduled()
+				if deleted > 0 {
+					log.Printf("Deleted %d accounts scheduled for deletion", deleted)
+				}
+				return err
+			})
+		}
+	}()
+
+	// Initialize the weather bot that answers slash commands and announces alerts
+	var chatBot *services.ChatBot
+	botUser, err := services.EnsureChatBotUser(userStore)
+	if errors.Is(err, services.ErrChatBotNameTaken) {
+		// Anyone holding the bot's name could pass for it in chat
+		log.Fatalf("Refusing to start: %v", err)
+	}
+	if err != nil {
+		log.Printf("Error setting up chat bot user, slash commands are disabled: %v", err)
+	} else {
+		chatBot = services.NewChatBot(chatService, chatBotWeatherSource{}, botUser.ID)
+	}
+
 	// Initialize chat handler
-	chatHandler := handlers.NewChatHandler(chatService)
+	mentionService := services.NewMentionService(dbConn, chatMentionNotifier{})
+	chatHandler := handlers.NewChatHandler(chatService, chatBot, mentionService, uploadService)
 	chatHandler.RegisterRoutes(router)
 
-	// Create the chat_images directory if it doesn't exist
-	os.MkdirAll(filepath.Join("static", "chat_images"), 0755)
+	// Initialize direct message handler
+	dmService := services.NewDirectMessageService(dbConn)
+	dmHandler := handlers.NewDirectMessageHandler(dmService, uploadService)
+	dmHandler.RegisterRoutes(router)
+
+	// Initialize ground report handler for structured condition reports
+	reportService := services.NewGroundReportService(dbConn, uploadService)
+	reportHandler := handlers.NewGroundReportHandler(reportService)
+	reportHandler.RegisterRoutes(router)
 
-	// Start a goroutine to clean up inactive users
+	// Start a goroutine to persist chat presence and evict idle rooms
 	go func() {
 		for {
-			time.Sleep(5 * time.Minute)
-			if err := chatService.RemoveInactiveUsers(); err != nil {
-				log.Printf("Error removing inactive users: %v", err)
-			}
+			jobMonitor.Wait("chat_presence", services.PresencePersistInterval)
+			jobMonitor.Run("chat_presence", chatService.PersistPresence)
 		}
 	}()
 
+	// Start a goroutine for the chat bot to announce weather alerts
+	if chatBot != nil {
+		go func() {
+			for {
+				jobMonitor.Wait("chat_weather_alerts", 10*time.Minute)
+				jobMonitor.Run("chat_weather_alerts", chatBot.CheckAlerts)
+			}
+		}()
+	}
+
 	// ============= CHAT FEATURE INTEGRATION END =============
 
+	// Initialize the admin console for moderators and admins
+	adminService := services.NewAdminService(dbConn)
+	adminHandler := handlers.NewAdminHandler(userStore, adminService, chatService, notificationOutbox, jobMonitor, apiUsage)
+	adminHandler.RegisterRoutes(router)
+
 	// Pre-initialize notification service
 	initializeNotificationService()
 
@@ -4119,11 +4713,14 @@ func main() {
 			log.Printf("Next daily weather report scheduled at %v (in %v)", nextReport.Format("2006-01-02 15:04:05"), waitDuration)
 
 			// Wait until next report time
-			time.Sleep(waitDuration)
+			jobMonitor.Wait("daily_reports", waitDuration)
 
 			// Send daily reports to users who opted for all weather updates
 			log.Println("Sending daily weather reports...")
-			sendDailyReportsToAllUsers(userStore)
+			jobMonitor.Run("daily_reports", func() error {
+				sendDailyReportsToAllUsers(userStore)
+				return nil
+			})
 		}
 	}()
 
@@ -3,18 +3,41 @@ package middleware
 import (
 	"log"
 	"net/http"
+	"strings"
+	"weather-app/models"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
-// AuthRequired ensures that a user is logged in
-func AuthRequired() gin.HandlerFunc {
+// TwoFactorPendingKey is the session key holding the user who passed the password step
+// but has not entered their two-factor code yet
+const TwoFactorPendingKey = "two_factor_user_id"
+
+// AuthRequired ensures that a user is logged in. Requests authenticated with an API token
+// are only allowed when the token has one of scopes, so routes without scopes stay
+// browser-only.
+func AuthRequired(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if tokenScopes, ok := TokenScopes(c); ok {
+			if !hasScope(tokenScopes, scopes...) {
+				log.Printf("AuthRequired: API token not allowed for path %s", c.Request.URL.Path)
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used with this API token"})
+				return
+			}
+			c.Next()
+			return
+		}
+
 		session := sessions.Default(c)
 		userID := session.Get("user_id")
 		path := c.Request.URL.Path
 
+		// A half-authenticated session is treated as logged out
+		if session.Get(TwoFactorPendingKey) != nil {
+			userID = nil
+		}
+
 		log.Printf("AuthRequired: Path=%s, UserID=%v", path, userID)
 
 		if userID == nil {
@@ -40,6 +63,35 @@ func AuthRequired() gin.HandlerFunc {
 	}
 }
 
+// UserRoleKey is the context key holding the role of a user that passed RequireRole
+const UserRoleKey = "user_role"
+
+// UserLookup loads users for role checks
+type UserLookup interface {
+	GetUserByID(id int) (*models.User, error)
+}
+
+// RequireRole ensures the signed-in user has role or a more privileged one. It must run
+// after AuthRequired. Disabled accounts are always rejected.
+func RequireRole(users UserLookup, role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := users.GetUserByID(CurrentUserID(c))
+		if err != nil || user.Disabled || !user.HasRole(role) {
+			log.Printf("RequireRole: user %d denied %s access to %s", CurrentUserID(c), role, c.Request.URL.Path)
+			if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You do not have permission to do this"})
+				return
+			}
+			c.String(http.StatusForbidden, "You do not have permission to view this page.")
+			c.Abort()
+			return
+		}
+
+		c.Set(UserRoleKey, user.Role)
+		c.Next()
+	}
+}
+
 // RedirectIfLoggedIn redirects to home if user is already logged in
 func RedirectIfLoggedIn() gin.HandlerFunc {
 	return func(c *gin.Context) {
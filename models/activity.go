@@ -1,6 +1,16 @@
 package models
 
-import "time"
+import (
+	"database/sql"
+	"time"
+)
+
+// Activity types recorded for signed-in users
+const (
+	ActivityTypeWeatherSearch = "WEATHER_SEARCH"
+	ActivityTypeComparison    = "COMPARISON"
+	ActivityTypeHistorical    = "HISTORICAL_COMPARISON"
+)
 
 // Activity represents a user action in the application
 type Activity struct {
@@ -15,9 +25,197 @@ type Activity struct {
 	Details string `json:"details,omitempty"`
 }
 
+// ActivityFilter narrows a user's activity timeline. BeforeID pages backwards from an
+// activity; zero values mean no filter.
+type ActivityFilter struct {
+	Type     string
+	BeforeID int
+	Limit    int
+}
+
+// CityActivity is how often and how recently a user looked at a city
+type CityActivity struct {
+	City         string    `json:"city"`
+	Views        int       `json:"views"`
+	LastViewedAt time.Time `json:"last_viewed_at"`
+}
+
 // ActivityStore defines the interface for activity storage
 type ActivityStore interface {
 	RecordActivity(activity Activity) error
 	GetActivitiesByUserID(userID int, limit int) ([]Activity, error)
 	GetRecentActivities(limit int) ([]Activity, error)
+	GetTimeline(userID int, filter ActivityFilter) ([]Activity, error)
+	GetMostViewedCities(userID int, since time.Time, limit int) ([]CityActivity, error)
+	GetRecentCities(userID int, limit int) ([]CityActivity, error)
+	CountByType(userID int, since time.Time) (map[string]int, error)
+	DeleteOlderThan(before time.Time) (int, error)
+}
+
+// MySQLActivityStore implements ActivityStore with MySQL database
+type MySQLActivityStore struct {
+	db *sql.DB
+}
+
+// NewMySQLActivityStore creates a new MySQL activity store
+func NewMySQLActivityStore(db *sql.DB) *MySQLActivityStore {
+	return &MySQLActivityStore{db: db}
+}
+
+// RecordActivity stores an activity, stamping it with the current time if it has none
+func (s *MySQLActivityStore) RecordActivity(activity Activity) error {
+	if activity.Timestamp.IsZero() {
+		activity.Timestamp = time.Now()
+	}
+
+	_, err := s.db.Exec(
+		`INSERT INTO user_activities (user_id, activity_type, city, latitude, longitude, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		activity.UserID, activity.Type, activity.City, activity.Latitude, activity.Longitude, activity.Details, activity.Timestamp,
+	)
+	return err
+}
+
+// GetActivitiesByUserID returns a user's most recent activities, newest first
+func (s *MySQLActivityStore) GetActivitiesByUserID(userID int, limit int) ([]Activity, error) {
+	return s.GetTimeline(userID, ActivityFilter{Limit: limit})
+}
+
+// GetRecentActivities returns the most recent activities of all users, newest first
+func (s *MySQLActivityStore) GetRecentActivities(limit int) ([]Activity, error) {
+	rows, err := s.db.Query(
+		`SELECT id, user_id, activity_type, city, latitude, longitude, details, created_at
+		FROM user_activities
+		ORDER BY id DESC
+		LIMIT ?`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanActivities(rows)
+}
+
+// GetTimeline returns a user's activities matching filter, newest first
+func (s *MySQLActivityStore) GetTimeline(userID int, filter ActivityFilter) ([]Activity, error) {
+	query := `SELECT id, user_id, activity_type, city, latitude, longitude, details, created_at
+		FROM user_activities
+		WHERE user_id = ?`
+	args := []interface{}{userID}
+	if filter.Type != "" {
+		query += " AND activity_type = ?"
+		args = append(args, filter.Type)
+	}
+	if filter.BeforeID > 0 {
+		query += " AND id < ?"
+		args = append(args, filter.BeforeID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanActivities(rows)
+}
+
+// GetMostViewedCities returns the cities a user looked at most often since a time
+func (s *MySQLActivityStore) GetMostViewedCities(userID int, since time.Time, limit int) ([]CityActivity, error) {
+	return s.queryCities(
+		`SELECT city, COUNT(*) AS views, MAX(created_at) AS last_viewed_at
+		FROM user_activities
+		WHERE user_id = ? AND city <> '' AND created_at >= ?
+		GROUP BY city
+		ORDER BY views DESC, last_viewed_at DESC
+		LIMIT ?`,
+		userID, since, limit,
+	)
+}
+
+// GetRecentCities returns the cities a user looked at most recently, each once
+func (s *MySQLActivityStore) GetRecentCities(userID int, limit int) ([]CityActivity, error) {
+	return s.queryCities(
+		`SELECT city, COUNT(*) AS views, MAX(created_at) AS last_viewed_at
+		FROM user_activities
+		WHERE user_id = ? AND city <> ''
+		GROUP BY city
+		ORDER BY last_viewed_at DESC
+		LIMIT ?`,
+		userID, limit,
+	)
+}
+
+// CountByType returns how many activities of each type a user had since a time
+func (s *MySQLActivityStore) CountByType(userID int, since time.Time) (map[string]int, error) {
+	rows, err := s.db.Query(
+		"SELECT activity_type, COUNT(*) FROM user_activities WHERE user_id = ? AND created_at >= ? GROUP BY activity_type",
+		userID, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var activityType string
+		var count int
+		if err := rows.Scan(&activityType, &count); err != nil {
+			return nil, err
+		}
+		counts[activityType] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// DeleteOlderThan deletes activities recorded before a time and returns how many were deleted
+func (s *MySQLActivityStore) DeleteOlderThan(before time.Time) (int, error) {
+	result, err := s.db.Exec("DELETE FROM user_activities WHERE created_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// queryCities runs a per-city aggregate query
+func (s *MySQLActivityStore) queryCities(query string, args ...interface{}) ([]CityActivity, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cities := make([]CityActivity, 0)
+	for rows.Next() {
+		var city CityActivity
+		if err := rows.Scan(&city.City, &city.Views, &city.LastViewedAt); err != nil {
+			return nil, err
+		}
+		cities = append(cities, city)
+	}
+
+	return cities, rows.Err()
+}
+
+// scanActivities reads user_activities rows
+func scanActivities(rows *sql.Rows) ([]Activity, error) {
+	activities := make([]Activity, 0)
+	for rows.Next() {
+		var activity Activity
+		if err := rows.Scan(&activity.ID, &activity.UserID, &activity.Type, &activity.City,
+			&activity.Latitude, &activity.Longitude, &activity.Details, &activity.Timestamp); err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+
+	return activities, rows.Err()
 }
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// API token scopes
+const (
+	ScopeReadWeather = "read:weather"
+	ScopeWriteCities = "write:cities"
+	ScopeChat        = "chat"
+)
+
+// APITokenScopes lists every scope a token can be granted
+var APITokenScopes = []string{ScopeReadWeather, ScopeWriteCities, ScopeChat}
+
+// IsValidAPITokenScope reports whether scope is a known API token scope
+func IsValidAPITokenScope(scope string) bool {
+	for _, known := range APITokenScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken is a personal access token for the JSON API. The secret itself is only
+// returned once, when the token is created.
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // First characters of the token, to tell tokens apart
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Token      string     `json:"token,omitempty"`
+}
@@ -6,19 +6,100 @@ import (
 
 // ChatMessage represents a single message in a city chat
 type ChatMessage struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	Username  string    `json:"username"`
-	CityName  string    `json:"city_name"`
-	Message   string    `json:"message"`
-	ImageURL  string    `json:"image_url,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	AvatarURL string    `json:"avatar_url"`
+	ID        int               `json:"id"`
+	UserID    int               `json:"user_id"`
+	Username  string            `json:"username"`
+	CityName  string            `json:"city_name,omitempty"`
+	PlaceID   string            `json:"place_id,omitempty"`
+	Message   string            `json:"message"`
+	ImageURL  string            `json:"image_url,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	AvatarURL string            `json:"avatar_url"`
+	EditedAt  *time.Time        `json:"edited_at,omitempty"`
+	Deleted   bool              `json:"deleted"`
+	Reactions []ReactionSummary `json:"reactions,omitempty"`
+	Card      *MessageCard      `json:"card,omitempty"`
+
+	// ConversationID is set instead of CityName for direct messages
+	ConversationID int `json:"conversation_id,omitempty"`
+}
+
+// MessageCard is structured content attached to a chat message, such as a weather bot reply
+type MessageCard struct {
+	Type   string      `json:"type"` // e.g., "weather", "forecast", "aqi", "sun", "alert_start", "alert_end"
+	Title  string      `json:"title"`
+	Icon   string      `json:"icon,omitempty"`
+	Fields []CardField `json:"fields,omitempty"`
+	Footer string      `json:"footer,omitempty"`
+}
+
+// CardField is a single labelled value shown on a message card
+type CardField struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// ChatMessageEdit is a previous version of an edited chat message
+type ChatMessageEdit struct {
+	ID              int       `json:"id"`
+	MessageID       int       `json:"message_id"`
+	PreviousMessage string    `json:"previous_message"`
+	EditedAt        time.Time `json:"edited_at"`
+}
+
+// ReactionSummary aggregates the reactions with one emoji on a message
+type ReactionSummary struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	UserIDs []int  `json:"user_ids"`
 }
 
 // ChatRoom represents a city-based chat room
 type ChatRoom struct {
+	PlaceID     string        `json:"place_id"`
 	CityName    string        `json:"city_name"`
 	Messages    []ChatMessage `json:"messages"`
 	ActiveUsers int           `json:"active_users"`
+	OnlineUsers []OnlineUser  `json:"online_users"`
+}
+
+// OnlineUser is a user currently present in a chat room
+type OnlineUser struct {
+	UserID   int       `json:"user_id"`
+	Username string    `json:"username"`
+	Typing   bool      `json:"typing"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// ChatPlace is a geocoded place that identifies a chat room
+type ChatPlace struct {
+	ID        string  `json:"place_id"` // e.g., "us/new-york/new-york"
+	Name      string  `json:"name"`
+	State     string  `json:"state,omitempty"`
+	Country   string  `json:"country"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// WeatherQuery returns the "city,country" query used to look up weather for the place
+func (p ChatPlace) WeatherQuery() string {
+	if p.Country == "" {
+		return p.Name
+	}
+	return p.Name + "," + p.Country
+}
+
+// ChatMention records that a chat message addressed a user with @username
+type ChatMention struct {
+	ID             int        `json:"id"`
+	MessageID      int        `json:"message_id"`
+	UserID         int        `json:"user_id"` // The mentioned user
+	AuthorID       int        `json:"author_id"`
+	AuthorUsername string     `json:"author_username"`
+	PlaceID        string     `json:"place_id"`
+	CityName       string     `json:"city_name"`
+	Message        string     `json:"message"`
+	Link           string     `json:"link"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
 }
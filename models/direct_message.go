@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Conversation is a private 1:1 thread between two users.
+// UserAID is always the lower of the two user IDs so each pair has one row.
+type Conversation struct {
+	ID            int       `json:"id"`
+	UserAID       int       `json:"user_a_id"`
+	UserBID       int       `json:"user_b_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastMessageAt time.Time `json:"last_message_at"`
+}
+
+// OtherUserID returns the participant that is not userID
+func (c *Conversation) OtherUserID(userID int) int {
+	if c.UserAID == userID {
+		return c.UserBID
+	}
+	return c.UserAID
+}
+
+// HasParticipant reports whether userID is one of the two participants
+func (c *Conversation) HasParticipant(userID int) bool {
+	return c.UserAID == userID || c.UserBID == userID
+}
+
+// ConversationSummary is one entry in a user's conversation list
+type ConversationSummary struct {
+	ID             int       `json:"id"`
+	OtherUserID    int       `json:"other_user_id"`
+	OtherUsername  string    `json:"other_username"`
+	OtherAvatarURL string    `json:"other_avatar_url"`
+	LastMessage    string    `json:"last_message"`
+	LastMessageAt  time.Time `json:"last_message_at"`
+	UnreadCount    int       `json:"unread_count"`
+	Blocked        bool      `json:"blocked"`
+}
+
+// BlockedUser is a user that the current user has blocked
+type BlockedUser struct {
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Ground report conditions users can report
+const (
+	ReportConditionHail        = "hail"
+	ReportConditionFlooding    = "flooding"
+	ReportConditionFog         = "fog"
+	ReportConditionIceOnRoad   = "ice_on_road"
+	ReportConditionPowerOutage = "power_outage"
+)
+
+// Ground report intensities, from least to most severe
+const (
+	ReportIntensityLight    = 1
+	ReportIntensityModerate = 2
+	ReportIntensitySevere   = 3
+)
+
+// GroundReport is a structured "ground truth" observation posted by a user
+type GroundReport struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Condition string    `json:"condition"`
+	Intensity int       `json:"intensity"`
+	Note      string    `json:"note,omitempty"`
+	PhotoURL  string    `json:"photo_url,omitempty"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GroundReportArea aggregates the reports of one condition within one area
+type GroundReportArea struct {
+	Condition    string    `json:"condition"`
+	Count        int       `json:"count"`
+	MaxIntensity int       `json:"max_intensity"`
+	AvgIntensity float64   `json:"avg_intensity"`
+	Latitude     float64   `json:"latitude"`  // Centroid of the reports
+	Longitude    float64   `json:"longitude"` // Centroid of the reports
+	DistanceKm   float64   `json:"distance_km"`
+	LatestAt     time.Time `json:"latest_at"`
+	PhotoURLs    []string  `json:"photo_urls,omitempty"`
+}
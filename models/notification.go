@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Notification outbox statuses
+const (
+	OutboxStatusSent   = "sent"
+	OutboxStatusFailed = "failed"
+)
+
+// OutboxEntry is a record of an email the app tried to send
+type OutboxEntry struct {
+	ID        int       `json:"id"`
+	Recipient string    `json:"recipient"`
+	Subject   string    `json:"subject"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
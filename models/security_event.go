@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Security event types
+const (
+	SecurityEventLoginSuccess  = "login_success"
+	SecurityEventLoginFailed   = "login_failed"
+	SecurityEventAccountLocked = "account_locked"
+)
+
+// SecurityEvent is a sign-in related event shown in the profile security log
+type SecurityEvent struct {
+	ID        int       `json:"id"`
+	EventType string    `json:"event_type"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Upload purposes
+const (
+	UploadPurposeChat    = "chat"
+	UploadPurposeProfile = "profile"
+	UploadPurposeMisc    = "misc"
+)
+
+// Upload is an uploaded image and the blob keys of its stored variants
+type Upload struct {
+	ID           int               `json:"id"`
+	UserID       int               `json:"user_id"`
+	Purpose      string            `json:"purpose"`
+	URL          string            `json:"url"`  // Media URL of the original variant
+	URLs         map[string]string `json:"urls"` // Media URL of every variant by name
+	Keys         map[string]string `json:"-"`    // Blob key of every variant by name
+	SizeBytes    int64             `json:"size_bytes"`
+	Width        int               `json:"width"`
+	Height       int               `json:"height"`
+	ReferencedAt *time.Time        `json:"referenced_at,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+// UploadUsage is how much upload storage a user has used against their quotas
+type UploadUsage struct {
+	DailyBytes int64 `json:"daily_bytes"`
+	DailyLimit int64 `json:"daily_limit"`
+	TotalBytes int64 `json:"total_bytes"`
+	TotalLimit int64 `json:"total_limit"`
+}
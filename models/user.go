@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,6 +16,9 @@ type User struct {
 	ID                   int       `json:"id" db:"id"`
 	Username             string    `json:"username" db:"username"`
 	Email                string    `json:"email" db:"email"`
+	EmailVerified        bool      `json:"email_verified" db:"email_verified"`
+	Role                 string    `json:"role" db:"role"`
+	Disabled             bool      `json:"disabled" db:"disabled"`
 	Password             string    `json:"-" db:"password"` // Password is excluded from JSON responses
 	HomeCity             string    `json:"home_city" db:"home_city"`
 	NotificationsEnabled bool      `json:"notifications_enabled" db:"notifications_enabled"`
@@ -25,6 +29,40 @@ type User struct {
 	UpdatedAt            time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// User roles, from least to most privileged
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// roleRanks orders the roles so higher roles include the rights of lower ones
+var roleRanks = map[string]int{RoleUser: 0, RoleModerator: 1, RoleAdmin: 2}
+
+// IsValidRole reports whether role is a known user role
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// HasRole reports whether the user has role or a more privileged one
+func (u *User) HasRole(role string) bool {
+	rank, ok := roleRanks[u.Role]
+	return ok && rank >= roleRanks[role]
+}
+
+// BotUsername is the username of the built-in chat bot. Nobody else can sign up with it.
+const BotUsername = "WeatherBot"
+
+// ErrUsernameReserved is returned when a new account asks for a username kept for the app
+var ErrUsernameReserved = errors.New("this username is reserved")
+
+// IsReservedUsername reports whether a username is kept for the app's own accounts,
+// ignoring case
+func IsReservedUsername(username string) bool {
+	return strings.EqualFold(strings.TrimSpace(username), BotUsername)
+}
+
 // UserStore interface defines methods for user data storage
 type UserStore interface {
 	CreateUser(user *User) error
@@ -77,6 +115,11 @@ func (s *MySQLStore) Close() error {
 
 // CreateUser adds a new user to the store
 func (s *MySQLStore) CreateUser(user *User) error {
+	// The bot's account is created separately, so no one can sign up as it
+	if IsReservedUsername(user.Username) {
+		return ErrUsernameReserved
+	}
+
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -97,6 +140,9 @@ func (s *MySQLStore) CreateUser(user *User) error {
 		user.AvatarColor = "blue" // Default avatar color
 	}
 
+	// New accounts never get elevated rights
+	user.Role = RoleUser
+
 	// Start a transaction
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -140,8 +186,8 @@ func (s *MySQLStore) CreateUser(user *User) error {
 func (s *MySQLStore) GetUserByUsername(username string) (*User, error) {
 	user := &User{}
 	err := s.db.QueryRow(
-		"SELECT id, username, email, password, home_city, notifications_enabled, alert_threshold, profile_photo, avatar_color, created_at, updated_at FROM users WHERE username = ?",
-		username).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.HomeCity,
+		"SELECT id, username, email, email_verified, role, disabled, password, home_city, notifications_enabled, alert_threshold, profile_photo, avatar_color, created_at, updated_at FROM users WHERE username = ?",
+		username).Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerified, &user.Role, &user.Disabled, &user.Password, &user.HomeCity,
 		&user.NotificationsEnabled, &user.AlertThreshold, &user.ProfilePhoto, &user.AvatarColor, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
@@ -158,8 +204,8 @@ func (s *MySQLStore) GetUserByUsername(username string) (*User, error) {
 func (s *MySQLStore) GetUserByEmail(email string) (*User, error) {
 	user := &User{}
 	err := s.db.QueryRow(
-		"SELECT id, username, email, password, home_city, notifications_enabled, alert_threshold, profile_photo, avatar_color, created_at, updated_at FROM users WHERE email = ?",
-		email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.HomeCity,
+		"SELECT id, username, email, email_verified, role, disabled, password, home_city, notifications_enabled, alert_threshold, profile_photo, avatar_color, created_at, updated_at FROM users WHERE email = ?",
+		email).Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerified, &user.Role, &user.Disabled, &user.Password, &user.HomeCity,
 		&user.NotificationsEnabled, &user.AlertThreshold, &user.ProfilePhoto, &user.AvatarColor, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
@@ -176,8 +222,8 @@ func (s *MySQLStore) GetUserByEmail(email string) (*User, error) {
 func (s *MySQLStore) GetUserByID(id int) (*User, error) {
 	user := &User{}
 	err := s.db.QueryRow(
-		"SELECT id, username, email, password, home_city, notifications_enabled, alert_threshold, profile_photo, avatar_color, created_at, updated_at FROM users WHERE id = ?",
-		id).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.HomeCity,
+		"SELECT id, username, email, email_verified, role, disabled, password, home_city, notifications_enabled, alert_threshold, profile_photo, avatar_color, created_at, updated_at FROM users WHERE id = ?",
+		id).Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerified, &user.Role, &user.Disabled, &user.Password, &user.HomeCity,
 		&user.NotificationsEnabled, &user.AlertThreshold, &user.ProfilePhoto, &user.AvatarColor, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
@@ -194,9 +240,11 @@ func (s *MySQLStore) GetUserByID(id int) (*User, error) {
 func (s *MySQLStore) GetUsersWithDailyReports() ([]*User, error) {
 	users := []*User{}
 	query := `
-        SELECT id, username, email, password, home_city, notifications_enabled, alert_threshold, profile_photo, avatar_color, created_at, updated_at 
+        SELECT id, username, email, email_verified, role, disabled, password, home_city, notifications_enabled, alert_threshold, profile_photo, avatar_color, created_at, updated_at 
         FROM users 
         WHERE notifications_enabled = true 
+        AND email_verified = true 
+        AND disabled = false 
         AND alert_threshold = 'all' 
         AND home_city != ''
     `
@@ -210,7 +258,7 @@ func (s *MySQLStore) GetUsersWithDailyReports() ([]*User, error) {
 	for rows.Next() {
 		user := &User{}
 		err := rows.Scan(
-			&user.ID, &user.Username, &user.Email, &user.Password,
+			&user.ID, &user.Username, &user.Email, &user.EmailVerified, &user.Role, &user.Disabled, &user.Password,
 			&user.HomeCity, &user.NotificationsEnabled, &user.AlertThreshold,
 			&user.ProfilePhoto, &user.AvatarColor, &user.CreatedAt, &user.UpdatedAt,
 		)
@@ -226,11 +274,14 @@ func (s *MySQLStore) GetUsersWithDailyReports() ([]*User, error) {
 // UpdateUser updates an existing user
 func (s *MySQLStore) UpdateUser(user *User) error {
 	// Get existing user to confirm it exists
-	_, err := s.GetUserByID(user.ID)
+	existingUser, err := s.GetUserByID(user.ID)
 	if err != nil {
 		return err
 	}
 
+	// A changed email address has to be verified again
+	user.EmailVerified = existingUser.EmailVerified && user.Email == existingUser.Email
+
 	// Update timestamp
 	user.UpdatedAt = time.Now()
 
@@ -249,8 +300,8 @@ func (s *MySQLStore) UpdateUser(user *User) error {
 		}
 
 		_, err = tx.Exec(
-			"UPDATE users SET email = ?, password = ?, home_city = ?, notifications_enabled = ?, alert_threshold = ?, profile_photo = ?, avatar_color = ?, updated_at = ? WHERE id = ?",
-			user.Email, string(hashedPassword), user.HomeCity, user.NotificationsEnabled, user.AlertThreshold, user.ProfilePhoto, user.AvatarColor, user.UpdatedAt, user.ID)
+			"UPDATE users SET email = ?, email_verified = ?, password = ?, home_city = ?, notifications_enabled = ?, alert_threshold = ?, profile_photo = ?, avatar_color = ?, updated_at = ? WHERE id = ?",
+			user.Email, user.EmailVerified, string(hashedPassword), user.HomeCity, user.NotificationsEnabled, user.AlertThreshold, user.ProfilePhoto, user.AvatarColor, user.UpdatedAt, user.ID)
 
 		if err != nil {
 			return handleUpdateError(err)
@@ -258,8 +309,8 @@ func (s *MySQLStore) UpdateUser(user *User) error {
 	} else {
 		// Otherwise just update other fields
 		_, err = tx.Exec(
-			"UPDATE users SET email = ?, home_city = ?, notifications_enabled = ?, alert_threshold = ?, profile_photo = ?, avatar_color = ?, updated_at = ? WHERE id = ?",
-			user.Email, user.HomeCity, user.NotificationsEnabled, user.AlertThreshold, user.ProfilePhoto, user.AvatarColor, user.UpdatedAt, user.ID)
+			"UPDATE users SET email = ?, email_verified = ?, home_city = ?, notifications_enabled = ?, alert_threshold = ?, profile_photo = ?, avatar_color = ?, updated_at = ? WHERE id = ?",
+			user.Email, user.EmailVerified, user.HomeCity, user.NotificationsEnabled, user.AlertThreshold, user.ProfilePhoto, user.AvatarColor, user.UpdatedAt, user.ID)
 
 		if err != nil {
 			return handleUpdateError(err)
@@ -287,20 +338,11 @@ func (s *MySQLStore) UpdateUserProfile(user *User) error {
 	}
 	defer tx.Rollback()
 
-	// Validate profile photo
-	validPhotos := map[string]bool{
-		"photo1.jpg":  true,
-		"photo2.jpg":  true,
-		"photo3.jpg":  true,
-		"photo4.jpg":  true,
-		"photo5.jpg":  true,
-		"default.jpg": true,
-	}
+	// A changed email address has to be verified again
+	user.EmailVerified = existingUser.EmailVerified && user.Email == existingUser.Email
 
-	// If profile photo is not provided or invalid, keep existing
-	if user.ProfilePhoto == "" || !validPhotos[user.ProfilePhoto] {
-		user.ProfilePhoto = existingUser.ProfilePhoto
-	}
+	// Profile photos only change through UploadService.SetProfilePhoto, which keeps the uploads table in step
+	user.ProfilePhoto = existingUser.ProfilePhoto
 
 	// If avatar color is not provided, keep existing
 	if user.AvatarColor == "" {
@@ -315,8 +357,8 @@ func (s *MySQLStore) UpdateUserProfile(user *User) error {
 		}
 
 		_, err = tx.Exec(
-			"UPDATE users SET email = ?, password = ?, home_city = ?, notifications_enabled = ?, alert_threshold = ?, profile_photo = ?, avatar_color = ?, updated_at = ? WHERE id = ?",
-			user.Email, string(hashedPassword), user.HomeCity, user.NotificationsEnabled, user.AlertThreshold, user.ProfilePhoto, user.AvatarColor, user.UpdatedAt, user.ID)
+			"UPDATE users SET email = ?, email_verified = ?, password = ?, home_city = ?, notifications_enabled = ?, alert_threshold = ?, profile_photo = ?, avatar_color = ?, updated_at = ? WHERE id = ?",
+			user.Email, user.EmailVerified, string(hashedPassword), user.HomeCity, user.NotificationsEnabled, user.AlertThreshold, user.ProfilePhoto, user.AvatarColor, user.UpdatedAt, user.ID)
 
 		if err != nil {
 			return handleUpdateError(err)
@@ -324,8 +366,8 @@ func (s *MySQLStore) UpdateUserProfile(user *User) error {
 	} else {
 		// Otherwise just update other fields
 		_, err = tx.Exec(
-			"UPDATE users SET email = ?, home_city = ?, notifications_enabled = ?, alert_threshold = ?, profile_photo = ?, avatar_color = ?, updated_at = ? WHERE id = ?",
-			user.Email, user.HomeCity, user.NotificationsEnabled, user.AlertThreshold, user.ProfilePhoto, user.AvatarColor, user.UpdatedAt, user.ID)
+			"UPDATE users SET email = ?, email_verified = ?, home_city = ?, notifications_enabled = ?, alert_threshold = ?, profile_photo = ?, avatar_color = ?, updated_at = ? WHERE id = ?",
+			user.Email, user.EmailVerified, user.HomeCity, user.NotificationsEnabled, user.AlertThreshold, user.ProfilePhoto, user.AvatarColor, user.UpdatedAt, user.ID)
 
 		if err != nil {
 			return handleUpdateError(err)
@@ -351,8 +393,58 @@ func (s *MySQLStore) GetDB() *sql.DB {
 	return s.db
 }
 
+// AvatarURL returns the public URL of the user's profile photo
+func (u *User) AvatarURL() string {
+	return ProfilePhotoURL(u.ProfilePhoto)
+}
+
+// BuiltinProfilePhotos lists the stock avatars in static/profile_photos
+var BuiltinProfilePhotos = []string{"default.jpg", "photo1.jpg", "photo2.jpg", "photo3.jpg", "photo4.jpg", "photo5.jpg"}
+
+// CustomProfilePhotoPrefix is the media URL prefix of uploaded avatars, followed by the user ID
+const CustomProfilePhotoPrefix = "/media/profile_photos/"
+
+// IsBuiltinProfilePhoto reports whether photo is one of the stock avatars
+func IsBuiltinProfilePhoto(photo string) bool {
+	for _, builtin := range BuiltinProfilePhotos {
+		if photo == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCustomProfilePhoto reports whether photo has the form of an avatar uploaded by the user.
+// It doesn't check that the upload still exists.
+func IsCustomProfilePhoto(userID int, photo string) bool {
+	prefix := CustomProfilePhotoPrefix + strconv.Itoa(userID) + "/"
+	name := strings.TrimPrefix(photo, prefix)
+	return name != photo && name != "" && !strings.ContainsAny(name, "/\\?#")
+}
+
+// ProfilePhotoURL returns the public URL for a stored profile photo name
+func ProfilePhotoURL(photo string) string {
+	if photo == "" {
+		photo = "default.jpg"
+	}
+	if strings.HasPrefix(photo, CustomProfilePhotoPrefix) {
+		return photo
+	}
+	return "/static/profile_photos/" + photo
+}
+
 // ValidatePassword checks if the provided password matches the user's password
 func (u *User) ValidatePassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	return err == nil
 }
+
+// UserSession is a signed-in browser session shown in the profile device list
+type UserSession struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
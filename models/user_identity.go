@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// UserIdentity links an account to a user at an external OpenID Connect provider
+type UserIdentity struct {
+	ID          int        `json:"id"`
+	Issuer      string     `json:"issuer"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
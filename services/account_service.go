@@ -0,0 +1,661 @@
+package services
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"path"
+	"time"
+
+	"weather-app/models"
+)
+
+// Account deletion settings
+const (
+	AccountDeletionGracePeriod = 14 * 24 * time.Hour
+	AccountDeletionInterval    = time.Hour
+	DeletedUserName            = "Deleted user"
+	accountDeletionBatchSize   = 50
+)
+
+// Errors returned by account operations
+var (
+	ErrDeletionAlreadyScheduled = errors.New("account deletion is already scheduled")
+	ErrDeletionNotScheduled     = errors.New("account deletion is not scheduled")
+)
+
+// AccountDeletionNotifier tells users that their account is about to be deleted
+type AccountDeletionNotifier interface {
+	SendAccountDeletionScheduled(to, username string, deleteAt time.Time) error
+}
+
+// exportChatMessage is a city chat message in a data export
+type exportChatMessage struct {
+	ID        int        `json:"id"`
+	CityName  string     `json:"city_name"`
+	PlaceID   string     `json:"place_id,omitempty"`
+	Message   string     `json:"message"`
+	ImageURL  string     `json:"image_url,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// exportDirectMessage is a direct message the user sent, in a data export
+type exportDirectMessage struct {
+	ID             int        `json:"id"`
+	ConversationID int        `json:"conversation_id"`
+	To             string     `json:"to"`
+	Message        string     `json:"message"`
+	ImageURL       string     `json:"image_url,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	EditedAt       *time.Time `json:"edited_at,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+}
+
+// exportGroundReport is a ground report in a data export
+type exportGroundReport struct {
+	ID        int       `json:"id"`
+	Condition string    `json:"condition"`
+	Intensity int       `json:"intensity"`
+	Note      string    `json:"note,omitempty"`
+	PhotoURL  string    `json:"photo_url,omitempty"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// exportUpload is an uploaded image in a data export; File is its path inside the archive
+type exportUpload struct {
+	Purpose   string    `json:"purpose"`
+	URL       string    `json:"url"`
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	File      string    `json:"file,omitempty"`
+	key       string
+}
+
+// AccountService exports a user's personal data and deletes accounts once their grace
+// period is over
+type AccountService struct {
+	db       *sql.DB
+	store    BlobStore
+	notifier AccountDeletionNotifier
+}
+
+// NewAccountService creates a new instance of AccountService
+func NewAccountService(db *sql.DB, store BlobStore, notifier AccountDeletionNotifier) *AccountService {
+	return &AccountService{
+		db:       db,
+		store:    store,
+		notifier: notifier,
+	}
+}
+
+// WriteExport writes a ZIP archive of the user's personal data to w: one JSON file per kind
+// of data, plus the original of every uploaded image. The data is read before anything is
+// written, so an error before the first write leaves w untouched.
+func (s *AccountService) WriteExport(user *models.User, w io.Writer) error {
+	savedCities, err := s.exportSavedCities(user.ID)
+	if err != nil {
+		return err
+	}
+	chatMessages, err := s.exportChatMessages(user.ID)
+	if err != nil {
+		return err
+	}
+	directMessages, err := s.exportDirectMessages(user.ID)
+	if err != nil {
+		return err
+	}
+	groundReports, err := s.exportGroundReports(user.ID)
+	if err != nil {
+		return err
+	}
+	uploads, err := s.exportUploads(user.ID)
+	if err != nil {
+		return err
+	}
+	notifications, err := s.exportNotifications(user.Email)
+	if err != nil {
+		return err
+	}
+	activities, err := s.exportActivities(user.ID)
+	if err != nil {
+		return err
+	}
+	customActivities, err := s.exportCustomActivities(user.ID)
+	if err != nil {
+		return err
+	}
+	activityWindows, err := s.exportActivityWindows(user.ID)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"saved_cities.json", savedCities},
+		{"chat_messages.json", chatMessages},
+		{"direct_messages.json", directMessages},
+		{"ground_reports.json", groundReports},
+		{"uploads.json", uploads},
+		{"notifications.json", notifications},
+		{"activity_history.json", activities},
+		{"custom_activities.json", customActivities},
+		{"custom_activity_windows.json", activityWindows},
+	}
+	for _, file := range files {
+		if err := writeZipJSON(archive, file.name, file.data); err != nil {
+			return err
+		}
+	}
+
+	for _, upload := range uploads {
+		if upload.File == "" {
+			continue
+		}
+		if err := s.copyBlob(archive, upload.File, upload.key); err != nil {
+			// Keep going; the JSON still lists the upload's URL
+			log.Printf("Error adding upload %s to export of user %d: %v", upload.URL, user.ID, err)
+		}
+	}
+
+	return archive.Close()
+}
+
+// ScheduleDeletion schedules the user's account for deletion after the grace period and
+// emails them about it. It returns when the account will be deleted.
+func (s *AccountService) ScheduleDeletion(userID int) (time.Time, error) {
+	result, err := s.db.Exec(
+		"UPDATE users SET deletion_scheduled_at = NOW() + INTERVAL ? SECOND WHERE id = ? AND deletion_scheduled_at IS NULL",
+		int(AccountDeletionGracePeriod.Seconds()), userID,
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return time.Time{}, err
+	} else if affected == 0 {
+		return time.Time{}, ErrDeletionAlreadyScheduled
+	}
+
+	var username, email string
+	var deleteAt time.Time
+	err = s.db.QueryRow(
+		"SELECT username, email, deletion_scheduled_at FROM users WHERE id = ?",
+		userID,
+	).Scan(&username, &email, &deleteAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	log.Printf("Account deletion scheduled for user %d at %v", userID, deleteAt)
+	if err := s.notifier.SendAccountDeletionScheduled(email, username, deleteAt); err != nil {
+		log.Printf("Error sending account deletion email: %v", err)
+	}
+	return deleteAt, nil
+}
+
+// CancelDeletion keeps an account that was scheduled for deletion
+func (s *AccountService) CancelDeletion(userID int) error {
+	result, err := s.db.Exec(
+		"UPDATE users SET deletion_scheduled_at = NULL WHERE id = ? AND deletion_scheduled_at IS NOT NULL",
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrDeletionNotScheduled
+	}
+	log.Printf("Account deletion cancelled for user %d", userID)
+	return nil
+}
+
+// DeletionScheduledAt returns when the user's account will be deleted, or nil when it is not
+// scheduled for deletion
+func (s *AccountService) DeletionScheduledAt(userID int) (*time.Time, error) {
+	var scheduledAt sql.NullTime
+	if err := s.db.QueryRow("SELECT deletion_scheduled_at FROM users WHERE id = ?", userID).Scan(&scheduledAt); err != nil {
+		return nil, err
+	}
+	if !scheduledAt.Valid {
+		return nil, nil
+	}
+	return &scheduledAt.Time, nil
+}
+
+// DeleteScheduled deletes the accounts whose grace period is over and returns how many
+// were deleted
+func (s *AccountService) DeleteScheduled() (int, error) {
+	rows, err := s.db.Query(
+		"SELECT id FROM users WHERE deletion_scheduled_at <= NOW() ORDER BY deletion_scheduled_at LIMIT ?",
+		accountDeletionBatchSize,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, userID := range userIDs {
+		if err := s.deleteAccount(userID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// deleteAccount deletes a user and their data in one transaction. Their city chat messages
+// stay, attributed to DeletedUserName, so conversations still make sense; everything else
+// goes. Tables with a foreign key to users are cleared by ON DELETE CASCADE. Blobs are
+// deleted after the commit, except images still shown in the anonymized chat messages.
+func (s *AccountService) deleteAccount(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user and make sure the deletion was not cancelled in the meantime
+	var email string
+	err = tx.QueryRow(
+		"SELECT email FROM users WHERE id = ? AND deletion_scheduled_at <= NOW() FOR UPDATE",
+		userID,
+	).Scan(&email)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	blobKeys, err := unsharedUploadKeys(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"DELETE e FROM chat_message_edits e JOIN chat_messages m ON m.id = e.message_id WHERE m.user_id = ?", []interface{}{userID}},
+		{"UPDATE chat_messages SET user_id = 0, username = ?, avatar_url = ? WHERE user_id = ?", []interface{}{DeletedUserName, models.ProfilePhotoURL("default.jpg"), userID}},
+		{"DELETE FROM chat_message_reactions WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM chat_mentions WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM chat_active_users WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE m FROM dm_messages m JOIN dm_conversations c ON c.id = m.conversation_id WHERE c.user_a_id = ? OR c.user_b_id = ?", []interface{}{userID, userID}},
+		{"DELETE r FROM dm_reads r JOIN dm_conversations c ON c.id = r.conversation_id WHERE c.user_a_id = ? OR c.user_b_id = ?", []interface{}{userID, userID}},
+		{"DELETE FROM dm_conversations WHERE user_a_id = ? OR user_b_id = ?", []interface{}{userID, userID}},
+		{"DELETE FROM user_blocks WHERE blocker_id = ? OR blocked_id = ?", []interface{}{userID, userID}},
+		{"DELETE FROM ground_reports WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM saved_cities WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM user_activities WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM custom_activities WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM uploads WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM user_sessions WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM notification_outbox WHERE recipient = ?", []interface{}{email}},
+		{"DELETE FROM users WHERE id = ?", []interface{}{userID}},
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement.query, statement.args...); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Deleted account of user %d", userID)
+
+	for _, key := range blobKeys {
+		if err := s.store.Delete(key); err != nil {
+			log.Printf("Error deleting blob %s of deleted user %d: %v", key, userID, err)
+		}
+	}
+	return nil
+}
+
+// unsharedUploadKeys returns the blob keys of a user's uploads that no chat message shows
+func unsharedUploadKeys(tx *sql.Tx, userID int) ([]string, error) {
+	rows, err := tx.Query(
+		`SELECT u.id, u.blob_keys
+		FROM uploads u
+		WHERE u.user_id = ? AND NOT EXISTS (SELECT 1 FROM chat_messages m WHERE m.image_url = u.url)`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var id int
+		var keysJSON string
+		if err := rows.Scan(&id, &keysJSON); err != nil {
+			return nil, err
+		}
+
+		var variants map[string]string
+		if err := json.Unmarshal([]byte(keysJSON), &variants); err != nil {
+			log.Printf("Skipping upload %d with unreadable blob keys: %v", id, err)
+			continue
+		}
+		for _, key := range variants {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, rows.Err()
+}
+
+// exportSavedCities returns the names of the user's saved cities
+func (s *AccountService) exportSavedCities(userID int) ([]string, error) {
+	rows, err := s.db.Query("SELECT city_name FROM saved_cities WHERE user_id = ? ORDER BY city_name", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cities := make([]string, 0)
+	for rows.Next() {
+		var city string
+		if err := rows.Scan(&city); err != nil {
+			return nil, err
+		}
+		cities = append(cities, city)
+	}
+
+	return cities, rows.Err()
+}
+
+// exportChatMessages returns every city chat message the user posted, including deleted ones
+func (s *AccountService) exportChatMessages(userID int) ([]exportChatMessage, error) {
+	rows, err := s.db.Query(
+		`SELECT id, city_name, place_id, message, image_url, created_at, edited_at, deleted_at
+		FROM chat_messages
+		WHERE user_id = ?
+		ORDER BY created_at, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]exportChatMessage, 0)
+	for rows.Next() {
+		var msg exportChatMessage
+		var placeID sql.NullString
+		var editedAt, deletedAt sql.NullTime
+		if err := rows.Scan(&msg.ID, &msg.CityName, &placeID, &msg.Message, &msg.ImageURL, &msg.CreatedAt, &editedAt, &deletedAt); err != nil {
+			return nil, err
+		}
+		msg.PlaceID = placeID.String
+		msg.EditedAt = nullTimePtr(editedAt)
+		msg.DeletedAt = nullTimePtr(deletedAt)
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// exportDirectMessages returns every direct message the user sent
+func (s *AccountService) exportDirectMessages(userID int) ([]exportDirectMessage, error) {
+	rows, err := s.db.Query(
+		`SELECT m.id, m.conversation_id, u.username, m.message, m.image_url, m.created_at, m.edited_at, m.deleted_at
+		FROM dm_messages m
+		JOIN dm_conversations c ON c.id = m.conversation_id
+		JOIN users u ON u.id = IF(c.user_a_id = ?, c.user_b_id, c.user_a_id)
+		WHERE m.sender_id = ?
+		ORDER BY m.created_at, m.id`,
+		userID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]exportDirectMessage, 0)
+	for rows.Next() {
+		var msg exportDirectMessage
+		var editedAt, deletedAt sql.NullTime
+		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.To, &msg.Message, &msg.ImageURL, &msg.CreatedAt, &editedAt, &deletedAt); err != nil {
+			return nil, err
+		}
+		msg.EditedAt = nullTimePtr(editedAt)
+		msg.DeletedAt = nullTimePtr(deletedAt)
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// exportGroundReports returns every ground report the user posted
+func (s *AccountService) exportGroundReports(userID int) ([]exportGroundReport, error) {
+	rows, err := s.db.Query(
+		`SELECT id, condition_type, intensity, note, photo_url, latitude, longitude, created_at
+		FROM ground_reports
+		WHERE user_id = ?
+		ORDER BY created_at, id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]exportGroundReport, 0)
+	for rows.Next() {
+		var report exportGroundReport
+		if err := rows.Scan(&report.ID, &report.Condition, &report.Intensity, &report.Note, &report.PhotoURL, &report.Latitude, &report.Longitude, &report.CreatedAt); err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// exportUploads returns the user's uploads with the archive path of each original image
+func (s *AccountService) exportUploads(userID int) ([]exportUpload, error) {
+	rows, err := s.db.Query(
+		"SELECT id, purpose, url, blob_keys, size_bytes, created_at FROM uploads WHERE user_id = ? ORDER BY created_at, id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := make([]exportUpload, 0)
+	for rows.Next() {
+		var id int
+		var keysJSON string
+		var upload exportUpload
+		if err := rows.Scan(&id, &upload.Purpose, &upload.URL, &keysJSON, &upload.SizeBytes, &upload.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		var variants map[string]string
+		if err := json.Unmarshal([]byte(keysJSON), &variants); err == nil && variants["original"] != "" {
+			upload.key = variants["original"]
+			upload.File = "images/" + path.Base(upload.key)
+		}
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
+
+// exportNotifications returns the emails sent to the user that are still in the outbox
+func (s *AccountService) exportNotifications(email string) ([]models.OutboxEntry, error) {
+	rows, err := s.db.Query(
+		`SELECT id, recipient, subject, status, error, created_at
+		FROM notification_outbox
+		WHERE recipient = ?
+		ORDER BY created_at, id`,
+		email,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]models.OutboxEntry, 0)
+	for rows.Next() {
+		var entry models.OutboxEntry
+		if err := rows.Scan(&entry.ID, &entry.Recipient, &entry.Subject, &entry.Status, &entry.Error, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// exportActivities returns the user's activity history, oldest first
+func (s *AccountService) exportActivities(userID int) ([]models.Activity, error) {
+	rows, err := s.db.Query(
+		`SELECT id, user_id, activity_type, city, latitude, longitude, details, created_at
+		FROM user_activities
+		WHERE user_id = ?
+		ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activities := make([]models.Activity, 0)
+	for rows.Next() {
+		var activity models.Activity
+		if err := rows.Scan(&activity.ID, &activity.UserID, &activity.Type, &activity.City,
+			&activity.Latitude, &activity.Longitude, &activity.Details, &activity.Timestamp); err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+
+	return activities, rows.Err()
+}
+
+// exportCustomActivities returns the activities the user defined, oldest first
+func (s *AccountService) exportCustomActivities(userID int) ([]CustomActivity, error) {
+	rows, err := s.db.Query(
+		"SELECT "+customActivityColumns+" FROM custom_activities WHERE user_id = ? ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activities := make([]CustomActivity, 0)
+	for rows.Next() {
+		activity, err := scanCustomActivity(rows)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+
+	return activities, rows.Err()
+}
+
+// exportActivityWindows returns the weather windows found for the user's custom activities
+func (s *AccountService) exportActivityWindows(userID int) ([]ActivityWindow, error) {
+	rows, err := s.db.Query(
+		`SELECT w.id, w.activity_id, w.start_at, w.end_at, w.score, w.planned, w.created_at
+		FROM custom_activity_windows w
+		JOIN custom_activities a ON a.id = w.activity_id
+		WHERE a.user_id = ?
+		ORDER BY w.activity_id, w.start_at`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := make([]ActivityWindow, 0)
+	for rows.Next() {
+		var window ActivityWindow
+		if err := rows.Scan(&window.ID, &window.ActivityID, &window.Start, &window.End,
+			&window.Score, &window.Planned, &window.CreatedAt); err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+
+	return windows, rows.Err()
+}
+
+// copyBlob copies a blob into the archive under name
+func (s *AccountService) copyBlob(archive *zip.Writer, name, key string) error {
+	blob, _, err := s.store.Open(key)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	// Images are already compressed
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, blob)
+	return err
+}
+
+// writeZipJSON adds v to the archive as an indented JSON file
+func writeZipJSON(archive *zip.Writer, name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	return err
+}
+
+// nullTimePtr returns a pointer to a nullable time's value, or nil
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
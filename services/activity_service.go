@@ -62,6 +62,7 @@ type WeatherActivities struct {
 	HomeGarden        []ActivityRecommendation `json:"homeGarden"`
 	Allergens         []AllergenInfo           `json:"allergens"`
 	HealthImpacts     []HealthImpact           `json:"healthImpacts"`
+	Pollen            *PollenData              `json:"pollen"`
 }
 
 // PollutionData represents air quality and pollution data
@@ -81,27 +82,87 @@ type PollutionData struct {
 	} `json:"components"`
 }
 
-// PollenData represents pollen counts and allergen data
-// Note: This is a simplified model, as actual pollen data depends on your specific API
+// PollenData represents pollen counts and allergen data on a 0-100 scale. Source says where
+// the counts came from; Estimated is set when they are not measurements, and EstimatedTypes
+// lists measured readings' types that were filled in from the climatology.
 type PollenData struct {
-	Tree    int `json:"tree"`
-	Grass   int `json:"grass"`
-	Weed    int `json:"weed"`
-	Mold    int `json:"mold"`
-	Ragweed int `json:"ragweed"`
-	Dust    int `json:"dust"`
+	Tree           int      `json:"tree"`
+	Grass          int      `json:"grass"`
+	Weed           int      `json:"weed"`
+	Mold           int      `json:"mold"`
+	Ragweed        int      `json:"ragweed"`
+	Dust           int      `json:"dust"`
+	Source         string   `json:"source"`
+	Estimated      bool     `json:"estimated"`
+	EstimatedTypes []string `json:"estimated_types,omitempty"`
 }
 
-// ActivityService is responsible for providing activity recommendations
+// Activity history limits
+const (
+	ActivityTimelineDefaultLimit = 50
+	ActivityTimelineMaxLimit     = 200
+	ActivityInsightsDefaultDays  = 30
+	ActivityInsightsMaxDays      = 365
+	ActivityRetention            = 365 * 24 * time.Hour
+	activityInsightsCityLimit    = 10
+)
+
+// ActivityInsights summarizes a user's recent activity
+type ActivityInsights struct {
+	Days             int                   `json:"days"`
+	MostViewedCities []models.CityActivity `json:"most_viewed_cities"`
+	RecentCities     []models.CityActivity `json:"recent_cities"`
+	CountsByType     map[string]int        `json:"counts_by_type"`
+}
+
+// ActivityService is responsible for providing activity recommendations and keeping a
+// history of what users looked at
 type ActivityService struct {
-	apiKey string
+	apiKey      string
+	store       models.ActivityStore
+	pollen      PollenProvider
+	pollenCache *pollenCache
+	forecast    ActivityForecastSource
+	forecasts   *forecastCache
 }
 
-// NewActivityService creates a new activity service with the given API key
-func NewActivityService(apiKey string) *ActivityService {
+// NewActivityService creates a new activity service with the given API key, activity store,
+// pollen provider and hourly forecast source. Without a pollen provider, pollen counts are
+// always estimated.
+func NewActivityService(apiKey string, store models.ActivityStore, pollen PollenProvider, forecast ActivityForecastSource) *ActivityService {
 	return &ActivityService{
-		apiKey: apiKey,
+		apiKey:      apiKey,
+		store:       store,
+		pollen:      pollen,
+		pollenCache: newPollenCache(),
+		forecast:    forecast,
+		forecasts:   newForecastCache(),
+	}
+}
+
+// ActivityWindows are the best upcoming times for each built-in activity at a location
+type ActivityWindows struct {
+	TimezoneOffset int                   `json:"timezone_offset"`
+	Activities     []ActivitySuitability `json:"activities"`
+}
+
+// GetActivityWindows scores every hour of the forecast for each built-in activity and returns
+// each activity's best windows. Forecasts are cached by location for a few minutes.
+func (s *ActivityService) GetActivityWindows(lat, lon float64) (*ActivityWindows, error) {
+	forecast, ok := s.forecasts.get(lat, lon)
+	if !ok {
+		var err error
+		forecast, err = s.forecast.HourlyForecast(lat, lon)
+		if err != nil {
+			return nil, err
+		}
+		s.forecasts.add(lat, lon, forecast)
 	}
+
+	return &ActivityWindows{
+		TimezoneOffset: forecast.TimezoneOffset,
+		Activities:     EvaluateActivities(DefaultActivityProfiles, forecast.Hours),
+	}, nil
 }
 
 // GetAirPollutionData fetches air pollution data from OpenWeatherMap
@@ -135,58 +196,42 @@ func (s *ActivityService) GetAirPollutionData(lat, lon float64) (*PollutionData,
 	return &result.List[0], nil
 }
 
-// GetPollenData would fetch pollen data from a third-party API
-// Note: You'll need to integrate with a specific provider for this data
+// GetPollenData returns current pollen counts from the pollen provider, cached by location.
+// When the provider fails or has no data for the location, counts are estimated from the
+// climatology; types the provider doesn't measure are filled in from it too.
 func (s *ActivityService) GetPollenData(lat, lon float64) (*PollenData, error) {
-	// This is a mock implementation
-	// In a real implementation, you would call an actual pollen data API
+	if data, ok := s.pollenCache.get(lat, lon); ok {
+		return data, nil
+	}
 
-	// For demonstration purposes, we're generating synthetic data
-	// based on the current month (since pollen levels are seasonal)
-	month := time.Now().Month()
+	estimate := ClimatologyPollen(lat, time.Now())
+	if s.pollen == nil {
+		s.pollenCache.add(lat, lon, estimate, PollenCacheTTL)
+		return estimate, nil
+	}
 
-	// Generate synthetic pollen data based on typical seasonal patterns
-	pollenData := &PollenData{
-		Tree:    10,
-		Grass:   10,
-		Weed:    10,
-		Mold:    10,
-		Ragweed: 10,
-		Dust:    15,
+	data, err := s.pollen.GetPollen(lat, lon)
+	if err != nil {
+		log.Printf("Warning: Couldn't fetch pollen data for (%.2f, %.2f): %v. Using seasonal estimates.", lat, lon, err)
+		s.pollenCache.add(lat, lon, estimate, PollenEstimateCacheTTL)
+		return estimate, nil
 	}
 
-	// Adjust based on season (Northern Hemisphere patterns)
-	switch {
-	case month >= time.March && month <= time.May: // Spring
-		pollenData.Tree = 60 + (time.Now().Day() % 20)  // High tree pollen in spring
-		pollenData.Grass = 30 + (time.Now().Day() % 30) // Medium grass pollen
-		pollenData.Weed = 20 + (time.Now().Day() % 10)  // Low-medium weed pollen
-		pollenData.Mold = 15 + (time.Now().Day() % 15)  // Low-medium mold
-	case month >= time.June && month <= time.August: // Summer
-		pollenData.Tree = 20 + (time.Now().Day() % 20)    // Low-medium tree pollen
-		pollenData.Grass = 70 + (time.Now().Day() % 20)   // High grass pollen
-		pollenData.Weed = 40 + (time.Now().Day() % 30)    // Medium weed pollen
-		pollenData.Ragweed = 60 + (time.Now().Day() % 30) // Higher ragweed in late summer
-		pollenData.Mold = 40 + (time.Now().Day() % 20)    // Medium-high mold in humid summer
-	case month >= time.September && month <= time.November: // Fall
-		pollenData.Tree = 10 + (time.Now().Day() % 10)    // Low tree pollen
-		pollenData.Grass = 20 + (time.Now().Day() % 20)   // Low-medium grass pollen
-		pollenData.Weed = 60 + (time.Now().Day() % 30)    // High weed pollen
-		pollenData.Ragweed = 70 + (time.Now().Day() % 20) // High ragweed pollen
-		pollenData.Mold = 60 + (time.Now().Day() % 30)    // High mold with falling leaves
-	default: // Winter
-		pollenData.Tree = 5 + (time.Now().Day() % 10)    // Very low tree pollen
-		pollenData.Grass = 5 + (time.Now().Day() % 10)   // Very low grass pollen
-		pollenData.Weed = 5 + (time.Now().Day() % 10)    // Very low weed pollen
-		pollenData.Ragweed = 5 + (time.Now().Day() % 10) // Very low ragweed pollen
-		pollenData.Mold = 20 + (time.Now().Day() % 20)   // Medium indoor mold possible
-		pollenData.Dust = 30 + (time.Now().Day() % 30)   // Higher dust due to heating systems
-	}
-
-	// Add some randomness to make it seem more realistic
-	// In a real implementation, this would come from the API
-
-	return pollenData, nil
+	fill := func(name string, count *int, estimated int) {
+		if *count < 0 {
+			*count = estimated
+			data.EstimatedTypes = append(data.EstimatedTypes, name)
+		}
+	}
+	fill("tree", &data.Tree, estimate.Tree)
+	fill("grass", &data.Grass, estimate.Grass)
+	fill("weed", &data.Weed, estimate.Weed)
+	fill("ragweed", &data.Ragweed, estimate.Ragweed)
+	fill("mold", &data.Mold, estimate.Mold)
+	fill("dust", &data.Dust, estimate.Dust)
+
+	s.pollenCache.add(lat, lon, data, PollenCacheTTL)
+	return data, nil
 }
 
 // GetActivitiesAndHealth generates comprehensive activity recommendations and health information
@@ -234,113 +279,42 @@ func (s *ActivityService) GetActivitiesAndHealth(weatherData *WeatherData, lat,
 		HomeGarden:        s.getHomeGardenActivities(weatherCondition, temperature, humidity),
 		Allergens:         s.getAllergenInfo(pollenData, humidity),
 		HealthImpacts:     s.getHealthImpacts(temperature, humidity, weatherCondition, aqi, pollenData),
+		Pollen:            pollenData,
 	}
 
 	return activities, nil
 }
 
-// getOutdoorActivities generates recommendations for outdoor activities
+// getOutdoorActivities rates the built-in outdoor activities for current conditions
 func (s *ActivityService) getOutdoorActivities(temp float64, condition string, windSpeed float64, isDaytime bool, aqi int) []ActivityRecommendation {
-	activities := []ActivityRecommendation{
-		{Name: "Fishing", Icon: "🎣"},
-		{Name: "Running", Icon: "🏃"},
-		{Name: "Golf", Icon: "⛳"},
-		{Name: "Biking & Cycling", Icon: "🚲"},
-		{Name: "Beach & Pool", Icon: "🏖️"},
-		{Name: "Stargazing", Icon: "🔭"},
-	}
-
-	// Set default status
-	for i := range activities {
-		activities[i].Status = "Good"
-		activities[i].Color = "#4CAF50" // Green
-	}
-
-	// Check if it's raining/snowing/etc.
-	isPrecipitation := strings.Contains(condition, "rain") ||
-		strings.Contains(condition, "snow") ||
-		strings.Contains(condition, "drizzle") ||
-		strings.Contains(condition, "thunderstorm")
-
-	// Check if it's cloudy
-	isCloudy := strings.Contains(condition, "cloud") || strings.Contains(condition, "overcast")
-
-	// Check if it's windy
-	isWindy := windSpeed > 15.0
-
-	// Check if it's extremely hot or cold
-	isExtremeCold := temp < 0
-	isExtremeHot := temp > 35
-
-	// Adjust recommendations based on conditions
-
-	// Fishing
-	if isPrecipitation || isWindy {
-		activities[0].Status = "Fair"
-		activities[0].Color = "#FFC107" // Yellow
-	}
-	if isExtremeCold || isExtremeHot {
-		activities[0].Status = "Poor"
-		activities[0].Color = "#F44336" // Red
-	}
-
-	// Running
-	if isPrecipitation {
-		activities[1].Status = "Fair"
-		activities[1].Color = "#FFC107"
-	}
-	if isExtremeCold || isExtremeHot || aqi > 3 {
-		activities[1].Status = "Poor"
-		activities[1].Color = "#F44336"
-	}
-
-	// Golf
-	if isPrecipitation || isWindy {
-		activities[2].Status = "Poor"
-		activities[2].Color = "#F44336"
-	}
-	if isCloudy && !isPrecipitation && !isWindy {
-		activities[2].Status = "Fair"
-		activities[2].Color = "#FFC107"
-	}
-
-	// Biking & Cycling
-	if isPrecipitation || isWindy {
-		activities[3].Status = "Poor"
-		activities[3].Color = "#F44336"
-	}
-	if isExtremeCold || isExtremeHot || aqi > 3 {
-		activities[3].Status = "Fair"
-		activities[3].Color = "#FFC107"
-	}
-
-	// Beach & Pool
-	if isPrecipitation || isWindy || temp < 20 {
-		activities[4].Status = "Poor"
-		activities[4].Color = "#F44336"
-	}
-	if isCloudy && temp >= 20 && temp < 25 {
-		activities[4].Status = "Fair"
-		activities[4].Color = "#FFC107"
-	}
-
-	// Stargazing
-	if !isDaytime {
-		if isPrecipitation || isCloudy {
-			activities[5].Status = "Poor"
-			activities[5].Color = "#F44336"
-		} else {
-			activities[5].Status = "Ideal"
-			activities[5].Color = "#4CAF50"
+	hour := EstimateConditionHour(temp, windSpeed, condition, isDaytime, aqi)
+
+	activities := make([]ActivityRecommendation, len(DefaultActivityProfiles))
+	for i, profile := range DefaultActivityProfiles {
+		score := ScoreHour(profile.Conditions, hour)
+		activities[i] = ActivityRecommendation{
+			Name:   profile.Name,
+			Status: score.Rating,
+			Icon:   profile.Icon,
+			Color:  suitabilityColor(score.Score),
 		}
-	} else {
-		activities[5].Status = "Poor"
-		activities[5].Color = "#F44336"
 	}
 
 	return activities
 }
 
+// suitabilityColor returns the color of a suitability score
+func suitabilityColor(score int) string {
+	switch {
+	case score >= 60:
+		return "#4CAF50" // Green
+	case score >= 40:
+		return "#FFC107" // Yellow
+	default:
+		return "#F44336" // Red
+	}
+}
+
 // getTravelRecommendations generates recommendations for travel and commute
 func (s *ActivityService) getTravelRecommendations(condition string, windSpeed float64, temp float64, aqi int) []ActivityRecommendation {
 	activities := []ActivityRecommendation{
@@ -539,12 +513,57 @@ func getAllergenColor(level int) string {
 
 // RecordActivity records a user's weather-related activity
 func (s *ActivityService) RecordActivity(activity models.Activity) error {
-	// In a production implementation, you would store this in your database
-	// For now, we'll just log it
-	log.Printf("Recording activity: User ID=%d, Type=%s, Location=(%.4f, %.4f), Time=%v",
-		activity.UserID, activity.Type, activity.Latitude, activity.Longitude, activity.Timestamp)
+	activity.City = truncate(strings.TrimSpace(activity.City), 100)
+	activity.Details = truncate(activity.Details, 500)
+	return s.store.RecordActivity(activity)
+}
+
+// Timeline returns a page of a user's activities, newest first
+func (s *ActivityService) Timeline(userID int, filter models.ActivityFilter) ([]models.Activity, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = ActivityTimelineDefaultLimit
+	}
+	if filter.Limit > ActivityTimelineMaxLimit {
+		filter.Limit = ActivityTimelineMaxLimit
+	}
+	return s.store.GetTimeline(userID, filter)
+}
+
+// Insights returns a user's most viewed cities and activity counts over the last days, and
+// the cities they looked at most recently
+func (s *ActivityService) Insights(userID, days int) (*ActivityInsights, error) {
+	if days <= 0 {
+		days = ActivityInsightsDefaultDays
+	}
+	if days > ActivityInsightsMaxDays {
+		days = ActivityInsightsMaxDays
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	mostViewed, err := s.store.GetMostViewedCities(userID, since, activityInsightsCityLimit)
+	if err != nil {
+		return nil, err
+	}
+	recent, err := s.store.GetRecentCities(userID, activityInsightsCityLimit)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.store.CountByType(userID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ActivityInsights{
+		Days:             days,
+		MostViewedCities: mostViewed,
+		RecentCities:     recent,
+		CountsByType:     counts,
+	}, nil
+}
 
-	return nil
+// DeleteOldActivities deletes activities older than ActivityRetention
+func (s *ActivityService) DeleteOldActivities() (int, error) {
+	return s.store.DeleteOlderThan(time.Now().Add(-ActivityRetention))
 }
 
 // getHealthImpacts generates information about potential health impacts
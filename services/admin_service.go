@@ -0,0 +1,237 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"weather-app/models"
+)
+
+// Admin console limits
+const (
+	AdminUsersPageSize    = 50
+	AdminRoomMessageLimit = 100
+	adminRoomListLimit    = 50
+)
+
+// Errors returned by admin operations
+var (
+	ErrUserNotFound     = errors.New("user not found")
+	ErrInvalidRole      = errors.New("role must be user, moderator or admin")
+	ErrCannotModifySelf = errors.New("you cannot change your own role or disable your own account")
+	// ErrAccountDisabled is returned by every sign-in path when an admin has disabled the account
+	ErrAccountDisabled = errors.New("this account has been disabled, please contact support")
+)
+
+// AdminChatRoom summarizes a chat room's activity for moderators
+type AdminChatRoom struct {
+	PlaceID       string    `json:"place_id"`
+	Name          string    `json:"name"`
+	Messages24h   int       `json:"messages_24h"`
+	TotalMessages int       `json:"total_messages"`
+	LastMessageAt time.Time `json:"last_message_at"`
+}
+
+// AdminService backs the admin console: user management and chat moderation queries
+type AdminService struct {
+	db *sql.DB
+}
+
+// NewAdminService creates a new instance of AdminService
+func NewAdminService(db *sql.DB) *AdminService {
+	return &AdminService{
+		db: db,
+	}
+}
+
+// ListUsers returns a page of users whose username or email contains search, newest
+// first, and the total number of matches
+func (s *AdminService) ListUsers(search string, page int) ([]models.User, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	pattern := "%" + escapeLike(strings.TrimSpace(search)) + "%"
+
+	var total int
+	err := s.db.QueryRow(
+		"SELECT COUNT(*) FROM users WHERE username LIKE ? OR email LIKE ?",
+		pattern, pattern,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(
+		`SELECT id, username, email, email_verified, role, disabled, home_city, created_at
+		FROM users
+		WHERE username LIKE ? OR email LIKE ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?`,
+		pattern, pattern, AdminUsersPageSize, (page-1)*AdminUsersPageSize,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerified, &user.Role, &user.Disabled, &user.HomeCity, &user.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// SetDisabled disables or re-enables an account. Disabling signs the user out everywhere
+// and deletes their API tokens.
+func (s *AdminService) SetDisabled(actorID, userID int, disabled bool) error {
+	if actorID == userID {
+		return ErrCannotModifySelf
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE users SET disabled = ? WHERE id = ?", disabled, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.requireUser(tx, result, userID); err != nil {
+		return err
+	}
+
+	if disabled {
+		if _, err := tx.Exec("DELETE FROM user_sessions WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM api_tokens WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Admin %d set disabled=%t for user %d", actorID, disabled, userID)
+	return nil
+}
+
+// SetRole changes a user's role
+func (s *AdminService) SetRole(actorID, userID int, role string) error {
+	if !models.IsValidRole(role) {
+		return ErrInvalidRole
+	}
+	if actorID == userID {
+		return ErrCannotModifySelf
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.requireUser(tx, result, userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Admin %d set role=%s for user %d", actorID, role, userID)
+	return nil
+}
+
+// ListChatRooms returns the chat rooms with messages, most active first
+func (s *AdminService) ListChatRooms() ([]AdminChatRoom, error) {
+	rows, err := s.db.Query(
+		`SELECT m.place_id, p.name,
+			SUM(m.created_at > NOW() - INTERVAL 1 DAY) AS messages_24h,
+			COUNT(*) AS total_messages,
+			MAX(m.created_at) AS last_message_at
+		FROM chat_messages m
+		JOIN chat_places p ON p.place_id = m.place_id
+		GROUP BY m.place_id, p.name
+		ORDER BY messages_24h DESC, last_message_at DESC
+		LIMIT ?`,
+		adminRoomListLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := make([]AdminChatRoom, 0)
+	for rows.Next() {
+		var room AdminChatRoom
+		if err := rows.Scan(&room.PlaceID, &room.Name, &room.Messages24h, &room.TotalMessages, &room.LastMessageAt); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+
+	return rooms, rows.Err()
+}
+
+// RoomMessages returns a chat room's most recent messages, newest first, including removed
+// ones so moderators can see what was already handled
+func (s *AdminService) RoomMessages(placeID string) ([]models.ChatMessage, error) {
+	rows, err := s.db.Query(
+		`SELECT id, user_id, username, city_name, place_id, message, image_url, created_at, avatar_url, edited_at, deleted_at, card_json
+		FROM chat_messages
+		WHERE place_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?`,
+		placeID, AdminRoomMessageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]models.ChatMessage, 0)
+	for rows.Next() {
+		msg, err := scanChatMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// requireUser turns an UPDATE that matched no user into ErrUserNotFound. MySQL reports
+// unchanged rows as unaffected, so a missing match is confirmed with a lookup.
+func (s *AdminService) requireUser(tx *sql.Tx, result sql.Result, userID int) error {
+	if affected, err := result.RowsAffected(); err != nil || affected > 0 {
+		return err
+	}
+
+	var exists int
+	err := tx.QueryRow("SELECT 1 FROM users WHERE id = ?", userID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// escapeLike escapes the LIKE wildcards in a search term
+func escapeLike(term string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return replacer.Replace(term)
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"weather-app/models"
+)
+
+// API token limits
+const (
+	APITokenPrefix        = "gwt_"
+	MaxAPITokensPerUser   = 20
+	MaxAPITokenLifetime   = 365 * 24 * time.Hour
+	MaxAPITokenNameLength = 100
+	apiTokenBytes         = 32
+	apiTokenDisplayLength = 12
+	apiTokenTouchInterval = time.Minute
+)
+
+// Errors returned by API token operations
+var (
+	ErrInvalidAPIToken    = errors.New("invalid or expired API token")
+	ErrAPITokenNotFound   = errors.New("API token not found")
+	ErrInvalidTokenName   = errors.New("token name must be 1-100 characters")
+	ErrInvalidTokenScopes = errors.New("choose at least one valid scope")
+	ErrInvalidTokenExpiry = errors.New("token lifetime must be between 1 and 365 days")
+	ErrTooManyAPITokens   = errors.New("too many API tokens, revoke one first")
+)
+
+// APITokenService manages personal access tokens. Only the SHA-256 of a token is stored,
+// so the token is shown to its owner once when it is created.
+type APITokenService struct {
+	db *sql.DB
+}
+
+// NewAPITokenService creates a new instance of APITokenService
+func NewAPITokenService(db *sql.DB) *APITokenService {
+	return &APITokenService{
+		db: db,
+	}
+}
+
+// CreateToken creates a named token with the given scopes that expires after lifetime
+func (s *APITokenService) CreateToken(userID int, name string, scopes []string, lifetime time.Duration) (models.APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > MaxAPITokenNameLength {
+		return models.APIToken{}, ErrInvalidTokenName
+	}
+	scopes = uniqueScopes(scopes)
+	if len(scopes) == 0 {
+		return models.APIToken{}, ErrInvalidTokenScopes
+	}
+	for _, scope := range scopes {
+		if !models.IsValidAPITokenScope(scope) {
+			return models.APIToken{}, ErrInvalidTokenScopes
+		}
+	}
+	if lifetime < 24*time.Hour || lifetime > MaxAPITokenLifetime {
+		return models.APIToken{}, ErrInvalidTokenExpiry
+	}
+
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM api_tokens WHERE user_id = ? AND expires_at > NOW()", userID).Scan(&count); err != nil {
+		return models.APIToken{}, err
+	}
+	if count >= MaxAPITokensPerUser {
+		return models.APIToken{}, ErrTooManyAPITokens
+	}
+
+	secret := APITokenPrefix + randomToken(apiTokenBytes)
+	now := time.Now()
+	token := models.APIToken{
+		Name:      name,
+		Prefix:    secret[:apiTokenDisplayLength],
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: now.Add(lifetime),
+		Token:     secret,
+	}
+
+	result, err := s.db.Exec(
+		`INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, token.Name, hashToken(secret), token.Prefix, strings.Join(scopes, " "), token.CreatedAt, token.ExpiresAt,
+	)
+	if err != nil {
+		return models.APIToken{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.APIToken{}, err
+	}
+	token.ID = int(id)
+
+	return token, nil
+}
+
+// ListTokens returns a user's unexpired tokens, newest first, without their secrets
+func (s *APITokenService) ListTokens(userID int) ([]models.APIToken, error) {
+	rows, err := s.db.Query(
+		`SELECT id, name, token_prefix, scopes, created_at, expires_at, last_used_at
+		FROM api_tokens
+		WHERE user_id = ? AND expires_at > NOW()
+		ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]models.APIToken, 0)
+	for rows.Next() {
+		var token models.APIToken
+		var scopes string
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&token.ID, &token.Name, &token.Prefix, &scopes, &token.CreatedAt, &token.ExpiresAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		token.Scopes = strings.Fields(scopes)
+		if lastUsed.Valid {
+			token.LastUsedAt = &lastUsed.Time
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeToken deletes one of a user's tokens
+func (s *APITokenService) RevokeToken(userID, tokenID int) error {
+	result, err := s.db.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", tokenID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// AuthenticateToken returns the user and scopes of a valid, unexpired token whose owner
+// is not disabled
+func (s *APITokenService) AuthenticateToken(secret string) (int, []string, error) {
+	if !strings.HasPrefix(secret, APITokenPrefix) {
+		return 0, nil, ErrInvalidAPIToken
+	}
+
+	var id, userID int
+	var scopes string
+	err := s.db.QueryRow(
+		`SELECT t.id, t.user_id, t.scopes
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ? AND t.expires_at > NOW() AND u.disabled = FALSE`,
+		hashToken(secret),
+	).Scan(&id, &userID, &scopes)
+	if err == sql.ErrNoRows {
+		return 0, nil, ErrInvalidAPIToken
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Record when the token was last used, at most once per apiTokenTouchInterval
+	s.db.Exec(
+		`UPDATE api_tokens SET last_used_at = NOW()
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL ? SECOND)`,
+		id, int(apiTokenTouchInterval.Seconds()),
+	)
+
+	return userID, strings.Fields(scopes), nil
+}
+
+// DeleteExpired removes expired tokens
+func (s *APITokenService) DeleteExpired() (int, error) {
+	result, err := s.db.Exec("DELETE FROM api_tokens WHERE expires_at <= NOW()")
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// uniqueScopes trims scopes and drops empty and duplicate entries
+func uniqueScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	unique := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		unique = append(unique, scope)
+	}
+	return unique
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiUsagePathSegments is how many path segments identify an upstream endpoint, e.g.
+// "/data/3.0/onecall"; longer paths are cut so per-object URLs don't create new entries
+const apiUsagePathSegments = 3
+
+// APIUsage is the traffic to one upstream endpoint since the server started
+type APIUsage struct {
+	Host          string    `json:"host"`
+	Path          string    `json:"path"`
+	Requests      int       `json:"requests"`
+	RequestsToday int       `json:"requests_today"`
+	Errors        int       `json:"errors"`
+	AvgLatencyMs  int64     `json:"avg_latency_ms"`
+	LastStatus    int       `json:"last_status"`
+	LastRequestAt time.Time `json:"last_request_at"`
+
+	totalLatency time.Duration
+	day          string
+}
+
+// APIUsageTracker is an http.RoundTripper that counts outgoing requests per endpoint, so
+// admins can watch upstream quotas such as OpenWeatherMap's daily call limit. Query
+// strings, which carry API keys, are never recorded.
+type APIUsageTracker struct {
+	next    http.RoundTripper
+	started time.Time
+
+	mu    sync.Mutex
+	usage map[string]*APIUsage
+}
+
+// NewAPIUsageTracker wraps next, usually http.DefaultTransport
+func NewAPIUsageTracker(next http.RoundTripper) *APIUsageTracker {
+	return &APIUsageTracker{
+		next:    next,
+		started: time.Now(),
+		usage:   make(map[string]*APIUsage),
+	}
+}
+
+// RoundTrip sends the request and records its outcome
+func (t *APIUsageTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	latency := time.Since(started)
+
+	path := req.URL.Path
+	if segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", apiUsagePathSegments+1); len(segments) > apiUsagePathSegments {
+		path = "/" + strings.Join(segments[:apiUsagePathSegments], "/") + "/…"
+	}
+	key := req.URL.Host + path
+	today := started.Format("2006-01-02")
+
+	t.mu.Lock()
+	usage, ok := t.usage[key]
+	if !ok {
+		usage = &APIUsage{Host: req.URL.Host, Path: path}
+		t.usage[key] = usage
+	}
+	if usage.day != today {
+		usage.day = today
+		usage.RequestsToday = 0
+	}
+	usage.Requests++
+	usage.RequestsToday++
+	usage.totalLatency += latency
+	usage.AvgLatencyMs = (usage.totalLatency / time.Duration(usage.Requests)).Milliseconds()
+	usage.LastRequestAt = started
+	if err != nil {
+		usage.Errors++
+		usage.LastStatus = 0
+	} else {
+		usage.LastStatus = resp.StatusCode
+		if resp.StatusCode >= 400 {
+			usage.Errors++
+		}
+	}
+	t.mu.Unlock()
+
+	return resp, err
+}
+
+// Usage returns the counters for every endpoint, busiest first, and when counting started
+func (t *APIUsageTracker) Usage() ([]APIUsage, time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	today := time.Now().Format("2006-01-02")
+	usage := make([]APIUsage, 0, len(t.usage))
+	for _, entry := range t.usage {
+		copied := *entry
+		if copied.day != today {
+			copied.RequestsToday = 0
+		}
+		usage = append(usage, copied)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Requests > usage[j].Requests })
+	return usage, t.started
+}
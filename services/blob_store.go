@@ -0,0 +1,222 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MediaURLPrefix is the app path under which stored blobs are served.
+// URLs saved in the database use this prefix so they keep working when the backend changes.
+const MediaURLPrefix = "/media/"
+
+// Errors returned by blob stores
+var (
+	ErrBlobNotFound   = errors.New("blob not found")
+	ErrInvalidBlobKey = errors.New("invalid blob key")
+)
+
+// BlobStore stores uploaded files under slash-separated keys such as "chat_images/abc.jpg"
+type BlobStore interface {
+	// Put stores data under key, replacing any existing blob
+	Put(key string, data []byte, contentType string) error
+	// Open returns the content and content type of a blob, or ErrBlobNotFound
+	Open(key string) (io.ReadCloser, string, error)
+	// Delete removes a blob; deleting a missing blob is not an error
+	Delete(key string) error
+	// DirectURL returns a URL clients can download the blob from without going through
+	// the app, valid for at least expiry, or "" if the blob has to be proxied
+	DirectURL(key string, expiry time.Duration) (string, error)
+}
+
+// MediaURL returns the stable app URL of a blob
+func MediaURL(key string) string {
+	return MediaURLPrefix + key
+}
+
+// MediaKey returns the blob key of an app media URL, or "" if the URL is not a media URL
+func MediaKey(url string) string {
+	if !strings.HasPrefix(url, MediaURLPrefix) {
+		return ""
+	}
+	key, err := cleanBlobKey(strings.TrimPrefix(url, MediaURLPrefix))
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// cleanBlobKey validates a key so it cannot escape the store's root
+func cleanBlobKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidBlobKey
+	}
+
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return "", ErrInvalidBlobKey
+	}
+
+	return cleaned, nil
+}
+
+// blobContentType guesses a content type from the key's extension
+func blobContentType(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// LocalBlobStore keeps blobs as files in a directory
+type LocalBlobStore struct {
+	root          string
+	publicBaseURL string
+}
+
+// NewLocalBlobStore creates a blob store rooted at dir. If publicBaseURL is set (for example a
+// web server or CDN in front of dir), clients are sent there instead of through the app.
+func NewLocalBlobStore(dir, publicBaseURL string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &LocalBlobStore{
+		root:          dir,
+		publicBaseURL: strings.TrimRight(publicBaseURL, "/"),
+	}, nil
+}
+
+// Put writes a blob to a temporary file and renames it into place
+func (s *LocalBlobStore) Put(key string, data []byte, contentType string) error {
+	filename, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// Open opens a blob file
+func (s *LocalBlobStore) Open(key string) (io.ReadCloser, string, error) {
+	filename, err := s.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, "", ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return file, blobContentType(key), nil
+}
+
+// Delete removes a blob file
+func (s *LocalBlobStore) Delete(key string) error {
+	filename, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// DirectURL returns the public URL of a blob when a public base URL is configured
+func (s *LocalBlobStore) DirectURL(key string, expiry time.Duration) (string, error) {
+	if s.publicBaseURL == "" {
+		return "", nil
+	}
+
+	key, err := cleanBlobKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return s.publicBaseURL + "/" + key, nil
+}
+
+// path returns the file name of a key inside the root directory
+func (s *LocalBlobStore) path(key string) (string, error) {
+	key, err := cleanBlobKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// MigrateLegacyUploads copies images uploaded under staticDir before blob storage existed
+// into store and points the chat, direct message and ground report rows at the new media URLs
+func MigrateLegacyUploads(store BlobStore, db execer, staticDir string) (int, error) {
+	entries, err := os.ReadDir(filepath.Join(staticDir, "chat_images"))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(staticDir, "chat_images", entry.Name()))
+		if err != nil {
+			return migrated, err
+		}
+
+		key := "chat_images/" + entry.Name()
+		if err := store.Put(key, data, blobContentType(key)); err != nil {
+			return migrated, err
+		}
+
+		oldURL := "/static/" + key
+		for _, query := range []string{
+			"UPDATE chat_messages SET image_url = ? WHERE image_url = ?",
+			"UPDATE dm_messages SET image_url = ? WHERE image_url = ?",
+			"UPDATE ground_reports SET photo_url = ? WHERE photo_url = ?",
+		} {
+			if _, err := db.Exec(query, MediaURL(key), oldURL); err != nil {
+				return migrated, err
+			}
+		}
+
+		migrated++
+	}
+
+	return migrated, nil
+}
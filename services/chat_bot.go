@@ -0,0 +1,487 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"weather-app/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ChatBotUsername is the username of the built-in weather bot
+const ChatBotUsername = models.BotUsername
+
+// ErrChatBotNameTaken is returned at startup when an account other than the bot has its name
+var ErrChatBotNameTaken = errors.New("an account that is not the chat bot is named " + ChatBotUsername)
+
+// chatBotEmail is the bot account's address, on a domain that can never receive mail
+const chatBotEmail = "weatherbot@goweather.invalid"
+
+// chatBotAvatarURL is the avatar shown next to bot messages
+const chatBotAvatarURL = "/static/Mainlogo.png"
+
+// BotWeatherReport is the weather snapshot the chat bot reports on
+type BotWeatherReport struct {
+	City           string
+	TimezoneOffset int // Shift in seconds from UTC
+	Temp           float64
+	FeelsLike      float64
+	Humidity       int
+	WindSpeed      float64
+	Description    string
+	Icon           string
+	Sunrise        time.Time
+	Sunset         time.Time
+	AQI            int
+	AQICategory    string
+	Daily          []BotDailyForecast
+	Alerts         []BotWeatherAlert
+}
+
+// BotDailyForecast is one day of the forecast used by the /forecast command
+type BotDailyForecast struct {
+	Date        time.Time
+	MinTemp     float64
+	MaxTemp     float64
+	Description string
+	PrecipProb  float64 // Percentage
+}
+
+// BotWeatherAlert is an official weather alert for a city
+type BotWeatherAlert struct {
+	Event       string
+	Sender      string
+	Start       time.Time
+	End         time.Time
+	Description string
+}
+
+// BotWeatherSource fetches the weather the chat bot reports on
+type BotWeatherSource interface {
+	WeatherReport(city string) (*BotWeatherReport, error)
+}
+
+// ChatBot answers slash commands and announces weather alerts in city chat rooms
+type ChatBot struct {
+	chatService *ChatService
+	source      BotWeatherSource
+	botUserID   int
+}
+
+// NewChatBot creates a new chat bot posting as the given user
+func NewChatBot(chatService *ChatService, source BotWeatherSource, botUserID int) *ChatBot {
+	return &ChatBot{
+		chatService: chatService,
+		source:      source,
+		botUserID:   botUserID,
+	}
+}
+
+// EnsureChatBotUser returns the bot's user account, creating it on first start. The bot is
+// the account flagged is_bot, never whoever holds the name; if an account that isn't the bot
+// has the bot's name, the bot can't start.
+func EnsureChatBotUser(userStore models.UserStore) (*models.User, error) {
+	db := userStore.GetDB()
+
+	var botID int
+	err := db.QueryRow("SELECT id FROM users WHERE is_bot = TRUE ORDER BY id LIMIT 1").Scan(&botID)
+	if err == nil {
+		return userStore.GetUserByID(botID)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var impostorID int
+	err = db.QueryRow("SELECT id FROM users WHERE LOWER(username) = LOWER(?)", ChatBotUsername).Scan(&impostorID)
+	if err == nil {
+		return nil, fmt.Errorf("%w: user %d; rename that account, or set is_bot on it if it is the bot", ErrChatBotNameTaken, impostorID)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// The bot never logs in, so give it a random password nobody knows
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(randomBytes)), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	// CreateUser refuses the reserved name, so the bot is inserted directly
+	now := time.Now()
+	result, err := db.Exec(
+		`INSERT INTO users (username, email, password, home_city, notifications_enabled, alert_threshold,
+		profile_photo, avatar_color, role, is_bot, created_at, updated_at)
+		VALUES (?, ?, ?, '', FALSE, 'severe', 'default.jpg', 'blue', ?, TRUE, ?, ?)`,
+		ChatBotUsername, chatBotEmail, string(hashedPassword), models.RoleUser, now, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chat bot user: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Created chat bot user %s (ID=%d)", ChatBotUsername, id)
+	return userStore.GetUserByID(int(id))
+}
+
+// IsCommand reports whether a chat message is a slash command for the bot
+func IsCommand(text string) bool {
+	return strings.HasPrefix(strings.TrimSpace(text), "/")
+}
+
+// HandleCommand runs a slash command and posts the bot's reply in the room
+func (b *ChatBot) HandleCommand(place models.ChatPlace, text string) (models.ChatMessage, error) {
+	fields := strings.Fields(strings.TrimSpace(text))
+	command := strings.ToLower(fields[0])
+	args := fields[1:]
+
+	var reply models.ChatMessage
+	switch command {
+	case "/weather", "/forecast", "/aqi", "/sun":
+		report, err := b.source.WeatherReport(place.WeatherQuery())
+		if err != nil {
+			log.Printf("Chat bot: error fetching weather for %s: %v", place.ID, err)
+			reply = b.errorReply(fmt.Sprintf("Sorry, I couldn't fetch the weather for %s right now.", place.Name))
+			break
+		}
+
+		switch command {
+		case "/weather":
+			reply = weatherReply(report)
+		case "/forecast":
+			days := 3
+			if len(args) > 0 {
+				if n, err := strconv.Atoi(args[0]); err == nil {
+					days = n
+				}
+			}
+			reply = forecastReply(report, days)
+		case "/aqi":
+			reply = aqiReply(report)
+		case "/sun":
+			reply = sunReply(report)
+		}
+	default:
+		reply = helpReply()
+	}
+
+	return b.post(place, reply)
+}
+
+// CheckAlerts announces alerts that started or ended in any recently active room
+func (b *ChatBot) CheckAlerts() error {
+	places, err := b.watchedPlaces()
+	if err != nil {
+		return err
+	}
+
+	for _, place := range places {
+		if err := b.checkPlaceAlerts(place); err != nil {
+			log.Printf("Chat bot: error checking alerts for %s: %v", place.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// watchedPlaces returns rooms with recent messages and rooms with an announced alert still open
+func (b *ChatBot) watchedPlaces() ([]models.ChatPlace, error) {
+	rows, err := b.chatService.GetDB().Query(
+		`SELECT place_id, name, state, country, latitude, longitude
+		FROM chat_places
+		WHERE place_id IN (
+			SELECT place_id FROM chat_messages WHERE created_at > NOW() - INTERVAL 24 HOUR
+			UNION
+			SELECT place_id FROM chat_bot_alerts WHERE ended_at IS NULL
+		)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var places []models.ChatPlace
+	for rows.Next() {
+		place, err := scanChatPlace(rows)
+		if err != nil {
+			return nil, err
+		}
+		places = append(places, place)
+	}
+
+	return places, rows.Err()
+}
+
+// checkPlaceAlerts compares the current alerts of a place with the ones already announced
+func (b *ChatBot) checkPlaceAlerts(place models.ChatPlace) error {
+	report, err := b.source.WeatherReport(place.WeatherQuery())
+	if err != nil {
+		return err
+	}
+
+	db := b.chatService.GetDB()
+
+	// Load the alerts announced as started but not yet as ended
+	rows, err := db.Query(
+		"SELECT alert_key, event FROM chat_bot_alerts WHERE place_id = ? AND ended_at IS NULL",
+		place.ID,
+	)
+	if err != nil {
+		return err
+	}
+	open := make(map[string]string)
+	for rows.Next() {
+		var key, event string
+		if err := rows.Scan(&key, &event); err != nil {
+			rows.Close()
+			return err
+		}
+		open[key] = event
+	}
+	rows.Close()
+
+	now := time.Now()
+	current := make(map[string]bool)
+	for _, alert := range report.Alerts {
+		if !alert.End.IsZero() && alert.End.Before(now) {
+			continue
+		}
+
+		key := alertKey(alert)
+		current[key] = true
+		if _, announced := open[key]; announced {
+			continue
+		}
+
+		result, err := db.Exec(
+			"INSERT IGNORE INTO chat_bot_alerts (city_name, place_id, alert_key, event, started_at) VALUES (?, ?, ?, ?, NOW())",
+			place.Name, place.ID, key, alert.Event,
+		)
+		if err != nil {
+			return err
+		}
+
+		// Another instance may already have announced this alert
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+
+		if _, err := b.post(place, alertStartReply(report, alert)); err != nil {
+			return err
+		}
+	}
+
+	for key, event := range open {
+		if current[key] {
+			continue
+		}
+
+		result, err := db.Exec(
+			"UPDATE chat_bot_alerts SET ended_at = NOW() WHERE place_id = ? AND alert_key = ? AND ended_at IS NULL",
+			place.ID, key,
+		)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+
+		if _, err := b.post(place, alertEndReply(place.Name, event)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// post adds a bot reply to a place's room
+func (b *ChatBot) post(place models.ChatPlace, reply models.ChatMessage) (models.ChatMessage, error) {
+	reply.UserID = b.botUserID
+	reply.Username = ChatBotUsername
+	reply.CityName = place.Name
+	reply.PlaceID = place.ID
+	reply.AvatarURL = chatBotAvatarURL
+
+	return b.chatService.AddMessage(reply)
+}
+
+// errorReply builds a plain reply for failed commands
+func (b *ChatBot) errorReply(text string) models.ChatMessage {
+	return models.ChatMessage{
+		Message: text,
+		Card: &models.MessageCard{
+			Type:  "error",
+			Title: text,
+		},
+	}
+}
+
+// alertKey identifies an alert across polls of the OneCall API
+func alertKey(alert BotWeatherAlert) string {
+	return fmt.Sprintf("%s|%d", alert.Event, alert.Start.Unix())
+}
+
+// localTime formats a time in the city's own timezone
+func localTime(t time.Time, offset int, layout string) string {
+	return t.In(time.FixedZone("local", offset)).Format(layout)
+}
+
+// weatherReply builds the reply to /weather
+func weatherReply(report *BotWeatherReport) models.ChatMessage {
+	return models.ChatMessage{
+		Message: fmt.Sprintf("Current weather in %s: %.0f°C, %s", report.City, report.Temp, report.Description),
+		Card: &models.MessageCard{
+			Type:  "weather",
+			Title: "Current weather in " + report.City,
+			Icon:  report.Icon,
+			Fields: []models.CardField{
+				{Label: "Temperature", Value: fmt.Sprintf("%.1f°C", report.Temp)},
+				{Label: "Feels like", Value: fmt.Sprintf("%.1f°C", report.FeelsLike)},
+				{Label: "Conditions", Value: report.Description},
+				{Label: "Humidity", Value: fmt.Sprintf("%d%%", report.Humidity)},
+				{Label: "Wind", Value: fmt.Sprintf("%.1f m/s", report.WindSpeed)},
+			},
+		},
+	}
+}
+
+// forecastReply builds the reply to /forecast N
+func forecastReply(report *BotWeatherReport, days int) models.ChatMessage {
+	if days < 1 {
+		days = 1
+	}
+	if days > 7 {
+		days = 7
+	}
+	if days > len(report.Daily) {
+		days = len(report.Daily)
+	}
+	if days == 0 {
+		return models.ChatMessage{
+			Message: "No forecast is available for " + report.City + " right now.",
+			Card: &models.MessageCard{
+				Type:  "error",
+				Title: "No forecast is available for " + report.City + " right now.",
+			},
+		}
+	}
+
+	fields := make([]models.CardField, 0, days)
+	for _, day := range report.Daily[:days] {
+		fields = append(fields, models.CardField{
+			Label: localTime(day.Date, report.TimezoneOffset, "Mon Jan 2"),
+			Value: fmt.Sprintf("%.0f°C / %.0f°C, %s, %.0f%% rain", day.MaxTemp, day.MinTemp, day.Description, day.PrecipProb),
+		})
+	}
+
+	return models.ChatMessage{
+		Message: fmt.Sprintf("%d-day forecast for %s", days, report.City),
+		Card: &models.MessageCard{
+			Type:   "forecast",
+			Title:  fmt.Sprintf("%d-day forecast for %s", days, report.City),
+			Icon:   report.Icon,
+			Fields: fields,
+		},
+	}
+}
+
+// aqiReply builds the reply to /aqi
+func aqiReply(report *BotWeatherReport) models.ChatMessage {
+	return models.ChatMessage{
+		Message: fmt.Sprintf("Air quality in %s: %s (AQI %d)", report.City, report.AQICategory, report.AQI),
+		Card: &models.MessageCard{
+			Type:  "aqi",
+			Title: "Air quality in " + report.City,
+			Fields: []models.CardField{
+				{Label: "AQI", Value: fmt.Sprintf("%d of 5", report.AQI)},
+				{Label: "Category", Value: report.AQICategory},
+			},
+		},
+	}
+}
+
+// sunReply builds the reply to /sun
+func sunReply(report *BotWeatherReport) models.ChatMessage {
+	daylight := report.Sunset.Sub(report.Sunrise).Round(time.Minute)
+	return models.ChatMessage{
+		Message: fmt.Sprintf("Sunrise in %s at %s, sunset at %s", report.City,
+			localTime(report.Sunrise, report.TimezoneOffset, "15:04"), localTime(report.Sunset, report.TimezoneOffset, "15:04")),
+		Card: &models.MessageCard{
+			Type:  "sun",
+			Title: "Sun times in " + report.City,
+			Fields: []models.CardField{
+				{Label: "Sunrise", Value: localTime(report.Sunrise, report.TimezoneOffset, "15:04")},
+				{Label: "Sunset", Value: localTime(report.Sunset, report.TimezoneOffset, "15:04")},
+				{Label: "Daylight", Value: fmt.Sprintf("%dh %dm", int(daylight.Hours()), int(daylight.Minutes())%60)},
+			},
+			Footer: "Times are local to " + report.City,
+		},
+	}
+}
+
+// alertStartReply builds the announcement for a new weather alert
+func alertStartReply(report *BotWeatherReport, alert BotWeatherAlert) models.ChatMessage {
+	fields := []models.CardField{
+		{Label: "From", Value: localTime(alert.Start, report.TimezoneOffset, "Jan 2, 15:04")},
+	}
+	if !alert.End.IsZero() {
+		fields = append(fields, models.CardField{Label: "Until", Value: localTime(alert.End, report.TimezoneOffset, "Jan 2, 15:04")})
+	}
+	if alert.Description != "" {
+		fields = append(fields, models.CardField{Label: "Details", Value: alert.Description})
+	}
+
+	return models.ChatMessage{
+		Message: fmt.Sprintf("Weather alert for %s: %s", report.City, alert.Event),
+		Card: &models.MessageCard{
+			Type:   "alert_start",
+			Title:  "⚠️ " + alert.Event,
+			Fields: fields,
+			Footer: "Issued by " + alert.Sender,
+		},
+	}
+}
+
+// alertEndReply builds the announcement for an alert that is no longer active
+func alertEndReply(city, event string) models.ChatMessage {
+	return models.ChatMessage{
+		Message: fmt.Sprintf("The %s for %s has ended", event, city),
+		Card: &models.MessageCard{
+			Type:  "alert_end",
+			Title: "✅ " + event + " ended",
+		},
+	}
+}
+
+// helpReply lists the available slash commands
+func helpReply() models.ChatMessage {
+	return models.ChatMessage{
+		Message: "Available commands: /weather, /forecast [days], /aqi, /sun",
+		Card: &models.MessageCard{
+			Type:  "help",
+			Title: "WeatherBot commands",
+			Fields: []models.CardField{
+				{Label: "/weather", Value: "Current conditions"},
+				{Label: "/forecast [1-7]", Value: "Daily forecast, 3 days by default"},
+				{Label: "/aqi", Value: "Air quality index"},
+				{Label: "/sun", Value: "Sunrise, sunset and daylight"},
+			},
+		},
+	}
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"weather-app/models"
+)
+
+// ErrPlaceNotFound is returned when a city name cannot be resolved to a real place
+var ErrPlaceNotFound = errors.New("place not found")
+
+// Limits of the in-memory place cache. Names that don't resolve are remembered briefly so
+// repeated lookups of the same typo don't each call the geocoder.
+const (
+	MaxCachedPlaces  = 1000
+	PlaceNotFoundTTL = 10 * time.Minute
+)
+
+// cachedPlace is a resolved place, or a lookup that found nothing
+type cachedPlace struct {
+	place    models.ChatPlace
+	notFound bool
+	cachedAt time.Time
+}
+
+// PlaceResolver geocodes a free-text city name into a place
+type PlaceResolver interface {
+	ResolvePlace(query string) (*models.ChatPlace, error)
+}
+
+// chatRoomAliases maps common abbreviations to the geocoding query of the place they stand for
+var chatRoomAliases = map[string]string{
+	"nyc":    "New York,US",
+	"la":     "Los Angeles,US",
+	"sf":     "San Francisco,US",
+	"dc":     "Washington,US",
+	"philly": "Philadelphia,US",
+	"vegas":  "Las Vegas,US",
+}
+
+// ResolvePlace maps a city name or alias to its canonical place, geocoding names not seen before
+func (s *ChatService) ResolvePlace(query string) (models.ChatPlace, error) {
+	alias := normalizeRoomAlias(query)
+	if alias == "" {
+		return models.ChatPlace{}, ErrPlaceNotFound
+	}
+
+	s.placesMutex.Lock()
+	cached, exists := s.places.get(alias)
+	s.placesMutex.Unlock()
+	if exists && !cached.notFound {
+		return cached.place, nil
+	}
+	if exists && time.Since(cached.cachedAt) < PlaceNotFoundTTL {
+		return models.ChatPlace{}, ErrPlaceNotFound
+	}
+
+	// Look for an alias stored by an earlier lookup
+	row := s.db.QueryRow(
+		`SELECT p.place_id, p.name, p.state, p.country, p.latitude, p.longitude
+		FROM chat_room_aliases a
+		JOIN chat_places p ON p.place_id = a.place_id
+		WHERE a.alias = ?`,
+		alias,
+	)
+	place, err := scanChatPlace(row)
+	if err != nil && err != sql.ErrNoRows {
+		return models.ChatPlace{}, err
+	}
+
+	if err == sql.ErrNoRows {
+		if s.resolver == nil {
+			return models.ChatPlace{}, ErrPlaceNotFound
+		}
+
+		lookup := strings.TrimSpace(query)
+		if expanded, ok := chatRoomAliases[alias]; ok {
+			lookup = expanded
+		}
+
+		resolved, err := s.resolver.ResolvePlace(lookup)
+		if err == nil && (resolved == nil || resolved.Name == "") {
+			err = ErrPlaceNotFound
+		}
+		if err == ErrPlaceNotFound {
+			s.cachePlace(alias, cachedPlace{notFound: true, cachedAt: time.Now()})
+		}
+		if err != nil {
+			return models.ChatPlace{}, err
+		}
+
+		place = *resolved
+		place.ID = makePlaceID(place.Country, place.State, place.Name)
+
+		if err := s.savePlace(place, alias, normalizeRoomAlias(place.Name)); err != nil {
+			return models.ChatPlace{}, err
+		}
+	}
+
+	s.cachePlace(alias, cachedPlace{place: place, cachedAt: time.Now()})
+
+	return place, nil
+}
+
+// cachePlace remembers the outcome of resolving an alias
+func (s *ChatService) cachePlace(alias string, entry cachedPlace) {
+	s.placesMutex.Lock()
+	s.places.set(alias, entry)
+	s.placesMutex.Unlock()
+}
+
+// GetPlace returns a previously resolved place by its ID
+func (s *ChatService) GetPlace(placeID string) (models.ChatPlace, error) {
+	row := s.db.QueryRow(
+		"SELECT place_id, name, state, country, latitude, longitude FROM chat_places WHERE place_id = ?",
+		placeID,
+	)
+
+	place, err := scanChatPlace(row)
+	if err == sql.ErrNoRows {
+		return models.ChatPlace{}, ErrPlaceNotFound
+	}
+
+	return place, err
+}
+
+// savePlace stores a resolved place together with the aliases that lead to it
+func (s *ChatService) savePlace(place models.ChatPlace, aliases ...string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO chat_places (place_id, name, state, country, latitude, longitude, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW())
+		ON DUPLICATE KEY UPDATE place_id = place_id`,
+		place.ID, place.Name, place.State, place.Country, place.Latitude, place.Longitude,
+	)
+	if err != nil {
+		return err
+	}
+
+	// The first place to claim an alias keeps it
+	for _, alias := range aliases {
+		if alias == "" {
+			continue
+		}
+		if _, err := tx.Exec(
+			"INSERT IGNORE INTO chat_room_aliases (alias, place_id, created_at) VALUES (?, ?, NOW())",
+			alias, place.ID,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// MigrateChatRooms moves messages, active users and bot alerts stored under free-text
+// city names into their canonical rooms. Names that cannot be resolved are returned
+// and left untouched.
+func (s *ChatService) MigrateChatRooms() (int, []string, error) {
+	rows, err := s.db.Query(
+		`SELECT city_name FROM chat_messages WHERE place_id IS NULL
+		UNION
+		SELECT city_name FROM chat_active_users WHERE place_id IS NULL
+		UNION
+		SELECT city_name FROM chat_bot_alerts WHERE place_id IS NULL`,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	merged := 0
+	var unresolved []string
+	for _, name := range names {
+		place, err := s.ResolvePlace(name)
+		if err == ErrPlaceNotFound {
+			unresolved = append(unresolved, name)
+			continue
+		}
+		if err != nil {
+			return merged, unresolved, err
+		}
+
+		if err := s.mergeRoom(name, place); err != nil {
+			return merged, unresolved, err
+		}
+
+		log.Printf("Merged chat room %q into %s", name, place.ID)
+		merged++
+	}
+
+	// Rooms cached under the old names are stale now
+	s.roomsMutex.Lock()
+	s.chatRooms.clear()
+	s.roomsMutex.Unlock()
+
+	return merged, unresolved, nil
+}
+
+// mergeRoom moves the rows of a free-text room into a canonical place in one transaction
+func (s *ChatService) mergeRoom(cityName string, place models.ChatPlace) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"UPDATE chat_messages SET place_id = ?, city_name = ? WHERE city_name = ? AND place_id IS NULL",
+		place.ID, place.Name, cityName,
+	); err != nil {
+		return err
+	}
+
+	// A user may already be active in the canonical room, so keep the latest activity
+	if _, err := tx.Exec(
+		`INSERT INTO chat_active_users (user_id, city_name, place_id, last_active)
+		SELECT old.user_id, ?, ?, MAX(old.last_active)
+		FROM chat_active_users old
+		WHERE old.city_name = ? AND old.place_id IS NULL
+		GROUP BY old.user_id
+		ON DUPLICATE KEY UPDATE last_active = GREATEST(chat_active_users.last_active, VALUES(last_active))`,
+		place.Name, place.ID, cityName,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		"DELETE FROM chat_active_users WHERE city_name = ? AND place_id IS NULL",
+		cityName,
+	); err != nil {
+		return err
+	}
+
+	// Alerts already open in the canonical room win over duplicates
+	if _, err := tx.Exec(
+		"UPDATE IGNORE chat_bot_alerts SET place_id = ?, city_name = ? WHERE city_name = ? AND place_id IS NULL",
+		place.ID, place.Name, cityName,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		"DELETE FROM chat_bot_alerts WHERE city_name = ? AND place_id IS NULL",
+		cityName,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scanChatPlace reads a chat_places row
+func scanChatPlace(row rowScanner) (models.ChatPlace, error) {
+	var place models.ChatPlace
+	err := row.Scan(&place.ID, &place.Name, &place.State, &place.Country, &place.Latitude, &place.Longitude)
+	return place, err
+}
+
+// normalizeRoomAlias lowercases a city name and collapses its whitespace
+func normalizeRoomAlias(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// makePlaceID builds a stable place ID such as "us/new-york/new-york" from geocoding fields
+func makePlaceID(country, state, name string) string {
+	var parts []string
+	for _, part := range []string{country, state, name} {
+		if slug := slugify(part); slug != "" {
+			parts = append(parts, slug)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// slugify lowercases text and replaces runs of other characters with single dashes
+func slugify(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
@@ -2,67 +2,105 @@ package services
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"weather-app/models"
 )
 
+// MessageEditWindow is how long after posting an author may still edit a message
+const MessageEditWindow = 15 * time.Minute
+
+// Errors returned by message edit, delete and reaction operations
+var (
+	ErrMessageNotFound   = errors.New("message not found")
+	ErrNotMessageAuthor  = errors.New("only the author can change this message")
+	ErrEditWindowExpired = errors.New("message can no longer be edited")
+	ErrMessageDeleted    = errors.New("message has been deleted")
+	ErrInvalidReaction   = errors.New("invalid reaction")
+)
+
 // ChatService handles chat operations
 type ChatService struct {
-	db         *sql.DB
-	chatRooms  map[string]*models.ChatRoom
-	roomsMutex sync.RWMutex
+	db          *sql.DB
+	resolver    PlaceResolver
+	presence    *PresenceTracker
+	chatRooms   *lruCache[*models.ChatRoom]
+	roomsMutex  sync.Mutex
+	places      *lruCache[cachedPlace] // keyed by normalized alias
+	placesMutex sync.Mutex
 }
 
-// NewChatService creates a new instance of ChatService
-func NewChatService(db *sql.DB) *ChatService {
+// NewChatService creates a new instance of ChatService.
+// resolver geocodes city names into chat rooms; without one only known places can be joined.
+func NewChatService(db *sql.DB, resolver PlaceResolver) *ChatService {
 	return &ChatService{
 		db:        db,
-		chatRooms: make(map[string]*models.ChatRoom),
+		resolver:  resolver,
+		presence:  NewPresenceTracker(),
+		chatRooms: newLRUCache[*models.ChatRoom](MaxCachedRooms),
+		places:    newLRUCache[cachedPlace](MaxCachedPlaces),
 	}
 }
 
-// GetOrCreateChatRoom returns a chat room for a city
-func (s *ChatService) GetOrCreateChatRoom(cityName string) *models.ChatRoom {
-	s.roomsMutex.RLock()
-	room, exists := s.chatRooms[cityName]
-	s.roomsMutex.RUnlock()
+// GetOrCreateChatRoom returns a snapshot of the chat room for a place, including who is online
+func (s *ChatService) GetOrCreateChatRoom(place models.ChatPlace) models.ChatRoom {
+	s.roomsMutex.Lock()
+	room, exists := s.chatRooms.get(place.ID)
+	s.roomsMutex.Unlock()
 
 	if !exists {
 		room = &models.ChatRoom{
-			CityName:    cityName,
-			Messages:    make([]models.ChatMessage, 0),
-			ActiveUsers: 0,
+			PlaceID:  place.ID,
+			CityName: place.Name,
+			Messages: make([]models.ChatMessage, 0),
 		}
 
 		// Load recent messages from database
-		messages, err := s.getRecentMessages(cityName, 50)
+		messages, err := s.getRecentMessages(place.ID, 50)
 		if err == nil {
 			room.Messages = messages
 		}
 
-		// Get active users count
-		count, err := s.getActiveUsersCount(cityName)
-		if err == nil {
-			room.ActiveUsers = count
-		}
-
 		s.roomsMutex.Lock()
-		s.chatRooms[cityName] = room
+		room = s.chatRooms.add(place.ID, room)
 		s.roomsMutex.Unlock()
 	}
 
-	return room
+	// Copy the room so callers can serialize it while new messages arrive
+	s.roomsMutex.Lock()
+	snapshot := *room
+	snapshot.Messages = append([]models.ChatMessage(nil), room.Messages...)
+	s.roomsMutex.Unlock()
+
+	snapshot.OnlineUsers = s.presence.OnlineUsers(place.ID)
+	snapshot.ActiveUsers = len(snapshot.OnlineUsers)
+
+	return snapshot
 }
 
 // AddMessage adds a new message to a chat room
 func (s *ChatService) AddMessage(msg models.ChatMessage) (models.ChatMessage, error) {
+	// Encode any structured card attached to the message
+	var cardJSON sql.NullString
+	if msg.Card != nil {
+		encoded, err := json.Marshal(msg.Card)
+		if err != nil {
+			return models.ChatMessage{}, err
+		}
+		cardJSON = sql.NullString{String: string(encoded), Valid: true}
+	}
+
 	// Save to database
 	var id int64
 	result, err := s.db.Exec(
-		"INSERT INTO chat_messages (user_id, username, city_name, message, image_url, created_at, avatar_url) VALUES (?, ?, ?, ?, ?, NOW(), ?)",
-		msg.UserID, msg.Username, msg.CityName, msg.Message, msg.ImageURL, msg.AvatarURL,
+		"INSERT INTO chat_messages (user_id, username, city_name, place_id, message, image_url, created_at, avatar_url, card_json) VALUES (?, ?, ?, ?, ?, ?, NOW(), ?, ?)",
+		msg.UserID, msg.Username, msg.CityName, msg.PlaceID, msg.Message, msg.ImageURL, msg.AvatarURL, cardJSON,
 	)
 
 	if err != nil {
@@ -77,87 +115,99 @@ func (s *ChatService) AddMessage(msg models.ChatMessage) (models.ChatMessage, er
 	msg.ID = int(id)
 	msg.CreatedAt = time.Now()
 
-	// Add to in-memory room
+	// Add to the in-memory room; rooms not in the cache load the message from the database later
 	s.roomsMutex.Lock()
-	room, exists := s.chatRooms[msg.CityName]
-	if !exists {
-		room = &models.ChatRoom{
-			CityName:    msg.CityName,
-			Messages:    make([]models.ChatMessage, 0),
-			ActiveUsers: 0,
+	if room, exists := s.chatRooms.get(msg.PlaceID); exists {
+		// Limit to last 100 messages in memory
+		if len(room.Messages) >= 100 {
+			room.Messages = room.Messages[1:]
 		}
-		s.chatRooms[msg.CityName] = room
-	}
 
-	// Limit to last 100 messages in memory
-	if len(room.Messages) >= 100 {
-		room.Messages = room.Messages[1:]
+		room.Messages = append(room.Messages, msg)
 	}
-
-	room.Messages = append(room.Messages, msg)
 	s.roomsMutex.Unlock()
 
 	return msg, nil
 }
 
-// UpdateUserActivity marks a user as active in a chat room
-func (s *ChatService) UpdateUserActivity(userID int, cityName string) error {
-	_, err := s.db.Exec(
-		`INSERT INTO chat_active_users (user_id, city_name, last_active) 
-		VALUES (?, ?, NOW()) 
-		ON DUPLICATE KEY UPDATE last_active = NOW()`,
-		userID, cityName,
-	)
-
+// UpdateUserActivity marks a user as online in a chat room.
+// Presence is kept in memory and written to MySQL by PersistPresence.
+func (s *ChatService) UpdateUserActivity(userID int, place models.ChatPlace) error {
+	username, err := s.lookupUsername(userID)
 	if err != nil {
 		return err
 	}
 
-	// Update active users count in memory
-	count, err := s.getActiveUsersCount(cityName)
-	if err == nil {
-		s.roomsMutex.Lock()
-		if room, exists := s.chatRooms[cityName]; exists {
-			room.ActiveUsers = count
-		}
-		s.roomsMutex.Unlock()
-	}
-
+	s.presence.Heartbeat(place, userID, username)
 	return nil
 }
 
-// RemoveInactiveUsers removes users who haven't been active for more than 10 minutes
-func (s *ChatService) RemoveInactiveUsers() error {
-	_, err := s.db.Exec(
-		"DELETE FROM chat_active_users WHERE last_active < NOW() - INTERVAL 10 MINUTE",
-	)
-
+// SetTyping starts or stops the typing indicator of a user in a chat room
+func (s *ChatService) SetTyping(userID int, place models.ChatPlace, typing bool) error {
+	username, err := s.lookupUsername(userID)
 	if err != nil {
 		return err
 	}
 
-	// Update all active rooms with new counts
+	s.presence.SetTyping(place, userID, username, typing)
+	return nil
+}
+
+// lookupUsername returns a user's name, asking the database only for users not yet present
+func (s *ChatService) lookupUsername(userID int) (string, error) {
+	if username := s.presence.Username(userID); username != "" {
+		return username, nil
+	}
+
+	var username string
+	err := s.db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+	return username, err
+}
+
+// PersistPresence expires stale presence, evicts idle rooms from the cache and writes
+// who is online to chat_active_users, which ranks the popular rooms
+func (s *ChatService) PersistPresence() error {
+	s.presence.Expire()
+
 	s.roomsMutex.Lock()
-	for cityName, room := range s.chatRooms {
-		count, err := s.getActiveUsersCount(cityName)
-		if err == nil {
-			room.ActiveUsers = count
+	s.chatRooms.evictIdle(RoomIdleTimeout)
+	s.roomsMutex.Unlock()
+
+	records := s.presence.snapshot()
+	if len(records) > 0 {
+		placeholders := make([]string, 0, len(records))
+		args := make([]interface{}, 0, len(records)*4)
+		for _, record := range records {
+			placeholders = append(placeholders, "(?, ?, ?, NOW() - INTERVAL ? SECOND)")
+			args = append(args, record.userID, record.roomName, record.placeID, int(record.idle.Seconds()))
+		}
+
+		if _, err := s.db.Exec(
+			`INSERT INTO chat_active_users (user_id, city_name, place_id, last_active) 
+			VALUES `+strings.Join(placeholders, ", ")+` 
+			ON DUPLICATE KEY UPDATE last_active = VALUES(last_active)`,
+			args...,
+		); err != nil {
+			return err
 		}
 	}
-	s.roomsMutex.Unlock()
 
-	return nil
+	_, err := s.db.Exec(
+		"DELETE FROM chat_active_users WHERE last_active < NOW() - INTERVAL 10 MINUTE",
+	)
+
+	return err
 }
 
-// getRecentMessages retrieves recent messages for a city from the database
-func (s *ChatService) getRecentMessages(cityName string, limit int) ([]models.ChatMessage, error) {
+// getRecentMessages retrieves recent messages for a place from the database
+func (s *ChatService) getRecentMessages(placeID string, limit int) ([]models.ChatMessage, error) {
 	rows, err := s.db.Query(
-		`SELECT id, user_id, username, message, image_url, created_at, avatar_url 
+		`SELECT id, user_id, username, city_name, place_id, message, image_url, created_at, avatar_url, edited_at, deleted_at, card_json 
 		FROM chat_messages 
-		WHERE city_name = ? 
+		WHERE place_id = ? 
 		ORDER BY created_at DESC 
 		LIMIT ?`,
-		cityName, limit,
+		placeID, limit,
 	)
 
 	if err != nil {
@@ -167,12 +217,10 @@ func (s *ChatService) getRecentMessages(cityName string, limit int) ([]models.Ch
 
 	var messages []models.ChatMessage
 	for rows.Next() {
-		var msg models.ChatMessage
-		if err := rows.Scan(&msg.ID, &msg.UserID, &msg.Username, &msg.Message,
-			&msg.ImageURL, &msg.CreatedAt, &msg.AvatarURL); err != nil {
+		msg, err := scanChatMessage(rows)
+		if err != nil {
 			return nil, err
 		}
-		msg.CityName = cityName
 		messages = append(messages, msg)
 	}
 
@@ -181,22 +229,363 @@ func (s *ChatService) getRecentMessages(cityName string, limit int) ([]models.Ch
 		messages[i], messages[j] = messages[j], messages[i]
 	}
 
+	if err := s.loadReactions(messages); err != nil {
+		return nil, err
+	}
+
 	return messages, nil
 }
 
-// getActiveUsersCount gets the number of active users in a city
-func (s *ChatService) getActiveUsersCount(cityName string) (int, error) {
-	var count int
-	err := s.db.QueryRow(
-		"SELECT COUNT(*) FROM chat_active_users WHERE city_name = ? AND last_active > NOW() - INTERVAL 10 MINUTE",
-		cityName,
-	).Scan(&count)
+// EditMessage replaces the text of a message, keeping the previous text in its edit history
+func (s *ChatService) EditMessage(messageID, userID int, text string) (models.ChatMessage, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+	defer tx.Rollback()
+
+	var authorID int
+	var current string
+	var deletedAt sql.NullTime
+	var expired bool
+	err = tx.QueryRow(
+		`SELECT user_id, message, deleted_at, created_at < NOW() - INTERVAL ? SECOND 
+		FROM chat_messages 
+		WHERE id = ? 
+		FOR UPDATE`,
+		int(MessageEditWindow.Seconds()), messageID,
+	).Scan(&authorID, &current, &deletedAt, &expired)
 
+	if err == sql.ErrNoRows {
+		return models.ChatMessage{}, ErrMessageNotFound
+	}
 	if err != nil {
-		return 0, err
+		return models.ChatMessage{}, err
+	}
+
+	if authorID != userID {
+		return models.ChatMessage{}, ErrNotMessageAuthor
+	}
+	if deletedAt.Valid {
+		return models.ChatMessage{}, ErrMessageDeleted
+	}
+	if expired {
+		return models.ChatMessage{}, ErrEditWindowExpired
+	}
+
+	// Nothing to record if the text did not change
+	if current == text {
+		return s.refreshCachedMessage(messageID)
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO chat_message_edits (message_id, previous_message, edited_at) VALUES (?, ?, NOW())",
+		messageID, current,
+	); err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE chat_messages SET message = ?, edited_at = NOW() WHERE id = ?",
+		text, messageID,
+	); err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	return s.refreshCachedMessage(messageID)
+}
+
+// DeleteMessage soft-deletes a message so it stays in the timeline without its content
+func (s *ChatService) DeleteMessage(messageID, userID int) (models.ChatMessage, error) {
+	return s.deleteMessage(messageID, userID)
+}
+
+// ModerateMessage soft-deletes any user's message on behalf of a moderator
+func (s *ChatService) ModerateMessage(messageID int) (models.ChatMessage, error) {
+	return s.deleteMessage(messageID, 0)
+}
+
+// deleteMessage soft-deletes a message; authorOnly 0 skips the author check
+func (s *ChatService) deleteMessage(messageID, authorOnly int) (models.ChatMessage, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+	defer tx.Rollback()
+
+	var authorID int
+	var deletedAt sql.NullTime
+	err = tx.QueryRow(
+		"SELECT user_id, deleted_at FROM chat_messages WHERE id = ? FOR UPDATE",
+		messageID,
+	).Scan(&authorID, &deletedAt)
+
+	if err == sql.ErrNoRows {
+		return models.ChatMessage{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	if authorOnly != 0 && authorID != authorOnly {
+		return models.ChatMessage{}, ErrNotMessageAuthor
+	}
+	if deletedAt.Valid {
+		return models.ChatMessage{}, ErrMessageDeleted
+	}
+
+	if _, err := tx.Exec("UPDATE chat_messages SET deleted_at = NOW() WHERE id = ?", messageID); err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	return s.refreshCachedMessage(messageID)
+}
+
+// GetMessageHistory returns the previous versions of a message, oldest first
+func (s *ChatService) GetMessageHistory(messageID int) ([]models.ChatMessageEdit, error) {
+	msg, err := s.getMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Deleted {
+		return nil, ErrMessageDeleted
+	}
+
+	rows, err := s.db.Query(
+		`SELECT id, message_id, previous_message, edited_at 
+		FROM chat_message_edits 
+		WHERE message_id = ? 
+		ORDER BY edited_at ASC, id ASC`,
+		messageID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := make([]models.ChatMessageEdit, 0)
+	for rows.Next() {
+		var edit models.ChatMessageEdit
+		if err := rows.Scan(&edit.ID, &edit.MessageID, &edit.PreviousMessage, &edit.EditedAt); err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit)
+	}
+
+	return edits, rows.Err()
+}
+
+// AddReaction adds an emoji reaction from a user to a message
+func (s *ChatService) AddReaction(messageID, userID int, emoji string) (models.ChatMessage, error) {
+	emoji, err := normalizeReaction(emoji)
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	msg, err := s.getMessageByID(messageID)
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+	if msg.Deleted {
+		return models.ChatMessage{}, ErrMessageDeleted
+	}
+
+	if _, err := s.db.Exec(
+		"INSERT IGNORE INTO chat_message_reactions (message_id, user_id, emoji, created_at) VALUES (?, ?, ?, NOW())",
+		messageID, userID, emoji,
+	); err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	return s.refreshCachedMessage(messageID)
+}
+
+// RemoveReaction removes a user's emoji reaction from a message
+func (s *ChatService) RemoveReaction(messageID, userID int, emoji string) (models.ChatMessage, error) {
+	emoji, err := normalizeReaction(emoji)
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	if _, err := s.db.Exec(
+		"DELETE FROM chat_message_reactions WHERE message_id = ? AND user_id = ? AND emoji = ?",
+		messageID, userID, emoji,
+	); err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	return s.refreshCachedMessage(messageID)
+}
+
+// refreshCachedMessage reloads a message from the database and replaces the copy held in its chat room
+func (s *ChatService) refreshCachedMessage(messageID int) (models.ChatMessage, error) {
+	msg, err := s.getMessageByID(messageID)
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	s.roomsMutex.Lock()
+	if room, exists := s.chatRooms.peek(msg.PlaceID); exists {
+		for i := range room.Messages {
+			if room.Messages[i].ID == msg.ID {
+				room.Messages[i] = msg
+				break
+			}
+		}
+	}
+	s.roomsMutex.Unlock()
+
+	return msg, nil
+}
+
+// getMessageByID loads a single message together with its reactions
+func (s *ChatService) getMessageByID(messageID int) (models.ChatMessage, error) {
+	row := s.db.QueryRow(
+		`SELECT id, user_id, username, city_name, place_id, message, image_url, created_at, avatar_url, edited_at, deleted_at, card_json 
+		FROM chat_messages 
+		WHERE id = ?`,
+		messageID,
+	)
+
+	msg, err := scanChatMessage(row)
+	if err == sql.ErrNoRows {
+		return models.ChatMessage{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	messages := []models.ChatMessage{msg}
+	if err := s.loadReactions(messages); err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	return messages[0], nil
+}
+
+// loadReactions fills in the aggregated reactions for a list of messages
+func (s *ChatService) loadReactions(messages []models.ChatMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, 0, len(messages))
+	args := make([]interface{}, 0, len(messages))
+	index := make(map[int]int, len(messages))
+	for i, msg := range messages {
+		placeholders = append(placeholders, "?")
+		args = append(args, msg.ID)
+		index[msg.ID] = i
+	}
+
+	rows, err := s.db.Query(
+		`SELECT message_id, emoji, user_id 
+		FROM chat_message_reactions 
+		WHERE message_id IN (`+strings.Join(placeholders, ", ")+`) 
+		ORDER BY created_at ASC`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID, userID int
+		var emoji string
+		if err := rows.Scan(&messageID, &emoji, &userID); err != nil {
+			return err
+		}
+
+		msg := &messages[index[messageID]]
+		if msg.Deleted {
+			continue
+		}
+
+		found := false
+		for i := range msg.Reactions {
+			if msg.Reactions[i].Emoji == emoji {
+				msg.Reactions[i].Count++
+				msg.Reactions[i].UserIDs = append(msg.Reactions[i].UserIDs, userID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			msg.Reactions = append(msg.Reactions, models.ReactionSummary{
+				Emoji:   emoji,
+				Count:   1,
+				UserIDs: []int{userID},
+			})
+		}
+	}
+
+	return rows.Err()
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanChatMessage reads a chat_messages row, hiding the content of deleted messages
+func scanChatMessage(row rowScanner) (models.ChatMessage, error) {
+	var msg models.ChatMessage
+	var editedAt, deletedAt sql.NullTime
+	var placeID, cardJSON sql.NullString
+	if err := row.Scan(&msg.ID, &msg.UserID, &msg.Username, &msg.CityName, &placeID, &msg.Message,
+		&msg.ImageURL, &msg.CreatedAt, &msg.AvatarURL, &editedAt, &deletedAt, &cardJSON); err != nil {
+		return models.ChatMessage{}, err
+	}
+	msg.PlaceID = placeID.String
+
+	if cardJSON.Valid && cardJSON.String != "" {
+		var card models.MessageCard
+		if err := json.Unmarshal([]byte(cardJSON.String), &card); err == nil {
+			msg.Card = &card
+		}
+	}
+
+	applyMessageState(&msg, editedAt, deletedAt)
+
+	return msg, nil
+}
+
+// applyMessageState sets the edited and deleted flags of a message, hiding deleted content
+func applyMessageState(msg *models.ChatMessage, editedAt, deletedAt sql.NullTime) {
+	if editedAt.Valid {
+		msg.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		msg.Deleted = true
+		msg.Message = ""
+		msg.ImageURL = ""
+		msg.Card = nil
+	}
+}
+
+// normalizeReaction validates that a reaction is a short emoji sequence
+func normalizeReaction(emoji string) (string, error) {
+	emoji = strings.TrimSpace(emoji)
+	if emoji == "" || len(emoji) > 32 || utf8.RuneCountInString(emoji) > 8 {
+		return "", ErrInvalidReaction
+	}
+
+	for _, r := range emoji {
+		if r < utf8.RuneSelf || unicode.IsSpace(r) {
+			return "", ErrInvalidReaction
+		}
 	}
 
-	return count, nil
+	return emoji, nil
 }
 
 // GetDB returns the database connection
@@ -0,0 +1,601 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Custom activity limits and watch settings
+const (
+	MaxCustomActivitiesPerUser = 20
+	MaxCustomActivityNameLen   = 60
+	MaxCustomActivityMinHours  = 24
+	CustomActivityWatchDays    = 7
+	CustomActivityInterval     = time.Hour
+)
+
+// Errors returned by custom activity operations
+var (
+	ErrInvalidCustomActivity   = errors.New("invalid activity")
+	ErrCustomActivityNotFound  = errors.New("activity not found")
+	ErrTooManyCustomActivities = errors.New("too many activities")
+	ErrActivityWindowNotFound  = errors.New("window not found")
+)
+
+// CustomActivity is an activity a user defined, with the weather it needs, when they can do
+// it and where. PreferredDays are weekdays (0 is Sunday), empty for every day. Hours are
+// local to the location; StartHour after EndHour wraps past midnight, and equal hours mean
+// any time of day.
+type CustomActivity struct {
+	ID                   int                `json:"id"`
+	UserID               int                `json:"-"`
+	Name                 string             `json:"name"`
+	Conditions           ActivityConditions `json:"conditions"`
+	PreferredDays        []int              `json:"preferred_days"`
+	StartHour            int                `json:"start_hour"`
+	EndHour              int                `json:"end_hour"`
+	City                 string             `json:"city"`
+	Latitude             float64            `json:"latitude"`
+	Longitude            float64            `json:"longitude"`
+	MinHours             int                `json:"min_hours"`
+	NotificationsEnabled bool               `json:"notifications_enabled"`
+	CreatedAt            time.Time          `json:"created_at"`
+}
+
+// ActivityWindow is a qualifying window the user was told about. Planned windows are ones
+// the user made plans around; they get a notice if the window disappears.
+type ActivityWindow struct {
+	ID         int       `json:"id"`
+	ActivityID int       `json:"activity_id"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Score      int       `json:"score"`
+	Planned    bool      `json:"planned"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CustomActivityNotifier tells users about windows for their activities
+type CustomActivityNotifier interface {
+	SendActivityWindowsFound(to, username, activity, city string, windows []SuitabilityWindow, timezoneOffset int) error
+	SendActivityWindowLost(to, username, activity, city string, window ActivityWindow, timezoneOffset int) error
+}
+
+// CustomActivityService stores users' custom activities and watches the forecast for them
+type CustomActivityService struct {
+	db       *sql.DB
+	forecast ActivityForecastSource
+	notifier CustomActivityNotifier
+}
+
+// NewCustomActivityService creates a new instance of CustomActivityService
+func NewCustomActivityService(db *sql.DB, forecast ActivityForecastSource, notifier CustomActivityNotifier) *CustomActivityService {
+	return &CustomActivityService{
+		db:       db,
+		forecast: forecast,
+		notifier: notifier,
+	}
+}
+
+// customActivityColumns are the columns scanCustomActivity reads
+const customActivityColumns = `id, user_id, name, conditions, preferred_days, start_hour, end_hour,
+	city, latitude, longitude, min_hours, notifications_enabled, created_at`
+
+// ListActivities returns a user's custom activities, oldest first
+func (s *CustomActivityService) ListActivities(userID int) ([]CustomActivity, error) {
+	rows, err := s.db.Query(
+		"SELECT "+customActivityColumns+" FROM custom_activities WHERE user_id = ? ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activities := make([]CustomActivity, 0)
+	for rows.Next() {
+		activity, err := scanCustomActivity(rows)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+
+	return activities, rows.Err()
+}
+
+// GetActivity returns one of a user's custom activities
+func (s *CustomActivityService) GetActivity(userID, activityID int) (CustomActivity, error) {
+	activity, err := scanCustomActivity(s.db.QueryRow(
+		"SELECT "+customActivityColumns+" FROM custom_activities WHERE id = ? AND user_id = ?",
+		activityID, userID,
+	))
+	if err == sql.ErrNoRows {
+		return CustomActivity{}, ErrCustomActivityNotFound
+	}
+	return activity, err
+}
+
+// CreateActivity validates and stores a new custom activity
+func (s *CustomActivityService) CreateActivity(activity CustomActivity) (CustomActivity, error) {
+	if err := validateCustomActivity(&activity); err != nil {
+		return CustomActivity{}, err
+	}
+
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM custom_activities WHERE user_id = ?", activity.UserID).Scan(&count); err != nil {
+		return CustomActivity{}, err
+	}
+	if count >= MaxCustomActivitiesPerUser {
+		return CustomActivity{}, fmt.Errorf("%w: you can have at most %d", ErrTooManyCustomActivities, MaxCustomActivitiesPerUser)
+	}
+
+	conditions, err := json.Marshal(activity.Conditions)
+	if err != nil {
+		return CustomActivity{}, err
+	}
+
+	activity.CreatedAt = time.Now()
+	result, err := s.db.Exec(
+		`INSERT INTO custom_activities (user_id, name, conditions, preferred_days, start_hour, end_hour,
+			city, latitude, longitude, min_hours, notifications_enabled, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		activity.UserID, activity.Name, string(conditions), weekdayMask(activity.PreferredDays), activity.StartHour, activity.EndHour,
+		activity.City, activity.Latitude, activity.Longitude, activity.MinHours, activity.NotificationsEnabled, activity.CreatedAt,
+	)
+	if err != nil {
+		return CustomActivity{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return CustomActivity{}, err
+	}
+	activity.ID = int(id)
+
+	return activity, nil
+}
+
+// UpdateActivity replaces a custom activity. Windows found for the old settings are dropped
+// without notice so the next check starts over.
+func (s *CustomActivityService) UpdateActivity(activity CustomActivity) (CustomActivity, error) {
+	if err := validateCustomActivity(&activity); err != nil {
+		return CustomActivity{}, err
+	}
+
+	existing, err := s.GetActivity(activity.UserID, activity.ID)
+	if err != nil {
+		return CustomActivity{}, err
+	}
+	activity.CreatedAt = existing.CreatedAt
+
+	conditions, err := json.Marshal(activity.Conditions)
+	if err != nil {
+		return CustomActivity{}, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return CustomActivity{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`UPDATE custom_activities
+		SET name = ?, conditions = ?, preferred_days = ?, start_hour = ?, end_hour = ?,
+			city = ?, latitude = ?, longitude = ?, min_hours = ?, notifications_enabled = ?
+		WHERE id = ? AND user_id = ?`,
+		activity.Name, string(conditions), weekdayMask(activity.PreferredDays), activity.StartHour, activity.EndHour,
+		activity.City, activity.Latitude, activity.Longitude, activity.MinHours, activity.NotificationsEnabled,
+		activity.ID, activity.UserID,
+	)
+	if err != nil {
+		return CustomActivity{}, err
+	}
+	if _, err := tx.Exec("DELETE FROM custom_activity_windows WHERE activity_id = ?", activity.ID); err != nil {
+		return CustomActivity{}, err
+	}
+
+	return activity, tx.Commit()
+}
+
+// DeleteActivity deletes a custom activity and its windows
+func (s *CustomActivityService) DeleteActivity(userID, activityID int) error {
+	result, err := s.db.Exec("DELETE FROM custom_activities WHERE id = ? AND user_id = ?", activityID, userID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrCustomActivityNotFound
+	}
+
+	// Windows cascade with the activity
+	return nil
+}
+
+// SetWindowPlanned marks whether the user made plans around a window
+func (s *CustomActivityService) SetWindowPlanned(userID, activityID, windowID int, planned bool) error {
+	result, err := s.db.Exec(
+		`UPDATE custom_activity_windows w
+		JOIN custom_activities a ON a.id = w.activity_id
+		SET w.planned = ?
+		WHERE w.id = ? AND w.activity_id = ? AND a.user_id = ?`,
+		planned, windowID, activityID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	// MySQL reports zero rows when the value didn't change, so check the window exists
+	if updated, err := result.RowsAffected(); err != nil || updated > 0 {
+		return err
+	}
+	var exists int
+	err = s.db.QueryRow(
+		`SELECT COUNT(*) FROM custom_activity_windows w
+		JOIN custom_activities a ON a.id = w.activity_id
+		WHERE w.id = ? AND w.activity_id = ? AND a.user_id = ?`,
+		windowID, activityID, userID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrActivityWindowNotFound
+	}
+	return nil
+}
+
+// RefreshWindows checks the forecast for an activity now and returns its windows in the coming
+// week with the location's timezone offset. Windows the user sees here aren't emailed again.
+func (s *CustomActivityService) RefreshWindows(userID, activityID int) ([]ActivityWindow, int, error) {
+	activity, err := s.GetActivity(userID, activityID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	forecast, err := s.forecast.HourlyForecast(activity.Latitude, activity.Longitude)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var username, email string
+	var notify bool
+	err = s.db.QueryRow(
+		"SELECT username, email, notifications_enabled AND email_verified FROM users WHERE id = ?",
+		userID,
+	).Scan(&username, &email, &notify)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.checkActivity(activity, username, email, forecast, false, notify && activity.NotificationsEnabled); err != nil {
+		return nil, 0, err
+	}
+
+	windows, err := s.loadWindows(activityID)
+	return windows, forecast.TimezoneOffset, err
+}
+
+// qualifyingWindows finds windows of at least MinHours suitable hours on the activity's
+// preferred days and times
+func qualifyingWindows(activity CustomActivity, forecast *HourlyForecast) []SuitabilityWindow {
+	until := time.Now().Add(CustomActivityWatchDays * 24 * time.Hour)
+
+	// Dropping hours outside the preferred times leaves gaps that split windows
+	var hours []ForecastHour
+	for _, hour := range forecast.ExtendedHours(until) {
+		if activity.allows(hour.Time, forecast.TimezoneOffset) {
+			hours = append(hours, hour)
+		}
+	}
+
+	windows := BestWindows(activity.Conditions, hours, activity.MinHours, 0)
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Start.Before(windows[j].Start) })
+	return windows
+}
+
+// allows reports whether an hour falls on the activity's preferred days and times
+func (a CustomActivity) allows(at time.Time, timezoneOffset int) bool {
+	local := at.Add(time.Duration(timezoneOffset) * time.Second).UTC()
+
+	if len(a.PreferredDays) > 0 && weekdayMask(a.PreferredDays)&(1<<uint(local.Weekday())) == 0 {
+		return false
+	}
+
+	hour := local.Hour()
+	switch {
+	case a.StartHour == a.EndHour:
+		return true
+	case a.StartHour < a.EndHour:
+		return hour >= a.StartHour && hour < a.EndHour
+	default:
+		return hour >= a.StartHour || hour < a.EndHour
+	}
+}
+
+// CheckAllActivities re-checks the forecast for every watched activity. It emails users about
+// new windows and about planned windows that no longer qualify. Forecasts are fetched once per
+// location.
+func (s *CustomActivityService) CheckAllActivities() error {
+	rows, err := s.db.Query(
+		`SELECT ` + prefixColumns("a.", customActivityColumns) + `, u.username, u.email
+		FROM custom_activities a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.notifications_enabled = TRUE AND u.notifications_enabled = TRUE
+		AND u.email_verified = TRUE AND u.disabled = FALSE`,
+	)
+	if err != nil {
+		return err
+	}
+
+	type watchedActivity struct {
+		activity CustomActivity
+		username string
+		email    string
+	}
+	var watched []watchedActivity
+	for rows.Next() {
+		var w watchedActivity
+		activity, err := scanCustomActivity(rows, &w.username, &w.email)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		w.activity = activity
+		watched = append(watched, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	forecasts := make(map[string]*HourlyForecast)
+	failures := 0
+	for _, w := range watched {
+		key := fmt.Sprintf("%.2f,%.2f", w.activity.Latitude, w.activity.Longitude)
+		forecast, fetched := forecasts[key]
+		if !fetched {
+			forecast, err = s.forecast.HourlyForecast(w.activity.Latitude, w.activity.Longitude)
+			if err != nil {
+				log.Printf("Custom activities: forecast unavailable for %s: %v", w.activity.City, err)
+			}
+			forecasts[key] = forecast
+		}
+		if forecast == nil {
+			failures++
+			continue
+		}
+
+		if err := s.checkActivity(w.activity, w.username, w.email, forecast, true, true); err != nil {
+			log.Printf("Custom activities: failed to check activity %d: %v", w.activity.ID, err)
+			failures++
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d activities could not be checked", failures, len(watched))
+	}
+	return nil
+}
+
+// checkActivity compares an activity's current windows with the ones the user was told about,
+// emailing new windows if notifyFound is set and lost planned windows if notifyLost is
+func (s *CustomActivityService) checkActivity(activity CustomActivity, username, email string, forecast *HourlyForecast, notifyFound, notifyLost bool) error {
+	if _, err := s.db.Exec("DELETE FROM custom_activity_windows WHERE activity_id = ? AND end_at <= ?", activity.ID, time.Now()); err != nil {
+		return err
+	}
+
+	known, err := s.loadWindows(activity.ID)
+	if err != nil {
+		return err
+	}
+	current := qualifyingWindows(activity, forecast)
+
+	// Known windows that still overlap a qualifying window follow it as the forecast shifts
+	matched := make([]bool, len(current))
+	for _, window := range known {
+		index := -1
+		for i, candidate := range current {
+			if !matched[i] && candidate.Start.Before(window.End) && window.Start.Before(candidate.End) {
+				index = i
+				break
+			}
+		}
+
+		if index < 0 {
+			if _, err := s.db.Exec("DELETE FROM custom_activity_windows WHERE id = ?", window.ID); err != nil {
+				return err
+			}
+			// A window that already started has merely been cut short
+			if notifyLost && window.Planned && window.Start.After(time.Now()) {
+				if err := s.notifier.SendActivityWindowLost(email, username, activity.Name, activity.City, window, forecast.TimezoneOffset); err != nil {
+					log.Printf("Custom activities: failed to send lost window notice for activity %d: %v", activity.ID, err)
+				}
+			}
+			continue
+		}
+
+		matched[index] = true
+		_, err := s.db.Exec(
+			"UPDATE custom_activity_windows SET start_at = ?, end_at = ?, score = ? WHERE id = ?",
+			current[index].Start, current[index].End, current[index].Score, window.ID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	var found []SuitabilityWindow
+	for i, window := range current {
+		if matched[i] {
+			continue
+		}
+		_, err := s.db.Exec(
+			`INSERT INTO custom_activity_windows (activity_id, start_at, end_at, score, planned, created_at)
+			VALUES (?, ?, ?, ?, FALSE, ?)`,
+			activity.ID, window.Start, window.End, window.Score, time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+		found = append(found, window)
+	}
+
+	if notifyFound && len(found) > 0 {
+		if err := s.notifier.SendActivityWindowsFound(email, username, activity.Name, activity.City, found, forecast.TimezoneOffset); err != nil {
+			log.Printf("Custom activities: failed to send new windows for activity %d: %v", activity.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// loadWindows returns an activity's stored windows, soonest first
+func (s *CustomActivityService) loadWindows(activityID int) ([]ActivityWindow, error) {
+	rows, err := s.db.Query(
+		`SELECT id, activity_id, start_at, end_at, score, planned, created_at
+		FROM custom_activity_windows
+		WHERE activity_id = ?
+		ORDER BY start_at`,
+		activityID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := make([]ActivityWindow, 0)
+	for rows.Next() {
+		var window ActivityWindow
+		if err := rows.Scan(&window.ID, &window.ActivityID, &window.Start, &window.End, &window.Score,
+			&window.Planned, &window.CreatedAt); err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+
+	return windows, rows.Err()
+}
+
+// scanCustomActivity reads a custom_activities row selected with customActivityColumns,
+// followed by any extra columns
+func scanCustomActivity(row rowScanner, extra ...interface{}) (CustomActivity, error) {
+	var activity CustomActivity
+	var conditions string
+	var days int
+	dest := append([]interface{}{&activity.ID, &activity.UserID, &activity.Name, &conditions, &days,
+		&activity.StartHour, &activity.EndHour, &activity.City, &activity.Latitude, &activity.Longitude,
+		&activity.MinHours, &activity.NotificationsEnabled, &activity.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return CustomActivity{}, err
+	}
+
+	if err := json.Unmarshal([]byte(conditions), &activity.Conditions); err != nil {
+		return CustomActivity{}, fmt.Errorf("activity %d has invalid conditions: %w", activity.ID, err)
+	}
+	activity.PreferredDays = weekdaysFromMask(days)
+
+	return activity, nil
+}
+
+// prefixColumns qualifies a comma-separated column list with a table alias
+func prefixColumns(prefix, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, part := range parts {
+		parts[i] = prefix + strings.TrimSpace(part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// weekdayMask packs weekdays into a bit mask, bit 0 being Sunday
+func weekdayMask(days []int) int {
+	mask := 0
+	for _, day := range days {
+		mask |= 1 << uint(day)
+	}
+	return mask
+}
+
+// weekdaysFromMask unpacks a weekday bit mask
+func weekdaysFromMask(mask int) []int {
+	days := make([]int, 0)
+	for day := 0; day < 7; day++ {
+		if mask&(1<<uint(day)) != 0 {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// validateCustomActivity normalizes an activity and checks its settings
+func validateCustomActivity(activity *CustomActivity) error {
+	activity.Name = strings.TrimSpace(activity.Name)
+	if activity.Name == "" || len([]rune(activity.Name)) > MaxCustomActivityNameLen {
+		return fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidCustomActivity, MaxCustomActivityNameLen)
+	}
+
+	if activity.MinHours < 1 || activity.MinHours > MaxCustomActivityMinHours {
+		return fmt.Errorf("%w: minimum window must be 1 to %d hours", ErrInvalidCustomActivity, MaxCustomActivityMinHours)
+	}
+
+	seen := make(map[int]bool)
+	for _, day := range activity.PreferredDays {
+		if day < 0 || day > 6 || seen[day] {
+			return fmt.Errorf("%w: preferred days must be distinct weekdays from 0 (Sunday) to 6", ErrInvalidCustomActivity)
+		}
+		seen[day] = true
+	}
+	activity.PreferredDays = weekdaysFromMask(weekdayMask(activity.PreferredDays))
+
+	if activity.StartHour < 0 || activity.StartHour > 23 || activity.EndHour < 0 || activity.EndHour > 24 {
+		return fmt.Errorf("%w: hours must be between 0 and 24", ErrInvalidCustomActivity)
+	}
+	if activity.EndHour == 24 {
+		activity.EndHour = 0
+	}
+
+	if activity.Latitude < -90 || activity.Latitude > 90 || activity.Longitude < -180 || activity.Longitude > 180 {
+		return fmt.Errorf("%w: coordinates are out of range", ErrInvalidCustomActivity)
+	}
+	activity.City = truncate(strings.TrimSpace(activity.City), 100)
+
+	ranges := map[string]*FactorRange{
+		FactorTemperature:   activity.Conditions.Temperature,
+		FactorWind:          activity.Conditions.Wind,
+		FactorPrecipitation: activity.Conditions.Precipitation,
+		FactorUV:            activity.Conditions.UV,
+		FactorAQI:           activity.Conditions.AQI,
+		FactorClouds:        activity.Conditions.Clouds,
+	}
+	for factor, r := range ranges {
+		if r == nil {
+			continue
+		}
+		values := []float64{r.AcceptableMin, r.IdealMin, r.IdealMax, r.AcceptableMax}
+		for i, value := range values {
+			if math.IsNaN(value) || math.IsInf(value, 0) || (i > 0 && value < values[i-1]) {
+				return fmt.Errorf("%w: %s ranges must satisfy acceptable min <= ideal min <= ideal max <= acceptable max",
+					ErrInvalidCustomActivity, factorLabels[factor])
+			}
+		}
+	}
+
+	switch activity.Conditions.Daylight {
+	case DaylightAny, DaylightDay, DaylightNight:
+	default:
+		return fmt.Errorf("%w: daylight must be day, night or empty", ErrInvalidCustomActivity)
+	}
+
+	return nil
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+
+	"weather-app/models"
+)
+
+// Errors returned by direct message operations
+var (
+	ErrConversationNotFound = errors.New("conversation not found")
+	ErrCannotMessageSelf    = errors.New("you cannot start a conversation with yourself")
+	ErrUserBlocked          = errors.New("messages between these users are blocked")
+)
+
+// DirectMessageService handles private 1:1 conversations between users
+type DirectMessageService struct {
+	db *sql.DB
+}
+
+// NewDirectMessageService creates a new instance of DirectMessageService
+func NewDirectMessageService(db *sql.DB) *DirectMessageService {
+	return &DirectMessageService{
+		db: db,
+	}
+}
+
+// GetOrCreateConversation returns the conversation between two users, creating it if needed
+func (s *DirectMessageService) GetOrCreateConversation(userID, otherUserID int) (*models.Conversation, error) {
+	if userID == otherUserID {
+		return nil, ErrCannotMessageSelf
+	}
+
+	blocked, err := s.IsBlocked(userID, otherUserID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrUserBlocked
+	}
+
+	userA, userB := userID, otherUserID
+	if userA > userB {
+		userA, userB = userB, userA
+	}
+
+	if _, err := s.db.Exec(
+		`INSERT IGNORE INTO dm_conversations (user_a_id, user_b_id, created_at, last_message_at)
+		VALUES (?, ?, NOW(), NOW())`,
+		userA, userB,
+	); err != nil {
+		return nil, err
+	}
+
+	conv := &models.Conversation{}
+	err = s.db.QueryRow(
+		"SELECT id, user_a_id, user_b_id, created_at, last_message_at FROM dm_conversations WHERE user_a_id = ? AND user_b_id = ?",
+		userA, userB,
+	).Scan(&conv.ID, &conv.UserAID, &conv.UserBID, &conv.CreatedAt, &conv.LastMessageAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return conv, nil
+}
+
+// GetConversation returns a conversation only if userID is one of its participants
+func (s *DirectMessageService) GetConversation(conversationID, userID int) (*models.Conversation, error) {
+	conv := &models.Conversation{}
+	err := s.db.QueryRow(
+		"SELECT id, user_a_id, user_b_id, created_at, last_message_at FROM dm_conversations WHERE id = ?",
+		conversationID,
+	).Scan(&conv.ID, &conv.UserAID, &conv.UserBID, &conv.CreatedAt, &conv.LastMessageAt)
+
+	// Conversations of other users are reported as missing so their existence is not revealed
+	if err == sql.ErrNoRows || (err == nil && !conv.HasParticipant(userID)) {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return conv, nil
+}
+
+// ListConversations returns the user's conversations, most recently active first
+func (s *DirectMessageService) ListConversations(userID int) ([]models.ConversationSummary, error) {
+	rows, err := s.db.Query(
+		`SELECT c.id, u.id, u.username, u.profile_photo, c.last_message_at,
+			COALESCE((SELECT IF(m.deleted_at IS NULL, m.message, '') FROM dm_messages m
+				WHERE m.conversation_id = c.id ORDER BY m.id DESC LIMIT 1), ''),
+			(SELECT COUNT(*) FROM dm_messages m
+				WHERE m.conversation_id = c.id AND m.sender_id <> ? AND m.deleted_at IS NULL
+				AND m.id > COALESCE((SELECT r.last_read_message_id FROM dm_reads r
+					WHERE r.conversation_id = c.id AND r.user_id = ?), 0)),
+			EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = ? AND b.blocked_id = u.id)
+		FROM dm_conversations c
+		JOIN users u ON u.id = IF(c.user_a_id = ?, c.user_b_id, c.user_a_id)
+		WHERE c.user_a_id = ? OR c.user_b_id = ?
+		ORDER BY c.last_message_at DESC`,
+		userID, userID, userID, userID, userID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := make([]models.ConversationSummary, 0)
+	for rows.Next() {
+		var summary models.ConversationSummary
+		var photo string
+		if err := rows.Scan(&summary.ID, &summary.OtherUserID, &summary.OtherUsername, &photo,
+			&summary.LastMessageAt, &summary.LastMessage, &summary.UnreadCount, &summary.Blocked); err != nil {
+			return nil, err
+		}
+		summary.OtherAvatarURL = models.ProfilePhotoURL(photo)
+		conversations = append(conversations, summary)
+	}
+
+	return conversations, rows.Err()
+}
+
+// GetMessages returns the most recent messages of a conversation in chronological order
+func (s *DirectMessageService) GetMessages(conversationID, userID, limit int) ([]models.ChatMessage, error) {
+	if _, err := s.GetConversation(conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(
+		`SELECT m.id, m.sender_id, u.username, m.message, m.image_url, m.created_at, u.profile_photo, m.edited_at, m.deleted_at
+		FROM dm_messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE m.conversation_id = ?
+		ORDER BY m.id DESC
+		LIMIT ?`,
+		conversationID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]models.ChatMessage, 0)
+	for rows.Next() {
+		msg, err := scanDirectMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		msg.ConversationID = conversationID
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Reverse to get chronological order
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, nil
+}
+
+// SendMessage adds a message from userID to a conversation
+func (s *DirectMessageService) SendMessage(conversationID, userID int, text, imageURL string) (models.ChatMessage, error) {
+	conv, err := s.GetConversation(conversationID, userID)
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	blocked, err := s.IsBlocked(userID, conv.OtherUserID(userID))
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+	if blocked {
+		return models.ChatMessage{}, ErrUserBlocked
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO dm_messages (conversation_id, sender_id, message, image_url, created_at) VALUES (?, ?, ?, ?, NOW())",
+		conversationID, userID, text, imageURL,
+	)
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	if _, err := tx.Exec("UPDATE dm_conversations SET last_message_at = NOW() WHERE id = ?", conversationID); err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	// The sender has obviously read everything up to their own message
+	if err := markRead(tx, conversationID, userID, id); err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	msg, err := scanDirectMessage(s.db.QueryRow(
+		`SELECT m.id, m.sender_id, u.username, m.message, m.image_url, m.created_at, u.profile_photo, m.edited_at, m.deleted_at
+		FROM dm_messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE m.id = ?`,
+		id,
+	))
+	if err != nil {
+		return models.ChatMessage{}, err
+	}
+	msg.ConversationID = conversationID
+
+	return msg, nil
+}
+
+// MarkRead records that userID has read every message currently in the conversation
+func (s *DirectMessageService) MarkRead(conversationID, userID int) error {
+	if _, err := s.GetConversation(conversationID, userID); err != nil {
+		return err
+	}
+
+	var lastID sql.NullInt64
+	if err := s.db.QueryRow(
+		"SELECT MAX(id) FROM dm_messages WHERE conversation_id = ?",
+		conversationID,
+	).Scan(&lastID); err != nil {
+		return err
+	}
+	if !lastID.Valid {
+		return nil
+	}
+
+	return markRead(s.db, conversationID, userID, lastID.Int64)
+}
+
+// GetUnreadCount returns the number of unread messages across all of the user's conversations
+func (s *DirectMessageService) GetUnreadCount(userID int) (int, error) {
+	var count int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*)
+		FROM dm_messages m
+		JOIN dm_conversations c ON c.id = m.conversation_id
+		LEFT JOIN dm_reads r ON r.conversation_id = c.id AND r.user_id = ?
+		WHERE (c.user_a_id = ? OR c.user_b_id = ?)
+		AND m.sender_id <> ?
+		AND m.deleted_at IS NULL
+		AND m.id > COALESCE(r.last_read_message_id, 0)
+		AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = ? AND b.blocked_id = m.sender_id)`,
+		userID, userID, userID, userID, userID,
+	).Scan(&count)
+
+	return count, err
+}
+
+// BlockUser prevents two users from starting or continuing a conversation
+func (s *DirectMessageService) BlockUser(blockerID, blockedID int) error {
+	if blockerID == blockedID {
+		return ErrCannotMessageSelf
+	}
+
+	_, err := s.db.Exec(
+		"INSERT IGNORE INTO user_blocks (blocker_id, blocked_id, created_at) VALUES (?, ?, NOW())",
+		blockerID, blockedID,
+	)
+	return err
+}
+
+// UnblockUser removes a block previously created by blockerID
+func (s *DirectMessageService) UnblockUser(blockerID, blockedID int) error {
+	_, err := s.db.Exec(
+		"DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?",
+		blockerID, blockedID,
+	)
+	return err
+}
+
+// IsBlocked reports whether either user has blocked the other
+func (s *DirectMessageService) IsBlocked(userID, otherUserID int) (bool, error) {
+	var blocked bool
+	err := s.db.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM user_blocks
+		WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?))`,
+		userID, otherUserID, otherUserID, userID,
+	).Scan(&blocked)
+
+	return blocked, err
+}
+
+// ListBlockedUsers returns the users blocked by userID
+func (s *DirectMessageService) ListBlockedUsers(userID int) ([]models.BlockedUser, error) {
+	rows, err := s.db.Query(
+		`SELECT u.id, u.username, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = ?
+		ORDER BY b.created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := make([]models.BlockedUser, 0)
+	for rows.Next() {
+		var user models.BlockedUser
+		if err := rows.Scan(&user.UserID, &user.Username, &user.BlockedAt); err != nil {
+			return nil, err
+		}
+		blocked = append(blocked, user)
+	}
+
+	return blocked, rows.Err()
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// markRead moves the user's read marker forward, never backwards
+func markRead(db execer, conversationID, userID int, messageID int64) error {
+	_, err := db.Exec(
+		`INSERT INTO dm_reads (conversation_id, user_id, last_read_message_id)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE last_read_message_id = GREATEST(last_read_message_id, VALUES(last_read_message_id))`,
+		conversationID, userID, messageID,
+	)
+	return err
+}
+
+// scanDirectMessage reads a dm_messages row joined with its sender, reusing the chat message shape
+func scanDirectMessage(row rowScanner) (models.ChatMessage, error) {
+	var msg models.ChatMessage
+	var photo string
+	var editedAt, deletedAt sql.NullTime
+	if err := row.Scan(&msg.ID, &msg.UserID, &msg.Username, &msg.Message, &msg.ImageURL,
+		&msg.CreatedAt, &photo, &editedAt, &deletedAt); err != nil {
+		return models.ChatMessage{}, err
+	}
+
+	msg.AvatarURL = models.ProfilePhotoURL(photo)
+	applyMessageState(&msg, editedAt, deletedAt)
+
+	return msg, nil
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+)
+
+// Email verification limits
+const (
+	EmailVerificationTokenTTL    = 24 * time.Hour
+	MaxVerificationEmailsPerHour = 3
+	verificationTokenBytes       = 32
+	verificationLinkTemplate     = "/verify-email?token="
+)
+
+// Errors returned by email verification operations
+var (
+	ErrInvalidVerificationToken = errors.New("this verification link is invalid or has expired")
+	ErrEmailAlreadyVerified     = errors.New("email address is already verified")
+	ErrVerificationRateLimited  = errors.New("too many verification emails, please try again later")
+)
+
+// EmailVerificationNotifier emails verification links
+type EmailVerificationNotifier interface {
+	SendEmailVerification(to, username, link string) error
+}
+
+// EmailVerificationService issues and redeems email verification tokens. A token is tied to
+// the address it was sent to, so changing the email again invalidates older links.
+type EmailVerificationService struct {
+	db       *sql.DB
+	notifier EmailVerificationNotifier
+}
+
+// NewEmailVerificationService creates a new instance of EmailVerificationService
+func NewEmailVerificationService(db *sql.DB, notifier EmailVerificationNotifier) *EmailVerificationService {
+	return &EmailVerificationService{
+		db:       db,
+		notifier: notifier,
+	}
+}
+
+// SendVerification emails a verification link for the user's current address
+func (s *EmailVerificationService) SendVerification(userID int) error {
+	var username, email string
+	var verified bool
+	err := s.db.QueryRow(
+		"SELECT username, email, email_verified FROM users WHERE id = ?",
+		userID,
+	).Scan(&username, &email, &verified)
+	if err != nil {
+		return err
+	}
+	if verified {
+		return ErrEmailAlreadyVerified
+	}
+
+	var recent int
+	err = s.db.QueryRow(
+		"SELECT COUNT(*) FROM email_verifications WHERE user_id = ? AND created_at > NOW() - INTERVAL 1 HOUR",
+		userID,
+	).Scan(&recent)
+	if err != nil {
+		return err
+	}
+	if recent >= MaxVerificationEmailsPerHour {
+		return ErrVerificationRateLimited
+	}
+
+	token := randomToken(verificationTokenBytes)
+
+	_, err = s.db.Exec(
+		`INSERT INTO email_verifications (user_id, email, token_hash, created_at, expires_at)
+		VALUES (?, ?, ?, NOW(), NOW() + INTERVAL ? SECOND)`,
+		userID, email, hashToken(token), int(EmailVerificationTokenTTL.Seconds()),
+	)
+	if err != nil {
+		return err
+	}
+
+	link := verificationLinkTemplate + url.QueryEscape(token)
+	go func() {
+		if err := s.notifier.SendEmailVerification(email, username, link); err != nil {
+			log.Printf("Error sending verification email to user %d: %v", userID, err)
+		}
+	}()
+
+	return nil
+}
+
+// Verify redeems a verification token and marks the address it was sent to as verified.
+// It returns the ID of the verified user.
+func (s *EmailVerificationService) Verify(token string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var email string
+	err = tx.QueryRow(
+		`SELECT user_id, email FROM email_verifications
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > NOW()
+		FOR UPDATE`,
+		hashToken(token),
+	).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// The link only counts if the account still uses the address it was sent to
+	var current string
+	if err := tx.QueryRow("SELECT email FROM users WHERE id = ? FOR UPDATE", userID).Scan(&current); err != nil {
+		return 0, err
+	}
+	if current != email {
+		return 0, ErrInvalidVerificationToken
+	}
+
+	if _, err := tx.Exec("UPDATE users SET email_verified = TRUE, email_grandfathered = FALSE WHERE id = ?", userID); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec("UPDATE email_verifications SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL", userID); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
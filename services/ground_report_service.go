@@ -0,0 +1,293 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"weather-app/models"
+)
+
+// Limits on how often a single user may post ground reports
+const (
+	MaxReportsPerHour        = 5
+	SameConditionReportDelay = 10 * time.Minute
+)
+
+// MaxReportRadiusKm is the largest radius nearby reports can be searched in
+const MaxReportRadiusKm = 200
+
+// reportAreaCellDegrees is the size of the grid cells reports are grouped into (about 11 km)
+const reportAreaCellDegrees = 0.1
+
+// Errors returned by ground report operations
+var (
+	ErrInvalidReport     = errors.New("invalid report")
+	ErrReportRateLimited = errors.New("too many reports, please try again later")
+)
+
+// validReportConditions lists the conditions users can report
+var validReportConditions = map[string]bool{
+	models.ReportConditionHail:        true,
+	models.ReportConditionFlooding:    true,
+	models.ReportConditionFog:         true,
+	models.ReportConditionIceOnRoad:   true,
+	models.ReportConditionPowerOutage: true,
+}
+
+// GroundReportService stores and aggregates crowd-sourced weather reports
+type GroundReportService struct {
+	db      *sql.DB
+	uploads *UploadService
+}
+
+// NewGroundReportService creates a new instance of GroundReportService
+func NewGroundReportService(db *sql.DB, uploads *UploadService) *GroundReportService {
+	return &GroundReportService{
+		db:      db,
+		uploads: uploads,
+	}
+}
+
+// CreateReport validates and stores a report, enforcing the per-user rate limits
+func (s *GroundReportService) CreateReport(report models.GroundReport) (models.GroundReport, error) {
+	if err := validateReport(&report); err != nil {
+		return models.GroundReport{}, err
+	}
+
+	var lastHour, sameCondition int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*), COALESCE(SUM(condition_type = ? AND created_at > NOW() - INTERVAL ? SECOND), 0)
+		FROM ground_reports
+		WHERE user_id = ? AND created_at > NOW() - INTERVAL 1 HOUR`,
+		report.Condition, int(SameConditionReportDelay.Seconds()), report.UserID,
+	).Scan(&lastHour, &sameCondition)
+	if err != nil {
+		return models.GroundReport{}, err
+	}
+
+	if lastHour >= MaxReportsPerHour || sameCondition > 0 {
+		return models.GroundReport{}, ErrReportRateLimited
+	}
+
+	// Photos must be the reporter's own uploads, which are kept from now on
+	if report.PhotoURL != "" {
+		err := s.uploads.UseChatImage(report.UserID, report.PhotoURL)
+		if errors.Is(err, ErrImageNotUploaded) {
+			return models.GroundReport{}, fmt.Errorf("%w: %v", ErrInvalidReport, err)
+		}
+		if err != nil {
+			return models.GroundReport{}, err
+		}
+	}
+
+	result, err := s.db.Exec(
+		`INSERT INTO ground_reports (user_id, condition_type, intensity, note, photo_url, latitude, longitude, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NOW())`,
+		report.UserID, report.Condition, report.Intensity, report.Note, report.PhotoURL, report.Latitude, report.Longitude,
+	)
+	if err != nil {
+		return models.GroundReport{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.GroundReport{}, err
+	}
+
+	report.ID = int(id)
+	report.CreatedAt = time.Now()
+
+	return report, nil
+}
+
+// GetRecentReports returns individual reports within radiusKm of a point posted in the last window
+func (s *GroundReportService) GetRecentReports(lat, lon, radiusKm float64, window time.Duration) ([]models.GroundReport, error) {
+	if !ValidCoordinates(lat, lon) {
+		return nil, fmt.Errorf("%w: coordinates are out of range", ErrInvalidReport)
+	}
+
+	minLat, maxLat, lonRanges := boundingBox(lat, lon, radiusKm)
+
+	// A box crossing the antimeridian is split into one longitude range on each side
+	args := []interface{}{int(window.Seconds()), minLat, maxLat}
+	lonConditions := make([]string, len(lonRanges))
+	for i, lonRange := range lonRanges {
+		lonConditions[i] = "r.longitude BETWEEN ? AND ?"
+		args = append(args, lonRange[0], lonRange[1])
+	}
+
+	rows, err := s.db.Query(
+		`SELECT r.id, r.user_id, u.username, r.condition_type, r.intensity, r.note, r.photo_url, r.latitude, r.longitude, r.created_at
+		FROM ground_reports r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.created_at > NOW() - INTERVAL ? SECOND
+		AND r.latitude BETWEEN ? AND ?
+		AND (`+strings.Join(lonConditions, " OR ")+`)
+		ORDER BY r.created_at DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]models.GroundReport, 0)
+	for rows.Next() {
+		var report models.GroundReport
+		if err := rows.Scan(&report.ID, &report.UserID, &report.Username, &report.Condition, &report.Intensity,
+			&report.Note, &report.PhotoURL, &report.Latitude, &report.Longitude, &report.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		// The bounding box is a square, so trim the corners
+		if haversineKm(lat, lon, report.Latitude, report.Longitude) <= radiusKm {
+			reports = append(reports, report)
+		}
+	}
+
+	return reports, rows.Err()
+}
+
+// AggregateReports groups recent reports near a point by condition and area
+func (s *GroundReportService) AggregateReports(lat, lon, radiusKm float64, window time.Duration) ([]models.GroundReportArea, error) {
+	reports, err := s.GetRecentReports(lat, lon, radiusKm, window)
+	if err != nil {
+		return nil, err
+	}
+
+	type areaTotals struct {
+		area         *models.GroundReportArea
+		intensitySum int
+		latSum       float64
+		lonSum       float64
+	}
+
+	totals := make(map[string]*areaTotals)
+	var order []string
+	for _, report := range reports {
+		key := fmt.Sprintf("%s|%d|%d", report.Condition,
+			int(math.Floor(report.Latitude/reportAreaCellDegrees)),
+			int(math.Floor(report.Longitude/reportAreaCellDegrees)))
+
+		t, exists := totals[key]
+		if !exists {
+			t = &areaTotals{area: &models.GroundReportArea{Condition: report.Condition}}
+			totals[key] = t
+			order = append(order, key)
+		}
+
+		t.area.Count++
+		t.intensitySum += report.Intensity
+		t.latSum += report.Latitude
+		t.lonSum += report.Longitude
+		if report.Intensity > t.area.MaxIntensity {
+			t.area.MaxIntensity = report.Intensity
+		}
+		if report.CreatedAt.After(t.area.LatestAt) {
+			t.area.LatestAt = report.CreatedAt
+		}
+		if report.PhotoURL != "" && len(t.area.PhotoURLs) < 3 {
+			t.area.PhotoURLs = append(t.area.PhotoURLs, report.PhotoURL)
+		}
+	}
+
+	areas := make([]models.GroundReportArea, 0, len(order))
+	for _, key := range order {
+		t := totals[key]
+		count := float64(t.area.Count)
+		t.area.AvgIntensity = math.Round(float64(t.intensitySum)/count*10) / 10
+		t.area.Latitude = t.latSum / count
+		t.area.Longitude = t.lonSum / count
+		t.area.DistanceKm = math.Round(haversineKm(lat, lon, t.area.Latitude, t.area.Longitude)*10) / 10
+		areas = append(areas, *t.area)
+	}
+
+	return areas, nil
+}
+
+// validateReport checks the fields of a new report and normalizes free text
+func validateReport(report *models.GroundReport) error {
+	report.Condition = strings.ToLower(strings.TrimSpace(report.Condition))
+	if !validReportConditions[report.Condition] {
+		return fmt.Errorf("%w: unknown condition %q", ErrInvalidReport, report.Condition)
+	}
+
+	if report.Intensity < models.ReportIntensityLight || report.Intensity > models.ReportIntensitySevere {
+		return fmt.Errorf("%w: intensity must be between %d and %d", ErrInvalidReport,
+			models.ReportIntensityLight, models.ReportIntensitySevere)
+	}
+
+	if !ValidCoordinates(report.Latitude, report.Longitude) {
+		return fmt.Errorf("%w: coordinates are out of range", ErrInvalidReport)
+	}
+
+	report.Note = strings.TrimSpace(report.Note)
+	if len(report.Note) > 500 {
+		return fmt.Errorf("%w: note must be at most 500 characters", ErrInvalidReport)
+	}
+
+	// Photos must come from our own upload endpoint; CreateReport checks whose upload it is
+	if report.PhotoURL != "" && MediaKey(report.PhotoURL) == "" {
+		return fmt.Errorf("%w: %v", ErrInvalidReport, ErrImageNotUploaded)
+	}
+
+	return nil
+}
+
+// ValidCoordinates reports whether a point is a real latitude and longitude. Parsed input
+// can be NaN, which fails every comparison, so the ranges are checked the positive way round.
+func ValidCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// ValidReportRadius reports whether nearby reports can be searched within radiusKm
+func ValidReportRadius(radiusKm float64) bool {
+	return radiusKm > 0 && radiusKm <= MaxReportRadiusKm
+}
+
+// boundingBox returns the latitude range and the longitude ranges of a box containing a
+// circle of radiusKm around a point. Near the antimeridian the longitudes wrap around, so
+// the box is split into two ranges; a circle reaching a pole covers every longitude.
+func boundingBox(lat, lon, radiusKm float64) (minLat, maxLat float64, lonRanges [][2]float64) {
+	const kmPerDegree = 111.32
+
+	latDelta := radiusKm / kmPerDegree
+	minLat, maxLat = lat-latDelta, lat+latDelta
+	if minLat <= -90 || maxLat >= 90 {
+		return math.Max(minLat, -90), math.Min(maxLat, 90), [][2]float64{{-180, 180}}
+	}
+
+	cos := math.Cos(lat * math.Pi / 180)
+	lonDelta := radiusKm / (kmPerDegree * cos)
+	if lonDelta >= 180 {
+		return minLat, maxLat, [][2]float64{{-180, 180}}
+	}
+
+	minLon, maxLon := lon-lonDelta, lon+lonDelta
+	switch {
+	case minLon < -180:
+		lonRanges = [][2]float64{{minLon + 360, 180}, {-180, maxLon}}
+	case maxLon > 180:
+		lonRanges = [][2]float64{{minLon, 180}, {-180, maxLon - 360}}
+	default:
+		lonRanges = [][2]float64{{minLon, maxLon}}
+	}
+
+	return minLat, maxLat, lonRanges
+}
+
+// haversineKm returns the great-circle distance between two points in kilometers
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371.0
+
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
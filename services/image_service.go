@@ -0,0 +1,387 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+// Limits applied to uploaded images
+const (
+	MaxImageUploadBytes  = 5 * 1024 * 1024
+	MaxImageSourcePixels = 40_000_000 // reject decompression bombs before decoding
+	MaxImageDimension    = 2048       // longest side of the stored original
+	MediumImageDimension = 800
+	ThumbImageDimension  = 200
+	jpegQuality          = 85
+)
+
+// Errors returned when processing uploaded images
+var (
+	ErrImageTooLarge   = errors.New("image file is too large")
+	ErrNotAnImage      = errors.New("file is not a JPEG, PNG or GIF image")
+	ErrImageDimensions = errors.New("image dimensions are too large")
+	ErrInvalidCrop     = errors.New("crop area must be a square of at least 64 pixels inside the image")
+)
+
+// MinProfilePhotoCrop is the smallest crop accepted for a profile photo
+const MinProfilePhotoCrop = 64
+
+// ImageVariant is one encoded size of a processed image
+type ImageVariant struct {
+	Name   string // "original", "medium" or "thumbnail"
+	Suffix string // appended to the base filename, e.g. "_thumb"
+	Data   []byte
+	Width  int
+	Height int
+}
+
+// ProcessedImage is an uploaded image decoded, stripped of metadata and re-encoded in several sizes
+type ProcessedImage struct {
+	Format    string // "jpeg" or "png"
+	Extension string // ".jpg" or ".png"
+	Variants  []ImageVariant
+}
+
+// imageVariantSizes lists the variants created for every upload
+var imageVariantSizes = []struct {
+	name    string
+	suffix  string
+	maxSide int
+}{
+	{"original", "", MaxImageDimension},
+	{"medium", "_medium", MediumImageDimension},
+	{"thumbnail", "_thumb", ThumbImageDimension},
+}
+
+// profilePhotoSizes lists the square variants created for profile photos
+var profilePhotoSizes = []struct {
+	name   string
+	suffix string
+	side   int
+}{
+	{"original", "", 512},
+	{"medium", "_medium", 256},
+	{"thumbnail", "_thumb", 64},
+}
+
+// ProcessImage reads an uploaded image, checks that it really is a JPEG, PNG or GIF and
+// re-encodes it in every variant size. Re-encoding drops EXIF, GPS and any other metadata.
+// GIFs are stored as a still PNG of their first frame.
+func ProcessImage(r io.Reader) (*ProcessedImage, error) {
+	img, format, err := DecodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	processed := &ProcessedImage{Format: "png", Extension: ".png"}
+	if format == "jpeg" {
+		processed.Format = "jpeg"
+		processed.Extension = ".jpg"
+	}
+
+	for _, size := range imageVariantSizes {
+		variant := ResizeToFit(img, size.maxSide)
+
+		var buf bytes.Buffer
+		if processed.Format == "jpeg" {
+			err = jpeg.Encode(&buf, variant, &jpeg.Options{Quality: jpegQuality})
+		} else {
+			err = png.Encode(&buf, variant)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		bounds := variant.Bounds()
+		processed.Variants = append(processed.Variants, ImageVariant{
+			Name:   size.name,
+			Suffix: size.suffix,
+			Data:   buf.Bytes(),
+			Width:  bounds.Dx(),
+			Height: bounds.Dy(),
+		})
+	}
+
+	return processed, nil
+}
+
+// ProcessProfilePhoto decodes an uploaded profile photo, crops it to a square and encodes it
+// as JPEG in every profile photo size. crop is in pixels of the upright image; an empty crop
+// selects the largest centred square. Transparent areas are filled with white.
+func ProcessProfilePhoto(r io.Reader, crop image.Rectangle) (*ProcessedImage, error) {
+	img, _, err := DecodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	if crop.Empty() {
+		side := min(bounds.Dx(), bounds.Dy())
+		x := (bounds.Dx() - side) / 2
+		y := (bounds.Dy() - side) / 2
+		crop = image.Rect(x, y, x+side, y+side)
+	}
+
+	// Use the largest square centred in the requested area
+	side := min(crop.Dx(), crop.Dy())
+	x := crop.Min.X + (crop.Dx()-side)/2
+	y := crop.Min.Y + (crop.Dy()-side)/2
+	crop = image.Rect(x, y, x+side, y+side).Add(bounds.Min)
+	if side < MinProfilePhotoCrop || !crop.In(bounds) {
+		return nil, ErrInvalidCrop
+	}
+
+	square := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(square, square.Bounds(), img, crop.Min, draw.Over)
+
+	processed := &ProcessedImage{Format: "jpeg", Extension: ".jpg"}
+	for _, size := range profilePhotoSizes {
+		variant := resizeSquare(square, size.side)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, variant, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+
+		processed.Variants = append(processed.Variants, ImageVariant{
+			Name:   size.name,
+			Suffix: size.suffix,
+			Data:   buf.Bytes(),
+			Width:  size.side,
+			Height: size.side,
+		})
+	}
+
+	return processed, nil
+}
+
+// resizeSquare scales a square image to exactly side pixels, sampling the nearest pixel when enlarging
+func resizeSquare(src *image.NRGBA, side int) *image.NRGBA {
+	srcSide := src.Bounds().Dx()
+	if srcSide >= side {
+		return ResizeToFit(src, side)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, side, side))
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			dst.SetNRGBA(x, y, src.NRGBAAt(x*srcSide/side, y*srcSide/side))
+		}
+	}
+	return dst
+}
+
+// DecodeImage reads at most MaxImageUploadBytes, sniffs the content type, checks the pixel
+// dimensions and decodes the image, applying the JPEG EXIF orientation
+func DecodeImage(r io.Reader) (image.Image, string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxImageUploadBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > MaxImageUploadBytes {
+		return nil, "", ErrImageTooLarge
+	}
+
+	// Trust the bytes, not the file name or the client's content type
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, "", ErrNotAnImage
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrNotAnImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxImageSourcePixels {
+		return nil, "", ErrImageDimensions
+	}
+
+	var img image.Image
+	switch format {
+	case "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "gif":
+		img, err = gif.Decode(bytes.NewReader(data))
+	default:
+		return nil, "", ErrNotAnImage
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrNotAnImage, err)
+	}
+
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	return img, format, nil
+}
+
+// ResizeToFit scales an image down so its longest side is at most maxSide, averaging the
+// source pixels covered by each destination pixel. Smaller images are copied unscaled.
+func ResizeToFit(src image.Image, maxSide int) *image.NRGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width <= maxSide && height <= maxSide {
+		dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+		return dst
+	}
+
+	dstW, dstH := maxSide, maxSide
+	if width > height {
+		dstH = max(1, height*maxSide/width)
+	} else {
+		dstW = max(1, width*maxSide/height)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*height/dstH
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/dstH)
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*width/dstW
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/dstW)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+
+	return dst
+}
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, or 1 if it has none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Walk the JPEG markers up to the start of the image data looking for the APP1 Exif segment
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xDA || length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && len(segment) > 14 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF structure
+func exifOrientation(tiff []byte) int {
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+
+	return 1
+}
+
+// applyOrientation rotates and flips an image so it displays upright without its EXIF tag
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5-8 swap width and height
+	dstW, dstH := width, height
+	if orientation >= 5 {
+		dstW, dstH = height, width
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = width-1-x, y
+			case 3: // rotated 180
+				dx, dy = width-1-x, height-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, height-1-y
+			case 5: // mirrored and rotated 90 clockwise
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = height-1-y, x
+			case 7: // mirrored and rotated 90 counter-clockwise
+				dx, dy = height-1-y, width-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, width-1-x
+			}
+			dst.Set(dx, dy, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobStatus describes the runs of a background job for the admin console
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Running        bool       `json:"running"`
+	Runs           int        `json:"runs"`
+	Failures       int        `json:"failures"`
+	LastStartedAt  *time.Time `json:"last_started_at,omitempty"`
+	LastFinishedAt *time.Time `json:"last_finished_at,omitempty"`
+	LastDurationMs int64      `json:"last_duration_ms"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastErrorAt    *time.Time `json:"last_error_at,omitempty"`
+	NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+}
+
+// JobMonitor keeps the status of the app's background loops in memory. Jobs call Wait
+// instead of time.Sleep so the next run time is known, and wrap each run in Run.
+type JobMonitor struct {
+	mu   sync.Mutex
+	jobs map[string]*JobStatus
+}
+
+// NewJobMonitor creates a new instance of JobMonitor
+func NewJobMonitor() *JobMonitor {
+	return &JobMonitor{
+		jobs: make(map[string]*JobStatus),
+	}
+}
+
+// Wait records when a job runs next and sleeps until then
+func (m *JobMonitor) Wait(name string, d time.Duration) {
+	next := time.Now().Add(d)
+	m.mu.Lock()
+	m.job(name).NextRunAt = &next
+	m.mu.Unlock()
+
+	time.Sleep(d)
+}
+
+// Run runs one iteration of a job and records its outcome
+func (m *JobMonitor) Run(name string, run func() error) error {
+	started := time.Now()
+	m.mu.Lock()
+	job := m.job(name)
+	job.Running = true
+	job.LastStartedAt = &started
+	job.NextRunAt = nil
+	m.mu.Unlock()
+
+	err := run()
+
+	finished := time.Now()
+	m.mu.Lock()
+	job.Running = false
+	job.Runs++
+	job.LastFinishedAt = &finished
+	job.LastDurationMs = finished.Sub(started).Milliseconds()
+	if err != nil {
+		job.Failures++
+		job.LastError = err.Error()
+		job.LastErrorAt = &finished
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Job %s failed: %v", name, err)
+	}
+	return err
+}
+
+// Statuses returns a copy of every job's status, sorted by name
+func (m *JobMonitor) Statuses() []JobStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		statuses = append(statuses, *job)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// job returns the status entry for a job, creating it on first use. Callers hold m.mu.
+func (m *JobMonitor) job(name string) *JobStatus {
+	job, ok := m.jobs[name]
+	if !ok {
+		job = &JobStatus{Name: name}
+		m.jobs[name] = job
+	}
+	return job
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"weather-app/models"
+)
+
+// Login throttling limits
+const (
+	// LoginFailureWindow is how far back failed sign-ins count towards delays and lockouts
+	LoginFailureWindow = 15 * time.Minute
+	// FreeLoginFailures is how many failures are allowed before sign-ins are slowed down
+	FreeLoginFailures = 3
+	// MaxLoginDelay caps the progressive delay between attempts
+	MaxLoginDelay = 5 * time.Minute
+	// MaxAccountLoginFailures locks an account after this many failures in a row
+	MaxAccountLoginFailures = 5
+	// AccountLockDuration is how long a locked account stays locked
+	AccountLockDuration = 15 * time.Minute
+	// SecurityEventRetention is how long security events are kept
+	SecurityEventRetention = 90 * 24 * time.Hour
+)
+
+// Errors returned when a sign-in is not allowed yet
+var (
+	ErrLoginThrottled = errors.New("too many failed sign-in attempts")
+	ErrAccountLocked  = errors.New("account is temporarily locked")
+)
+
+// AccountLockNotifier tells users their account was locked
+type AccountLockNotifier interface {
+	SendAccountLocked(to, username, ipAddress string, duration time.Duration) error
+}
+
+// LoginSecurityService throttles sign-ins per IP address and per account, locks accounts
+// after repeated failures and records sign-in events for the user's security log
+type LoginSecurityService struct {
+	db       *sql.DB
+	notifier AccountLockNotifier
+}
+
+// NewLoginSecurityService creates a new instance of LoginSecurityService
+func NewLoginSecurityService(db *sql.DB, notifier AccountLockNotifier) *LoginSecurityService {
+	return &LoginSecurityService{
+		db:       db,
+		notifier: notifier,
+	}
+}
+
+// CheckAllowed reports whether a sign-in from ipAddress may be attempted now. userID is 0
+// when the username does not exist. When the attempt is not allowed it returns
+// ErrAccountLocked or ErrLoginThrottled and how long to wait.
+func (s *LoginSecurityService) CheckAllowed(userID int, ipAddress string) (time.Duration, error) {
+	if userID != 0 {
+		var remaining int
+		err := s.db.QueryRow(
+			"SELECT TIMESTAMPDIFF(SECOND, NOW(), locked_until) FROM users WHERE id = ? AND locked_until > NOW()",
+			userID,
+		).Scan(&remaining)
+		if err == nil {
+			return time.Duration(remaining+1) * time.Second, ErrAccountLocked
+		}
+		if err != sql.ErrNoRows {
+			return 0, err
+		}
+	}
+
+	failures, sinceLast, err := s.recentIPFailures(ipAddress)
+	if err != nil {
+		return 0, err
+	}
+	if wait := loginDelay(failures) - sinceLast; wait > 0 {
+		return wait, ErrLoginThrottled
+	}
+
+	if userID != 0 {
+		failures, sinceLast, err := s.recentAccountFailures(userID)
+		if err != nil {
+			return 0, err
+		}
+		if wait := loginDelay(failures) - sinceLast; wait > 0 {
+			return wait, ErrLoginThrottled
+		}
+	}
+
+	return 0, nil
+}
+
+// RecordFailure records a failed sign-in and locks the account once it has failed
+// MaxAccountLoginFailures times in a row. userID is 0 when the username does not exist.
+func (s *LoginSecurityService) RecordFailure(userID int, ipAddress, userAgent string) error {
+	if err := s.recordEvent(userID, models.SecurityEventLoginFailed, ipAddress, userAgent); err != nil {
+		return err
+	}
+	if userID == 0 {
+		return nil
+	}
+
+	failures, _, err := s.recentAccountFailures(userID)
+	if err != nil {
+		return err
+	}
+	if failures < MaxAccountLoginFailures {
+		return nil
+	}
+
+	result, err := s.db.Exec(
+		"UPDATE users SET locked_until = NOW() + INTERVAL ? SECOND WHERE id = ? AND (locked_until IS NULL OR locked_until <= NOW())",
+		int(AccountLockDuration.Seconds()), userID,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil
+	}
+
+	log.Printf("Locked user %d after %d failed sign-ins", userID, failures)
+	if err := s.recordEvent(userID, models.SecurityEventAccountLocked, ipAddress, userAgent); err != nil {
+		return err
+	}
+
+	// Security notices follow the same rule as other mail: verified addresses only
+	var username, email string
+	var verified bool
+	err = s.db.QueryRow("SELECT username, email, email_verified FROM users WHERE id = ?", userID).Scan(&username, &email, &verified)
+	if err != nil {
+		return err
+	}
+	if verified {
+		go func() {
+			if err := s.notifier.SendAccountLocked(email, username, ipAddress, AccountLockDuration); err != nil {
+				log.Printf("Error sending account locked email to user %d: %v", userID, err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// RecordSuccess records a successful sign-in, which also resets the account's failure count
+func (s *LoginSecurityService) RecordSuccess(userID int, ipAddress, userAgent string) error {
+	return s.recordEvent(userID, models.SecurityEventLoginSuccess, ipAddress, userAgent)
+}
+
+// ListEvents returns a user's most recent security events, newest first
+func (s *LoginSecurityService) ListEvents(userID, limit int) ([]models.SecurityEvent, error) {
+	rows, err := s.db.Query(
+		`SELECT id, event_type, ip_address, user_agent, created_at
+		FROM security_events
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?`,
+		userID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]models.SecurityEvent, 0)
+	for rows.Next() {
+		var event models.SecurityEvent
+		if err := rows.Scan(&event.ID, &event.EventType, &event.IPAddress, &event.UserAgent, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// DeleteOldEvents removes security events older than SecurityEventRetention
+func (s *LoginSecurityService) DeleteOldEvents() (int, error) {
+	result, err := s.db.Exec(
+		"DELETE FROM security_events WHERE created_at < NOW() - INTERVAL ? SECOND",
+		int(SecurityEventRetention.Seconds()),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// recordEvent stores a security event; userID 0 stores an event without an account
+func (s *LoginSecurityService) recordEvent(userID int, eventType, ipAddress, userAgent string) error {
+	var owner interface{}
+	if userID != 0 {
+		owner = userID
+	}
+
+	_, err := s.db.Exec(
+		`INSERT INTO security_events (user_id, event_type, ip_address, user_agent, created_at)
+		VALUES (?, ?, ?, ?, NOW())`,
+		owner, eventType, truncate(ipAddress, 45), truncate(userAgent, 255),
+	)
+	return err
+}
+
+// recentIPFailures counts failed sign-ins from an IP address within LoginFailureWindow
+// and returns how long ago the last one was
+func (s *LoginSecurityService) recentIPFailures(ipAddress string) (int, time.Duration, error) {
+	return s.countFailures(
+		`SELECT COUNT(*), COALESCE(TIMESTAMPDIFF(SECOND, MAX(created_at), NOW()), 0)
+		FROM security_events
+		WHERE ip_address = ? AND event_type = ? AND created_at > NOW() - INTERVAL ? SECOND`,
+		ipAddress, models.SecurityEventLoginFailed, int(LoginFailureWindow.Seconds()),
+	)
+}
+
+// recentAccountFailures counts an account's failed sign-ins within LoginFailureWindow since
+// its last successful sign-in or lockout, and returns how long ago the last one was
+func (s *LoginSecurityService) recentAccountFailures(userID int) (int, time.Duration, error) {
+	return s.countFailures(
+		`SELECT COUNT(*), COALESCE(TIMESTAMPDIFF(SECOND, MAX(created_at), NOW()), 0)
+		FROM security_events
+		WHERE user_id = ? AND event_type = ? AND created_at > NOW() - INTERVAL ? SECOND
+		AND created_at > COALESCE((
+			SELECT MAX(created_at) FROM security_events
+			WHERE user_id = ? AND event_type IN (?, ?)
+		), '1970-01-01')`,
+		userID, models.SecurityEventLoginFailed, int(LoginFailureWindow.Seconds()),
+		userID, models.SecurityEventLoginSuccess, models.SecurityEventAccountLocked,
+	)
+}
+
+// countFailures runs a failure count query returning a count and seconds since the last failure
+func (s *LoginSecurityService) countFailures(query string, args ...interface{}) (int, time.Duration, error) {
+	var count, seconds int
+	if err := s.db.QueryRow(query, args...).Scan(&count, &seconds); err != nil {
+		return 0, 0, err
+	}
+	return count, time.Duration(seconds) * time.Second, nil
+}
+
+// loginDelay is how long to wait after the last of n failures: nothing for the first
+// FreeLoginFailures, then doubling from one second up to MaxLoginDelay
+func loginDelay(failures int) time.Duration {
+	if failures < FreeLoginFailures {
+		return 0
+	}
+
+	delay := time.Second
+	for i := FreeLoginFailures; i < failures && delay < MaxLoginDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxLoginDelay {
+		delay = MaxLoginDelay
+	}
+	return delay
+}
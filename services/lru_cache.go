@@ -0,0 +1,117 @@
+package services
+
+import (
+	"container/list"
+	"time"
+)
+
+// Limits of the in-memory chat room cache
+const (
+	MaxCachedRooms  = 100
+	RoomIdleTimeout = 30 * time.Minute
+)
+
+// lruCacheEntry is a cached value and when it was last used
+type lruCacheEntry[V any] struct {
+	key      string
+	value    V
+	lastUsed time.Time
+}
+
+// lruCache is a least-recently-used cache keyed by string.
+// It is not safe for concurrent use; callers guard each cache with their own mutex.
+type lruCache[V any] struct {
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List // most recently used at the front
+}
+
+// newLRUCache creates a cache holding at most capacity values
+func newLRUCache[V any](capacity int) *lruCache[V] {
+	return &lruCache[V]{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns a cached value and marks it as recently used
+func (c *lruCache[V]) get(key string) (V, bool) {
+	elem, exists := c.items[key]
+	if !exists {
+		var zero V
+		return zero, false
+	}
+
+	entry := elem.Value.(*lruCacheEntry[V])
+	entry.lastUsed = time.Now()
+	c.order.MoveToFront(elem)
+
+	return entry.value, true
+}
+
+// peek returns a cached value without changing its position
+func (c *lruCache[V]) peek(key string) (V, bool) {
+	elem, exists := c.items[key]
+	if !exists {
+		var zero V
+		return zero, false
+	}
+	return elem.Value.(*lruCacheEntry[V]).value, true
+}
+
+// add caches a value, evicting the least recently used one when full.
+// If the key is already cached the existing value is kept and returned.
+func (c *lruCache[V]) add(key string, value V) V {
+	if existing, exists := c.get(key); exists {
+		return existing
+	}
+
+	c.items[key] = c.order.PushFront(&lruCacheEntry[V]{
+		key:      key,
+		value:    value,
+		lastUsed: time.Now(),
+	})
+
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+
+	return value
+}
+
+// set caches a value, replacing any value already cached under the key
+func (c *lruCache[V]) set(key string, value V) {
+	if elem, exists := c.items[key]; exists {
+		c.remove(elem)
+	}
+	c.add(key, value)
+}
+
+// evictIdle removes values not used within maxIdle and returns how many were removed
+func (c *lruCache[V]) evictIdle(maxIdle time.Duration) int {
+	evicted := 0
+	cutoff := time.Now().Add(-maxIdle)
+	for elem := c.order.Back(); elem != nil; {
+		if elem.Value.(*lruCacheEntry[V]).lastUsed.After(cutoff) {
+			break
+		}
+		prev := elem.Prev()
+		c.remove(elem)
+		evicted++
+		elem = prev
+	}
+	return evicted
+}
+
+// clear removes every cached value
+func (c *lruCache[V]) clear() {
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// remove drops a single element from the cache
+func (c *lruCache[V]) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*lruCacheEntry[V])
+	delete(c.items, entry.key)
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"weather-app/models"
+)
+
+// MaxMentionsPerMessage caps how many users a single message can notify
+const MaxMentionsPerMessage = 10
+
+// mentionPattern matches @username at the start of the text or after a non-word character
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]{1,100})`)
+
+// MentionNotifier delivers mention notifications outside the app, e.g. by email
+type MentionNotifier interface {
+	SendChatMention(to, author, city, message, link string) error
+}
+
+// MentionService stores @mentions in chat messages and notifies the mentioned users
+type MentionService struct {
+	db       *sql.DB
+	notifier MentionNotifier
+}
+
+// NewMentionService creates a new instance of MentionService.
+// notifier may be nil, in which case mentions only show up as in-app badges.
+func NewMentionService(db *sql.DB, notifier MentionNotifier) *MentionService {
+	return &MentionService{
+		db:       db,
+		notifier: notifier,
+	}
+}
+
+// ParseMentions returns the distinct usernames mentioned in a text, in order of appearance
+func ParseMentions(text string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		// Trailing punctuation such as "@alice." belongs to the sentence
+		username := strings.TrimRight(match[1], ".-")
+		key := strings.ToLower(username)
+		if username == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		usernames = append(usernames, username)
+		if len(usernames) == MaxMentionsPerMessage {
+			break
+		}
+	}
+	return usernames
+}
+
+// RecordMentions stores a mention row for every existing user mentioned in a chat message
+// and notifies them. It returns the IDs of the mentioned users.
+func (s *MentionService) RecordMentions(msg models.ChatMessage) ([]int, error) {
+	usernames := ParseMentions(msg.Message)
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, 0, len(usernames))
+	args := make([]interface{}, 0, len(usernames))
+	for _, username := range usernames {
+		placeholders = append(placeholders, "?")
+		args = append(args, username)
+	}
+
+	// Mentions are only emailed to verified addresses, and disabled accounts get none
+	rows, err := s.db.Query(
+		`SELECT id, email, notifications_enabled AND email_verified FROM users
+		WHERE disabled = FALSE AND username IN (`+strings.Join(placeholders, ", ")+`)`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	type mentionedUser struct {
+		id            int
+		email         string
+		notifications bool
+	}
+	var users []mentionedUser
+	for rows.Next() {
+		var user mentionedUser
+		if err := rows.Scan(&user.id, &user.email, &user.notifications); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if user.id != msg.UserID {
+			users = append(users, user)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var mentioned []int
+	for _, user := range users {
+		// Only email on the first unread mention; later ones just raise the badge count
+		var unread int
+		if err := s.db.QueryRow(
+			"SELECT COUNT(*) FROM chat_mentions WHERE user_id = ? AND read_at IS NULL",
+			user.id,
+		).Scan(&unread); err != nil {
+			return mentioned, err
+		}
+
+		result, err := s.db.Exec(
+			"INSERT IGNORE INTO chat_mentions (message_id, user_id, created_at) VALUES (?, ?, NOW())",
+			msg.ID, user.id,
+		)
+		if err != nil {
+			return mentioned, err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+
+		mentioned = append(mentioned, user.id)
+
+		if s.notifier != nil && user.notifications && unread == 0 {
+			go func(email string) {
+				if err := s.notifier.SendChatMention(email, msg.Username, msg.CityName, msg.Message, MentionLink(msg.PlaceID, msg.ID)); err != nil {
+					log.Printf("Error sending mention notification to user %d: %v", user.id, err)
+				}
+			}(user.email)
+		}
+	}
+
+	return mentioned, nil
+}
+
+// ListMentions returns the most recent mentions of a user, optionally only unread ones
+func (s *MentionService) ListMentions(userID int, unreadOnly bool, limit int) ([]models.ChatMention, error) {
+	query := `SELECT cm.id, cm.message_id, cm.user_id, m.user_id, m.username, COALESCE(m.place_id, ''), m.city_name,
+		m.message, cm.created_at, cm.read_at
+		FROM chat_mentions cm
+		JOIN chat_messages m ON m.id = cm.message_id
+		WHERE cm.user_id = ? AND m.deleted_at IS NULL`
+	if unreadOnly {
+		query += " AND cm.read_at IS NULL"
+	}
+	query += " ORDER BY cm.created_at DESC LIMIT ?"
+
+	rows, err := s.db.Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := make([]models.ChatMention, 0)
+	for rows.Next() {
+		var mention models.ChatMention
+		var readAt sql.NullTime
+		if err := rows.Scan(&mention.ID, &mention.MessageID, &mention.UserID, &mention.AuthorID, &mention.AuthorUsername,
+			&mention.PlaceID, &mention.CityName, &mention.Message, &mention.CreatedAt, &readAt); err != nil {
+			return nil, err
+		}
+		if readAt.Valid {
+			mention.ReadAt = &readAt.Time
+		}
+		mention.Link = MentionLink(mention.PlaceID, mention.MessageID)
+		mentions = append(mentions, mention)
+	}
+
+	return mentions, rows.Err()
+}
+
+// GetUnreadCount returns the number of unread mentions of a user
+func (s *MentionService) GetUnreadCount(userID int) (int, error) {
+	var count int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*)
+		FROM chat_mentions cm
+		JOIN chat_messages m ON m.id = cm.message_id
+		WHERE cm.user_id = ? AND cm.read_at IS NULL AND m.deleted_at IS NULL`,
+		userID,
+	).Scan(&count)
+
+	return count, err
+}
+
+// MarkRoomRead marks all of a user's mentions in one room as read
+func (s *MentionService) MarkRoomRead(userID int, placeID string) error {
+	_, err := s.db.Exec(
+		`UPDATE chat_mentions cm
+		JOIN chat_messages m ON m.id = cm.message_id
+		SET cm.read_at = NOW()
+		WHERE cm.user_id = ? AND m.place_id = ? AND cm.read_at IS NULL`,
+		userID, placeID,
+	)
+	return err
+}
+
+// MarkAllRead marks all of a user's mentions as read
+func (s *MentionService) MarkAllRead(userID int) error {
+	_, err := s.db.Exec(
+		"UPDATE chat_mentions SET read_at = NOW() WHERE user_id = ? AND read_at IS NULL",
+		userID,
+	)
+	return err
+}
+
+// MentionLink returns the chat page URL that opens a room at a message
+func MentionLink(placeID string, messageID int) string {
+	return fmt.Sprintf("/chat?place=%s#message-%d", url.QueryEscape(placeID), messageID)
+}
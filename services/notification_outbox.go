@@ -0,0 +1,105 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+
+	"weather-app/models"
+)
+
+// OutboxRetention is how long records of sent emails are kept
+const OutboxRetention = 30 * 24 * time.Hour
+
+// NotificationOutbox records every email NotificationService tries to send, so admins can
+// see what went out and what failed
+type NotificationOutbox struct {
+	db *sql.DB
+}
+
+// NewNotificationOutbox creates a new instance of NotificationOutbox
+func NewNotificationOutbox(db *sql.DB) *NotificationOutbox {
+	return &NotificationOutbox{
+		db: db,
+	}
+}
+
+// Record stores the outcome of one email; sendErr is nil when it was sent
+func (o *NotificationOutbox) Record(to, subject string, sendErr error) error {
+	status, errorText := models.OutboxStatusSent, ""
+	if sendErr != nil {
+		status, errorText = models.OutboxStatusFailed, sendErr.Error()
+	}
+
+	_, err := o.db.Exec(
+		`INSERT INTO notification_outbox (recipient, subject, status, error, created_at)
+		VALUES (?, ?, ?, ?, NOW())`,
+		truncate(to, 255), truncate(subject, 255), status, truncate(errorText, 500),
+	)
+	return err
+}
+
+// List returns the most recent entries, newest first, optionally only those with status
+func (o *NotificationOutbox) List(status string, limit int) ([]models.OutboxEntry, error) {
+	rows, err := o.db.Query(
+		`SELECT id, recipient, subject, status, error, created_at
+		FROM notification_outbox
+		WHERE ? = '' OR status = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?`,
+		status, status, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]models.OutboxEntry, 0)
+	for rows.Next() {
+		var entry models.OutboxEntry
+		if err := rows.Scan(&entry.ID, &entry.Recipient, &entry.Subject, &entry.Status, &entry.Error, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// Counts returns how many emails were sent and failed in the last 24 hours
+func (o *NotificationOutbox) Counts() (map[string]int, error) {
+	rows, err := o.db.Query(
+		`SELECT status, COUNT(*) FROM notification_outbox
+		WHERE created_at > NOW() - INTERVAL 1 DAY
+		GROUP BY status`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{models.OutboxStatusSent: 0, models.OutboxStatusFailed: 0}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// DeleteOld removes entries older than OutboxRetention
+func (o *NotificationOutbox) DeleteOld() (int, error) {
+	result, err := o.db.Exec(
+		"DELETE FROM notification_outbox WHERE created_at < NOW() - INTERVAL ? SECOND",
+		int(OutboxRetention.Seconds()),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
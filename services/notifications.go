@@ -6,6 +6,7 @@ import (
 	"net/smtp"
 	"os"
 	"strings"
+	"time"
 )
 
 // EmailConfig holds the configuration for sending emails
@@ -15,11 +16,13 @@ type EmailConfig struct {
 	SenderEmail  string
 	SenderName   string
 	SMTPPassword string
+	AppBaseURL   string // e.g., "https://weather.example.com", used to build links in emails
 }
 
 // NotificationService handles sending notifications to users
 type NotificationService struct {
 	Config EmailConfig
+	Outbox *NotificationOutbox // Records every email sent; nil to skip
 }
 
 // NewNotificationService creates a new notification service
@@ -104,6 +107,148 @@ Go Weather Team
 	return s.sendEmail(to, subject, body)
 }
 
+// SendChatMention tells a user that someone mentioned them in a city chat
+func (s *NotificationService) SendChatMention(to, author, city, message, link string) error {
+	subject := fmt.Sprintf("%s mentioned you in the %s chat", author, city)
+	body := fmt.Sprintf(`
+Hello,
+
+%s mentioned you in the %s weather chat:
+
+"%s"
+
+Open the conversation: %s%s
+
+You won't get another email for new mentions until you've read this one.
+
+Best regards,
+Go Weather Team
+`, author, city, message, s.Config.AppBaseURL, link)
+
+	return s.sendEmail(to, subject, body)
+}
+
+// SendPasswordReset emails a link to choose a new password
+func (s *NotificationService) SendPasswordReset(to, username, link string) error {
+	subject := "Reset your Go Weather password"
+	body := fmt.Sprintf(`
+Hello %s,
+
+We received a request to reset the password of your Go Weather account.
+Choose a new password here: %s%s
+
+The link can be used once and expires in one hour. If you didn't ask for this, you can
+ignore this email and your password will stay the same.
+
+Best regards,
+Go Weather Team
+`, username, s.Config.AppBaseURL, link)
+
+	return s.sendEmail(to, subject, body)
+}
+
+// SendEmailVerification emails a link to confirm the user's email address
+func (s *NotificationService) SendEmailVerification(to, username, link string) error {
+	subject := "Confirm your Go Weather email address"
+	body := fmt.Sprintf(`
+Hello %s,
+
+Please confirm that this is your email address: %s%s
+
+We won't send weather reports or other notifications here until it is confirmed.
+The link expires in 24 hours. If you didn't sign up for Go Weather, you can ignore this email.
+
+Best regards,
+Go Weather Team
+`, username, s.Config.AppBaseURL, link)
+
+	return s.sendEmail(to, subject, body)
+}
+
+// SendAccountLocked warns a user that their account was locked after failed sign-ins
+func (s *NotificationService) SendAccountLocked(to, username, ipAddress string, duration time.Duration) error {
+	subject := "Your Go Weather account was temporarily locked"
+	body := fmt.Sprintf(`
+Hello %s,
+
+We locked your Go Weather account for %d minutes after several failed sign-in attempts.
+The last attempt came from IP address %s.
+
+If this was you, wait until the lock expires and try again. If it wasn't, someone may be
+trying to guess your password; you can choose a new one here: %s/forgot-password
+
+Best regards,
+Go Weather Team
+`, username, int(duration.Minutes()), ipAddress, s.Config.AppBaseURL)
+
+	return s.sendEmail(to, subject, body)
+}
+
+// SendAccountDeletionScheduled tells a user when their account will be deleted and how to keep it
+func (s *NotificationService) SendAccountDeletionScheduled(to, username string, deleteAt time.Time) error {
+	subject := "Your Go Weather account will be deleted"
+	body := fmt.Sprintf(`
+Hello %s,
+
+We received a request to delete your Go Weather account. It will be deleted on %s,
+together with your saved cities, messages, reports and uploaded images. Your city chat
+messages will stay, shown as written by a deleted user.
+
+Changed your mind? Sign in and cancel the deletion on your profile page before then:
+%s/profile
+
+Best regards,
+Go Weather Team
+`, username, deleteAt.Format("January 2, 2006 at 15:04 MST"), s.Config.AppBaseURL)
+
+	return s.sendEmail(to, subject, body)
+}
+
+// SendActivityWindowsFound tells a user about new good weather windows for one of their activities
+func (s *NotificationService) SendActivityWindowsFound(to, username, activity, city string, windows []SuitabilityWindow, timezoneOffset int) error {
+	zone := time.FixedZone("", timezoneOffset)
+	var list strings.Builder
+	for _, window := range windows {
+		fmt.Fprintf(&list, "- %s to %s (%d hours, %s)\n", window.Start.In(zone).Format("Mon Jan 2 15:04"),
+			window.End.In(zone).Format("15:04"), window.Hours, strings.ToLower(window.Rating))
+	}
+
+	subject := fmt.Sprintf("Good weather for %s in %s", activity, city)
+	body := fmt.Sprintf(`
+Hello %s,
+
+The forecast has new windows that suit %s in %s (local time):
+
+%s
+Plan around one on your profile page and we'll let you know if it disappears: %s/profile
+
+Best regards,
+Go Weather Team
+`, username, activity, city, list.String(), s.Config.AppBaseURL)
+
+	return s.sendEmail(to, subject, body)
+}
+
+// SendActivityWindowLost tells a user that a window they planned an activity around no longer qualifies
+func (s *NotificationService) SendActivityWindowLost(to, username, activity, city string, window ActivityWindow, timezoneOffset int) error {
+	zone := time.FixedZone("", timezoneOffset)
+	subject := fmt.Sprintf("Your %s window in %s is gone", activity, city)
+	body := fmt.Sprintf(`
+Hello %s,
+
+You planned %s in %s for %s to %s (local time), but the forecast has changed and
+the weather no longer suits it.
+
+We'll email you when a new window appears. Your activities: %s/profile
+
+Best regards,
+Go Weather Team
+`, username, activity, city, window.Start.In(zone).Format("Mon Jan 2 15:04"), window.End.In(zone).Format("15:04"),
+		s.Config.AppBaseURL)
+
+	return s.sendEmail(to, subject, body)
+}
+
 // sendEmail sends an email using the configured SMTP server
 func (s *NotificationService) sendEmail(to, subject, body string) error {
 	// Format the email headers
@@ -133,6 +278,12 @@ func (s *NotificationService) sendEmail(to, subject, body string) error {
 		[]byte(message),
 	)
 
+	if s.Outbox != nil {
+		if recordErr := s.Outbox.Record(to, subject, err); recordErr != nil {
+			log.Printf("Error recording email in outbox: %v", recordErr)
+		}
+	}
+
 	if err != nil {
 		log.Printf("Error sending email: %v", err)
 		return err
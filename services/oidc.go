@@ -0,0 +1,537 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenID Connect client settings
+const (
+	oidcDiscoveryPath     = "/.well-known/openid-configuration"
+	oidcDiscoveryTTL      = 24 * time.Hour
+	oidcJWKSRefreshLimit  = time.Minute // Minimum time between JWKS refetches for unknown key IDs
+	oidcClockSkew         = time.Minute
+	oidcMaxResponseBytes  = 1 << 20
+	oidcDefaultScopes     = "openid email profile"
+	pkceVerifierBytes     = 32
+	oidcNonceBytes        = 32
+	oidcHTTPClientTimeout = 10 * time.Second
+)
+
+// Errors returned by the OpenID Connect client
+var (
+	ErrInvalidIDToken    = errors.New("invalid ID token")
+	ErrOIDCTokenExchange = errors.New("identity provider rejected the sign-in")
+)
+
+// OIDCConfig holds the relying party settings for one identity provider
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	ProviderName string // Shown on the sign-in button, e.g. "Okta"
+}
+
+// OIDCClaims are the verified ID token claims used to find or create an account
+type OIDCClaims struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	AuthTime          time.Time // When the user last authenticated, zero if the provider didn't say
+}
+
+// oidcDiscovery is the part of the provider metadata the client needs
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider is an OpenID Connect relying party using the authorization code flow with
+// PKCE. Provider metadata and signing keys are fetched on first use and cached.
+type OIDCProvider struct {
+	config OIDCConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	discoveredAt  time.Time
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+// NewOIDCProvider creates an OpenID Connect client. The issuer must use HTTPS, except on
+// localhost so the app can be tried against a local mock identity provider.
+func NewOIDCProvider(config OIDCConfig) (*OIDCProvider, error) {
+	config.IssuerURL = strings.TrimSuffix(config.IssuerURL, "/")
+	issuer, err := url.Parse(config.IssuerURL)
+	if err != nil || issuer.Host == "" {
+		return nil, fmt.Errorf("invalid OIDC issuer URL %q", config.IssuerURL)
+	}
+	if issuer.Scheme != "https" && !(issuer.Scheme == "http" && isLoopbackHost(issuer.Hostname())) {
+		return nil, fmt.Errorf("OIDC issuer %q must use https", config.IssuerURL)
+	}
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("OIDC client ID and redirect URL are required")
+	}
+	if config.ProviderName == "" {
+		config.ProviderName = issuer.Hostname()
+	}
+
+	return &OIDCProvider{
+		config: config,
+		client: &http.Client{Timeout: oidcHTTPClientTimeout},
+	}, nil
+}
+
+// Name returns the provider name shown to users
+func (p *OIDCProvider) Name() string {
+	return p.config.ProviderName
+}
+
+// Issuer returns the issuer identifier that linked identities are stored under
+func (p *OIDCProvider) Issuer() string {
+	return p.config.IssuerURL
+}
+
+// NewOIDCNonce creates a random value for the state and nonce parameters
+func NewOIDCNonce() string {
+	return randomToken(oidcNonceBytes)
+}
+
+// NewPKCEVerifier creates a random PKCE code verifier (RFC 7636)
+func NewPKCEVerifier() string {
+	return randomToken(pkceVerifierBytes)
+}
+
+// PKCEChallenge returns the S256 code challenge for a verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL that starts a sign-in at the identity provider. With
+// forceLogin the provider is asked to authenticate the user again even if they have a
+// session there.
+func (p *OIDCProvider) AuthCodeURL(state, nonce, verifier string, forceLogin bool) (string, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	params := authURL.Query()
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", oidcDefaultScopes)
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", PKCEChallenge(verifier))
+	params.Set("code_challenge_method", "S256")
+	if forceLogin {
+		params.Set("prompt", "login")
+	}
+	authURL.RawQuery = params.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified ID token claims
+func (p *OIDCProvider) Exchange(code, verifier, nonce string) (*OIDCClaims, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("decoding token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrOIDCTokenExchange, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token in response", ErrOIDCTokenExchange)
+	}
+
+	return p.VerifyIDToken(token.IDToken, nonce)
+}
+
+// VerifyIDToken checks an ID token's signature against the provider's JWKS and validates
+// its issuer, audience, expiry and nonce
+func (p *OIDCProvider) VerifyIDToken(rawToken, nonce string) (*OIDCClaims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidIDToken)
+	}
+
+	key, err := p.signingKey(header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims struct {
+		Issuer            string          `json:"iss"`
+		Subject           string          `json:"sub"`
+		Audience          json.RawMessage `json:"aud"`
+		AuthorizedParty   string          `json:"azp"`
+		Expiry            int64           `json:"exp"`
+		IssuedAt          int64           `json:"iat"`
+		Nonce             string          `json:"nonce"`
+		Email             string          `json:"email"`
+		EmailVerified     interface{}     `json:"email_verified"`
+		Name              string          `json:"name"`
+		PreferredUsername string          `json:"preferred_username"`
+		AuthTime          int64           `json:"auth_time"`
+	}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != p.config.IssuerURL:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	case !audienceAllows(claims.Audience, claims.AuthorizedParty, p.config.ClientID):
+		return nil, fmt.Errorf("%w: token is not for this client", ErrInvalidIDToken)
+	case now.After(time.Unix(claims.Expiry, 0).Add(oidcClockSkew)):
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidIDToken)
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(oidcClockSkew)):
+		return nil, fmt.Errorf("%w: token issued in the future", ErrInvalidIDToken)
+	case nonce == "" || claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	// Some providers send email_verified as the string "true"
+	verified := claims.EmailVerified == true || claims.EmailVerified == "true"
+
+	var authTime time.Time
+	if claims.AuthTime > 0 {
+		authTime = time.Unix(claims.AuthTime, 0)
+	}
+
+	return &OIDCClaims{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		Email:             strings.TrimSpace(claims.Email),
+		EmailVerified:     verified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+		AuthTime:          authTime,
+	}, nil
+}
+
+// getDiscovery returns the cached provider metadata, fetching it when missing or stale
+func (p *OIDCProvider) getDiscovery() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil && time.Since(p.discoveredAt) < oidcDiscoveryTTL {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(p.config.IssuerURL+oidcDiscoveryPath, &discovery); err != nil {
+		return nil, fmt.Errorf("fetching OIDC discovery document: %w", err)
+	}
+	if discovery.Issuer != p.config.IssuerURL {
+		return nil, fmt.Errorf("OIDC discovery issuer %q does not match %q", discovery.Issuer, p.config.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is missing endpoints")
+	}
+
+	p.discovery = &discovery
+	p.discoveredAt = time.Now()
+	return p.discovery, nil
+}
+
+// signingKey returns the JWKS key with the given ID, refetching the key set when the ID is
+// unknown so rotated keys are picked up
+func (p *OIDCProvider) signingKey(kid, alg string) (crypto.PublicKey, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := findJWK(p.keys, kid, alg); ok {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.keysFetchedAt) < oidcJWKSRefreshLimit {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching OIDC signing keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := findJWK(p.keys, kid, alg); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+}
+
+// getJSON fetches and decodes a JSON document
+func (p *OIDCProvider) getJSON(rawURL string, v interface{}) error {
+	resp, err := p.client.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, rawURL)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseBytes)).Decode(v)
+}
+
+// jsonWebKey is an RSA or EC public key from a JWKS document (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey converts the JWK to an *rsa.PublicKey or *ecdsa.PublicKey
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// findJWK looks up a key by ID, or the only key of the right type when the token has no ID
+func findJWK(keys map[string]crypto.PublicKey, kid, alg string) (crypto.PublicKey, bool) {
+	if kid != "" {
+		key, ok := keys[kid]
+		return key, ok
+	}
+
+	var found crypto.PublicKey
+	for _, key := range keys {
+		if keyMatchesAlg(key, alg) {
+			if found != nil {
+				return nil, false
+			}
+			found = key
+		}
+	}
+	return found, found != nil
+}
+
+// keyMatchesAlg reports whether a key type can verify a JWS algorithm
+func keyMatchesAlg(key crypto.PublicKey, alg string) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	}
+	return false
+}
+
+// verifyJWTSignature checks a JWS signature. Only asymmetric algorithms are accepted, so
+// "none" and HMAC tokens signed with a public key are rejected.
+func verifyJWTSignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidIDToken, alg)
+	}
+	if !keyMatchesAlg(key, alg) {
+		return fmt.Errorf("%w: key does not match algorithm %q", ErrInvalidIDToken, alg)
+	}
+
+	hasher := hash.New()
+	hasher.Write([]byte(signingInput))
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("%w: bad signature length", ErrInvalidIDToken)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+		}
+	}
+	return nil
+}
+
+// decodeJWTPart decodes a base64url JSON segment of a JWT
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceAllows checks the aud claim, which may be a string or a list. With several
+// audiences the token must also name this client as the authorized party.
+func audienceAllows(raw json.RawMessage, authorizedParty, clientID string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == clientID
+	}
+
+	var audiences []string
+	if json.Unmarshal(raw, &audiences) != nil {
+		return false
+	}
+	for _, audience := range audiences {
+		if audience == clientID {
+			return len(audiences) == 1 || authorizedParty == clientID
+		}
+	}
+	return false
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback address
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password reset limits
+const (
+	PasswordResetTokenTTL     = time.Hour
+	MaxPasswordResetsPerHour  = 3
+	MinPasswordLength         = 8
+	passwordResetTokenBytes   = 32
+	passwordResetLinkTemplate = "/reset-password?token="
+)
+
+// Errors returned by password reset operations
+var (
+	ErrInvalidResetToken = errors.New("this password reset link is invalid or has expired")
+	ErrWeakPassword      = errors.New("password must be at least 8 characters")
+)
+
+// PasswordResetNotifier emails password reset links
+type PasswordResetNotifier interface {
+	SendPasswordReset(to, username, link string) error
+}
+
+// PasswordResetService issues and redeems single-use password reset tokens. Only the
+// SHA-256 of a token is stored.
+type PasswordResetService struct {
+	db       *sql.DB
+	notifier PasswordResetNotifier
+	sessions *SessionStore
+}
+
+// NewPasswordResetService creates a new instance of PasswordResetService
+func NewPasswordResetService(db *sql.DB, notifier PasswordResetNotifier, sessions *SessionStore) *PasswordResetService {
+	return &PasswordResetService{
+		db:       db,
+		notifier: notifier,
+		sessions: sessions,
+	}
+}
+
+// RequestReset emails a reset link if email belongs to an account. It behaves the same
+// whether or not the address is registered so callers cannot probe for accounts.
+func (s *PasswordResetService) RequestReset(email string) error {
+	var userID int
+	var username, address string
+	err := s.db.QueryRow("SELECT id, username, email FROM users WHERE email = ?", email).Scan(&userID, &username, &address)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var recent int
+	err = s.db.QueryRow(
+		"SELECT COUNT(*) FROM password_resets WHERE user_id = ? AND created_at > NOW() - INTERVAL 1 HOUR",
+		userID,
+	).Scan(&recent)
+	if err != nil {
+		return err
+	}
+	if recent >= MaxPasswordResetsPerHour {
+		log.Printf("Password reset rate limit reached for user %d", userID)
+		return nil
+	}
+
+	token := randomToken(passwordResetTokenBytes)
+
+	_, err = s.db.Exec(
+		`INSERT INTO password_resets (user_id, token_hash, created_at, expires_at)
+		VALUES (?, ?, NOW(), NOW() + INTERVAL ? SECOND)`,
+		userID, hashToken(token), int(PasswordResetTokenTTL.Seconds()),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Send in the background so the response time does not reveal whether the account exists
+	link := passwordResetLinkTemplate + url.QueryEscape(token)
+	go func() {
+		if err := s.notifier.SendPasswordReset(address, username, link); err != nil {
+			log.Printf("Error sending password reset email to user %d: %v", userID, err)
+		}
+	}()
+
+	return nil
+}
+
+// ValidToken reports whether a reset token can still be used
+func (s *PasswordResetService) ValidToken(token string) bool {
+	var exists bool
+	err := s.db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM password_resets WHERE token_hash = ? AND used_at IS NULL AND expires_at > NOW())",
+		hashToken(token),
+	).Scan(&exists)
+	return err == nil && exists
+}
+
+// ResetPassword redeems a reset token, sets the new password, invalidates the user's other
+// reset tokens, lifts any sign-in lockout and signs the user out everywhere
+func (s *PasswordResetService) ResetPassword(token, password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(
+		`SELECT user_id FROM password_resets
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > NOW()
+		FOR UPDATE`,
+		hashToken(token),
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE password_resets SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET password = ?, locked_until = NULL, updated_at = NOW() WHERE id = ?", string(hashedPassword), userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if _, err := s.sessions.RevokeOtherSessions(userID, ""); err != nil {
+		log.Printf("Error signing out user %d after password reset: %v", userID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pollen data sources reported in PollenData.Source
+const (
+	PollenSourceProvider    = "provider"
+	PollenSourceStub        = "stub"
+	PollenSourceClimatology = "climatology"
+)
+
+// Pollen cache settings. Estimates are cached for less time so a provider that was down is
+// tried again soon.
+const (
+	PollenCacheTTL          = time.Hour
+	PollenEstimateCacheTTL  = 10 * time.Minute
+	MaxCachedPollenReadings = 1000
+	pollenRequestTimeout    = 10 * time.Second
+)
+
+// PollenProvider fetches current pollen counts for a location. Counts use the 0-100 scale
+// of PollenData; providers leave types they don't measure at -1.
+type PollenProvider interface {
+	GetPollen(lat, lon float64) (*PollenData, error)
+}
+
+// HTTPPollenProvider reads pollen concentrations from an Open-Meteo compatible air quality
+// API. Open-Meteo covers Europe; elsewhere it has no data and the climatology is used.
+type HTTPPollenProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPPollenProvider creates a pollen provider for the API at baseURL
+func NewHTTPPollenProvider(baseURL string) *HTTPPollenProvider {
+	return &HTTPPollenProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: pollenRequestTimeout},
+	}
+}
+
+// GetPollen fetches the current pollen concentrations at a location
+func (p *HTTPPollenProvider) GetPollen(lat, lon float64) (*PollenData, error) {
+	query := url.Values{}
+	query.Set("latitude", fmt.Sprintf("%.4f", lat))
+	query.Set("longitude", fmt.Sprintf("%.4f", lon))
+	query.Set("current", "alder_pollen,birch_pollen,olive_pollen,grass_pollen,mugwort_pollen,ragweed_pollen")
+
+	resp, err := p.client.Get(p.baseURL + "/v1/air-quality?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch pollen data: %s", resp.Status)
+	}
+
+	// Concentrations are grains per cubic metre, null where the model has no coverage
+	var result struct {
+		Current struct {
+			Alder   *float64 `json:"alder_pollen"`
+			Birch   *float64 `json:"birch_pollen"`
+			Olive   *float64 `json:"olive_pollen"`
+			Grass   *float64 `json:"grass_pollen"`
+			Mugwort *float64 `json:"mugwort_pollen"`
+			Ragweed *float64 `json:"ragweed_pollen"`
+		} `json:"current"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	current := result.Current
+	if current.Birch == nil && current.Grass == nil && current.Ragweed == nil {
+		return nil, fmt.Errorf("no pollen data available for this location")
+	}
+
+	tree := maxGrains(current.Alder, current.Birch, current.Olive)
+	weed := maxGrains(current.Mugwort, current.Ragweed)
+	ragweed := maxGrains(current.Ragweed)
+
+	return &PollenData{
+		Tree:    scaleGrains(tree, 15, 90, 1500),
+		Grass:   scaleGrains(maxGrains(current.Grass), 5, 20, 200),
+		Weed:    scaleGrains(weed, 10, 50, 500),
+		Ragweed: scaleGrains(ragweed, 10, 50, 500),
+		Mold:    -1,
+		Dust:    -1,
+		Source:  PollenSourceProvider,
+	}, nil
+}
+
+// maxGrains returns the highest of the concentrations that are present, or -1 if none are
+func maxGrains(values ...*float64) float64 {
+	highest := -1.0
+	for _, value := range values {
+		if value != nil && *value > highest {
+			highest = *value
+		}
+	}
+	return highest
+}
+
+// scaleGrains converts a concentration to the 0-100 scale, where the moderate, high and
+// very high thresholds (the National Allergy Bureau's) map to 20, 50 and 80
+func scaleGrains(grains, moderate, high, veryHigh float64) int {
+	switch {
+	case grains < 0:
+		return -1
+	case grains < moderate:
+		return int(20 * grains / moderate)
+	case grains < high:
+		return 20 + int(30*(grains-moderate)/(high-moderate))
+	case grains < veryHigh:
+		return 50 + int(30*(grains-high)/(veryHigh-high))
+	default:
+		return int(math.Min(100, 80+20*(grains-veryHigh)/veryHigh))
+	}
+}
+
+// StubPollenProvider returns the same counts everywhere, for development without a pollen API
+type StubPollenProvider struct {
+	Data PollenData
+}
+
+// NewStubPollenProvider creates a stub provider reporting moderate pollen
+func NewStubPollenProvider() *StubPollenProvider {
+	return &StubPollenProvider{
+		Data: PollenData{Tree: 35, Grass: 35, Weed: 25, Ragweed: 20, Mold: 30, Dust: 20},
+	}
+}
+
+// GetPollen returns the stub's counts, marked as estimates
+func (p *StubPollenProvider) GetPollen(lat, lon float64) (*PollenData, error) {
+	data := p.Data
+	data.Source = PollenSourceStub
+	data.Estimated = true
+	return &data, nil
+}
+
+// pollenSeason describes a pollen type's season at 45° north: the day of the year it peaks,
+// how many days later it peaks per degree further from the equator, how many days it takes
+// to fall to about 60% of the peak, and its level at the peak, off season and in the tropics
+// where seasons are weak
+type pollenSeason struct {
+	peakDay  int
+	shift    float64
+	width    float64
+	peak     int
+	floor    int
+	tropical int
+}
+
+// Pollen seasons used to estimate counts when no provider has data
+var (
+	treeSeason    = pollenSeason{peakDay: 105, shift: 3, width: 30, peak: 75, floor: 5, tropical: 30}
+	grassSeason   = pollenSeason{peakDay: 166, shift: 2, width: 35, peak: 75, floor: 5, tropical: 40}
+	weedSeason    = pollenSeason{peakDay: 232, width: 28, peak: 70, floor: 5, tropical: 25}
+	ragweedSeason = pollenSeason{peakDay: 250, width: 20, peak: 75, floor: 0, tropical: 10}
+	moldSeason    = pollenSeason{peakDay: 270, width: 50, peak: 70, floor: 20, tropical: 45}
+	dustSeason    = pollenSeason{peakDay: 15, width: 45, peak: 50, floor: 15, tropical: 20}
+)
+
+// ClimatologyPollen estimates pollen counts from typical seasons. Seasons are shifted by half
+// a year in the Southern Hemisphere, spring seasons come later further from the equator,
+// and seasons are weaker near the poles and flatten out in the tropics.
+func ClimatologyPollen(lat float64, at time.Time) *PollenData {
+	day := at.YearDay()
+	if lat < 0 {
+		day = (day + 182) % 365
+	}
+
+	return &PollenData{
+		Tree:      treeSeason.level(lat, day),
+		Grass:     grassSeason.level(lat, day),
+		Weed:      weedSeason.level(lat, day),
+		Ragweed:   ragweedSeason.level(lat, day),
+		Mold:      moldSeason.level(lat, day),
+		Dust:      dustSeason.level(lat, day),
+		Source:    PollenSourceClimatology,
+		Estimated: true,
+	}
+}
+
+// level estimates the season's count on a day of the year at a latitude
+func (s pollenSeason) level(lat float64, day int) int {
+	absLat := math.Abs(lat)
+
+	peakDay := s.peakDay + int(s.shift*(absLat-45))
+	distance := math.Mod(math.Abs(float64(day-peakDay)), 365)
+	distance = math.Min(distance, 365-distance)
+
+	seasonal := float64(s.floor) + float64(s.peak-s.floor)*math.Exp(-distance*distance/(2*s.width*s.width))
+
+	// Shorter, weaker seasons at high latitudes
+	if absLat > 55 {
+		seasonal *= math.Max(0.4, 1-0.6*(absLat-55)/15)
+	}
+
+	// Near the equator the year-round level takes over from the season
+	seasonality := math.Max(0, math.Min(1, (absLat-10)/13.5))
+	return int(math.Round(seasonality*seasonal + (1-seasonality)*float64(s.tropical)))
+}
+
+// pollenCacheEntry is a cached reading and when it expires
+type pollenCacheEntry struct {
+	data      PollenData
+	expiresAt time.Time
+}
+
+// pollenCache holds recent pollen readings by location, rounded to about 10 km. The least
+// recently used readings are dropped when it is full.
+type pollenCache struct {
+	mu      sync.Mutex
+	entries *lruCache[pollenCacheEntry]
+}
+
+// newPollenCache creates an empty pollen cache
+func newPollenCache() *pollenCache {
+	return &pollenCache{entries: newLRUCache[pollenCacheEntry](MaxCachedPollenReadings)}
+}
+
+// locationCacheKey rounds a location to about 10 km so nearby lookups share a cached value
+func locationCacheKey(lat, lon float64) string {
+	return fmt.Sprintf("%.1f,%.1f", lat, lon)
+}
+
+// get returns an unexpired reading for a location
+func (c *pollenCache) get(lat, lon float64) (*PollenData, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.entries.get(locationCacheKey(lat, lon))
+	if !exists || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	data := entry.data
+	return &data, true
+}
+
+// add caches a reading for ttl, replacing any earlier reading for the location
+func (c *pollenCache) add(lat, lon float64, data *PollenData, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries.set(locationCacheKey(lat, lon), pollenCacheEntry{data: *data, expiresAt: time.Now().Add(ttl)})
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"weather-app/models"
+)
+
+// Presence timing. Chat pages send a heartbeat at least once a minute.
+const (
+	PresenceTimeout         = 2 * time.Minute
+	TypingTimeout           = 6 * time.Second
+	PresencePersistInterval = time.Minute
+)
+
+// presenceEntry is one user's presence in one room
+type presenceEntry struct {
+	username    string
+	roomName    string
+	lastSeen    time.Time
+	typingUntil time.Time
+}
+
+// PresenceTracker keeps track of who is online and typing in each chat room
+type PresenceTracker struct {
+	mu    sync.Mutex
+	rooms map[string]map[int]*presenceEntry // place ID -> user ID -> entry
+}
+
+// NewPresenceTracker creates a new instance of PresenceTracker
+func NewPresenceTracker() *PresenceTracker {
+	return &PresenceTracker{
+		rooms: make(map[string]map[int]*presenceEntry),
+	}
+}
+
+// Heartbeat marks a user as online in a room
+func (t *PresenceTracker) Heartbeat(place models.ChatPlace, userID int, username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := t.entry(place, userID, username)
+	entry.lastSeen = time.Now()
+}
+
+// SetTyping starts or stops the typing indicator of a user, which also counts as a heartbeat
+func (t *PresenceTracker) SetTyping(place models.ChatPlace, userID int, username string, typing bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	entry := t.entry(place, userID, username)
+	entry.lastSeen = now
+	if typing {
+		entry.typingUntil = now.Add(TypingTimeout)
+	} else {
+		entry.typingUntil = time.Time{}
+	}
+}
+
+// Username returns the name a user last appeared under in any room
+func (t *PresenceTracker) Username(userID int) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, users := range t.rooms {
+		if entry, exists := users[userID]; exists && entry.username != "" {
+			return entry.username
+		}
+	}
+	return ""
+}
+
+// OnlineUsers returns the users with a recent heartbeat in a room, sorted by name
+func (t *PresenceTracker) OnlineUsers(placeID string) []models.OnlineUser {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	online := make([]models.OnlineUser, 0)
+	for userID, entry := range t.rooms[placeID] {
+		if now.Sub(entry.lastSeen) > PresenceTimeout {
+			continue
+		}
+		online = append(online, models.OnlineUser{
+			UserID:   userID,
+			Username: entry.username,
+			Typing:   now.Before(entry.typingUntil),
+			LastSeen: entry.lastSeen,
+		})
+	}
+
+	sort.Slice(online, func(i, j int) bool {
+		return online[i].Username < online[j].Username
+	})
+
+	return online
+}
+
+// Expire drops users whose heartbeat is older than PresenceTimeout and rooms left empty
+func (t *PresenceTracker) Expire() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for placeID, users := range t.rooms {
+		for userID, entry := range users {
+			if now.Sub(entry.lastSeen) > PresenceTimeout {
+				delete(users, userID)
+			}
+		}
+		if len(users) == 0 {
+			delete(t.rooms, placeID)
+		}
+	}
+}
+
+// presenceRecord is a snapshot of one user's presence used for persistence
+type presenceRecord struct {
+	userID   int
+	placeID  string
+	roomName string
+	idle     time.Duration
+}
+
+// snapshot returns the current presence of every online user
+func (t *PresenceTracker) snapshot() []presenceRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	var records []presenceRecord
+	for placeID, users := range t.rooms {
+		for userID, entry := range users {
+			records = append(records, presenceRecord{
+				userID:   userID,
+				placeID:  placeID,
+				roomName: entry.roomName,
+				idle:     now.Sub(entry.lastSeen),
+			})
+		}
+	}
+	return records
+}
+
+// entry returns the presence entry of a user in a room, creating it if needed. Callers hold t.mu.
+func (t *PresenceTracker) entry(place models.ChatPlace, userID int, username string) *presenceEntry {
+	users, exists := t.rooms[place.ID]
+	if !exists {
+		users = make(map[int]*presenceEntry)
+		t.rooms[place.ID] = users
+	}
+
+	entry, exists := users[userID]
+	if !exists {
+		entry = &presenceEntry{}
+		users[userID] = entry
+	}
+
+	entry.roomName = place.Name
+	if username != "" {
+		entry.username = username
+	}
+
+	return entry
+}
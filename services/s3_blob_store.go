@@ -0,0 +1,289 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxPresignExpiry is the longest validity S3 accepts for a presigned URL
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+// S3Config configures an S3-compatible blob store such as AWS S3 or MinIO
+type S3Config struct {
+	Endpoint      string // e.g. https://s3.us-east-1.amazonaws.com or http://localhost:9000
+	Region        string
+	Bucket        string
+	AccessKey     string
+	SecretKey     string
+	PathStyle     bool   // address the bucket as endpoint/bucket instead of bucket.endpoint (needed for MinIO)
+	PublicBaseURL string // optional public bucket or CDN URL; presigned URLs are used when empty
+}
+
+// S3BlobStore stores blobs in an S3-compatible bucket using AWS Signature Version 4
+type S3BlobStore struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3BlobStore creates a blob store for an S3-compatible bucket
+func NewS3BlobStore(config S3Config) (*S3BlobStore, error) {
+	if config.Bucket == "" || config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("S3 bucket, access key and secret key are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+
+	endpoint, err := url.Parse(strings.TrimRight(config.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+	config.PublicBaseURL = strings.TrimRight(config.PublicBaseURL, "/")
+
+	return &S3BlobStore{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Put uploads a blob
+func (s *S3BlobStore) Put(key string, data []byte, contentType string) error {
+	resp, err := s.do(http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// Open downloads a blob
+func (s *S3BlobStore) Open(key string) (io.ReadCloser, string, error) {
+	resp, err := s.do(http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		contentType := resp.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = blobContentType(key)
+		}
+		return resp.Body, contentType, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, "", ErrBlobNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, "", s3Error(resp)
+	}
+}
+
+// Delete removes a blob
+func (s *S3BlobStore) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// DirectURL returns the public URL of a blob, or a presigned GET URL valid for expiry
+func (s *S3BlobStore) DirectURL(key string, expiry time.Duration) (string, error) {
+	key, err := cleanBlobKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	if s.config.PublicBaseURL != "" {
+		return s.config.PublicBaseURL + "/" + escapeS3Path(key), nil
+	}
+
+	return s.presign(http.MethodGet, key, expiry, time.Now().UTC())
+}
+
+// do sends a signed request for one object
+func (s *S3BlobStore) do(method, key string, body []byte, contentType string) (*http.Response, error) {
+	key, err := cleanBlobKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	objectURL := s.objectURL(key)
+	req, err := http.NewRequest(method, objectURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	s.sign(req, objectURL, sha256Hex(body), time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// objectURL returns the URL of an object in path-style or virtual-hosted style
+func (s *S3BlobStore) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.config.PathStyle {
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + s.config.Bucket + "/" + key
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + key
+	}
+	u.RawPath = ""
+	return &u
+}
+
+// sign adds the Signature Version 4 Authorization header to a request
+func (s *S3BlobStore) sign(req *http.Request, objectURL *url.URL, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 objectURL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		headers["content-type"] = contentType
+	}
+
+	canonicalHeaders, signedHeaders := canonicalS3Headers(headers)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapeS3Path(objectURL.Path),
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope, signature := s.signature(canonicalRequest, now)
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+// presign returns a URL that allows method on an object until expiry without credentials
+func (s *S3BlobStore) presign(method, key string, expiry time.Duration, now time.Time) (string, error) {
+	if expiry <= 0 || expiry > MaxPresignExpiry {
+		expiry = MaxPresignExpiry
+	}
+
+	objectURL := s.objectURL(key)
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + s.config.Region + "/s3/aws4_request"
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.config.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+	canonicalRequest := strings.Join([]string{
+		method,
+		escapeS3Path(objectURL.Path),
+		canonicalQuery,
+		"host:" + objectURL.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	_, signature := s.signature(canonicalRequest, now)
+
+	objectURL.RawPath = escapeS3Path(objectURL.Path)
+	objectURL.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return objectURL.String(), nil
+}
+
+// signature derives the signing key for the request date and signs a canonical request
+func (s *S3BlobStore) signature(canonicalRequest string, now time.Time) (string, string) {
+	date := now.Format("20060102")
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), date)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return scope, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalS3Headers returns the canonical header block and signed header list
+func canonicalS3Headers(headers map[string]string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+
+	return canonical.String(), strings.Join(names, ";")
+}
+
+// escapeS3Path URI-encodes every path segment the way Signature Version 4 expects
+func escapeS3Path(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.QueryEscape(segment), "+", "%20")
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3Error turns an unexpected S3 response into an error
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("S3 request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// sha256Hex returns the hex-encoded SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"weather-app/models"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+)
+
+// SessionTouchInterval is how often the last seen time of a session is refreshed
+const SessionTouchInterval = time.Minute
+
+// ErrSessionNotFound is returned when revoking a session that does not belong to the user
+var ErrSessionNotFound = errors.New("session not found")
+
+var _ sessions.Store = (*SessionStore)(nil)
+
+// SessionStore keeps sessions in MySQL and only a signed random token in the cookie, so that
+// sessions can be listed and revoked. Rows are keyed by the SHA-256 of the token.
+type SessionStore struct {
+	db      *sql.DB
+	codecs  []securecookie.Codec
+	options *gsessions.Options
+}
+
+// NewSessionStore creates a MySQL-backed session store. keyPairs sign (and optionally
+// encrypt) the cookie, as with the cookie store.
+func NewSessionStore(db *sql.DB, keyPairs ...[]byte) *SessionStore {
+	store := &SessionStore{
+		db:     db,
+		codecs: securecookie.CodecsFromPairs(keyPairs...),
+	}
+	store.Options(sessions.Options{Path: "/", MaxAge: 86400 * 7, HttpOnly: true})
+	return store
+}
+
+// Options sets the cookie options of new sessions
+func (s *SessionStore) Options(options sessions.Options) {
+	s.options = options.ToGorillaOptions()
+	for _, codec := range s.codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(options.MaxAge)
+		}
+	}
+}
+
+// Get returns the session of the request, cached for the rest of the request
+func (s *SessionStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session named by the request cookie, or returns a new empty session when the
+// cookie is missing, invalid, expired or revoked
+func (s *SessionStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var token string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &token, s.codecs...); err != nil {
+		return session, nil
+	}
+
+	var data []byte
+	err = s.db.QueryRow(
+		"SELECT data FROM user_sessions WHERE id = ? AND expires_at > NOW()",
+		hashToken(token),
+	).Scan(&data)
+	if err == sql.ErrNoRows {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if err := (securecookie.GobEncoder{}).Deserialize(data, &session.Values); err != nil {
+		return session, nil
+	}
+	session.ID = token
+	session.IsNew = false
+
+	s.touch(r, token)
+	return session, nil
+}
+
+// Save stores the session and writes its cookie. A negative MaxAge deletes the session.
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if _, err := s.db.Exec("DELETE FROM user_sessions WHERE id = ?", hashToken(session.ID)); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	userID, _ := session.Values["user_id"].(int)
+
+	// Issue a fresh token whenever the signed-in user changes to prevent session fixation
+	if session.ID != "" && s.storedUserID(session.ID) != userID {
+		if _, err := s.db.Exec("DELETE FROM user_sessions WHERE id = ?", hashToken(session.ID)); err != nil {
+			return err
+		}
+		session.ID = ""
+	}
+	if session.ID == "" {
+		session.ID = randomToken(32)
+	}
+
+	data, err := (securecookie.GobEncoder{}).Serialize(session.Values)
+	if err != nil {
+		return err
+	}
+
+	var owner interface{}
+	if userID != 0 {
+		owner = userID
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO user_sessions (id, user_id, data, user_agent, ip_address, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, NOW(), NOW(), NOW() + INTERVAL ? SECOND)
+		ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), data = VALUES(data), user_agent = VALUES(user_agent),
+			ip_address = VALUES(ip_address), last_seen_at = NOW(), expires_at = VALUES(expires_at)`,
+		hashToken(session.ID), owner, data, truncate(r.UserAgent(), 255), clientIP(r), session.Options.MaxAge,
+	)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// ListSessions returns a user's active sessions, most recently used first. currentToken
+// is the ID of the requesting session, which is flagged as current.
+func (s *SessionStore) ListSessions(userID int, currentToken string) ([]models.UserSession, error) {
+	rows, err := s.db.Query(
+		`SELECT id, user_agent, ip_address, created_at, last_seen_at
+		FROM user_sessions
+		WHERE user_id = ? AND expires_at > NOW()
+		ORDER BY last_seen_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	current := hashToken(currentToken)
+	list := make([]models.UserSession, 0)
+	for rows.Next() {
+		var session models.UserSession
+		if err := rows.Scan(&session.ID, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastSeenAt); err != nil {
+			return nil, err
+		}
+		session.Current = session.ID == current
+		list = append(list, session)
+	}
+
+	return list, rows.Err()
+}
+
+// RevokeSession signs out one of a user's sessions by its listed ID
+func (s *SessionStore) RevokeSession(userID int, sessionID string) error {
+	result, err := s.db.Exec("DELETE FROM user_sessions WHERE id = ? AND user_id = ?", sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeOtherSessions signs out every session of a user except the one with currentToken,
+// or all of them when currentToken is empty. It returns how many sessions were revoked.
+func (s *SessionStore) RevokeOtherSessions(userID int, currentToken string) (int, error) {
+	result, err := s.db.Exec(
+		"DELETE FROM user_sessions WHERE user_id = ? AND id <> ?",
+		userID, hashToken(currentToken),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// DeleteExpired removes expired sessions
+func (s *SessionStore) DeleteExpired() (int, error) {
+	result, err := s.db.Exec("DELETE FROM user_sessions WHERE expires_at <= NOW()")
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// touch refreshes the last seen time, IP and user agent at most once per SessionTouchInterval
+func (s *SessionStore) touch(r *http.Request, token string) {
+	s.db.Exec(
+		`UPDATE user_sessions SET last_seen_at = NOW(), ip_address = ?, user_agent = ?
+		WHERE id = ? AND last_seen_at < NOW() - INTERVAL ? SECOND`,
+		clientIP(r), truncate(r.UserAgent(), 255), hashToken(token), int(SessionTouchInterval.Seconds()),
+	)
+}
+
+// storedUserID returns the user a stored session belongs to, or 0
+func (s *SessionStore) storedUserID(token string) int {
+	var userID sql.NullInt64
+	s.db.QueryRow("SELECT user_id FROM user_sessions WHERE id = ?", hashToken(token)).Scan(&userID)
+	return int(userID.Int64)
+}
+
+// randomToken creates a URL-safe random token of n bytes
+func randomToken(n int) string {
+	randomBytes := make([]byte, n)
+	rand.Read(randomBytes)
+	return base64.RawURLEncoding.EncodeToString(randomBytes)
+}
+
+// hashToken returns the hex SHA-256 under which a secret token is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientIP returns the IP address of the connection
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/go-sql-driver/mysql"
+	"weather-app/models"
+)
+
+// Single sign-on account settings
+const (
+	maxSSOUsernameLength   = 30
+	maxSSOUsernameAttempts = 20
+	ssoPasswordBytes       = 32
+)
+
+// Errors returned by single sign-on operations
+var (
+	ErrSSOEmailNotVerified  = errors.New("your identity provider did not confirm your email address")
+	ErrSSOAccountNotLinked  = errors.New("an account with this email already exists, sign in with your password and link it from your profile")
+	ErrSSOIdentityInUse     = errors.New("this identity is already linked to another account")
+	ErrSSOAlreadyLinked     = errors.New("your account is already linked to this provider")
+	ErrSSOIdentityNotFound  = errors.New("linked identity not found")
+	errSSOUsernameExhausted = errors.New("could not find a free username")
+)
+
+// SSOService maps OpenID Connect identities to local accounts. Identities are keyed by
+// issuer and subject; email addresses are only used to link an identity the first time,
+// and only when both the provider and this app have verified the address.
+type SSOService struct {
+	db        *sql.DB
+	userStore models.UserStore
+}
+
+// NewSSOService creates a new instance of SSOService
+func NewSSOService(db *sql.DB, userStore models.UserStore) *SSOService {
+	return &SSOService{
+		db:        db,
+		userStore: userStore,
+	}
+}
+
+// SignIn returns the account for a verified identity, linking it to an existing account
+// with the same verified email or creating a new account when there is none
+func (s *SSOService) SignIn(claims *OIDCClaims) (int, error) {
+	userID, err := s.identityUser(claims.Issuer, claims.Subject)
+	if err == nil {
+		if err := s.checkDisabled(userID); err != nil {
+			return 0, err
+		}
+		_, err := s.db.Exec(
+			"UPDATE user_identities SET email = ?, last_login_at = NOW() WHERE issuer = ? AND subject = ?",
+			truncate(claims.Email, 255), claims.Issuer, claims.Subject,
+		)
+		return userID, err
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return 0, ErrSSOEmailNotVerified
+	}
+
+	// Grandfathered addresses were marked verified without anyone confirming them
+	var verified, disabled bool
+	err = s.db.QueryRow(
+		"SELECT id, email_verified AND NOT email_grandfathered, disabled FROM users WHERE email = ?",
+		claims.Email,
+	).Scan(&userID, &verified, &disabled)
+	switch {
+	case err == nil && disabled:
+		return 0, ErrAccountDisabled
+	case err == nil && verified:
+		log.Printf("Linking SSO identity to user %d by verified email", userID)
+		return userID, s.insertIdentity(userID, claims)
+	case err == nil:
+		// Someone may have signed up with this address without owning it
+		return 0, ErrSSOAccountNotLinked
+	case err != sql.ErrNoRows:
+		return 0, err
+	}
+
+	userID, err = s.createUser(claims)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Created user %d from SSO sign-in", userID)
+	return userID, s.insertIdentity(userID, claims)
+}
+
+// Link connects a verified identity to a signed-in user
+func (s *SSOService) Link(userID int, claims *OIDCClaims) error {
+	owner, err := s.identityUser(claims.Issuer, claims.Subject)
+	if err == nil {
+		if owner == userID {
+			return nil
+		}
+		return ErrSSOIdentityInUse
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM user_identities WHERE user_id = ? AND issuer = ?", userID, claims.Issuer).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSSOAlreadyLinked
+	}
+
+	return s.insertIdentity(userID, claims)
+}
+
+// IsLinked reports whether a verified identity is linked to the user
+func (s *SSOService) IsLinked(userID int, claims *OIDCClaims) (bool, error) {
+	owner, err := s.identityUser(claims.Issuer, claims.Subject)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil && owner == userID, err
+}
+
+// ListIdentities returns the identities linked to a user
+func (s *SSOService) ListIdentities(userID int) ([]models.UserIdentity, error) {
+	rows, err := s.db.Query(
+		`SELECT id, issuer, email, created_at, last_login_at
+		FROM user_identities
+		WHERE user_id = ?
+		ORDER BY created_at`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := make([]models.UserIdentity, 0)
+	for rows.Next() {
+		var identity models.UserIdentity
+		var lastLogin sql.NullTime
+		if err := rows.Scan(&identity.ID, &identity.Issuer, &identity.Email, &identity.CreatedAt, &lastLogin); err != nil {
+			return nil, err
+		}
+		if lastLogin.Valid {
+			identity.LastLoginAt = &lastLogin.Time
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// Unlink removes one of a user's linked identities
+func (s *SSOService) Unlink(userID, identityID int) error {
+	result, err := s.db.Exec("DELETE FROM user_identities WHERE id = ? AND user_id = ?", identityID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSSOIdentityNotFound
+	}
+	return nil
+}
+
+// identityUser returns the user an identity is linked to, or sql.ErrNoRows
+func (s *SSOService) identityUser(issuer, subject string) (int, error) {
+	var userID int
+	err := s.db.QueryRow("SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?", issuer, subject).Scan(&userID)
+	return userID, err
+}
+
+// checkDisabled returns ErrAccountDisabled when an admin has disabled the account
+func (s *SSOService) checkDisabled(userID int) error {
+	var disabled bool
+	if err := s.db.QueryRow("SELECT disabled FROM users WHERE id = ?", userID).Scan(&disabled); err != nil {
+		return err
+	}
+	if disabled {
+		return ErrAccountDisabled
+	}
+	return nil
+}
+
+// insertIdentity stores a link between a user and an identity
+func (s *SSOService) insertIdentity(userID int, claims *OIDCClaims) error {
+	_, err := s.db.Exec(
+		`INSERT INTO user_identities (user_id, issuer, subject, email, created_at, last_login_at)
+		VALUES (?, ?, ?, ?, NOW(), NOW())`,
+		userID, claims.Issuer, claims.Subject, truncate(claims.Email, 255),
+	)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		return ErrSSOIdentityInUse
+	}
+	return err
+}
+
+// createUser creates an account for a new SSO user with an already verified email. The
+// account gets a random password; the user can set one later with a password reset.
+func (s *SSOService) createUser(claims *OIDCClaims) (int, error) {
+	base := ssoUsername(claims)
+	for attempt := 0; attempt < maxSSOUsernameAttempts; attempt++ {
+		username := base
+		if attempt > 0 {
+			suffix := fmt.Sprint(attempt + 1)
+			username = truncate(base, maxSSOUsernameLength-len(suffix)) + suffix
+		}
+
+		user := &models.User{
+			Username:             username,
+			Email:                claims.Email,
+			Password:             randomToken(ssoPasswordBytes),
+			NotificationsEnabled: false,
+			AlertThreshold:       "severe",
+			ProfilePhoto:         "default.jpg",
+		}
+		err := s.userStore.CreateUser(user)
+		if err != nil && err.Error() == "username already exists" {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := s.db.Exec("UPDATE users SET email_verified = TRUE WHERE id = ?", user.ID); err != nil {
+			return 0, err
+		}
+		return user.ID, nil
+	}
+	return 0, errSSOUsernameExhausted
+}
+
+// ssoUsername picks a username from the preferred username, the email or the name claim
+func ssoUsername(claims *OIDCClaims) string {
+	candidates := []string{claims.PreferredUsername, strings.SplitN(claims.Email, "@", 2)[0], claims.Name}
+	for _, candidate := range candidates {
+		var b strings.Builder
+		for _, r := range candidate {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-') {
+				b.WriteRune(r)
+			}
+		}
+		if username := truncate(b.String(), maxSSOUsernameLength); username != "" && !models.IsReservedUsername(username) {
+			return username
+		}
+	}
+	return "user"
+}
@@ -0,0 +1,557 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suitability scoring settings
+const (
+	// SuitabilityWindowMinScore is the lowest hourly score that can be part of a best window
+	SuitabilityWindowMinScore = 60
+	// MaxSuitabilityWindows is how many best windows are returned per activity
+	MaxSuitabilityWindows = 3
+)
+
+// Forecast cache settings for the public activity windows. Every miss costs two upstream calls.
+const (
+	ActivityForecastCacheTTL   = 10 * time.Minute
+	MaxCachedActivityForecasts = 1000
+)
+
+// Daylight requirements of an activity
+const (
+	DaylightAny   = ""
+	DaylightDay   = "day"
+	DaylightNight = "night"
+)
+
+// Factors an activity can put ranges on
+const (
+	FactorTemperature   = "temperature"
+	FactorWind          = "wind"
+	FactorPrecipitation = "precipitation"
+	FactorUV            = "uv"
+	FactorAQI           = "aqi"
+	FactorClouds        = "clouds"
+	FactorDaylight      = "daylight"
+)
+
+// factorLabels name factors in explanations
+var factorLabels = map[string]string{
+	FactorTemperature:   "temperature",
+	FactorWind:          "wind",
+	FactorPrecipitation: "chance of precipitation",
+	FactorUV:            "UV index",
+	FactorAQI:           "air quality index",
+	FactorClouds:        "cloud cover",
+}
+
+// FactorRange is the ideal and acceptable range of one weather factor. Scores fall from
+// full inside the ideal range to half at the edges of the acceptable range, and to zero
+// outside it.
+type FactorRange struct {
+	IdealMin      float64 `json:"ideal_min"`
+	IdealMax      float64 `json:"ideal_max"`
+	AcceptableMin float64 `json:"acceptable_min"`
+	AcceptableMax float64 `json:"acceptable_max"`
+}
+
+// ActivityConditions are the weather an activity needs. Factors without a range don't
+// affect its score.
+type ActivityConditions struct {
+	Temperature   *FactorRange `json:"temperature,omitempty"`   // °C
+	Wind          *FactorRange `json:"wind,omitempty"`          // m/s
+	Precipitation *FactorRange `json:"precipitation,omitempty"` // chance of precipitation, %
+	UV            *FactorRange `json:"uv,omitempty"`            // UV index
+	AQI           *FactorRange `json:"aqi,omitempty"`           // OpenWeatherMap air quality index, 1-5
+	Clouds        *FactorRange `json:"clouds,omitempty"`        // cloud cover, %
+	Daylight      string       `json:"daylight,omitempty"`      // day, night or empty for any time
+}
+
+// ActivityProfile is an activity and the conditions it needs
+type ActivityProfile struct {
+	Key        string             `json:"key"`
+	Name       string             `json:"name"`
+	Icon       string             `json:"icon"`
+	Conditions ActivityConditions `json:"conditions"`
+}
+
+// ForecastHour is the weather expected in one hour. AQI is zero when unknown.
+type ForecastHour struct {
+	Time       time.Time `json:"time"`
+	Temp       float64   `json:"temp"`
+	WindSpeed  float64   `json:"wind_speed"`
+	PrecipProb float64   `json:"precip_prob"`
+	UVI        float64   `json:"uvi"`
+	AQI        int       `json:"aqi"`
+	Clouds     float64   `json:"clouds"`
+	Daylight   bool      `json:"daylight"`
+}
+
+// DailyForecast is the forecast of one day. Date is any time during the day.
+type DailyForecast struct {
+	Date       time.Time `json:"date"`
+	Sunrise    time.Time `json:"sunrise"`
+	Sunset     time.Time `json:"sunset"`
+	TempMorn   float64   `json:"temp_morn"`
+	TempDay    float64   `json:"temp_day"`
+	TempEve    float64   `json:"temp_eve"`
+	TempNight  float64   `json:"temp_night"`
+	WindSpeed  float64   `json:"wind_speed"`
+	PrecipProb float64   `json:"precip_prob"`
+	UVI        float64   `json:"uvi"` // daily maximum
+	Clouds     float64   `json:"clouds"`
+}
+
+// HourlyForecast is the hourly forecast of a location, with the daily forecast for the days
+// after the hourly one ends
+type HourlyForecast struct {
+	TimezoneOffset int             `json:"timezone_offset"` // seconds east of UTC
+	Hours          []ForecastHour  `json:"hours"`
+	Days           []DailyForecast `json:"days,omitempty"`
+}
+
+// ExtendedHours returns the hourly forecast followed by hours derived from the daily forecast,
+// up to until. Derived hours interpolate between the morning, day, evening and night
+// temperatures and spread the daily UV maximum over daylight, so they are only approximate.
+func (f *HourlyForecast) ExtendedHours(until time.Time) []ForecastHour {
+	hours := make([]ForecastHour, 0, len(f.Hours))
+	for _, hour := range f.Hours {
+		if hour.Time.Before(until) {
+			hours = append(hours, hour)
+		}
+	}
+
+	var last time.Time
+	if len(hours) > 0 {
+		last = hours[len(hours)-1].Time
+	}
+
+	for _, day := range f.Days {
+		local := day.Date.Add(time.Duration(f.TimezoneOffset) * time.Second).UTC()
+		midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC).
+			Add(-time.Duration(f.TimezoneOffset) * time.Second)
+
+		for h := 0; h < 24; h++ {
+			at := midnight.Add(time.Duration(h) * time.Hour)
+			if !at.After(last) || !at.Before(until) {
+				continue
+			}
+			hours = append(hours, day.hour(at, h))
+		}
+	}
+
+	return hours
+}
+
+// hour derives the weather at a local hour of the day
+func (d DailyForecast) hour(at time.Time, localHour int) ForecastHour {
+	// Temperatures are anchored at 00:00 (night), 06:00 (morning), 13:00 (day), 18:00 (evening)
+	// and 24:00 (night again)
+	anchors := []struct {
+		hour float64
+		temp float64
+	}{{0, d.TempNight}, {6, d.TempMorn}, {13, d.TempDay}, {18, d.TempEve}, {24, d.TempNight}}
+	temp := d.TempDay
+	for i := 1; i < len(anchors); i++ {
+		if float64(localHour) <= anchors[i].hour {
+			prev, next := anchors[i-1], anchors[i]
+			temp = prev.temp + (next.temp-prev.temp)*(float64(localHour)-prev.hour)/(next.hour-prev.hour)
+			break
+		}
+	}
+
+	hour := ForecastHour{
+		Time:       at,
+		Temp:       math.Round(temp*10) / 10,
+		WindSpeed:  d.WindSpeed,
+		PrecipProb: d.PrecipProb,
+		Clouds:     d.Clouds,
+		Daylight:   !at.Before(d.Sunrise) && at.Before(d.Sunset),
+	}
+	if hour.Daylight {
+		progress := at.Sub(d.Sunrise).Hours() / d.Sunset.Sub(d.Sunrise).Hours()
+		hour.UVI = math.Round(d.UVI*math.Sin(math.Pi*progress)*10) / 10
+	}
+
+	return hour
+}
+
+// ActivityForecastSource fetches the hourly forecast activities are scored against
+type ActivityForecastSource interface {
+	HourlyForecast(lat, lon float64) (*HourlyForecast, error)
+}
+
+// forecastCacheEntry is a cached forecast and when it expires
+type forecastCacheEntry struct {
+	forecast  *HourlyForecast
+	expiresAt time.Time
+}
+
+// forecastCache holds recent hourly forecasts by location, rounded like the pollen cache
+type forecastCache struct {
+	mu      sync.Mutex
+	entries *lruCache[forecastCacheEntry]
+}
+
+// newForecastCache creates an empty forecast cache
+func newForecastCache() *forecastCache {
+	return &forecastCache{entries: newLRUCache[forecastCacheEntry](MaxCachedActivityForecasts)}
+}
+
+// get returns an unexpired forecast for a location. Callers must not modify it.
+func (c *forecastCache) get(lat, lon float64) (*HourlyForecast, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.entries.get(locationCacheKey(lat, lon))
+	if !exists || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.forecast, true
+}
+
+// add caches a forecast for ActivityForecastCacheTTL
+func (c *forecastCache) add(lat, lon float64, forecast *HourlyForecast) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries.set(locationCacheKey(lat, lon), forecastCacheEntry{
+		forecast:  forecast,
+		expiresAt: time.Now().Add(ActivityForecastCacheTTL),
+	})
+}
+
+// FactorLimit explains how a factor lowered a score
+type FactorLimit struct {
+	Factor      string  `json:"factor"`
+	Score       float64 `json:"score"` // 0-1 for this factor alone
+	Explanation string  `json:"explanation"`
+}
+
+// HourScore is how suitable one hour is for an activity
+type HourScore struct {
+	Time   time.Time     `json:"time"`
+	Score  int           `json:"score"` // 0-100, the score of the most limiting factor
+	Rating string        `json:"rating"`
+	Limits []FactorLimit `json:"limits,omitempty"` // most limiting first
+}
+
+// SuitabilityWindow is a run of consecutive suitable hours
+type SuitabilityWindow struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Hours       int       `json:"hours"`
+	Score       int       `json:"score"` // average hourly score
+	Rating      string    `json:"rating"`
+	Explanation string    `json:"explanation"`
+}
+
+// ActivitySuitability is an activity's best upcoming windows
+type ActivitySuitability struct {
+	Key     string              `json:"key"`
+	Name    string              `json:"name"`
+	Icon    string              `json:"icon"`
+	Current *HourScore          `json:"current,omitempty"`
+	Windows []SuitabilityWindow `json:"windows"`
+}
+
+// factorRange builds a FactorRange
+func factorRange(idealMin, idealMax, acceptableMin, acceptableMax float64) *FactorRange {
+	return &FactorRange{IdealMin: idealMin, IdealMax: idealMax, AcceptableMin: acceptableMin, AcceptableMax: acceptableMax}
+}
+
+// DefaultActivityProfiles are the built-in outdoor activities
+var DefaultActivityProfiles = []ActivityProfile{
+	{Key: "running", Name: "Running", Icon: "🏃", Conditions: ActivityConditions{
+		Temperature:   factorRange(8, 18, -5, 28),
+		Wind:          factorRange(0, 6, 0, 12),
+		Precipitation: factorRange(0, 20, 0, 60),
+		UV:            factorRange(0, 5, 0, 8),
+		AQI:           factorRange(1, 2, 1, 3),
+	}},
+	{Key: "cycling", Name: "Biking & Cycling", Icon: "🚲", Conditions: ActivityConditions{
+		Temperature:   factorRange(12, 24, 0, 32),
+		Wind:          factorRange(0, 5, 0, 10),
+		Precipitation: factorRange(0, 15, 0, 40),
+		UV:            factorRange(0, 6, 0, 9),
+		AQI:           factorRange(1, 2, 1, 3),
+		Daylight:      DaylightDay,
+	}},
+	{Key: "hiking", Name: "Hiking", Icon: "🥾", Conditions: ActivityConditions{
+		Temperature:   factorRange(10, 22, 0, 30),
+		Wind:          factorRange(0, 8, 0, 15),
+		Precipitation: factorRange(0, 20, 0, 50),
+		UV:            factorRange(0, 6, 0, 9),
+		AQI:           factorRange(1, 3, 1, 4),
+		Daylight:      DaylightDay,
+	}},
+	{Key: "picnic", Name: "Picnic", Icon: "🧺", Conditions: ActivityConditions{
+		Temperature:   factorRange(18, 27, 14, 32),
+		Wind:          factorRange(0, 4, 0, 8),
+		Precipitation: factorRange(0, 10, 0, 30),
+		UV:            factorRange(0, 6, 0, 9),
+		AQI:           factorRange(1, 2, 1, 3),
+		Daylight:      DaylightDay,
+	}},
+	{Key: "fishing", Name: "Fishing", Icon: "🎣", Conditions: ActivityConditions{
+		Temperature:   factorRange(10, 25, 0, 32),
+		Wind:          factorRange(0, 5, 0, 10),
+		Precipitation: factorRange(0, 30, 0, 60),
+	}},
+	{Key: "golf", Name: "Golf", Icon: "⛳", Conditions: ActivityConditions{
+		Temperature:   factorRange(15, 26, 8, 32),
+		Wind:          factorRange(0, 5, 0, 10),
+		Precipitation: factorRange(0, 10, 0, 30),
+		UV:            factorRange(0, 7, 0, 10),
+		Daylight:      DaylightDay,
+	}},
+	{Key: "beach", Name: "Beach & Pool", Icon: "🏖️", Conditions: ActivityConditions{
+		Temperature:   factorRange(25, 32, 21, 36),
+		Wind:          factorRange(0, 6, 0, 10),
+		Precipitation: factorRange(0, 10, 0, 30),
+		Clouds:        factorRange(0, 40, 0, 85),
+		Daylight:      DaylightDay,
+	}},
+	{Key: "stargazing", Name: "Stargazing", Icon: "🔭", Conditions: ActivityConditions{
+		Temperature:   factorRange(5, 25, -10, 32),
+		Wind:          factorRange(0, 6, 0, 12),
+		Precipitation: factorRange(0, 5, 0, 20),
+		Clouds:        factorRange(0, 10, 0, 40),
+		Daylight:      DaylightNight,
+	}},
+	{Key: "kite-flying", Name: "Kite Flying", Icon: "🪁", Conditions: ActivityConditions{
+		Temperature:   factorRange(10, 28, 0, 34),
+		Wind:          factorRange(4, 9, 2.5, 12),
+		Precipitation: factorRange(0, 10, 0, 30),
+		Daylight:      DaylightDay,
+	}},
+}
+
+// ScoreHour scores one hour of weather for an activity
+func ScoreHour(conditions ActivityConditions, hour ForecastHour) HourScore {
+	var limits []FactorLimit
+
+	check := func(factor string, r *FactorRange, value float64, unit string) {
+		if r == nil {
+			return
+		}
+		if score := r.score(value); score < 1 {
+			limits = append(limits, FactorLimit{Factor: factor, Score: score, Explanation: r.explain(factor, value, unit)})
+		}
+	}
+	check(FactorTemperature, conditions.Temperature, hour.Temp, "°C")
+	check(FactorWind, conditions.Wind, hour.WindSpeed, " m/s")
+	check(FactorPrecipitation, conditions.Precipitation, hour.PrecipProb, "%")
+	check(FactorUV, conditions.UV, hour.UVI, "")
+	if hour.AQI > 0 {
+		check(FactorAQI, conditions.AQI, float64(hour.AQI), "")
+	}
+	check(FactorClouds, conditions.Clouds, hour.Clouds, "%")
+
+	switch {
+	case conditions.Daylight == DaylightDay && !hour.Daylight:
+		limits = append(limits, FactorLimit{Factor: FactorDaylight, Explanation: "needs daylight"})
+	case conditions.Daylight == DaylightNight && hour.Daylight:
+		limits = append(limits, FactorLimit{Factor: FactorDaylight, Explanation: "needs darkness"})
+	}
+
+	sort.SliceStable(limits, func(i, j int) bool { return limits[i].Score < limits[j].Score })
+
+	score := 100
+	if len(limits) > 0 {
+		score = int(math.Round(100 * limits[0].Score))
+	}
+
+	return HourScore{Time: hour.Time, Score: score, Rating: SuitabilityRating(score), Limits: limits}
+}
+
+// SuitabilityRating names a 0-100 score
+func SuitabilityRating(score int) string {
+	switch {
+	case score >= 80:
+		return "Ideal"
+	case score >= 60:
+		return "Good"
+	case score >= 40:
+		return "Fair"
+	default:
+		return "Poor"
+	}
+}
+
+// score rates a value from 0 to 1 against the range
+func (r *FactorRange) score(value float64) float64 {
+	switch {
+	case value >= r.IdealMin && value <= r.IdealMax:
+		return 1
+	case value < r.AcceptableMin || value > r.AcceptableMax:
+		return 0
+	case value < r.IdealMin:
+		return 1 - 0.5*(r.IdealMin-value)/(r.IdealMin-r.AcceptableMin)
+	default:
+		return 1 - 0.5*(value-r.IdealMax)/(r.AcceptableMax-r.IdealMax)
+	}
+}
+
+// explain describes how a value outside the ideal range compares to it
+func (r *FactorRange) explain(factor string, value float64, unit string) string {
+	if value < r.IdealMin {
+		return fmt.Sprintf("%s %s%s is below the ideal %s%s", factorLabels[factor], formatFactor(value), unit, formatFactor(r.IdealMin), unit)
+	}
+	return fmt.Sprintf("%s %s%s is above the ideal %s%s", factorLabels[factor], formatFactor(value), unit, formatFactor(r.IdealMax), unit)
+}
+
+// formatFactor formats a factor value without needless decimals
+func formatFactor(value float64) string {
+	if value == math.Trunc(value) {
+		return fmt.Sprintf("%.0f", value)
+	}
+	return fmt.Sprintf("%.1f", value)
+}
+
+// BestWindows finds runs of at least minHours consecutive hours scoring SuitabilityWindowMinScore
+// or more, best average score first
+func BestWindows(conditions ActivityConditions, hours []ForecastHour, minHours, maxWindows int) []SuitabilityWindow {
+	if minHours < 1 {
+		minHours = 1
+	}
+
+	windows := make([]SuitabilityWindow, 0)
+	var run []HourScore
+	flush := func() {
+		if len(run) >= minHours {
+			windows = append(windows, newSuitabilityWindow(run))
+		}
+		run = nil
+	}
+
+	for i, hour := range hours {
+		// A gap in the forecast ends a window
+		if i > 0 && hour.Time.Sub(hours[i-1].Time) > time.Hour {
+			flush()
+		}
+		score := ScoreHour(conditions, hour)
+		if score.Score < SuitabilityWindowMinScore {
+			flush()
+			continue
+		}
+		run = append(run, score)
+	}
+	flush()
+
+	sort.SliceStable(windows, func(i, j int) bool {
+		if windows[i].Score != windows[j].Score {
+			return windows[i].Score > windows[j].Score
+		}
+		return windows[i].Start.Before(windows[j].Start)
+	})
+	if maxWindows > 0 && len(windows) > maxWindows {
+		windows = windows[:maxWindows]
+	}
+
+	return windows
+}
+
+// newSuitabilityWindow summarizes a run of hourly scores
+func newSuitabilityWindow(run []HourScore) SuitabilityWindow {
+	total := 0
+	limited := make(map[string]int)
+	worst := make(map[string]FactorLimit)
+	var factors []string
+	for _, hour := range run {
+		total += hour.Score
+		for _, limit := range hour.Limits {
+			if _, seen := limited[limit.Factor]; !seen {
+				factors = append(factors, limit.Factor)
+			}
+			limited[limit.Factor]++
+			if current, seen := worst[limit.Factor]; !seen || limit.Score < current.Score {
+				worst[limit.Factor] = limit
+			}
+		}
+	}
+
+	// Factors that cost the most points come first
+	sort.SliceStable(factors, func(i, j int) bool {
+		return worst[factors[i]].Score < worst[factors[j]].Score
+	})
+
+	explanation := "Ideal conditions throughout"
+	if len(factors) > 0 {
+		parts := make([]string, len(factors))
+		for i, factor := range factors {
+			if limited[factor] == len(run) {
+				parts[i] = worst[factor].Explanation + " (every hour)"
+			} else {
+				parts[i] = fmt.Sprintf("%s (%d of %d hours)", worst[factor].Explanation, limited[factor], len(run))
+			}
+		}
+		explanation = "Limited by " + strings.Join(parts, "; ")
+	}
+
+	score := int(math.Round(float64(total) / float64(len(run))))
+	return SuitabilityWindow{
+		Start:       run[0].Time,
+		End:         run[len(run)-1].Time.Add(time.Hour),
+		Hours:       len(run),
+		Score:       score,
+		Rating:      SuitabilityRating(score),
+		Explanation: explanation,
+	}
+}
+
+// EvaluateActivities scores the first forecast hour and finds the best windows of every profile
+func EvaluateActivities(profiles []ActivityProfile, hours []ForecastHour) []ActivitySuitability {
+	results := make([]ActivitySuitability, len(profiles))
+	for i, profile := range profiles {
+		results[i] = ActivitySuitability{
+			Key:     profile.Key,
+			Name:    profile.Name,
+			Icon:    profile.Icon,
+			Windows: BestWindows(profile.Conditions, hours, 1, MaxSuitabilityWindows),
+		}
+		if len(hours) > 0 {
+			current := ScoreHour(profile.Conditions, hours[0])
+			results[i].Current = &current
+		}
+	}
+	return results
+}
+
+// EstimateConditionHour builds a forecast hour from current conditions, estimating the chance
+// of precipitation and cloud cover from a weather description. UV is left for the caller.
+func EstimateConditionHour(temp, windSpeed float64, condition string, daylight bool, aqi int) ForecastHour {
+	condition = strings.ToLower(condition)
+	hour := ForecastHour{
+		Time:      time.Now().Truncate(time.Hour),
+		Temp:      temp,
+		WindSpeed: windSpeed,
+		AQI:       aqi,
+		Daylight:  daylight,
+	}
+
+	switch {
+	case strings.Contains(condition, "rain") || strings.Contains(condition, "snow") ||
+		strings.Contains(condition, "drizzle") || strings.Contains(condition, "thunder") ||
+		strings.Contains(condition, "storm"):
+		hour.PrecipProb = 100
+		hour.Clouds = 100
+	case strings.Contains(condition, "overcast") || strings.Contains(condition, "broken"):
+		hour.PrecipProb = 20
+		hour.Clouds = 90
+	case strings.Contains(condition, "cloud"):
+		hour.PrecipProb = 10
+		hour.Clouds = 40
+	case strings.Contains(condition, "mist") || strings.Contains(condition, "fog") || strings.Contains(condition, "haze"):
+		hour.PrecipProb = 10
+		hour.Clouds = 70
+	}
+
+	return hour
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// truncate shortens s to at most n characters, which is how MySQL measures VARCHAR columns.
+// It never splits a multi-byte character and drops invalid UTF-8, which strict mode rejects.
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	end := 0
+	for i := 0; i < n; i++ {
+		_, size := utf8.DecodeRuneInString(s[end:])
+		end += size
+	}
+	return s[:end]
+}
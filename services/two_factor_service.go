@@ -0,0 +1,243 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Two-factor authentication settings
+const (
+	TwoFactorIssuer       = "Go Weather"
+	RecoveryCodeCount     = 10
+	recoveryCodeBytes     = 5 // Encodes to 8 base32 characters
+	recoveryCodeGroupSize = 4
+)
+
+// Errors returned by two-factor operations
+var (
+	ErrInvalidTwoFactorCode  = errors.New("invalid authentication code")
+	ErrTwoFactorEnabled      = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled   = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolling = errors.New("start two-factor setup first")
+)
+
+// TwoFactorStatus describes a user's two-factor setup for the profile page
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	RemainingRecoveryCodes int  `json:"remaining_recovery_codes"`
+}
+
+// TwoFactorService manages TOTP secrets and one-time recovery codes. Recovery codes are only
+// stored as SHA-256 hashes and shown to the user once.
+type TwoFactorService struct {
+	db *sql.DB
+}
+
+// NewTwoFactorService creates a new instance of TwoFactorService
+func NewTwoFactorService(db *sql.DB) *TwoFactorService {
+	return &TwoFactorService{
+		db: db,
+	}
+}
+
+// Status returns whether two-factor authentication is on and how many recovery codes are left
+func (s *TwoFactorService) Status(userID int) (TwoFactorStatus, error) {
+	var status TwoFactorStatus
+	enabled, err := s.IsEnabled(userID)
+	if err != nil || !enabled {
+		return status, err
+	}
+	status.Enabled = true
+
+	err = s.db.QueryRow(
+		"SELECT COUNT(*) FROM two_factor_recovery_codes WHERE user_id = ? AND used_at IS NULL",
+		userID,
+	).Scan(&status.RemainingRecoveryCodes)
+	return status, err
+}
+
+// IsEnabled reports whether a user has confirmed two-factor authentication
+func (s *TwoFactorService) IsEnabled(userID int) (bool, error) {
+	var enabled bool
+	err := s.db.QueryRow("SELECT enabled FROM user_two_factor WHERE user_id = ?", userID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return enabled, err
+}
+
+// StartEnrollment creates a new pending secret and returns it with its provisioning URI.
+// Two-factor authentication stays off until ConfirmEnrollment gets a valid code.
+func (s *TwoFactorService) StartEnrollment(userID int) (string, string, error) {
+	enabled, err := s.IsEnabled(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", ErrTwoFactorEnabled
+	}
+
+	var username string
+	if err := s.db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+		return "", "", err
+	}
+
+	secret := GenerateTOTPSecret()
+	_, err = s.db.Exec(
+		`INSERT INTO user_two_factor (user_id, secret, enabled, last_used_step, created_at)
+		VALUES (?, ?, FALSE, 0, NOW())
+		ON DUPLICATE KEY UPDATE secret = VALUES(secret), last_used_step = 0, created_at = NOW()`,
+		userID, secret,
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, TOTPProvisioningURI(TwoFactorIssuer, username, secret), nil
+}
+
+// ConfirmEnrollment turns on two-factor authentication once the user proves their app
+// produces valid codes, and returns a fresh set of recovery codes
+func (s *TwoFactorService) ConfirmEnrollment(userID int, code string) ([]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var secret string
+	var enabled bool
+	err = tx.QueryRow("SELECT secret, enabled FROM user_two_factor WHERE user_id = ? FOR UPDATE", userID).Scan(&secret, &enabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrTwoFactorNotEnrolling
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	step, ok := MatchTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE user_two_factor SET enabled = TRUE, last_used_step = ?, enabled_at = NOW() WHERE user_id = ?",
+		step, userID,
+	); err != nil {
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+// Verify checks a TOTP code or an unused recovery code. Each TOTP code and each recovery
+// code is accepted only once.
+func (s *TwoFactorService) Verify(userID int, code string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var secret string
+	var lastStep int64
+	err = tx.QueryRow(
+		"SELECT secret, last_used_step FROM user_two_factor WHERE user_id = ? AND enabled = TRUE FOR UPDATE",
+		userID,
+	).Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+
+	if step, ok := MatchTOTP(secret, code, time.Now()); ok {
+		if step <= lastStep {
+			return ErrInvalidTwoFactorCode
+		}
+		if _, err := tx.Exec("UPDATE user_two_factor SET last_used_step = ? WHERE user_id = ?", step, userID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	result, err := tx.Exec(
+		"UPDATE two_factor_recovery_codes SET used_at = NOW() WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		userID, hashToken(normalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return tx.Commit()
+}
+
+// Disable turns off two-factor authentication after checking a current code
+func (s *TwoFactorService) Disable(userID int, code string) error {
+	if err := s.Verify(userID, code); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM two_factor_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_two_factor WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes deletes a user's recovery codes and stores a new set
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM two_factor_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code := newRecoveryCode()
+		if _, err := tx.Exec(
+			"INSERT INTO two_factor_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, NOW())",
+			userID, hashToken(normalizeRecoveryCode(code)),
+		); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// newRecoveryCode creates a random code like "ABCD-EFGH"
+func newRecoveryCode() string {
+	randomBytes := make([]byte, recoveryCodeBytes)
+	rand.Read(randomBytes)
+	code := totpEncoding.EncodeToString(randomBytes)
+	return code[:recoveryCodeGroupSize] + "-" + code[recoveryCodeGroupSize:]
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes in entered recovery codes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,370 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"weather-app/models"
+)
+
+// Per-user upload quotas and orphan collection timing
+const (
+	UploadDailyQuotaBytes   = 50 * 1024 * 1024
+	UploadTotalQuotaBytes   = 500 * 1024 * 1024
+	OrphanUploadGracePeriod = 24 * time.Hour // at least a day, so collected uploads no longer count towards the daily quota
+	UploadGCInterval        = time.Hour
+	uploadGCBatchSize       = 500
+)
+
+// Errors returned by upload operations
+var (
+	ErrDailyUploadQuota = errors.New("daily upload limit reached, please try again tomorrow")
+	ErrUploadQuota      = errors.New("upload storage limit reached")
+	ErrUploadPurpose    = errors.New("images can only be uploaded for chat, direct messages and ground reports")
+	ErrProfilePhoto     = errors.New("invalid profile photo selection")
+	ErrImageNotUploaded = errors.New("images must be uploaded through /api/upload/image")
+)
+
+// uploadKeyPrefixes maps each upload purpose to its key prefix in the blob store
+var uploadKeyPrefixes = map[string]string{
+	models.UploadPurposeChat:    "chat_images",
+	models.UploadPurposeProfile: "profile_photos",
+	models.UploadPurposeMisc:    "misc",
+}
+
+// UploadService stores uploads in the blob store and tracks them for quotas and garbage collection
+type UploadService struct {
+	db    *sql.DB
+	store BlobStore
+}
+
+// NewUploadService creates a new instance of UploadService
+func NewUploadService(db *sql.DB, store BlobStore) *UploadService {
+	return &UploadService{
+		db:    db,
+		store: store,
+	}
+}
+
+// SaveImage stores every variant of a processed image for a user after checking their quotas.
+// Only chat uploads, which also cover direct messages and ground reports, are accepted;
+// profile photos go through SaveProfilePhoto.
+func (s *UploadService) SaveImage(userID int, purpose string, processed *ProcessedImage) (models.Upload, error) {
+	if purpose == "" {
+		purpose = models.UploadPurposeChat
+	}
+	if purpose != models.UploadPurposeChat {
+		return models.Upload{}, ErrUploadPurpose
+	}
+
+	return s.save(userID, purpose, uploadKeyPrefixes[purpose], processed, false)
+}
+
+// SaveProfilePhoto stores a processed profile photo in the user's own folder. It is marked as
+// referenced right away since the caller sets it as the user's photo.
+func (s *UploadService) SaveProfilePhoto(userID int, processed *ProcessedImage) (models.Upload, error) {
+	prefix := uploadKeyPrefixes[models.UploadPurposeProfile] + "/" + strconv.Itoa(userID)
+	return s.save(userID, models.UploadPurposeProfile, prefix, processed, true)
+}
+
+// SetProfilePhoto makes photo the user's profile photo. It must be a built-in avatar or one
+// of the user's uploaded profile photos that is still stored. An uploaded photo it replaces
+// is left to CollectOrphans, since past chat messages keep showing it as their avatar.
+func (s *UploadService) SetProfilePhoto(userID int, photo string) error {
+	custom := !models.IsBuiltinProfilePhoto(photo)
+	if custom && !models.IsCustomProfilePhoto(userID, photo) {
+		return ErrProfilePhoto
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the upload so the collector can't delete it while it becomes the photo again
+	if custom {
+		var uploadID int
+		err := tx.QueryRow(
+			"SELECT id FROM uploads WHERE user_id = ? AND purpose = ? AND url = ? FOR UPDATE",
+			userID, models.UploadPurposeProfile, photo,
+		).Scan(&uploadID)
+		if err == sql.ErrNoRows {
+			return ErrProfilePhoto
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE uploads SET referenced_at = NOW() WHERE id = ?", uploadID); err != nil {
+			return err
+		}
+	}
+
+	var previous string
+	if err := tx.QueryRow("SELECT profile_photo FROM users WHERE id = ? FOR UPDATE", userID).Scan(&previous); err != nil {
+		return err
+	}
+	if previous == photo {
+		return tx.Commit()
+	}
+	if _, err := tx.Exec("UPDATE users SET profile_photo = ?, updated_at = NOW() WHERE id = ?", photo, userID); err != nil {
+		return err
+	}
+
+	// Unmark the old photo so the collector checks it again and deletes it once no chat
+	// message shows it any more
+	if models.IsCustomProfilePhoto(userID, previous) {
+		if _, err := tx.Exec(
+			"UPDATE uploads SET referenced_at = NULL WHERE user_id = ? AND purpose = ? AND url = ?",
+			userID, models.UploadPurposeProfile, previous,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseChatImage marks one of the user's chat uploads as referenced before a message, direct
+// message or ground report showing it is stored, so the collector keeps it from then on.
+// Any other URL, including another user's upload, fails with ErrImageNotUploaded.
+func (s *UploadService) UseChatImage(userID int, url string) error {
+	result, err := s.db.Exec(
+		"UPDATE uploads SET referenced_at = NOW() WHERE user_id = ? AND purpose = ? AND url = ?",
+		userID, models.UploadPurposeChat, url,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected > 0 {
+		return err
+	}
+
+	// MySQL counts changed rows, so an upload already marked within the same second reports none
+	var referenced bool
+	err = s.db.QueryRow(
+		"SELECT COUNT(*) > 0 FROM uploads WHERE user_id = ? AND purpose = ? AND url = ? AND referenced_at IS NOT NULL",
+		userID, models.UploadPurposeChat, url,
+	).Scan(&referenced)
+	if err != nil {
+		return err
+	}
+	if !referenced {
+		return ErrImageNotUploaded
+	}
+	return nil
+}
+
+// DeleteUpload deletes one of a user's uploads and its stored variants by its media URL
+func (s *UploadService) DeleteUpload(userID int, url string) error {
+	var id int
+	var keysJSON string
+	err := s.db.QueryRow(
+		"SELECT id, blob_keys FROM uploads WHERE user_id = ? AND url = ?",
+		userID, url,
+	).Scan(&id, &keysJSON)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var keys map[string]string
+	if err := json.Unmarshal([]byte(keysJSON), &keys); err != nil {
+		return err
+	}
+	if err := s.deleteBlobs(keys); err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("DELETE FROM uploads WHERE id = ?", id)
+	return err
+}
+
+// save checks the user's quotas, stores every variant under prefix and records the upload
+func (s *UploadService) save(userID int, purpose, prefix string, processed *ProcessedImage, referenced bool) (models.Upload, error) {
+	var size int64
+	for _, variant := range processed.Variants {
+		size += int64(len(variant.Data))
+	}
+
+	usage, err := s.GetUsage(userID)
+	if err != nil {
+		return models.Upload{}, err
+	}
+	if usage.DailyBytes+size > usage.DailyLimit {
+		return models.Upload{}, ErrDailyUploadQuota
+	}
+	if usage.TotalBytes+size > usage.TotalLimit {
+		return models.Upload{}, ErrUploadQuota
+	}
+
+	// Store every variant under the same random base name
+	baseName := randomUploadName()
+	contentType := "image/" + processed.Format
+	upload := models.Upload{
+		UserID:    userID,
+		Purpose:   purpose,
+		URLs:      make(map[string]string, len(processed.Variants)),
+		Keys:      make(map[string]string, len(processed.Variants)),
+		SizeBytes: size,
+		Width:     processed.Variants[0].Width,
+		Height:    processed.Variants[0].Height,
+		CreatedAt: time.Now(),
+	}
+	for _, variant := range processed.Variants {
+		key := prefix + "/" + baseName + variant.Suffix + processed.Extension
+		if err := s.store.Put(key, variant.Data, contentType); err != nil {
+			s.deleteBlobs(upload.Keys)
+			return models.Upload{}, err
+		}
+		upload.Keys[variant.Name] = key
+		upload.URLs[variant.Name] = MediaURL(key)
+	}
+	upload.URL = upload.URLs["original"]
+	if referenced {
+		upload.ReferencedAt = &upload.CreatedAt
+	}
+
+	keysJSON, err := json.Marshal(upload.Keys)
+	if err != nil {
+		s.deleteBlobs(upload.Keys)
+		return models.Upload{}, err
+	}
+
+	result, err := s.db.Exec(
+		`INSERT INTO uploads (user_id, purpose, url, blob_keys, size_bytes, referenced_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW())`,
+		userID, purpose, upload.URL, string(keysJSON), size, upload.ReferencedAt,
+	)
+	if err != nil {
+		s.deleteBlobs(upload.Keys)
+		return models.Upload{}, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return models.Upload{}, err
+	}
+	upload.ID = int(id)
+
+	return upload, nil
+}
+
+// GetUsage returns how much a user has uploaded in the last day and in total
+func (s *UploadService) GetUsage(userID int) (models.UploadUsage, error) {
+	usage := models.UploadUsage{
+		DailyLimit: UploadDailyQuotaBytes,
+		TotalLimit: UploadTotalQuotaBytes,
+	}
+
+	err := s.db.QueryRow(
+		`SELECT COALESCE(SUM(CASE WHEN created_at > NOW() - INTERVAL 1 DAY THEN size_bytes ELSE 0 END), 0),
+			COALESCE(SUM(size_bytes), 0)
+		FROM uploads
+		WHERE user_id = ?`,
+		userID,
+	).Scan(&usage.DailyBytes, &usage.TotalBytes)
+
+	return usage, err
+}
+
+// CollectOrphans records which uploads ended up in a message, direct message, ground report or
+// as someone's profile photo, including the avatars stored with past chat messages, and deletes the ones never used within OrphanUploadGracePeriod,
+// whatever their purpose. It returns how many uploads were deleted.
+func (s *UploadService) CollectOrphans() (int, error) {
+	graceSeconds := int(OrphanUploadGracePeriod.Seconds())
+
+	// Only uploads old enough to be collected need their references checked
+	_, err := s.db.Exec(
+		`UPDATE uploads u
+		SET u.referenced_at = NOW()
+		WHERE u.referenced_at IS NULL AND u.created_at < NOW() - INTERVAL ? SECOND
+			AND (EXISTS (SELECT 1 FROM chat_messages m WHERE m.image_url = u.url)
+				OR EXISTS (SELECT 1 FROM chat_messages a WHERE a.avatar_url = u.url)
+				OR EXISTS (SELECT 1 FROM dm_messages d WHERE d.image_url = u.url)
+				OR EXISTS (SELECT 1 FROM ground_reports g WHERE g.photo_url = u.url)
+				OR EXISTS (SELECT 1 FROM users p WHERE p.profile_photo = u.url))`,
+		graceSeconds,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := s.db.Query(
+		`SELECT id, blob_keys
+		FROM uploads
+		WHERE referenced_at IS NULL AND created_at < NOW() - INTERVAL ? SECOND
+		ORDER BY id
+		LIMIT ?`,
+		graceSeconds, uploadGCBatchSize,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	orphans := make(map[int]map[string]string)
+	for rows.Next() {
+		var id int
+		var keysJSON string
+		if err := rows.Scan(&id, &keysJSON); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		var keys map[string]string
+		if err := json.Unmarshal([]byte(keysJSON), &keys); err != nil {
+			log.Printf("Skipping upload %d with unreadable blob keys: %v", id, err)
+			continue
+		}
+		orphans[id] = keys
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for id, keys := range orphans {
+		// Delete the row first: an upload used since the query above is referenced now and
+		// stays, and one deleted here can no longer be used by UseChatImage
+		result, err := s.db.Exec("DELETE FROM uploads WHERE id = ? AND referenced_at IS NULL", id)
+		if err != nil {
+			return deleted, err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			continue
+		}
+		if err := s.deleteBlobs(keys); err != nil {
+			log.Printf("Error deleting blobs of upload %d, they are left in the store: %v", id, err)
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// deleteBlobs deletes the blobs of every variant, returning the first error
+func (s *UploadService) deleteBlobs(keys map[string]string) error {
+	var firstErr error
+	for _, key := range keys {
+		if err := s.store.Delete(key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// randomUploadName creates a random file name without an extension
+func randomUploadName() string {
+	randomBytes := make([]byte, 16)
+	rand.Read(randomBytes)
+	return hex.EncodeToString(randomBytes)
+}
@@ -0,0 +1,94 @@
+// Data export and account deletion on the profile page
+document.addEventListener('DOMContentLoaded', function() {
+    const deleteForm = document.getElementById('account-delete-form');
+    const passwordInput = document.getElementById('account-delete-password');
+    const deleteButton = document.getElementById('account-delete');
+    const pending = document.getElementById('account-deletion-pending');
+    const pendingDate = document.getElementById('account-deletion-date');
+    const cancelButton = document.getElementById('account-deletion-cancel');
+    const status = document.getElementById('account-status');
+
+    if (!deleteForm) return;
+
+    const reauthForm = document.getElementById('account-reauth-form');
+
+    let gracePeriodDays = 14;
+    let reauthenticated = false;
+
+    loadDeletion();
+
+    deleteButton.addEventListener('click', async function() {
+        if (!passwordInput.value && !reauthenticated) {
+            showStatus('Please enter your password to confirm', true);
+            return;
+        }
+        if (!confirm(`Delete your account? It will be deleted in ${gracePeriodDays} days unless you cancel before then.`)) return;
+
+        deleteButton.disabled = true;
+        try {
+            const response = await fetch('/api/account/deletion', {
+                method: 'POST',
+                headers: csrfHeaders({ 'Content-Type': 'application/json' }),
+                body: JSON.stringify({ password: passwordInput.value })
+            });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to delete account');
+
+            passwordInput.value = '';
+            reauthenticated = false;
+            showStatus('Account deletion scheduled. We emailed you the details.');
+            renderDeletion(data.scheduled_at);
+        } catch (error) {
+            console.error('Error scheduling account deletion:', error);
+            showStatus(error.message, true);
+        } finally {
+            deleteButton.disabled = false;
+        }
+    });
+
+    cancelButton.addEventListener('click', async function() {
+        try {
+            const response = await fetch('/api/account/deletion', { method: 'DELETE', headers: csrfHeaders() });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to cancel account deletion');
+
+            showStatus('Your account will not be deleted');
+            renderDeletion(null);
+        } catch (error) {
+            console.error('Error cancelling account deletion:', error);
+            showStatus(error.message, true);
+        }
+    });
+
+    async function loadDeletion() {
+        try {
+            const response = await fetch('/api/account/deletion');
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to check account deletion');
+
+            gracePeriodDays = data.grace_period_days;
+            reauthenticated = data.reauthenticated;
+            renderDeletion(data.scheduled_at);
+        } catch (error) {
+            console.error('Error loading account deletion:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    function renderDeletion(scheduledAt) {
+        deleteForm.style.display = scheduledAt ? 'none' : 'block';
+        pending.style.display = scheduledAt ? 'block' : 'none';
+        // After confirming with single sign-on no password is needed
+        passwordInput.style.display = reauthenticated ? 'none' : '';
+        if (reauthForm) reauthForm.style.display = reauthenticated ? 'none' : '';
+        if (scheduledAt) {
+            pendingDate.textContent = `Your account will be deleted on ${new Date(scheduledAt).toLocaleString()}.`;
+        }
+    }
+
+    function showStatus(message, isError) {
+        if (!status) return;
+        status.textContent = message;
+        status.classList.toggle('error', !!isError);
+    }
+});
@@ -0,0 +1,383 @@
+// Admin console: user management, chat moderation and service health
+document.addEventListener('DOMContentLoaded', function() {
+    const status = document.getElementById('admin-status');
+    const tabs = document.querySelectorAll('.admin-tab');
+
+    const loaders = {
+        'users': loadUsers,
+        'chat': loadRooms,
+        'outbox': loadOutbox,
+        'jobs': loadJobs,
+        'api-usage': loadAPIUsage
+    };
+
+    let usersPage = 1;
+    let usersTotal = 0;
+    let usersPageSize = 50;
+    let currentRoom = null;
+
+    tabs.forEach(tab => tab.addEventListener('click', () => showTab(tab.dataset.tab)));
+    if (tabs.length > 0) showTab(tabs[0].dataset.tab);
+
+    const searchForm = document.getElementById('user-search-form');
+    if (searchForm) {
+        searchForm.addEventListener('submit', function(event) {
+            event.preventDefault();
+            usersPage = 1;
+            loadUsers();
+        });
+        document.getElementById('users-prev').addEventListener('click', () => {
+            if (usersPage > 1) {
+                usersPage--;
+                loadUsers();
+            }
+        });
+        document.getElementById('users-next').addEventListener('click', () => {
+            if (usersPage * usersPageSize < usersTotal) {
+                usersPage++;
+                loadUsers();
+            }
+        });
+    }
+
+    const outboxStatus = document.getElementById('outbox-status');
+    if (outboxStatus) {
+        outboxStatus.addEventListener('change', loadOutbox);
+    }
+
+    function showTab(name) {
+        tabs.forEach(tab => tab.classList.toggle('active', tab.dataset.tab === name));
+        document.querySelectorAll('.admin-panel').forEach(panel => {
+            panel.classList.toggle('active', panel.id === 'panel-' + name);
+        });
+        showStatus('');
+        loaders[name]();
+    }
+
+    async function getJSON(url) {
+        const response = await fetch(url);
+        const data = await response.json();
+        if (!response.ok) throw new Error(data.error || 'Request failed');
+        return data;
+    }
+
+    async function send(method, url, body) {
+        const options = { method: method, headers: csrfHeaders({ 'Content-Type': 'application/json' }) };
+        if (body) options.body = JSON.stringify(body);
+
+        const response = await fetch(url, options);
+        const data = await response.json();
+        if (!response.ok) throw new Error(data.error || 'Request failed');
+        return data;
+    }
+
+    // Users
+
+    async function loadUsers() {
+        const query = document.getElementById('user-search').value;
+        try {
+            const data = await getJSON(`/api/admin/users?q=${encodeURIComponent(query)}&page=${usersPage}`);
+            usersTotal = data.total;
+            usersPageSize = data.page_size;
+            renderUsers(data.users);
+        } catch (error) {
+            console.error('Error loading users:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    function renderUsers(users) {
+        const body = document.getElementById('users-body');
+        body.innerHTML = '';
+
+        users.forEach(user => {
+            const row = document.createElement('tr');
+            row.appendChild(cell(user.username));
+            row.appendChild(cell(user.email + (user.email_verified ? '' : ' (unverified)')));
+            row.appendChild(cell(new Date(user.created_at).toLocaleDateString()));
+
+            const roleCell = document.createElement('td');
+            const roleSelect = document.createElement('select');
+            ['user', 'moderator', 'admin'].forEach(role => {
+                const option = document.createElement('option');
+                option.value = role;
+                option.textContent = role;
+                option.selected = role === user.role;
+                roleSelect.appendChild(option);
+            });
+            roleSelect.addEventListener('change', () => setRole(user, roleSelect));
+            roleCell.appendChild(roleSelect);
+            row.appendChild(roleCell);
+
+            const statusCell = document.createElement('td');
+            const badge = document.createElement('span');
+            badge.className = 'admin-badge' + (user.disabled ? ' disabled' : '');
+            badge.textContent = user.disabled ? 'Disabled' : 'Active';
+            statusCell.appendChild(badge);
+
+            const toggle = document.createElement('button');
+            toggle.type = 'button';
+            toggle.className = 'session-revoke';
+            toggle.textContent = user.disabled ? 'Enable' : 'Disable';
+            toggle.addEventListener('click', () => setDisabled(user, !user.disabled));
+            statusCell.appendChild(document.createTextNode(' '));
+            statusCell.appendChild(toggle);
+            row.appendChild(statusCell);
+
+            body.appendChild(row);
+        });
+
+        const pages = Math.max(1, Math.ceil(usersTotal / usersPageSize));
+        document.getElementById('users-page').textContent = `Page ${usersPage} of ${pages} · ${usersTotal} user${usersTotal === 1 ? '' : 's'}`;
+    }
+
+    async function setRole(user, select) {
+        try {
+            await send('PUT', `/api/admin/users/${user.id}/role`, { role: select.value });
+            user.role = select.value;
+            showStatus(`${user.username} is now ${user.role}`);
+        } catch (error) {
+            console.error('Error changing role:', error);
+            select.value = user.role;
+            showStatus(error.message, true);
+        }
+    }
+
+    async function setDisabled(user, disabled) {
+        if (disabled && !confirm(`Disable ${user.username}? They will be signed out everywhere and their API tokens deleted.`)) return;
+
+        try {
+            await send('POST', `/api/admin/users/${user.id}/${disabled ? 'disable' : 'enable'}`);
+            showStatus(`${user.username} ${disabled ? 'disabled' : 'enabled'}`);
+            loadUsers();
+        } catch (error) {
+            console.error('Error updating account:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    // Chat moderation
+
+    async function loadRooms() {
+        try {
+            const data = await getJSON('/api/admin/chat/rooms');
+            renderRooms(data.rooms);
+            if (currentRoom) loadRoomMessages(currentRoom);
+        } catch (error) {
+            console.error('Error loading chat rooms:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    function renderRooms(rooms) {
+        const list = document.getElementById('rooms-list');
+        list.innerHTML = '';
+
+        if (rooms.length === 0) {
+            const empty = document.createElement('li');
+            empty.className = 'session-meta';
+            empty.textContent = 'No chat rooms yet';
+            list.appendChild(empty);
+            return;
+        }
+
+        rooms.forEach(room => {
+            const item = document.createElement('li');
+            item.className = 'session-item' + (room.place_id === currentRoom ? ' active' : '');
+
+            const info = document.createElement('div');
+            const name = document.createElement('div');
+            name.className = 'session-device';
+            name.textContent = room.name;
+            info.appendChild(name);
+
+            const meta = document.createElement('div');
+            meta.className = 'session-meta';
+            meta.textContent = `${room.messages_24h} today · ${room.total_messages} total · last ${new Date(room.last_message_at).toLocaleString()}`;
+            info.appendChild(meta);
+
+            item.appendChild(info);
+            item.addEventListener('click', () => {
+                currentRoom = room.place_id;
+                list.querySelectorAll('.session-item').forEach(el => el.classList.remove('active'));
+                item.classList.add('active');
+                loadRoomMessages(room.place_id);
+            });
+            list.appendChild(item);
+        });
+    }
+
+    async function loadRoomMessages(placeID) {
+        try {
+            const data = await getJSON(`/api/admin/chat/messages?place_id=${encodeURIComponent(placeID)}`);
+            renderRoomMessages(data.messages);
+        } catch (error) {
+            console.error('Error loading messages:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    function renderRoomMessages(messages) {
+        const list = document.getElementById('room-messages');
+        list.innerHTML = '';
+
+        messages.forEach(msg => {
+            const item = document.createElement('li');
+            item.className = 'session-item' + (msg.deleted ? ' deleted' : '');
+
+            const info = document.createElement('div');
+            const meta = document.createElement('div');
+            meta.className = 'session-meta';
+            meta.textContent = `${msg.username} · ${new Date(msg.created_at).toLocaleString()}${msg.edited_at ? ' · edited' : ''}`;
+            info.appendChild(meta);
+
+            const text = document.createElement('div');
+            text.className = 'message-text';
+            text.textContent = msg.deleted ? 'Message removed' : (msg.message || (msg.image_url ? '[image]' : ''));
+            info.appendChild(text);
+            item.appendChild(info);
+
+            if (!msg.deleted) {
+                const remove = document.createElement('button');
+                remove.type = 'button';
+                remove.className = 'session-revoke';
+                remove.textContent = 'Remove';
+                remove.addEventListener('click', () => removeMessage(msg));
+                item.appendChild(remove);
+            }
+
+            list.appendChild(item);
+        });
+    }
+
+    async function removeMessage(msg) {
+        if (!confirm(`Remove this message from ${msg.username}?`)) return;
+
+        try {
+            await send('DELETE', `/api/admin/chat/messages/${msg.id}`);
+            showStatus('Message removed');
+            loadRoomMessages(currentRoom);
+        } catch (error) {
+            console.error('Error removing message:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    // Email outbox
+
+    async function loadOutbox() {
+        const filter = document.getElementById('outbox-status').value;
+        try {
+            const data = await getJSON(`/api/admin/outbox?status=${encodeURIComponent(filter)}`);
+            const counts = data.last_24h;
+            document.getElementById('outbox-counts').textContent = `Last 24 hours: ${counts.sent || 0} sent, ${counts.failed || 0} failed`;
+            renderOutbox(data.entries);
+        } catch (error) {
+            console.error('Error loading outbox:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    function renderOutbox(entries) {
+        const body = document.getElementById('outbox-body');
+        body.innerHTML = '';
+
+        entries.forEach(entry => {
+            const row = document.createElement('tr');
+            row.appendChild(cell(new Date(entry.created_at).toLocaleString()));
+            row.appendChild(cell(entry.recipient));
+            row.appendChild(cell(entry.subject));
+
+            const statusCell = document.createElement('td');
+            const badge = document.createElement('span');
+            badge.className = 'admin-badge ' + entry.status;
+            badge.textContent = entry.status;
+            statusCell.appendChild(badge);
+            if (entry.error) {
+                const error = document.createElement('div');
+                error.className = 'session-meta';
+                error.textContent = entry.error;
+                statusCell.appendChild(error);
+            }
+            row.appendChild(statusCell);
+
+            body.appendChild(row);
+        });
+    }
+
+    // Background jobs
+
+    async function loadJobs() {
+        try {
+            const data = await getJSON('/api/admin/jobs');
+            const body = document.getElementById('jobs-body');
+            body.innerHTML = '';
+
+            data.jobs.forEach(job => {
+                const row = document.createElement('tr');
+
+                const nameCell = cell(job.name + ' ');
+                if (job.running) {
+                    const badge = document.createElement('span');
+                    badge.className = 'admin-badge running';
+                    badge.textContent = 'running';
+                    nameCell.appendChild(badge);
+                }
+                row.appendChild(nameCell);
+
+                row.appendChild(cell(job.runs));
+                row.appendChild(cell(job.failures));
+                row.appendChild(cell(formatTime(job.last_finished_at)));
+                row.appendChild(cell(job.runs > 0 ? `${job.last_duration_ms} ms` : '—'));
+                row.appendChild(cell(formatTime(job.next_run_at)));
+                row.appendChild(cell(job.last_error ? `${job.last_error} (${formatTime(job.last_error_at)})` : '—'));
+                body.appendChild(row);
+            });
+        } catch (error) {
+            console.error('Error loading jobs:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    // Upstream API usage
+
+    async function loadAPIUsage() {
+        try {
+            const data = await getJSON('/api/admin/api-usage');
+            document.getElementById('api-usage-since').textContent = `Outgoing requests since the server started at ${new Date(data.since).toLocaleString()}`;
+
+            const body = document.getElementById('api-usage-body');
+            body.innerHTML = '';
+
+            data.usage.forEach(usage => {
+                const row = document.createElement('tr');
+                row.appendChild(cell(usage.host + usage.path));
+                row.appendChild(cell(usage.requests));
+                row.appendChild(cell(usage.requests_today));
+                row.appendChild(cell(usage.errors));
+                row.appendChild(cell(`${usage.avg_latency_ms} ms`));
+                row.appendChild(cell(usage.last_status || 'error'));
+                row.appendChild(cell(formatTime(usage.last_request_at)));
+                body.appendChild(row);
+            });
+        } catch (error) {
+            console.error('Error loading API usage:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    function cell(value) {
+        const td = document.createElement('td');
+        td.textContent = value;
+        return td;
+    }
+
+    function formatTime(value) {
+        return value ? new Date(value).toLocaleString() : '—';
+    }
+
+    function showStatus(message, isError) {
+        status.textContent = message;
+        status.classList.toggle('error', !!isError);
+    }
+});
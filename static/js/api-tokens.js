@@ -0,0 +1,141 @@
+// Personal access tokens on the profile page
+document.addEventListener('DOMContentLoaded', function() {
+    const list = document.getElementById('api-tokens-list');
+    const nameInput = document.getElementById('api-token-name');
+    const scopesContainer = document.getElementById('api-token-scopes');
+    const expirySelect = document.getElementById('api-token-expiry');
+    const createButton = document.getElementById('api-token-create');
+    const created = document.getElementById('api-token-created');
+    const secret = document.getElementById('api-token-secret');
+    const status = document.getElementById('api-tokens-status');
+
+    const scopeLabels = {
+        'read:weather': 'Read weather and saved cities',
+        'write:cities': 'Change saved cities',
+        'chat': 'Chat and direct messages'
+    };
+
+    if (!list) return;
+
+    loadTokens();
+
+    createButton.addEventListener('click', async function() {
+        const scopes = Array.from(scopesContainer.querySelectorAll('input:checked')).map(input => input.value);
+
+        try {
+            const response = await fetch('/api/tokens', {
+                method: 'POST',
+                headers: csrfHeaders({
+                    'Content-Type': 'application/json'
+                }),
+                body: JSON.stringify({
+                    name: nameInput.value.trim(),
+                    scopes: scopes,
+                    expires_in_days: parseInt(expirySelect.value, 10)
+                })
+            });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to create token');
+
+            secret.textContent = data.token.token;
+            created.style.display = 'block';
+            nameInput.value = '';
+            showStatus('');
+            loadTokens();
+        } catch (error) {
+            console.error('Error creating API token:', error);
+            showStatus(error.message, true);
+        }
+    });
+
+    async function loadTokens() {
+        try {
+            const response = await fetch('/api/tokens');
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to load API tokens');
+
+            if (!scopesContainer.children.length) {
+                renderScopes(data.scopes);
+            }
+            renderTokens(data.tokens);
+        } catch (error) {
+            console.error('Error loading API tokens:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    function renderScopes(scopes) {
+        scopes.forEach(scope => {
+            const label = document.createElement('label');
+            const input = document.createElement('input');
+            input.type = 'checkbox';
+            input.value = scope;
+            label.appendChild(input);
+            label.appendChild(document.createTextNode(scopeLabels[scope] || scope));
+            scopesContainer.appendChild(label);
+        });
+    }
+
+    function renderTokens(tokens) {
+        list.innerHTML = '';
+
+        if (!tokens.length) {
+            const empty = document.createElement('li');
+            empty.className = 'help-text';
+            empty.textContent = 'No API tokens yet';
+            list.appendChild(empty);
+            return;
+        }
+
+        tokens.forEach(token => {
+            const item = document.createElement('li');
+            item.className = 'session-item';
+
+            const info = document.createElement('div');
+
+            const name = document.createElement('div');
+            name.className = 'session-device';
+            name.textContent = `${token.name} (${token.prefix}…)`;
+            info.appendChild(name);
+
+            const lastUsed = token.last_used_at ? `last used ${new Date(token.last_used_at).toLocaleString()}` : 'never used';
+            const meta = document.createElement('div');
+            meta.className = 'session-meta';
+            meta.textContent = `${token.scopes.join(', ')} · ${lastUsed} · expires ${new Date(token.expires_at).toLocaleDateString()}`;
+            info.appendChild(meta);
+
+            item.appendChild(info);
+
+            const revoke = document.createElement('button');
+            revoke.type = 'button';
+            revoke.className = 'session-revoke';
+            revoke.textContent = 'Revoke';
+            revoke.addEventListener('click', () => revokeToken(token));
+            item.appendChild(revoke);
+
+            list.appendChild(item);
+        });
+    }
+
+    async function revokeToken(token) {
+        if (!confirm(`Revoke the token "${token.name}"? Scripts using it will stop working.`)) return;
+
+        try {
+            const response = await fetch(`/api/tokens/${token.id}`, { method: 'DELETE', headers: csrfHeaders() });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to revoke token');
+
+            showStatus('Token revoked');
+            loadTokens();
+        } catch (error) {
+            console.error('Error revoking API token:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    function showStatus(message, isError) {
+        if (!status) return;
+        status.textContent = message;
+        status.classList.toggle('error', !!isError);
+    }
+});
@@ -11,6 +11,8 @@ document.addEventListener('DOMContentLoaded', function() {
     const previewImg = document.getElementById('preview-img');
     const removeImageBtn = document.getElementById('remove-image');
     const activeUsersCount = document.getElementById('active-users-count');
+    const onlineUsersList = document.getElementById('online-users-list');
+    const typingIndicator = document.getElementById('typing-indicator');
     const weatherSummary = document.getElementById('weather-summary-content');
     const recentPhotosContainer = document.getElementById('recent-photos-container');
     const createPollBtn = document.getElementById('create-poll');
@@ -27,8 +29,18 @@ document.addEventListener('DOMContentLoaded', function() {
     const pollTemplate = document.getElementById('poll-template');
     const pollOptionTemplate = document.getElementById('poll-option-template');
 
+    // Reactions offered in the quick picker
+    const quickReactions = ['👍', '❤️', '😂', '😮', '🌧️', '☀️'];
+
+    // Authors can edit for 15 minutes after posting (enforced by the server)
+    const editWindowMs = 15 * 60 * 1000;
+
+    // Typing notifications are re-sent at most this often while the user keeps typing
+    const typingThrottleMs = 3000;
+
     // Variables
     let selectedImage = null;
+    let lastTypingSent = 0;
     let chatRefreshInterval;
     let weatherRefreshInterval;
     // Make sure polls is defined globally
@@ -105,6 +117,9 @@ document.addEventListener('DOMContentLoaded', function() {
         // Send message form
         messageForm.addEventListener('submit', sendMessage);
 
+        // Let others know while the user is typing
+        messageText.addEventListener('input', notifyTyping);
+
         // Image upload
         attachImageBtn.addEventListener('click', () => {
             imageUpload.click();
@@ -278,10 +293,77 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     }
 
+    // Replace the text of a message with text and @mention spans; returns true if the current user is mentioned
+    function renderMentions(textEl, text) {
+        const mentionPattern = /(^|[^\w@])@([\w.-]{1,100})/g;
+        let mentionsMe = false;
+        let lastIndex = 0;
+        let match;
+
+        textEl.textContent = '';
+        while ((match = mentionPattern.exec(text)) !== null) {
+            const name = match[2].replace(/[.-]+$/, '');
+            const start = match.index + match[1].length;
+
+            textEl.appendChild(document.createTextNode(text.slice(lastIndex, start)));
+
+            const mention = document.createElement('span');
+            mention.className = 'mention';
+            mention.textContent = '@' + name;
+            if (name.toLowerCase() === username.toLowerCase()) {
+                mention.classList.add('mention-me');
+                mentionsMe = true;
+            }
+            textEl.appendChild(mention);
+
+            lastIndex = start + 1 + name.length;
+            mentionPattern.lastIndex = lastIndex;
+        }
+        textEl.appendChild(document.createTextNode(text.slice(lastIndex)));
+
+        return mentionsMe;
+    }
+
+    // Mark the user's mentions in this room as read, at most once per refresh
+    let mentionReadPending = false;
+    function markMentionsRead() {
+        if (mentionReadPending) return;
+        mentionReadPending = true;
+
+        setTimeout(async () => {
+            try {
+                await fetch('/api/chat/mentions/read', {
+                    method: 'POST',
+                    headers: csrfHeaders({
+                        'Content-Type': 'application/json'
+                    }),
+                    body: JSON.stringify({ place_id: placeID })
+                });
+            } catch (error) {
+                console.error('Error marking mentions as read:', error);
+            } finally {
+                mentionReadPending = false;
+            }
+        }, 1000);
+    }
+
+    // Scroll to the message linked from a mention, once it has loaded
+    let linkedMessageShown = false;
+    function showLinkedMessage() {
+        if (linkedMessageShown || !location.hash.startsWith('#message-')) return;
+
+        const target = document.getElementById(location.hash.slice(1));
+        if (!target) return;
+
+        linkedMessageShown = true;
+        target.classList.add('linked-message');
+        setTimeout(() => target.scrollIntoView({ block: 'center' }), 100);
+    }
+
     // Load chat room data
     async function loadChatRoom() {
         try {
-            const response = await fetch(`/api/chat/room?city=${encodeURIComponent(cityName)}`);
+            const response = await fetch(`/api/chat/room?place_id=${encodeURIComponent(placeID)}`);
             if (!response.ok) throw new Error('Failed to load chat room');
 
             const data = await response.json();
@@ -289,6 +371,9 @@ document.addEventListener('DOMContentLoaded', function() {
             // Update active users count
             activeUsersCount.textContent = data.active_users;
 
+            // Update who is online and typing
+            updatePresence(data.online_users || []);
+
             // Check for poll messages
             const pollMessages = data.messages.filter(msg =>
                 msg.message && msg.message.startsWith('Poll:') && msg.poll_data
@@ -300,6 +385,7 @@ document.addEventListener('DOMContentLoaded', function() {
 
             // Update messages
             updateChatMessages(data.messages);
+            showLinkedMessage();
 
             // Update recent photos
             updateRecentPhotos(data.messages);
@@ -311,6 +397,55 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     }
 
+    // Show the online users and who is typing
+    function updatePresence(onlineUsers) {
+        onlineUsersList.innerHTML = '';
+        onlineUsers.forEach(user => {
+            const item = document.createElement('li');
+            item.textContent = user.username;
+            if (user.user_id === parseInt(userID)) {
+                item.classList.add('self');
+            }
+            onlineUsersList.appendChild(item);
+        });
+
+        const typing = onlineUsers
+            .filter(user => user.typing && user.user_id !== parseInt(userID))
+            .map(user => user.username);
+
+        if (typing.length === 0) {
+            typingIndicator.textContent = '';
+        } else if (typing.length === 1) {
+            typingIndicator.textContent = `${typing[0]} is typing...`;
+        } else if (typing.length === 2) {
+            typingIndicator.textContent = `${typing[0]} and ${typing[1]} are typing...`;
+        } else {
+            typingIndicator.textContent = 'Several people are typing...';
+        }
+    }
+
+    // Tell the server the user is typing, throttled
+    async function notifyTyping() {
+        const now = Date.now();
+        if (!messageText.value.trim() || now - lastTypingSent < typingThrottleMs) return;
+        lastTypingSent = now;
+
+        try {
+            await fetch('/api/chat/typing', {
+                method: 'POST',
+                headers: csrfHeaders({
+                    'Content-Type': 'application/json'
+                }),
+                body: JSON.stringify({
+                    place_id: placeID,
+                    typing: true
+                })
+            });
+        } catch (error) {
+            console.error('Error updating typing status:', error);
+        }
+    }
+
     // Load weather data with structure matching the weather.html template
     async function loadWeatherData() {
         // Show temporary loading state
@@ -541,11 +676,11 @@ document.addEventListener('DOMContentLoaded', function() {
         try {
             await fetch('/api/chat/activity', {
                 method: 'POST',
-                headers: {
+                headers: csrfHeaders({
                     'Content-Type': 'application/json'
-                },
+                }),
                 body: JSON.stringify({
-                    city_name: cityName
+                    place_id: placeID
                 })
             });
         } catch (error) {
@@ -562,7 +697,7 @@ document.addEventListener('DOMContentLoaded', function() {
 
         // Prepare message data
         const messageData = {
-            city_name: cityName,
+            place_id: placeID,
             message: message
         };
 
@@ -573,7 +708,7 @@ document.addEventListener('DOMContentLoaded', function() {
                 messageData.image_url = imageUrl;
             } catch (error) {
                 console.error('Error uploading image:', error);
-                alert('Failed to upload image. Please try again.');
+                alert(error.message || 'Failed to upload image. Please try again.');
                 return;
             }
         }
@@ -582,9 +717,9 @@ document.addEventListener('DOMContentLoaded', function() {
         try {
             const response = await fetch('/api/chat/message', {
                 method: 'POST',
-                headers: {
+                headers: csrfHeaders({
                     'Content-Type': 'application/json'
-                },
+                }),
                 body: JSON.stringify(messageData)
             });
 
@@ -606,7 +741,7 @@ document.addEventListener('DOMContentLoaded', function() {
     async function sendPollMessage(pollData) {
         // Create message data
         const messageData = {
-            city_name: cityName,
+            place_id: placeID,
             message: 'Poll: ' + pollData.question,
             poll_data: JSON.stringify(pollData)
         };
@@ -616,9 +751,9 @@ document.addEventListener('DOMContentLoaded', function() {
         try {
             const response = await fetch('/api/chat/message', {
                 method: 'POST',
-                headers: {
+                headers: csrfHeaders({
                     'Content-Type': 'application/json'
-                },
+                }),
                 body: JSON.stringify(messageData)
             });
 
@@ -669,11 +804,11 @@ document.addEventListener('DOMContentLoaded', function() {
         try {
             const response = await fetch('/api/chat/message', {
                 method: 'POST',
-                headers: {
+                headers: csrfHeaders({
                     'Content-Type': 'application/json'
-                },
+                }),
                 body: JSON.stringify({
-                    city_name: cityName,
+                    place_id: placeID,
                     message: `Voted on poll: ${pollData.question}`,
                     poll_vote: JSON.stringify({
                         pollId: pollId,
@@ -819,26 +954,25 @@ document.addEventListener('DOMContentLoaded', function() {
 
         const response = await fetch('/api/upload/image', {
             method: 'POST',
+            headers: csrfHeaders(),
             body: formData
         });
 
-        if (!response.ok) throw new Error('Failed to upload image');
-
         const data = await response.json();
+        if (!response.ok) throw new Error(data.error || 'Failed to upload image');
+
         return data.url;
     }
 
     // Update chat messages
     function updateChatMessages(messages) {
-        // Get current message IDs to avoid duplicates
-        const currentMessageIds = Array.from(chatMessages.querySelectorAll('.message'))
-            .map(el => parseInt(el.dataset.id));
-
-        // Add new messages
         messages.forEach(msg => {
-            if (!currentMessageIds.includes(msg.id)) {
-                const messageEl = createMessageElement(msg);
-                chatMessages.appendChild(messageEl);
+            const existing = chatMessages.querySelector(`.message[data-id="${msg.id}"]`);
+            if (!existing) {
+                chatMessages.appendChild(createMessageElement(msg));
+            } else if (existing.dataset.version !== messageVersion(msg)) {
+                // Re-render messages that were edited, deleted or reacted to
+                existing.replaceWith(createMessageElement(msg));
             }
         });
 
@@ -848,6 +982,187 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     }
 
+    // Build a key that changes whenever a message needs to be re-rendered
+    function messageVersion(msg) {
+        return [msg.edited_at || '', msg.deleted ? 1 : 0, JSON.stringify(msg.reactions || [])].join('|');
+    }
+
+    // Render a weather bot card inside a message
+    function renderCard(messageEl, card) {
+        const cardEl = messageEl.querySelector('.message-card');
+        if (!cardEl) return;
+
+        // The card replaces the plain-text summary
+        messageEl.querySelector('.message-text').style.display = 'none';
+        cardEl.className = `message-card card-${card.type}`;
+        cardEl.style.display = 'block';
+
+        const header = document.createElement('div');
+        header.className = 'card-title';
+        if (card.icon) {
+            const icon = document.createElement('img');
+            icon.src = `https://openweathermap.org/img/wn/${card.icon}.png`;
+            icon.alt = '';
+            header.appendChild(icon);
+        }
+        const title = document.createElement('span');
+        title.textContent = card.title;
+        header.appendChild(title);
+        cardEl.appendChild(header);
+
+        if (card.fields && card.fields.length > 0) {
+            const fields = document.createElement('dl');
+            fields.className = 'card-fields';
+            card.fields.forEach(field => {
+                const label = document.createElement('dt');
+                label.textContent = field.label;
+                const value = document.createElement('dd');
+                value.textContent = field.value;
+                fields.appendChild(label);
+                fields.appendChild(value);
+            });
+            cardEl.appendChild(fields);
+        }
+
+        if (card.footer) {
+            const footer = document.createElement('div');
+            footer.className = 'card-footer';
+            footer.textContent = card.footer;
+            cardEl.appendChild(footer);
+        }
+    }
+
+    // Render reaction chips for a message
+    function renderReactions(messageEl, msg) {
+        const reactionsEl = messageEl.querySelector('.message-reactions');
+        if (!reactionsEl) return;
+
+        reactionsEl.innerHTML = '';
+        (msg.reactions || []).forEach(reaction => {
+            const chip = document.createElement('button');
+            chip.type = 'button';
+            chip.className = 'reaction-chip';
+            chip.textContent = `${reaction.emoji} ${reaction.count}`;
+
+            const reacted = (reaction.user_ids || []).includes(parseInt(userID));
+            if (reacted) {
+                chip.classList.add('reacted');
+            }
+
+            chip.addEventListener('click', () => toggleReaction(msg.id, reaction.emoji, reacted));
+            reactionsEl.appendChild(chip);
+        });
+    }
+
+    // Show the quick reaction picker below a message
+    function showReactionPicker(messageEl, msg) {
+        const existingPicker = messageEl.querySelector('.reaction-picker');
+        if (existingPicker) {
+            existingPicker.remove();
+            return;
+        }
+
+        const picker = document.createElement('div');
+        picker.className = 'reaction-picker';
+        quickReactions.forEach(emoji => {
+            const btn = document.createElement('button');
+            btn.type = 'button';
+            btn.textContent = emoji;
+            btn.addEventListener('click', () => {
+                picker.remove();
+                toggleReaction(msg.id, emoji, false);
+            });
+            picker.appendChild(btn);
+        });
+
+        messageEl.querySelector('.message-content').appendChild(picker);
+    }
+
+    // Add or remove the current user's reaction
+    async function toggleReaction(messageId, emoji, remove) {
+        try {
+            const response = await fetch(`/api/chat/message/${messageId}/reactions`, {
+                method: remove ? 'DELETE' : 'POST',
+                headers: csrfHeaders({
+                    'Content-Type': 'application/json'
+                }),
+                body: JSON.stringify({ emoji: emoji })
+            });
+
+            if (!response.ok) throw new Error('Failed to update reaction');
+
+            loadChatRoom();
+        } catch (error) {
+            console.error('Error updating reaction:', error);
+        }
+    }
+
+    // Open a private conversation with the author of a message
+    async function startDirectMessage(otherUserID) {
+        try {
+            const response = await fetch('/api/dm/conversations', {
+                method: 'POST',
+                headers: csrfHeaders({
+                    'Content-Type': 'application/json'
+                }),
+                body: JSON.stringify({ user_id: otherUserID })
+            });
+
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to start conversation');
+
+            window.location.href = `/messages?conversation=${data.id}`;
+        } catch (error) {
+            console.error('Error starting conversation:', error);
+            alert(error.message);
+        }
+    }
+
+    // Edit one of the current user's messages
+    async function editMessage(msg) {
+        const text = prompt('Edit your message:', msg.message);
+        if (text === null || text.trim() === '' || text.trim() === msg.message) return;
+
+        try {
+            const response = await fetch(`/api/chat/message/${msg.id}`, {
+                method: 'PUT',
+                headers: csrfHeaders({
+                    'Content-Type': 'application/json'
+                }),
+                body: JSON.stringify({ message: text.trim() })
+            });
+
+            if (!response.ok) {
+                const data = await response.json();
+                throw new Error(data.error || 'Failed to edit message');
+            }
+
+            loadChatRoom();
+        } catch (error) {
+            console.error('Error editing message:', error);
+            alert(error.message);
+        }
+    }
+
+    // Delete one of the current user's messages
+    async function deleteMessage(msg) {
+        if (!confirm('Delete this message?')) return;
+
+        try {
+            const response = await fetch(`/api/chat/message/${msg.id}`, {
+                method: 'DELETE',
+                headers: csrfHeaders()
+            });
+
+            if (!response.ok) throw new Error('Failed to delete message');
+
+            loadChatRoom();
+        } catch (error) {
+            console.error('Error deleting message:', error);
+            alert('Failed to delete message. Please try again.');
+        }
+    }
+
     // Create message element - improved version
     function createMessageElement(msg) {
         // Make sure the message template exists
@@ -857,7 +1172,9 @@ document.addEventListener('DOMContentLoaded', function() {
         }
 
         const messageEl = document.importNode(messageTemplate.content, true).firstElementChild;
+        messageEl.id = `message-${msg.id}`;
         messageEl.dataset.id = msg.id;
+        messageEl.dataset.version = messageVersion(msg);
 
         // Set user avatar
         const avatarImg = messageEl.querySelector('.message-avatar img');
@@ -869,6 +1186,53 @@ document.addEventListener('DOMContentLoaded', function() {
         messageEl.querySelector('.message-time').textContent = formatTime(new Date(msg.created_at));
         messageEl.querySelector('.message-text').textContent = msg.message;
 
+        const isOwnMessage = msg.user_id === parseInt(userID);
+
+        // Deleted messages keep their place in the timeline without content
+        if (msg.deleted) {
+            messageEl.classList.add('deleted-message');
+            messageEl.querySelector('.message-text').textContent = 'This message was deleted';
+            messageEl.querySelector('.message-actions').remove();
+            if (isOwnMessage) {
+                messageEl.classList.add('own-message');
+            }
+            return messageEl;
+        }
+
+        if (msg.edited_at) {
+            messageEl.querySelector('.message-edited').style.display = 'inline';
+        }
+
+        // Highlight @mentions, especially of the current user
+        if (renderMentions(messageEl.querySelector('.message-text'), msg.message) && !isOwnMessage) {
+            messageEl.classList.add('mentions-me');
+            markMentionsRead();
+        }
+
+        // Weather bot replies carry a structured card
+        if (msg.card) {
+            renderCard(messageEl, msg.card);
+        }
+
+        renderReactions(messageEl, msg);
+
+        messageEl.querySelector('.btn-react').addEventListener('click', () => showReactionPicker(messageEl, msg));
+        if (isOwnMessage) {
+            const deleteBtn = messageEl.querySelector('.btn-delete');
+            deleteBtn.style.display = 'inline';
+            deleteBtn.addEventListener('click', () => deleteMessage(msg));
+
+            if (Date.now() - new Date(msg.created_at).getTime() < editWindowMs) {
+                const editBtn = messageEl.querySelector('.btn-edit');
+                editBtn.style.display = 'inline';
+                editBtn.addEventListener('click', () => editMessage(msg));
+            }
+        } else if (!msg.card) {
+            const dmBtn = messageEl.querySelector('.btn-direct-message');
+            dmBtn.style.display = 'inline';
+            dmBtn.addEventListener('click', () => startDirectMessage(msg.user_id));
+        }
+
         // Handle image if present
         if (msg.image_url) {
             const imageContainer = messageEl.querySelector('.message-image');
@@ -1027,7 +1391,7 @@ document.addEventListener('DOMContentLoaded', function() {
         }
 
         // Mark own messages
-        if (msg.user_id === parseInt(userID)) {
+        if (isOwnMessage) {
             messageEl.classList.add('own-message');
         }
 
@@ -0,0 +1,11 @@
+// CSRF token for state-changing requests. The server sets it in a readable cookie and
+// expects it back in the X-CSRF-Token header on POST, PUT and DELETE requests.
+function csrfToken() {
+    const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+    return match ? decodeURIComponent(match[1]) : '';
+}
+
+// csrfHeaders adds the CSRF header to a request's headers
+function csrfHeaders(headers) {
+    return Object.assign({ 'X-CSRF-Token': csrfToken() }, headers || {});
+}
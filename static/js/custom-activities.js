@@ -0,0 +1,270 @@
+// User-defined activities and their good weather windows on the profile page
+document.addEventListener('DOMContentLoaded', function() {
+    const list = document.getElementById('custom-activities-list');
+    const nameInput = document.getElementById('custom-activity-name');
+    const cityInput = document.getElementById('custom-activity-city');
+    const minHoursInput = document.getElementById('custom-activity-min-hours');
+    const daysContainer = document.getElementById('custom-activity-days');
+    const startHourInput = document.getElementById('custom-activity-start-hour');
+    const endHourInput = document.getElementById('custom-activity-end-hour');
+    const tempMinInput = document.getElementById('custom-activity-temp-min');
+    const tempMaxInput = document.getElementById('custom-activity-temp-max');
+    const windInput = document.getElementById('custom-activity-wind');
+    const precipitationInput = document.getElementById('custom-activity-precipitation');
+    const uvInput = document.getElementById('custom-activity-uv');
+    const cloudsInput = document.getElementById('custom-activity-clouds');
+    const daylightSelect = document.getElementById('custom-activity-daylight');
+    const notifyInput = document.getElementById('custom-activity-notify');
+    const createButton = document.getElementById('custom-activity-create');
+    const status = document.getElementById('custom-activities-status');
+
+    const dayNames = ['Sun', 'Mon', 'Tue', 'Wed', 'Thu', 'Fri', 'Sat'];
+
+    if (!list) return;
+
+    renderDays();
+    loadActivities();
+
+    createButton.addEventListener('click', async function() {
+        const name = nameInput.value.trim();
+        const city = cityInput.value.trim();
+        if (!name || !city) {
+            showStatus('Please enter an activity name and a city', true);
+            return;
+        }
+
+        createButton.disabled = true;
+        try {
+            const response = await fetch('/api/custom-activities', {
+                method: 'POST',
+                headers: csrfHeaders({ 'Content-Type': 'application/json' }),
+                body: JSON.stringify({
+                    name: name,
+                    city: city,
+                    min_hours: parseInt(minHoursInput.value, 10),
+                    preferred_days: Array.from(daysContainer.querySelectorAll('input:checked')).map(input => parseInt(input.value, 10)),
+                    start_hour: parseInt(startHourInput.value, 10) || 0,
+                    end_hour: parseInt(endHourInput.value, 10) || 0,
+                    conditions: readConditions(),
+                    notifications_enabled: notifyInput.checked
+                })
+            });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to add activity');
+
+            nameInput.value = '';
+            showStatus(`Added ${data.name} in ${data.city}`);
+            loadActivities();
+        } catch (error) {
+            console.error('Error adding custom activity:', error);
+            showStatus(error.message, true);
+        } finally {
+            createButton.disabled = false;
+        }
+    });
+
+    // The form asks for limits only, so each range's ideal and acceptable bounds are the same
+    function readConditions() {
+        const conditions = {};
+        const tempMin = parseFloat(tempMinInput.value);
+        const tempMax = parseFloat(tempMaxInput.value);
+        if (!isNaN(tempMin) || !isNaN(tempMax)) {
+            conditions.temperature = limitRange(isNaN(tempMin) ? -100 : tempMin, isNaN(tempMax) ? 100 : tempMax);
+        }
+
+        const maximums = [
+            { key: 'wind', input: windInput },
+            { key: 'precipitation', input: precipitationInput },
+            { key: 'uv', input: uvInput },
+            { key: 'clouds', input: cloudsInput }
+        ];
+        maximums.forEach(({ key, input }) => {
+            const max = parseFloat(input.value);
+            if (!isNaN(max)) conditions[key] = limitRange(0, max);
+        });
+
+        if (daylightSelect.value) conditions.daylight = daylightSelect.value;
+        return conditions;
+    }
+
+    function limitRange(min, max) {
+        return { ideal_min: min, ideal_max: max, acceptable_min: min, acceptable_max: max };
+    }
+
+    function renderDays() {
+        dayNames.forEach((dayName, day) => {
+            const label = document.createElement('label');
+            const input = document.createElement('input');
+            input.type = 'checkbox';
+            input.value = day;
+            label.appendChild(input);
+            label.appendChild(document.createTextNode(dayName));
+            daysContainer.appendChild(label);
+        });
+    }
+
+    async function loadActivities() {
+        try {
+            const response = await fetch('/api/custom-activities');
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to load activities');
+
+            renderActivities(data.activities);
+        } catch (error) {
+            console.error('Error loading custom activities:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    function renderActivities(activities) {
+        list.innerHTML = '';
+
+        if (!activities.length) {
+            const empty = document.createElement('li');
+            empty.className = 'help-text';
+            empty.textContent = 'No activities yet';
+            list.appendChild(empty);
+            return;
+        }
+
+        activities.forEach(activity => {
+            const item = document.createElement('li');
+            item.className = 'session-item custom-activity-item';
+
+            const info = document.createElement('div');
+            info.className = 'custom-activity-info';
+
+            const name = document.createElement('div');
+            name.className = 'session-device';
+            name.textContent = `${activity.name} in ${activity.city}`;
+            info.appendChild(name);
+
+            const meta = document.createElement('div');
+            meta.className = 'session-meta';
+            meta.textContent = describeActivity(activity);
+            info.appendChild(meta);
+
+            const windows = document.createElement('ul');
+            windows.className = 'custom-activity-windows';
+            info.appendChild(windows);
+
+            item.appendChild(info);
+
+            const remove = document.createElement('button');
+            remove.type = 'button';
+            remove.className = 'session-revoke';
+            remove.textContent = 'Delete';
+            remove.addEventListener('click', () => deleteActivity(activity));
+            item.appendChild(remove);
+
+            list.appendChild(item);
+            loadWindows(activity, windows);
+        });
+    }
+
+    function describeActivity(activity) {
+        const days = activity.preferred_days.length
+            ? activity.preferred_days.map(day => dayNames[day]).join(', ')
+            : 'Any day';
+        const hours = activity.start_hour === activity.end_hour
+            ? 'any time'
+            : `${activity.start_hour}:00–${activity.end_hour}:00`;
+        const notify = activity.notifications_enabled ? 'email on' : 'email off';
+        return `${activity.min_hours}+ hours · ${days}, ${hours} · ${notify}`;
+    }
+
+    async function loadWindows(activity, container) {
+        container.innerHTML = '<li class="session-meta">Checking the forecast…</li>';
+        try {
+            const response = await fetch(`/api/custom-activities/${activity.id}/windows`);
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to load windows');
+
+            renderWindows(activity, data.windows, data.timezone_offset, container);
+        } catch (error) {
+            console.error('Error loading activity windows:', error);
+            container.innerHTML = '';
+            const failed = document.createElement('li');
+            failed.className = 'session-meta';
+            failed.textContent = error.message;
+            container.appendChild(failed);
+        }
+    }
+
+    function renderWindows(activity, windows, offsetSeconds, container) {
+        container.innerHTML = '';
+
+        if (!windows.length) {
+            const empty = document.createElement('li');
+            empty.className = 'session-meta';
+            empty.textContent = 'No good windows in the next week';
+            container.appendChild(empty);
+            return;
+        }
+
+        windows.forEach(activityWindow => {
+            const item = document.createElement('li');
+            item.className = 'custom-activity-window' + (activityWindow.planned ? ' planned' : '');
+
+            const time = document.createElement('span');
+            time.textContent = `${formatLocalTime(activityWindow.start, offsetSeconds)} – ${formatLocalTime(activityWindow.end, offsetSeconds)} · score ${activityWindow.score}`;
+            item.appendChild(time);
+
+            const plan = document.createElement('button');
+            plan.type = 'button';
+            plan.className = 'custom-activity-plan';
+            plan.textContent = activityWindow.planned ? 'Planned ✓' : 'Plan';
+            plan.title = activityWindow.planned
+                ? 'We will email you if this window falls through. Click to unplan.'
+                : 'Mark that you made plans around this window';
+            plan.addEventListener('click', () => setPlanned(activity, activityWindow, !activityWindow.planned, container));
+            item.appendChild(plan);
+
+            container.appendChild(item);
+        });
+    }
+
+    async function setPlanned(activity, activityWindow, planned, container) {
+        try {
+            const response = await fetch(`/api/custom-activities/${activity.id}/windows/${activityWindow.id}/plan`, {
+                method: planned ? 'POST' : 'DELETE',
+                headers: csrfHeaders()
+            });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to update window');
+
+            loadWindows(activity, container);
+        } catch (error) {
+            console.error('Error updating activity window:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    async function deleteActivity(activity) {
+        if (!confirm(`Delete "${activity.name}"? You won't get emails about it any more.`)) return;
+
+        try {
+            const response = await fetch(`/api/custom-activities/${activity.id}`, { method: 'DELETE', headers: csrfHeaders() });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to delete activity');
+
+            showStatus('Activity deleted');
+            loadActivities();
+        } catch (error) {
+            console.error('Error deleting custom activity:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    // Windows are shown in the activity location's local time
+    function formatLocalTime(value, offsetSeconds) {
+        const local = new Date(new Date(value).getTime() + offsetSeconds * 1000);
+        return local.toLocaleString([], { weekday: 'short', hour: '2-digit', minute: '2-digit', timeZone: 'UTC' });
+    }
+
+    function showStatus(message, isError) {
+        if (!status) return;
+        status.textContent = message;
+        status.classList.toggle('error', !!isError);
+    }
+});
@@ -551,6 +551,7 @@ function loadWeatherData(city) {
     fetchWeatherData(city)
         .then(data => {
             updateDashboardWithWeatherData(data);
+            document.dispatchEvent(new CustomEvent('weatherloaded', { detail: data }));
             if (loadingIndicator) {
                 loadingIndicator.style.display = 'none';
                 loadingIndicator.classList.remove('show');
@@ -1748,6 +1749,11 @@ function updateWeatherMapLocation(lat, lon) {
 
     // Add or update the location marker
     addLocationMarker(lat, lon, currentMapLayer);
+
+    // Show what people nearby are reporting
+    if (typeof loadGroundReports === 'function') {
+        loadGroundReports(lat, lon);
+    }
 }
 
 // Function to update legend visibility based on selected layer
@@ -0,0 +1,30 @@
+// Resend the email verification link from the profile page
+document.addEventListener('DOMContentLoaded', function() {
+    const button = document.getElementById('resend-verification');
+    const status = document.getElementById('verification-status');
+
+    if (!button) return;
+
+    button.addEventListener('click', async function() {
+        button.disabled = true;
+
+        try {
+            const response = await fetch('/api/email-verification/resend', { method: 'POST', headers: csrfHeaders() });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to send verification email');
+
+            showStatus('Verification email sent. Check your inbox.');
+        } catch (error) {
+            console.error('Error resending verification email:', error);
+            showStatus(error.message, true);
+        } finally {
+            button.disabled = false;
+        }
+    });
+
+    function showStatus(message, isError) {
+        if (!status) return;
+        status.textContent = message;
+        status.classList.toggle('error', !!isError);
+    }
+});
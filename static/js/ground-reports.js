@@ -0,0 +1,191 @@
+// Crowd-sourced ground reports shown next to the forecast on the dashboard
+
+const groundReportLabels = {
+    hail: 'Hail',
+    flooding: 'Flooding',
+    fog: 'Fog',
+    ice_on_road: 'Ice on road',
+    power_outage: 'Power outage'
+};
+
+const groundReportColors = {
+    hail: '#9ad0ff',
+    flooding: '#2f7bff',
+    fog: '#b0b0b0',
+    ice_on_road: '#7fe7ff',
+    power_outage: '#ffb13b'
+};
+
+const groundReportIntensities = ['', 'Light', 'Moderate', 'Severe'];
+
+let groundReportLayer = null;
+let groundReportLocation = null;
+
+// Fetch aggregated reports around a location and show them on the map and in the list
+async function loadGroundReports(lat, lon) {
+    groundReportLocation = { lat: lat, lon: lon };
+
+    try {
+        const response = await fetch(`/api/reports/nearby?lat=${lat}&lon=${lon}`);
+        if (!response.ok) throw new Error('Failed to load ground reports');
+
+        const data = await response.json();
+        renderGroundReports(data.areas || []);
+    } catch (error) {
+        console.error('Error loading ground reports:', error);
+    }
+}
+
+// Render report areas as a list and as circles on the weather map
+function renderGroundReports(areas) {
+    const list = document.getElementById('groundReportsList');
+    if (!list) return;
+
+    list.innerHTML = '';
+
+    if (typeof weatherMap !== 'undefined' && weatherMap) {
+        if (groundReportLayer) {
+            groundReportLayer.clearLayers();
+        } else {
+            groundReportLayer = L.layerGroup().addTo(weatherMap);
+        }
+    }
+
+    if (areas.length === 0) {
+        list.innerHTML = '<div class="ground-report-empty">No reports near this location yet.</div>';
+        return;
+    }
+
+    areas.forEach(area => {
+        const label = groundReportLabels[area.condition] || area.condition;
+        const intensity = groundReportIntensities[area.max_intensity] || '';
+        const reports = area.count === 1 ? '1 report' : `${area.count} reports`;
+        const latest = new Date(area.latest_at).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
+
+        const item = document.createElement('div');
+        item.className = 'ground-report-item';
+        item.style.borderLeftColor = groundReportColors[area.condition] || '#ffffff';
+
+        const title = document.createElement('div');
+        title.className = 'ground-report-title';
+        title.textContent = `${label} (up to ${intensity.toLowerCase()})`;
+
+        const details = document.createElement('div');
+        details.className = 'ground-report-details';
+        details.textContent = `${reports} · ${area.distance_km} km away · latest ${latest}`;
+
+        item.appendChild(title);
+        item.appendChild(details);
+
+        (area.photo_urls || []).forEach(url => {
+            const photo = document.createElement('img');
+            photo.src = url;
+            photo.alt = label;
+            photo.className = 'ground-report-photo';
+            item.appendChild(photo);
+        });
+
+        list.appendChild(item);
+
+        if (groundReportLayer) {
+            L.circleMarker([area.latitude, area.longitude], {
+                radius: 6 + Math.min(area.count, 10) * 1.5,
+                color: groundReportColors[area.condition] || '#ffffff',
+                fillOpacity: 0.5,
+                weight: 2
+            }).bindPopup(`<strong>${label}</strong><br>${reports}, up to ${intensity.toLowerCase()}`)
+                .addTo(groundReportLayer);
+        }
+    });
+}
+
+// Use the device location when available, otherwise the location shown on the dashboard
+function getGroundReportPosition() {
+    return new Promise(resolve => {
+        const fallback = () => resolve(groundReportLocation);
+
+        if (!navigator.geolocation) {
+            fallback();
+            return;
+        }
+
+        navigator.geolocation.getCurrentPosition(
+            position => resolve({ lat: position.coords.latitude, lon: position.coords.longitude }),
+            fallback,
+            { timeout: 5000, maximumAge: 300000 }
+        );
+    });
+}
+
+// Upload the optional photo through the existing image upload endpoint
+async function uploadGroundReportPhoto(file) {
+    const formData = new FormData();
+    formData.append('image', file);
+    formData.append('purpose', 'chat');
+
+    const response = await fetch('/api/upload/image', {
+        method: 'POST',
+        headers: csrfHeaders(),
+        body: formData
+    });
+
+    if (!response.ok) throw new Error('Failed to upload photo');
+
+    const data = await response.json();
+    return data.url;
+}
+
+// Submit a new ground report
+async function submitGroundReport(event) {
+    event.preventDefault();
+
+    const status = document.getElementById('groundReportStatus');
+    const photoInput = document.getElementById('groundReportPhoto');
+    const noteInput = document.getElementById('groundReportNote');
+
+    try {
+        const position = await getGroundReportPosition();
+        if (!position) throw new Error('Search for a location or allow location access first');
+
+        let photoURL = '';
+        if (photoInput.files.length > 0) {
+            photoURL = await uploadGroundReportPhoto(photoInput.files[0]);
+        }
+
+        const response = await fetch('/api/reports', {
+            method: 'POST',
+            headers: csrfHeaders({
+                'Content-Type': 'application/json'
+            }),
+            body: JSON.stringify({
+                condition: document.getElementById('groundReportCondition').value,
+                intensity: parseInt(document.getElementById('groundReportIntensity').value, 10),
+                note: noteInput.value.trim(),
+                photo_url: photoURL,
+                latitude: position.lat,
+                longitude: position.lon
+            })
+        });
+
+        const data = await response.json();
+        if (!response.ok) throw new Error(data.error || 'Failed to send report');
+
+        noteInput.value = '';
+        photoInput.value = '';
+        status.textContent = 'Thanks! Your report has been shared.';
+
+        if (groundReportLocation) {
+            loadGroundReports(groundReportLocation.lat, groundReportLocation.lon);
+        }
+    } catch (error) {
+        console.error('Error sending ground report:', error);
+        status.textContent = error.message;
+    }
+}
+
+document.addEventListener('DOMContentLoaded', function() {
+    const form = document.getElementById('groundReportForm');
+    if (form) {
+        form.addEventListener('submit', submitGroundReport);
+    }
+});
@@ -0,0 +1,267 @@
+// Direct messages between users
+
+document.addEventListener('DOMContentLoaded', function() {
+    // Elements
+    const conversationList = document.getElementById('conversation-list');
+    const newConversationForm = document.getElementById('new-conversation-form');
+    const newConversationUsername = document.getElementById('new-conversation-username');
+    const threadTitle = document.getElementById('thread-title');
+    const threadMessages = document.getElementById('thread-messages');
+    const messageForm = document.getElementById('dm-message-form');
+    const messageText = document.getElementById('dm-message-text');
+    const blockToggle = document.getElementById('block-toggle');
+
+    // Variables
+    let conversations = [];
+    let activeConversation = null;
+
+    // Initialize
+    loadConversations().then(() => {
+        if (initialConversationID) {
+            openConversation(initialConversationID);
+        }
+    });
+
+    newConversationForm.addEventListener('submit', startConversation);
+    messageForm.addEventListener('submit', sendMessage);
+    blockToggle.addEventListener('click', toggleBlock);
+
+    // Refresh the list and the open thread every 5 seconds
+    setInterval(() => {
+        loadConversations();
+        if (activeConversation) {
+            loadMessages(activeConversation.id);
+        }
+    }, 5000);
+
+    // Load the conversation list
+    async function loadConversations() {
+        try {
+            const response = await fetch('/api/dm/conversations');
+            if (!response.ok) throw new Error('Failed to load conversations');
+
+            const data = await response.json();
+            conversations = data.conversations || [];
+            renderConversations();
+        } catch (error) {
+            console.error('Error loading conversations:', error);
+        }
+    }
+
+    // Render the conversation list
+    function renderConversations() {
+        conversationList.innerHTML = '';
+
+        if (conversations.length === 0) {
+            conversationList.innerHTML = '<div class="no-cities"><p>No conversations yet.</p></div>';
+            return;
+        }
+
+        conversations.forEach(conv => {
+            const item = document.createElement('div');
+            item.className = 'dm-conversation';
+            if (activeConversation && activeConversation.id === conv.id) {
+                item.classList.add('active');
+            }
+
+            const avatar = document.createElement('img');
+            avatar.src = conv.other_avatar_url;
+            avatar.alt = `${conv.other_username}'s avatar`;
+
+            const info = document.createElement('div');
+            info.className = 'dm-conversation-info';
+
+            const name = document.createElement('div');
+            name.className = 'dm-conversation-name';
+            name.textContent = conv.other_username;
+
+            const preview = document.createElement('div');
+            preview.className = 'dm-conversation-preview';
+            preview.textContent = conv.blocked ? 'Blocked' : conv.last_message;
+
+            info.appendChild(name);
+            info.appendChild(preview);
+            item.appendChild(avatar);
+            item.appendChild(info);
+
+            if (conv.unread_count > 0) {
+                const badge = document.createElement('span');
+                badge.className = 'dm-unread-badge';
+                badge.textContent = conv.unread_count;
+                item.appendChild(badge);
+            }
+
+            item.addEventListener('click', () => openConversation(conv.id));
+            conversationList.appendChild(item);
+        });
+    }
+
+    // Open a conversation and mark it as read
+    async function openConversation(conversationID) {
+        activeConversation = conversations.find(conv => conv.id === conversationID) || { id: conversationID };
+        threadTitle.textContent = activeConversation.other_username || 'Conversation';
+        messageForm.style.display = 'flex';
+        threadMessages.innerHTML = '';
+
+        updateBlockToggle();
+        await loadMessages(conversationID);
+        renderConversations();
+    }
+
+    // Load messages of a conversation
+    async function loadMessages(conversationID) {
+        try {
+            const response = await fetch(`/api/dm/conversations/${conversationID}/messages`);
+            if (!response.ok) throw new Error('Failed to load messages');
+
+            const data = await response.json();
+            renderMessages(data.messages || []);
+
+            await fetch(`/api/dm/conversations/${conversationID}/read`, { method: 'POST', headers: csrfHeaders() });
+        } catch (error) {
+            console.error('Error loading messages:', error);
+        }
+    }
+
+    // Render the messages of the open conversation
+    function renderMessages(messages) {
+        const nearBottom = threadMessages.scrollHeight - threadMessages.scrollTop < threadMessages.clientHeight + 100;
+
+        threadMessages.innerHTML = '';
+        messages.forEach(msg => {
+            const messageEl = document.createElement('div');
+            messageEl.className = 'dm-message';
+            if (msg.user_id === userID) {
+                messageEl.classList.add('own');
+            }
+
+            const text = document.createElement('div');
+            if (msg.deleted) {
+                messageEl.classList.add('deleted');
+                text.textContent = 'This message was deleted';
+            } else {
+                text.textContent = msg.message;
+            }
+            messageEl.appendChild(text);
+
+            if (msg.image_url && !msg.deleted) {
+                const image = document.createElement('img');
+                image.src = msg.image_url;
+                image.alt = `Shared by ${msg.username}`;
+                image.style.maxWidth = '100%';
+                messageEl.appendChild(image);
+            }
+
+            const time = document.createElement('div');
+            time.className = 'dm-message-time';
+            time.textContent = new Date(msg.created_at).toLocaleString();
+            messageEl.appendChild(time);
+
+            threadMessages.appendChild(messageEl);
+        });
+
+        if (nearBottom) {
+            threadMessages.scrollTop = threadMessages.scrollHeight;
+        }
+    }
+
+    // Start a conversation with a user by username
+    async function startConversation(event) {
+        event.preventDefault();
+
+        const username = newConversationUsername.value.trim();
+        if (!username) return;
+
+        try {
+            const response = await fetch('/api/dm/conversations', {
+                method: 'POST',
+                headers: csrfHeaders({
+                    'Content-Type': 'application/json'
+                }),
+                body: JSON.stringify({ username: username })
+            });
+
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to start conversation');
+
+            newConversationUsername.value = '';
+            await loadConversations();
+            openConversation(data.id);
+        } catch (error) {
+            console.error('Error starting conversation:', error);
+            alert(error.message);
+        }
+    }
+
+    // Send a message in the open conversation
+    async function sendMessage(event) {
+        event.preventDefault();
+
+        const message = messageText.value.trim();
+        if (!message || !activeConversation) return;
+
+        try {
+            const response = await fetch(`/api/dm/conversations/${activeConversation.id}/messages`, {
+                method: 'POST',
+                headers: csrfHeaders({
+                    'Content-Type': 'application/json'
+                }),
+                body: JSON.stringify({ message: message })
+            });
+
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to send message');
+
+            messageText.value = '';
+            loadMessages(activeConversation.id);
+            loadConversations();
+        } catch (error) {
+            console.error('Error sending message:', error);
+            alert(error.message);
+        }
+    }
+
+    // Show block or unblock for the other participant
+    function updateBlockToggle() {
+        if (!activeConversation || !activeConversation.other_user_id) {
+            blockToggle.style.display = 'none';
+            return;
+        }
+
+        blockToggle.style.display = 'inline-block';
+        blockToggle.textContent = activeConversation.blocked ? 'Unblock' : 'Block';
+    }
+
+    // Block or unblock the other participant
+    async function toggleBlock() {
+        if (!activeConversation || !activeConversation.other_user_id) return;
+
+        const otherUserID = activeConversation.other_user_id;
+        const blocked = activeConversation.blocked;
+
+        if (!blocked && !confirm(`Block ${activeConversation.other_username}? They will not be able to message you.`)) {
+            return;
+        }
+
+        try {
+            const response = blocked
+                ? await fetch(`/api/dm/blocks/${otherUserID}`, { method: 'DELETE', headers: csrfHeaders() })
+                : await fetch('/api/dm/blocks', {
+                    method: 'POST',
+                    headers: csrfHeaders({
+                        'Content-Type': 'application/json'
+                    }),
+                    body: JSON.stringify({ user_id: otherUserID })
+                });
+
+            if (!response.ok) throw new Error('Failed to update block');
+
+            activeConversation.blocked = !blocked;
+            updateBlockToggle();
+            loadConversations();
+        } catch (error) {
+            console.error('Error updating block:', error);
+            alert('Failed to update block. Please try again.');
+        }
+    }
+});
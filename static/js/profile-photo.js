@@ -0,0 +1,185 @@
+// Custom profile photo upload with a draggable square crop
+document.addEventListener('DOMContentLoaded', function() {
+    const fileInput = document.getElementById('photo-upload-input');
+    const cropper = document.getElementById('photo-cropper');
+    const stage = document.getElementById('cropper-stage');
+    const cropImage = document.getElementById('cropper-image');
+    const cropBox = document.getElementById('cropper-box');
+    const zoomInput = document.getElementById('cropper-zoom');
+    const saveButton = document.getElementById('cropper-save');
+    const cancelButton = document.getElementById('cropper-cancel');
+    const removeButton = document.getElementById('photo-remove');
+    const status = document.getElementById('photo-upload-status');
+    const currentPhoto = document.getElementById('current-photo');
+    const profilePhotoInput = document.getElementById('profile_photo');
+
+    if (!fileInput || !cropper || !currentPhoto || !profilePhotoInput) return;
+
+    let selectedFile = null;
+    let objectURL = null;
+    // Crop square in displayed pixels
+    let crop = { x: 0, y: 0, size: 0 };
+    let drag = null;
+
+    updateRemoveButton();
+
+    fileInput.addEventListener('change', function() {
+        const file = this.files[0];
+        if (!file) return;
+
+        if (file.size > 5 * 1024 * 1024) {
+            showStatus('Image must be smaller than 5MB', true);
+            this.value = '';
+            return;
+        }
+
+        selectedFile = file;
+        if (objectURL) URL.revokeObjectURL(objectURL);
+        objectURL = URL.createObjectURL(file);
+        cropImage.src = objectURL;
+        showStatus('');
+    });
+
+    cropImage.addEventListener('load', function() {
+        cropper.style.display = 'block';
+        zoomInput.value = 100;
+        resetCrop();
+    });
+
+    zoomInput.addEventListener('input', function() {
+        // Resize around the current centre
+        const centerX = crop.x + crop.size / 2;
+        const centerY = crop.y + crop.size / 2;
+        crop.size = maxCropSize() * this.value / 100;
+        crop.x = centerX - crop.size / 2;
+        crop.y = centerY - crop.size / 2;
+        renderCrop();
+    });
+
+    cropBox.addEventListener('pointerdown', function(e) {
+        drag = { startX: e.clientX, startY: e.clientY, x: crop.x, y: crop.y };
+        cropBox.setPointerCapture(e.pointerId);
+        e.preventDefault();
+    });
+
+    cropBox.addEventListener('pointermove', function(e) {
+        if (!drag) return;
+        crop.x = drag.x + e.clientX - drag.startX;
+        crop.y = drag.y + e.clientY - drag.startY;
+        renderCrop();
+    });
+
+    cropBox.addEventListener('pointerup', function() {
+        drag = null;
+    });
+
+    cancelButton.addEventListener('click', closeCropper);
+
+    saveButton.addEventListener('click', async function() {
+        if (!selectedFile) return;
+
+        // Convert the crop from displayed to natural image pixels
+        const scale = cropImage.naturalWidth / cropImage.clientWidth;
+        const formData = new FormData();
+        formData.append('image', selectedFile);
+        formData.append('crop_x', Math.round(crop.x * scale));
+        formData.append('crop_y', Math.round(crop.y * scale));
+        formData.append('crop_size', Math.floor(crop.size * scale));
+
+        saveButton.disabled = true;
+        showStatus('Uploading...');
+
+        try {
+            const response = await fetch('/api/upload/profile-photo', {
+                method: 'POST',
+                headers: csrfHeaders(),
+                body: formData
+            });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to upload photo');
+
+            setPhoto(data.profile_photo, data.profile_photo);
+            closeCropper();
+            showStatus('Profile photo updated');
+        } catch (error) {
+            console.error('Error uploading profile photo:', error);
+            showStatus(error.message, true);
+        } finally {
+            saveButton.disabled = false;
+        }
+    });
+
+    if (removeButton) {
+        removeButton.addEventListener('click', async function() {
+            try {
+                const response = await fetch('/api/upload/profile-photo', { method: 'DELETE', headers: csrfHeaders() });
+                const data = await response.json();
+                if (!response.ok) throw new Error(data.error || 'Failed to remove photo');
+
+                setPhoto(data.profile_photo, `/static/profile_photos/${data.profile_photo}`);
+                showStatus('Uploaded photo removed');
+            } catch (error) {
+                console.error('Error removing profile photo:', error);
+                showStatus(error.message, true);
+            }
+        });
+    }
+
+    // Largest crop that fits the displayed image
+    function maxCropSize() {
+        return Math.min(cropImage.clientWidth, cropImage.clientHeight);
+    }
+
+    function resetCrop() {
+        crop.size = maxCropSize();
+        crop.x = (cropImage.clientWidth - crop.size) / 2;
+        crop.y = (cropImage.clientHeight - crop.size) / 2;
+        renderCrop();
+    }
+
+    // Keep the crop inside the image and draw it
+    function renderCrop() {
+        crop.x = Math.min(Math.max(0, crop.x), cropImage.clientWidth - crop.size);
+        crop.y = Math.min(Math.max(0, crop.y), cropImage.clientHeight - crop.size);
+
+        cropBox.style.left = `${crop.x}px`;
+        cropBox.style.top = `${crop.y}px`;
+        cropBox.style.width = `${crop.size}px`;
+        cropBox.style.height = `${crop.size}px`;
+    }
+
+    function closeCropper() {
+        cropper.style.display = 'none';
+        fileInput.value = '';
+        selectedFile = null;
+        if (objectURL) {
+            URL.revokeObjectURL(objectURL);
+            objectURL = null;
+        }
+    }
+
+    function setPhoto(value, url) {
+        profilePhotoInput.value = value;
+        currentPhoto.src = url;
+        document.querySelectorAll('.photo-option').forEach(opt => {
+            opt.classList.toggle('selected', opt.dataset.photo === value);
+        });
+        updateRemoveButton();
+    }
+
+    function updateRemoveButton() {
+        if (removeButton) {
+            removeButton.style.display = profilePhotoInput.value.startsWith('/media/') ? 'inline-block' : 'none';
+        }
+    }
+
+    function showStatus(message, isError) {
+        status.textContent = message;
+        status.classList.toggle('error', !!isError);
+    }
+
+    // Recompute the crop when the layout changes the displayed image size
+    window.addEventListener('resize', function() {
+        if (cropper.style.display !== 'none' && stage) resetCrop();
+    });
+});
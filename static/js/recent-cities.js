@@ -0,0 +1,74 @@
+// Recently viewed and most viewed cities under the dashboard search bar
+document.addEventListener('DOMContentLoaded', function() {
+    const container = document.getElementById('recentCities');
+    if (!container) return;
+
+    loadRecentCities();
+
+    // dashboard.js fetches weather in the browser, so searches are recorded from here
+    document.addEventListener('weatherloaded', async function(event) {
+        const data = event.detail;
+        if (!data || !data.city) return;
+
+        try {
+            const response = await fetch('/api/activity/views', {
+                method: 'POST',
+                headers: csrfHeaders({ 'Content-Type': 'application/json' }),
+                body: JSON.stringify({ city: data.city, lat: data.current.lat, lon: data.current.lon })
+            });
+            if (response.ok) loadRecentCities();
+        } catch (error) {
+            console.error('Error recording city view:', error);
+        }
+    });
+
+    async function loadRecentCities() {
+        try {
+            const response = await fetch('/api/activity/insights');
+            if (!response.ok) return;
+            renderRecentCities(await response.json());
+        } catch (error) {
+            console.error('Error loading recent cities:', error);
+        }
+    }
+
+    function renderRecentCities(insights) {
+        container.innerHTML = '';
+
+        const recent = insights.recent_cities.slice(0, 5);
+        const recentNames = recent.map(city => city.city);
+        const popular = insights.most_viewed_cities
+            .filter(city => city.views > 1 && !recentNames.includes(city.city))
+            .slice(0, 5);
+
+        addGroup('Recent', recent, city => `Last viewed ${new Date(city.last_viewed_at).toLocaleString()}`);
+        addGroup('Most viewed', popular, city => `${city.views} views in the last ${insights.days} days`);
+    }
+
+    function addGroup(label, cities, describe) {
+        if (cities.length === 0) return;
+
+        const group = document.createElement('div');
+        group.className = 'recent-cities-group';
+
+        const title = document.createElement('span');
+        title.className = 'recent-cities-label';
+        title.textContent = label;
+        group.appendChild(title);
+
+        cities.forEach(city => {
+            const chip = document.createElement('button');
+            chip.type = 'button';
+            chip.className = 'recent-city';
+            chip.textContent = city.city;
+            chip.title = describe(city);
+            chip.addEventListener('click', () => {
+                document.getElementById('cityInput').value = city.city;
+                document.getElementById('searchForm').requestSubmit();
+            });
+            group.appendChild(chip);
+        });
+
+        container.appendChild(group);
+    }
+});
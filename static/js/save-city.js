@@ -63,9 +63,9 @@ async function saveCity(cityName) {
     try {
         const response = await fetch('/api/cities/save', {
             method: 'POST',
-            headers: {
+            headers: csrfHeaders({
                 'Content-Type': 'application/json'
-            },
+            }),
             body: JSON.stringify({
                 city_name: cityName
             })
@@ -88,9 +88,9 @@ async function removeCity(cityName) {
     try {
         const response = await fetch('/api/cities/remove', {
             method: 'DELETE',
-            headers: {
+            headers: csrfHeaders({
                 'Content-Type': 'application/json'
-            },
+            }),
             body: JSON.stringify({
                 city_name: cityName
             })
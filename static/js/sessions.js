@@ -0,0 +1,180 @@
+// Signed-in devices list and sign-in activity on the profile page
+document.addEventListener('DOMContentLoaded', function() {
+    const list = document.getElementById('sessions-list');
+    const revokeOthersButton = document.getElementById('revoke-other-sessions');
+    const status = document.getElementById('sessions-status');
+
+    const eventsList = document.getElementById('security-events-list');
+
+    if (!list) return;
+
+    loadSessions();
+    loadSecurityEvents();
+
+    if (revokeOthersButton) {
+        revokeOthersButton.addEventListener('click', async function() {
+            if (!confirm('Sign out of all other devices?')) return;
+
+            try {
+                const response = await fetch('/api/sessions/revoke-others', { method: 'POST', headers: csrfHeaders() });
+                const data = await response.json();
+                if (!response.ok) throw new Error(data.error || 'Failed to sign out other devices');
+
+                showStatus(`Signed out ${data.revoked} other device${data.revoked === 1 ? '' : 's'}`);
+                loadSessions();
+            } catch (error) {
+                console.error('Error revoking sessions:', error);
+                showStatus(error.message, true);
+            }
+        });
+    }
+
+    async function loadSessions() {
+        try {
+            const response = await fetch('/api/sessions');
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to load sessions');
+
+            renderSessions(data.sessions);
+        } catch (error) {
+            console.error('Error loading sessions:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    function renderSessions(sessions) {
+        list.innerHTML = '';
+
+        sessions.forEach(session => {
+            const item = document.createElement('li');
+            item.className = 'session-item';
+
+            const info = document.createElement('div');
+
+            const device = document.createElement('div');
+            device.className = 'session-device';
+            device.textContent = describeUserAgent(session.user_agent);
+            info.appendChild(device);
+
+            const meta = document.createElement('div');
+            meta.className = 'session-meta';
+            meta.textContent = `${session.ip_address} · last active ${new Date(session.last_seen_at).toLocaleString()} · signed in ${new Date(session.created_at).toLocaleDateString()}`;
+            info.appendChild(meta);
+
+            item.appendChild(info);
+
+            if (session.current) {
+                const current = document.createElement('span');
+                current.className = 'session-current';
+                current.textContent = 'This device';
+                item.appendChild(current);
+            } else {
+                const revoke = document.createElement('button');
+                revoke.type = 'button';
+                revoke.className = 'session-revoke';
+                revoke.textContent = 'Sign out';
+                revoke.addEventListener('click', () => revokeSession(session.id));
+                item.appendChild(revoke);
+            }
+
+            list.appendChild(item);
+        });
+
+        if (revokeOthersButton) {
+            revokeOthersButton.style.display = sessions.some(s => !s.current) ? 'inline-block' : 'none';
+        }
+    }
+
+    async function revokeSession(id) {
+        try {
+            const response = await fetch(`/api/sessions/${encodeURIComponent(id)}`, { method: 'DELETE', headers: csrfHeaders() });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to sign out device');
+
+            showStatus('Device signed out');
+            loadSessions();
+        } catch (error) {
+            console.error('Error revoking session:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    async function loadSecurityEvents() {
+        if (!eventsList) return;
+
+        try {
+            const response = await fetch('/api/security/events');
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to load sign-in activity');
+
+            renderSecurityEvents(data.events);
+        } catch (error) {
+            console.error('Error loading security events:', error);
+        }
+    }
+
+    function renderSecurityEvents(events) {
+        const labels = {
+            login_success: 'Signed in',
+            login_failed: 'Failed sign-in attempt',
+            account_locked: 'Account temporarily locked'
+        };
+
+        eventsList.innerHTML = '';
+
+        if (events.length === 0) {
+            const empty = document.createElement('li');
+            empty.className = 'session-meta';
+            empty.textContent = 'No sign-in activity yet';
+            eventsList.appendChild(empty);
+            return;
+        }
+
+        events.forEach(event => {
+            const item = document.createElement('li');
+            item.className = 'session-item security-event ' + event.event_type;
+
+            const info = document.createElement('div');
+
+            const label = document.createElement('div');
+            label.className = 'session-device';
+            label.textContent = labels[event.event_type] || event.event_type;
+            info.appendChild(label);
+
+            const meta = document.createElement('div');
+            meta.className = 'session-meta';
+            meta.textContent = `${new Date(event.created_at).toLocaleString()} · ${event.ip_address} · ${describeUserAgent(event.user_agent)}`;
+            info.appendChild(meta);
+
+            item.appendChild(info);
+            eventsList.appendChild(item);
+        });
+    }
+
+    // Turn a user agent string into a short "Browser on OS" label
+    function describeUserAgent(userAgent) {
+        if (!userAgent) return 'Unknown device';
+
+        let browser = 'Browser';
+        if (/Edg\//.test(userAgent)) browser = 'Edge';
+        else if (/OPR\//.test(userAgent)) browser = 'Opera';
+        else if (/Chrome\//.test(userAgent)) browser = 'Chrome';
+        else if (/Firefox\//.test(userAgent)) browser = 'Firefox';
+        else if (/Safari\//.test(userAgent)) browser = 'Safari';
+
+        let os = 'unknown OS';
+        if (/Windows/.test(userAgent)) os = 'Windows';
+        else if (/Android/.test(userAgent)) os = 'Android';
+        else if (/iPhone|iPad/.test(userAgent)) os = 'iOS';
+        else if (/Mac OS X/.test(userAgent)) os = 'macOS';
+        else if (/Linux/.test(userAgent)) os = 'Linux';
+
+        return `${browser} on ${os}`;
+    }
+
+    function showStatus(message, isError) {
+        if (!status) return;
+        status.textContent = message;
+        status.classList.toggle('error', !!isError);
+    }
+});
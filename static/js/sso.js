@@ -0,0 +1,81 @@
+// Accounts linked for single sign-on on the profile page
+document.addEventListener('DOMContentLoaded', function() {
+    const list = document.getElementById('sso-identities-list');
+    const linkForm = document.getElementById('sso-link-form');
+    const status = document.getElementById('sso-status');
+
+    if (!list) return;
+
+    loadIdentities();
+
+    async function loadIdentities() {
+        try {
+            const response = await fetch('/api/sso/identities');
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to load linked accounts');
+
+            renderIdentities(data.identities, data.provider);
+        } catch (error) {
+            console.error('Error loading linked accounts:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    function renderIdentities(identities, provider) {
+        list.innerHTML = '';
+
+        identities.forEach(identity => {
+            const item = document.createElement('li');
+            item.className = 'session-item';
+
+            const info = document.createElement('div');
+
+            const name = document.createElement('div');
+            name.className = 'session-device';
+            name.textContent = identity.issuer === provider.issuer ? provider.name : identity.issuer;
+            info.appendChild(name);
+
+            const lastLogin = identity.last_login_at ? `last used ${new Date(identity.last_login_at).toLocaleString()}` : 'never used';
+            const meta = document.createElement('div');
+            meta.className = 'session-meta';
+            meta.textContent = `${identity.email || 'no email'} · ${lastLogin} · linked ${new Date(identity.created_at).toLocaleDateString()}`;
+            info.appendChild(meta);
+
+            item.appendChild(info);
+
+            const unlink = document.createElement('button');
+            unlink.type = 'button';
+            unlink.className = 'session-revoke';
+            unlink.textContent = 'Unlink';
+            unlink.addEventListener('click', () => unlinkIdentity(identity, name.textContent));
+            item.appendChild(unlink);
+
+            list.appendChild(item);
+        });
+
+        const linked = identities.some(identity => identity.issuer === provider.issuer);
+        linkForm.style.display = linked ? 'none' : 'block';
+    }
+
+    async function unlinkIdentity(identity, providerName) {
+        if (!confirm(`Unlink your ${providerName} account? If you never set a password, use "Forgot password?" on the login page to set one first.`)) return;
+
+        try {
+            const response = await fetch(`/api/sso/identities/${identity.id}`, { method: 'DELETE', headers: csrfHeaders() });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to unlink account');
+
+            showStatus('Account unlinked');
+            loadIdentities();
+        } catch (error) {
+            console.error('Error unlinking account:', error);
+            showStatus(error.message, true);
+        }
+    }
+
+    function showStatus(message, isError) {
+        if (!status) return;
+        status.textContent = message;
+        status.classList.toggle('error', !!isError);
+    }
+});
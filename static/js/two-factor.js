@@ -0,0 +1,121 @@
+// Two-factor authentication setup on the profile page
+document.addEventListener('DOMContentLoaded', function() {
+    const state = document.getElementById('two-factor-state');
+    const startButton = document.getElementById('two-factor-start');
+    const setup = document.getElementById('two-factor-setup');
+    const qr = document.getElementById('two-factor-qr');
+    const secret = document.getElementById('two-factor-secret');
+    const enableCode = document.getElementById('two-factor-enable-code');
+    const enableButton = document.getElementById('two-factor-enable');
+    const recovery = document.getElementById('two-factor-recovery');
+    const recoveryCodes = document.getElementById('two-factor-recovery-codes');
+    const disableForm = document.getElementById('two-factor-disable-form');
+    const disableCode = document.getElementById('two-factor-disable-code');
+    const disableButton = document.getElementById('two-factor-disable');
+    const status = document.getElementById('two-factor-status');
+
+    if (!state) return;
+
+    loadStatus();
+
+    startButton.addEventListener('click', async function() {
+        try {
+            const data = await postJSON('/api/2fa/setup', {});
+
+            qr.innerHTML = '';
+            if (window.QRCode) {
+                new QRCode(qr, { text: data.provisioning_uri, width: 180, height: 180 });
+            } else {
+                qr.style.display = 'none';
+            }
+            secret.textContent = data.secret.match(/.{1,4}/g).join(' ');
+
+            startButton.style.display = 'none';
+            setup.style.display = 'block';
+            enableCode.focus();
+            showStatus('');
+        } catch (error) {
+            console.error('Error starting two-factor setup:', error);
+            showStatus(error.message, true);
+        }
+    });
+
+    enableButton.addEventListener('click', async function() {
+        try {
+            const data = await postJSON('/api/2fa/enable', { code: enableCode.value.trim() });
+
+            setup.style.display = 'none';
+            enableCode.value = '';
+
+            recoveryCodes.innerHTML = '';
+            data.recovery_codes.forEach(code => {
+                const item = document.createElement('li');
+                item.textContent = code;
+                recoveryCodes.appendChild(item);
+            });
+            recovery.style.display = 'block';
+
+            showStatus('Two-factor authentication is on');
+            loadStatus();
+        } catch (error) {
+            console.error('Error enabling two-factor authentication:', error);
+            showStatus(error.message, true);
+        }
+    });
+
+    disableButton.addEventListener('click', async function() {
+        if (!confirm('Turn off two-factor authentication?')) return;
+
+        try {
+            await postJSON('/api/2fa/disable', { code: disableCode.value.trim() });
+
+            disableCode.value = '';
+            recovery.style.display = 'none';
+            showStatus('Two-factor authentication is off');
+            loadStatus();
+        } catch (error) {
+            console.error('Error disabling two-factor authentication:', error);
+            showStatus(error.message, true);
+        }
+    });
+
+    async function loadStatus() {
+        try {
+            const response = await fetch('/api/2fa/status');
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Failed to load two-factor status');
+
+            if (data.enabled) {
+                state.textContent = `On · ${data.remaining_recovery_codes} recovery code${data.remaining_recovery_codes === 1 ? '' : 's'} left`;
+                startButton.style.display = 'none';
+                disableForm.style.display = 'block';
+            } else {
+                state.textContent = 'Off · sign-ins only need your password';
+                startButton.style.display = setup.style.display === 'block' ? 'none' : 'inline-block';
+                disableForm.style.display = 'none';
+            }
+        } catch (error) {
+            console.error('Error loading two-factor status:', error);
+            state.textContent = error.message;
+        }
+    }
+
+    async function postJSON(url, body) {
+        const response = await fetch(url, {
+            method: 'POST',
+            headers: csrfHeaders({
+                'Content-Type': 'application/json'
+            }),
+            body: JSON.stringify(body)
+        });
+        const data = await response.json();
+        if (!response.ok) throw new Error(data.error || 'Request failed');
+        return data;
+    }
+
+    function showStatus(message, isError) {
+        if (!status) return;
+        status.textContent = message;
+        status.classList.toggle('error', !!isError);
+    }
+});
@@ -137,6 +137,8 @@ document.addEventListener('DOMContentLoaded', function() {
 
                 // Update UI with weather data
                 updateWeatherDisplay(formattedWeather);
+                updatePollenDisplay(weatherData.pollen);
+                loadBestTimes(city);
                 generateImpactAssessments(formattedWeather);
                 checkWeatherAlerts(formattedWeather);
 
@@ -212,6 +214,102 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     }
 
+    function loadBestTimes(city) {
+        const bestTimes = document.getElementById('best-times');
+        if (!bestTimes) return;
+        bestTimes.innerHTML = '';
+
+        fetch(`/api/activities/windows?city=${encodeURIComponent(city)}`)
+            .then(response => response.ok ? response.json() : Promise.reject(new Error('Best times not available')))
+            .then(data => renderBestTimes(bestTimes, data))
+            .catch(error => console.error('Error loading best times:', error));
+    }
+
+    function renderBestTimes(container, data) {
+        const title = document.createElement('h3');
+        title.textContent = 'Best Times in the Next 48 Hours';
+        container.appendChild(title);
+
+        const list = document.createElement('div');
+        list.className = 'best-times-list';
+
+        data.activities.forEach(activity => {
+            const item = document.createElement('div');
+            item.className = 'best-time';
+
+            const name = document.createElement('div');
+            name.className = 'best-time-name';
+            name.textContent = `${activity.icon} ${activity.name}`;
+            item.appendChild(name);
+
+            const when = document.createElement('div');
+            const reason = document.createElement('div');
+            reason.className = 'best-time-reason';
+
+            const best = activity.windows[0];
+            if (best) {
+                when.textContent = `${formatLocalTime(best.start, data.timezone_offset)} – ${formatLocalTime(best.end, data.timezone_offset)} · ${best.rating}`;
+                reason.textContent = best.explanation;
+            } else {
+                when.textContent = 'No good time in the forecast';
+                const limits = activity.current && activity.current.limits;
+                if (limits && limits.length > 0) reason.textContent = `Now: ${limits[0].explanation}`;
+            }
+
+            item.appendChild(when);
+            item.appendChild(reason);
+            list.appendChild(item);
+        });
+
+        container.appendChild(list);
+    }
+
+    // Formats a time in the searched city's timezone
+    function formatLocalTime(value, offsetSeconds) {
+        const local = new Date(new Date(value).getTime() + offsetSeconds * 1000);
+        return local.toLocaleString([], { weekday: 'short', hour: '2-digit', minute: '2-digit', timeZone: 'UTC' });
+    }
+
+    function updatePollenDisplay(pollen) {
+        const pollenElement = document.getElementById('current-pollen');
+        if (!pollenElement) return;
+        pollenElement.innerHTML = '';
+        if (!pollen) return;
+
+        const types = [
+            { key: 'tree', label: 'Tree pollen' },
+            { key: 'grass', label: 'Grass pollen' },
+            { key: 'weed', label: 'Weed pollen' },
+            { key: 'mold', label: 'Mold' }
+        ];
+        const estimatedTypes = pollen.estimated_types || [];
+
+        types.forEach(type => {
+            const item = document.createElement('div');
+            item.className = 'pollen-item';
+            const estimated = pollen.estimated || estimatedTypes.includes(type.key);
+            item.textContent = `${type.label}: ${getPollenLevel(pollen[type.key])}${estimated ? '*' : ''}`;
+            pollenElement.appendChild(item);
+        });
+
+        if (pollen.estimated || estimatedTypes.length > 0) {
+            const note = document.createElement('div');
+            note.className = 'pollen-note';
+            note.textContent = pollen.source === 'stub'
+                ? '* Sample values, no pollen data source is configured'
+                : '* Estimated from typical seasonal levels, not measured';
+            pollenElement.appendChild(note);
+        }
+    }
+
+    // Matches the levels of the server's allergen information
+    function getPollenLevel(count) {
+        if (count < 20) return 'Low';
+        if (count < 50) return 'Moderate';
+        if (count < 80) return 'High';
+        return 'Very High';
+    }
+
     function checkWeatherAlerts(data) {
         // Hide alert by default
         if (weatherAlert) {